@@ -1,5 +1,7 @@
 package nacos
 
+import "context"
+
 var _ Client = new(client)
 
 const (
@@ -13,48 +15,216 @@ type Client interface {
 	Naming() NamingClient
 	Config() ConfigClient
 	Logger() Logger
+
+	// Namespaces manages the namespaces of the server
+	Namespaces() NamespaceClient
+
+	// AddConnectionListener listens to the state of the connections to the
+	// server, which exist with ProtocolGRPC only
+	AddConnectionListener(listener ConnectionListener)
+}
+
+// ConnectionListener is notified, in order, of the state changes of the
+// gRPC connections; it is called by the goroutine keeping the connection
+// alive and must not block
+type ConnectionListener interface {
+	OnConnectionChange(event ConnectionEvent)
 }
 
 // NamingClient provides a client to the Nacos naming API
 type NamingClient interface {
 	SelectServices(ServiceQueryOptions) (*ServiceList, error)
 
+	SelectAllServices(ctx context.Context, groupName string) ([]string, error)
+
+	ServiceIterator(ctx context.Context, opts ServiceIteratorOptions) *ServiceIterator
+
 	SelectService(ServiceQueryOptions) (*Service, error)
 
+	GetService(serviceName, groupName string) (*Service, error)
+
 	CreateService(ServiceOptions) (*Response, error)
 
 	DeleteService(ServiceOptions) (*Response, error)
 
 	UpdateService(ServiceOptions) (*Response, error)
 
+	CreateCluster(ClusterOptions) (*Response, error)
+
+	UpdateCluster(ClusterOptions) (*Response, error)
+
 	RegisterInstance(*Instance) (*Response, error)
 
 	DeRegisterInstance(serviceName, groupName, clusterName, ip string, port int, ephemeral bool) (*Response, error)
 
+	// BatchRegisterInstances registers instances of one service, by one
+	// request per instance over HTTP which has no batch endpoint
+	BatchRegisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult
+
+	BatchDeregisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult
+
+	UpdateInstance(*Instance) (*Response, error)
+
+	PatchInstanceMetadata(key InstanceKey, add map[string]string, remove []string) (*Response, error)
+
+	UpdateInstanceHealth(key InstanceKey, healthy bool) (*Response, error)
+
 	SelectInstance(InstanceQueryOptions) []*Instance
 
+	// SelectHealthyInstances returns the instances SelectOneHealthyInstance
+	// picks from: healthy, not ejected by the outlier detection unless all
+	// are, in the zone of the client while it has enough of them
+	SelectHealthyInstances(InstanceQueryOptions) []*Instance
+
+	// SelectOneHealthyInstance picks a healthy instance by weighted random,
+	// it returns ErrNoInstanceAvailable if there is none; instances ejected
+	// by the outlier detection are left out and the zone of the client is
+	// preferred
+	SelectOneHealthyInstance(InstanceQueryOptions) (*Instance, error)
+
+	// Report records the outcome of a request to an instance of the grouped
+	// service for the outlier detection, err is nil on success; the naming
+	// client is an OutlierReporter for Transport
+	Report(groupedServiceName string, instance *Instance, err error)
+
+	// AddOutlierListener listens to the instances ejected and returned by
+	// the outlier detection
+	AddOutlierListener(listener OutlierListener)
+
+	// GetServiceInfo returns the subscribed service from the cache,
+	// subscribing to it first if needed
+	GetServiceInfo(serviceName, groupName string, clusters []string) *ServiceInfo
+
+	// Subscribe calls listener with every change of the service; the
+	// listener is identified by ==, so it must be comparable such as a
+	// pointer
 	Subscribe(serviceName, groupName string, clusters []string, listener EventListener)
 
 	Unsubscribe(serviceName, groupName string, clusters []string, listener EventListener)
 
-	Shutdown()
+	// Catalog returns a client of the catalog endpoints
+	Catalog() CatalogClient
+
+	// Operator returns a client of the operator endpoints
+	Operator() OperatorClient
+
+	// BeatStats returns the heartbeat state of every ephemeral instance
+	// registered by this client
+	BeatStats() []BeatStats
+
+	// AddRedoListener listens to the registrations and subscriptions the
+	// server lost being applied again
+	AddRedoListener(listener RedoListener)
+
+	// RedoStats returns the state of the redo of registrations and
+	// subscriptions
+	RedoStats() RedoStats
+
+	// Shutdown stops heartbeats and the redo, deregisters the ephemeral
+	// instances registered by this client unless
+	// Config.KeepInstancesOnShutdown is set, closes the push receiver, flushes
+	// the failover snapshot and waits for running listener callbacks. It returns ctx.Err() if ctx is done first.
+	Shutdown(ctx context.Context) error
+}
+
+// RedoListener is notified, in order, of every registration or subscription
+// applied again; it must not block
+type RedoListener interface {
+	OnRedo(event RedoEvent)
+}
+
+// OutlierListener is notified of every instance ejected or returned; it must
+// not block
+type OutlierListener interface {
+	OnOutlier(event OutlierEvent)
+}
+
+// CatalogClient provides read access to the Nacos catalog API
+type CatalogClient interface {
+	// Services lists services with their cluster and instance counts
+	Services(ctx context.Context, q CatalogQueryOptions) (*CatalogServiceList, error)
+
+	// Subscribers lists the clients subscribed to a service
+	Subscribers(ctx context.Context, q CatalogQueryOptions) (*SubscriberList, error)
+
+	// Instances lists the instances of a cluster
+	Instances(ctx context.Context, q CatalogQueryOptions) (*CatalogInstanceList, error)
+
+	// Instance returns the detail of one instance
+	Instance(ctx context.Context, key InstanceKey) (*Instance, error)
+}
+
+// OperatorClient provides a client to the Nacos operator API
+type OperatorClient interface {
+	// Switches reads the runtime switches of the naming service
+	Switches(ctx context.Context) (*Switches, error)
+
+	// UpdateSwitch sets one switch entry, debug applies it to the answering
+	// server only
+	UpdateSwitch(ctx context.Context, entry, value string, debug bool) error
+
+	// Metrics returns the metrics of the answering server
+	Metrics(ctx context.Context) (*ServerMetrics, error)
+
+	// Servers lists the members of the cluster
+	Servers(ctx context.Context, healthyOnly bool) ([]*ServerMember, error)
+
+	// Leader returns the raft leader of the naming service
+	Leader(ctx context.Context) (*RaftPeer, error)
+}
+
+// ConfigListener receives the content of a listened config when it changes,
+// content is empty once the config is removed
+type ConfigListener interface {
+	OnChange(namespace, group, dataID, content string)
 }
 
 // ConfigClient provides a client to the Nacos config API
 type ConfigClient interface {
-	GetConfig(dataID, group string) string
+	// GetConfig returns ErrConfigNotFound if the config does not exist
+	GetConfig(dataID, group string) (string, error)
 
-	GetConfigAndSignListener(dataID, group string, listener EventListener) string
+	// GetConfigAndSignListener returns the content of a config and listens
+	// to its changes from there, the listener is added even if the config
+	// does not exist yet
+	GetConfigAndSignListener(dataID, group string, listener ConfigListener) (string, error)
 
-	AddListener(dataID, group string, listener EventListener)
+	// AddListener listens to a config, the listener is first notified with
+	// the current content
+	AddListener(dataID, group string, listener ConfigListener) error
 
-	PublishConfig(dataID, group, content string)
+	PublishConfig(dataID, group, content string) error
 
-	RemoveConfig(dataID, group string)
+	RemoveConfig(dataID, group string) error
 
+	// RemoveListener removes every listener of a config
 	RemoveListener(dataID, group string)
 
+	// GetServerStatus returns ServerStatusUp or ServerStatusDown
 	GetServerStatus() string
 
+	// SearchConfigs lists the configs of the namespace
+	SearchConfigs(ctx context.Context, q ConfigSearchOptions) (*ConfigList, error)
+
+	// History lists the past changes of a config, the latest first
+	History(ctx context.Context, q ConfigHistoryOptions) (*ConfigHistoryList, error)
+
+	// HistoryDetail returns one past change of a config with its content
+	HistoryDetail(ctx context.Context, dataID, group, id string) (*ConfigHistoryItem, error)
+
 	Shutdown()
 }
+
+// NamespaceClient manages the namespaces, over the HTTP API whatever the
+// Protocol
+type NamespaceClient interface {
+	List(ctx context.Context) ([]*Namespace, error)
+
+	Create(ctx context.Context, ns NamespaceOptions) error
+
+	// Update changes the name and description of a namespace
+	Update(ctx context.Context, ns NamespaceOptions) error
+
+	// Delete deletes a namespace, its configs are kept
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,50 @@
+package nacos
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// ErrNoInstanceAvailable is returned when a service has no healthy instance
+// to pick
+var ErrNoInstanceAvailable = errors.New("no instance available")
+
+// Balancer picks one of the instances of a service, instances are healthy
+// and never empty
+type Balancer interface {
+	Pick(instances []*Instance) *Instance
+}
+
+// NewWeightedRandomBalancer returns a balancer picking instances at random
+// in proportion to their weight
+func NewWeightedRandomBalancer() Balancer {
+	return weightedRandom{}
+}
+
+type weightedRandom struct{}
+
+func (weightedRandom) Pick(instances []*Instance) *Instance {
+	var total float64
+	for _, instance := range instances {
+		total += instance.Weight
+	}
+	r := rand.Float64() * total
+	for _, instance := range instances {
+		if r -= instance.Weight; r < 0 {
+			return instance
+		}
+	}
+	return instances[len(instances)-1]
+}
+
+// healthyInstances returns the instances which are healthy, enabled and have
+// a positive weight
+func healthyInstances(instances []*Instance) []*Instance {
+	healthy := make([]*Instance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.Healthy && instance.Enable && instance.Weight > 0 {
+			healthy = append(healthy, instance)
+		}
+	}
+	return healthy
+}
@@ -0,0 +1,164 @@
+package nacos
+
+import (
+	"context"
+	"strconv"
+)
+
+var _ CatalogClient = new(catalogClient)
+
+// ServiceEntry is one service of a listing, the counts are only filled by
+// listings that read the catalog
+type ServiceEntry struct {
+	Name                 string `json:"name"`
+	GroupName            string `json:"groupName"`
+	ClusterCount         int    `json:"clusterCount"`
+	IPCount              int    `json:"ipCount"`
+	HealthyInstanceCount int    `json:"healthyInstanceCount"`
+}
+
+// CatalogServiceList is one page of catalog services
+type CatalogServiceList struct {
+	Count    int            `json:"count"`
+	Services []ServiceEntry `json:"serviceList"`
+}
+
+// Subscriber is a client subscribed to a service
+type Subscriber struct {
+	AddrStr     string `json:"addrStr"`
+	Agent       string `json:"agent"`
+	App         string `json:"app"`
+	IP          string `json:"ip"`
+	Port        int    `json:"port"`
+	NamespaceID string `json:"namespaceId"`
+	ServiceName string `json:"serviceName"`
+	Cluster     string `json:"cluster"`
+}
+
+// SubscriberList is one page of subscribers
+type SubscriberList struct {
+	Count       int           `json:"count"`
+	Subscribers []*Subscriber `json:"subscribers"`
+}
+
+// CatalogInstanceList is one page of the instances of a cluster
+type CatalogInstanceList struct {
+	Count     int         `json:"count"`
+	Instances []*Instance `json:"list"`
+}
+
+// CatalogQueryOptions query options
+type CatalogQueryOptions struct {
+	Page int
+	Size int
+	// matched as a substring by Services, exactly by the other calls
+	ServiceName string
+	// matched as a substring by Services, exactly by the other calls
+	GroupName string
+	// required by Instances
+	ClusterName string
+}
+
+func setCatalogQueryOptions(r *Request, q *CatalogQueryOptions) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.Size <= 0 {
+		q.Size = 10
+	}
+	r.params.Set("pageNo", strconv.Itoa(q.Page))
+	r.params.Set("pageSize", strconv.Itoa(q.Size))
+}
+
+type catalogClient struct {
+	ns *namingClient
+}
+
+func (ns *namingClient) Catalog() CatalogClient {
+	return &catalogClient{ns: ns}
+}
+
+func (cc *catalogClient) Services(ctx context.Context, q CatalogQueryOptions) (*CatalogServiceList, error) {
+	r := cc.ns.NewRequest(GET, "/catalog/services")
+	r.ctx = ctx
+	setCatalogQueryOptions(r, &q)
+	r.params.Set("serviceNameParam", q.ServiceName)
+	r.params.Set("groupNameParam", q.GroupName)
+	r.params.Set("hasIpCount", "true")
+	var list CatalogServiceList
+	if err := cc.call(r, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (cc *catalogClient) Subscribers(ctx context.Context, q CatalogQueryOptions) (*SubscriberList, error) {
+	if q.GroupName == "" {
+		q.GroupName = DefaultGroup
+	}
+	r := cc.ns.NewRequest(GET, "/service/subscribers")
+	r.ctx = ctx
+	setCatalogQueryOptions(r, &q)
+	r.params.Set("serviceName", q.ServiceName)
+	r.params.Set("groupName", q.GroupName)
+	var list SubscriberList
+	if err := cc.call(r, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (cc *catalogClient) Instances(ctx context.Context, q CatalogQueryOptions) (*CatalogInstanceList, error) {
+	if q.GroupName == "" {
+		q.GroupName = DefaultGroup
+	}
+	if q.ClusterName == "" {
+		q.ClusterName = DefaultCluster
+	}
+	r := cc.ns.NewRequest(GET, "/catalog/instances")
+	r.ctx = ctx
+	setCatalogQueryOptions(r, &q)
+	r.params.Set("serviceName", q.ServiceName)
+	r.params.Set("groupName", q.GroupName)
+	r.params.Set("clusterName", q.ClusterName)
+	var list CatalogInstanceList
+	if err := cc.call(r, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (cc *catalogClient) Instance(ctx context.Context, key InstanceKey) (*Instance, error) {
+	if key.GroupName == "" {
+		key.GroupName = DefaultGroup
+	}
+	if key.ClusterName == "" {
+		key.ClusterName = DefaultCluster
+	}
+	r := cc.ns.NewRequest(GET, "/instance")
+	r.ctx = ctx
+	r.params.Set("serviceName", key.GroupName+serviceInfoSpliter+key.ServiceName)
+	r.params.Set("groupName", key.GroupName)
+	r.params.Set("cluster", key.ClusterName)
+	r.params.Set("ip", key.IP)
+	r.params.Set("port", strconv.Itoa(key.Port))
+	r.params.Set("ephemeral", strconv.FormatBool(key.Ephemeral))
+	var instance Instance
+	if err := cc.call(r, &instance); err != nil {
+		return nil, err
+	}
+	instance.ServiceName = key.ServiceName
+	instance.GroupName = key.GroupName
+	if instance.ClusterName == "" {
+		instance.ClusterName = key.ClusterName
+	}
+	return &instance, nil
+}
+
+func (cc *catalogClient) call(r *Request, out interface{}) error {
+	rs, err := callServer(cc.ns.c, r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(rs.Data), out)
+}
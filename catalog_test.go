@@ -0,0 +1,102 @@
+package nacos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "gopkg.in/check.v1"
+)
+
+type CatalogSuite struct {
+	srv   *httptest.Server
+	ns    *namingClient
+	path  string
+	query url.Values
+}
+
+var _ = Suite(&CatalogSuite{})
+
+func (s *CatalogSuite) SetUpTest(c *C) {
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.path = r.URL.Path
+		s.query = r.URL.Query()
+		switch r.URL.Path {
+		case "/nacos/v1/ns/catalog/services":
+			w.Write([]byte(`{"count":1,"serviceList":[{"name":"svc","groupName":"DEFAULT_GROUP","clusterCount":2,"ipCount":4,"healthyInstanceCount":3,"triggerFlag":"false"}]}`))
+		case "/nacos/v1/ns/service/subscribers":
+			w.Write([]byte(`{"count":1,"subscribers":[{"addrStr":"10.0.0.9:54951","agent":"Nacos-Java-Client:v1.4.1","app":"web","ip":"10.0.0.9","port":54951,"namespaceId":"public","serviceName":"DEFAULT_GROUP@@svc","cluster":""}]}`))
+		case "/nacos/v1/ns/catalog/instances":
+			w.Write([]byte(`{"count":1,"list":[{"instanceId":"10.0.0.1#8080#DEFAULT#DEFAULT_GROUP@@svc","ip":"10.0.0.1","port":8080,"weight":1.0,"healthy":true,"enabled":true,"ephemeral":true,"clusterName":"DEFAULT","serviceName":"DEFAULT_GROUP@@svc","metadata":{"zone":"a"}}]}`))
+		case "/nacos/v1/ns/instance":
+			w.Write([]byte(`{"service":"DEFAULT_GROUP@@svc","ip":"10.0.0.1","port":8080,"clusterName":"DEFAULT","weight":2.0,"healthy":false,"instanceId":"10.0.0.1#8080#DEFAULT#DEFAULT_GROUP@@svc","metadata":{"zone":"a"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("caused: no such api"))
+		}
+	}))
+	u, _ := url.Parse(s.srv.URL)
+	s.ns = newOfflineNamingClient(c)
+	s.ns.c.config.Scheme = "http"
+	s.ns.c.config.Hosts = []string{u.Host}
+	s.ns.c.config.ContextPath = "/nacos"
+	s.ns.c.config.HttpClient = DefaultPooledClient()
+}
+
+func (s *CatalogSuite) TearDownTest(c *C) {
+	s.ns.c.cancel()
+	s.srv.Close()
+}
+
+func (s *CatalogSuite) TestServices(c *C) {
+	list, err := s.ns.Catalog().Services(context.Background(), CatalogQueryOptions{ServiceName: "sv", Page: 2, Size: 5})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("serviceNameParam"), Equals, "sv")
+	c.Assert(s.query.Get("pageNo"), Equals, "2")
+	c.Assert(s.query.Get("pageSize"), Equals, "5")
+	c.Assert(list.Count, Equals, 1)
+	c.Assert(list.Services, DeepEquals, []ServiceEntry{{Name: "svc", GroupName: DefaultGroup, ClusterCount: 2, IPCount: 4, HealthyInstanceCount: 3}})
+}
+
+func (s *CatalogSuite) TestSubscribers(c *C) {
+	list, err := s.ns.Catalog().Subscribers(context.Background(), CatalogQueryOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("groupName"), Equals, DefaultGroup)
+	c.Assert(list.Subscribers, HasLen, 1)
+	c.Assert(*list.Subscribers[0], DeepEquals, Subscriber{
+		AddrStr:     "10.0.0.9:54951",
+		Agent:       "Nacos-Java-Client:v1.4.1",
+		App:         "web",
+		IP:          "10.0.0.9",
+		Port:        54951,
+		NamespaceID: "public",
+		ServiceName: "DEFAULT_GROUP@@svc",
+	})
+}
+
+func (s *CatalogSuite) TestInstances(c *C) {
+	list, err := s.ns.Catalog().Instances(context.Background(), CatalogQueryOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("clusterName"), Equals, DefaultCluster)
+	c.Assert(list.Instances, HasLen, 1)
+	c.Assert(list.Instances[0].Enable, Equals, true)
+	c.Assert(list.Instances[0].Metadata.Get("zone"), Equals, "a")
+}
+
+func (s *CatalogSuite) TestInstance(c *C) {
+	instance, err := s.ns.Catalog().Instance(context.Background(), InstanceKey{ServiceName: "svc", IP: "10.0.0.1", Port: 8080})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("serviceName"), Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(instance.ServiceName, Equals, "svc")
+	c.Assert(instance.GroupName, Equals, DefaultGroup)
+	c.Assert(instance.Weight, Equals, 2.0)
+	c.Assert(instance.Healthy, Equals, false)
+	c.Assert(instance.Metadata.Get("zone"), Equals, "a")
+}
+
+func (s *CatalogSuite) TestServerError(c *C) {
+	s.ns.c.config.ContextPath = "/missing"
+	_, err := s.ns.Catalog().Services(context.Background(), CatalogQueryOptions{})
+	c.Assert(err, ErrorMatches, "caused: no such api")
+}
@@ -1,6 +1,7 @@
 package nacos
 
 import (
+	"bufio"
 	"context"
 	"crypto/hmac"
 	"crypto/sha1"
@@ -49,9 +50,32 @@ type Config struct {
 	SecretKey   string
 	Metadata    map[string]string
 	HttpClient  *http.Client
-	CacheDir    string
-	LogDir      string
-	LogLevel    LogLevel
+	// Protocol is ProtocolHTTP, the default, for the 1.x API or ProtocolGRPC
+	// for the 2.x API
+	Protocol string
+	// GrpcPortOffset is the offset of the gRPC port from the port in Hosts,
+	// 1000 if zero
+	GrpcPortOffset int
+	CacheDir       string
+	LogDir         string
+	LogLevel       LogLevel
+	// KeepInstancesOnShutdown leaves ephemeral instances registered when the
+	// naming client shuts down, they expire once their beats stop, or at
+	// once over gRPC as they are bound to the connection
+	KeepInstancesOnShutdown bool
+	// RedoInterval is how often the instances registered and the services
+	// subscribed are reconciled against the server, 30s if zero; negative
+	// disables reconciliation
+	RedoInterval time.Duration
+	// Outlier configures the ejection of the instances reported failing
+	// through NamingClient.Report
+	Outlier OutlierConfig
+	// ZoneRouting configures the preference for the instances in the zone
+	// of the client, the "zone" entry of Metadata or else NACOS_ZONE. It
+	// applies to SelectHealthyInstances, so to SelectOneHealthyInstance and
+	// Transport; SelectInstance, the subscriptions and the gRPC resolver
+	// list the instances of every zone
+	ZoneRouting ZoneConfig
 }
 
 // AccessToken
@@ -65,13 +89,19 @@ type accessToken struct {
 // Client provides a client to the Nacos API
 type client struct {
 	sync.Mutex
-	config       Config
-	token        accessToken
-	namingClient *namingClient
-	configClient *configClient
-	logger       Logger
-	ctx          context.Context
-	cancel       context.CancelFunc
+	config        Config
+	token         accessToken
+	namingClient  *namingClient
+	configClient  *configClient
+	logger        Logger
+	connListeners []ConnectionListener
+	ctx           context.Context
+	cancel        context.CancelFunc
+
+	// the servers listed by Config.Endpoint
+	srvMu                 sync.Mutex
+	serversFromEndpoint   []string
+	lastServerRefreshTime int64
 }
 
 func (c *client) Naming() NamingClient {
@@ -80,10 +110,18 @@ func (c *client) Naming() NamingClient {
 	if c.namingClient != nil {
 		return c.namingClient
 	}
-	ns := &namingClient{c: c, serviceInfoMap: make(map[string]*ServiceInfo)}
-	ns.pushReceiver = newPushRecevier(ns)
+	ns := &namingClient{c: c, serviceInfoHolder: NewServiceInfoHolder()}
+	ns.listeners = newServiceChangeListener(c.ctx, c.logger)
+	if c.config.Protocol != ProtocolGRPC {
+		ns.updater = newUpdater(ns)
+		ns.pushReceiver = newPushRecevier(ns)
+	}
 	ns.failover = newFailover(ns)
 	ns.heartbeat = newHeartbeat(ns)
+	ns.redo = newRedo(ns)
+	ns.outliers = newOutlierDetector(ns)
+	ns.zones = newZoneRouter(ns)
+	ns.transport = newNamingTransport(ns)
 	go func(ns *namingClient) {
 		t := time.NewTicker(time.Second * 30)
 		for {
@@ -92,7 +130,7 @@ func (c *client) Naming() NamingClient {
 				t.Stop()
 				return
 			case <-t.C:
-				ns.refreshSrvIfNeed()
+				ns.c.refreshSrvIfNeed()
 			}
 		}
 	}(ns)
@@ -109,19 +147,46 @@ func (c *client) Naming() NamingClient {
 		}
 	}(ns)
 	c.tryLogin(ns.getServerList())
-	ns.refreshSrvIfNeed()
 	c.namingClient = ns
 	return ns
 }
 
 func (c *client) Config() ConfigClient {
-	return &configClient{c: c}
+	c.Lock()
+	defer c.Unlock()
+	if c.configClient == nil {
+		c.configClient = newConfigClient(c)
+	}
+	return c.configClient
 }
 
 func (c *client) Logger() Logger {
 	return c.logger
 }
 
+func (c *client) AddConnectionListener(listener ConnectionListener) {
+	c.Lock()
+	defer c.Unlock()
+	c.connListeners = append(c.connListeners, listener)
+}
+
+func (c *client) connectionChanged(event ConnectionEvent) {
+	c.logger.Info("%s grpc connection %s to %s %s", event.Module, event.ConnectionID, event.Server, event.State)
+	c.Lock()
+	listeners := append([]ConnectionListener(nil), c.connListeners...)
+	c.Unlock()
+	for _, listener := range listeners {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					c.logger.Error("connection listener panicked, %v", r)
+				}
+			}()
+			listener.OnConnectionChange(event)
+		}()
+	}
+}
+
 // DefaultConfig returns a new default config
 func DefaultConfig() *Config {
 	pwd := os.Getenv("HOME")
@@ -193,6 +258,65 @@ func NewClient(config *Config) (Client, error) {
 	return client, nil
 }
 
+// refreshSrvIfNeed fetches the servers listed by Config.Endpoint once the
+// last list is vipSrvRefInterMillis old
+func (c *client) refreshSrvIfNeed() error {
+	if len(c.config.Hosts) != 0 {
+		// server list provide by user
+		return nil
+	}
+	c.srvMu.Lock()
+	defer c.srvMu.Unlock()
+	if time.Now().Unix()-c.lastServerRefreshTime < vipSrvRefInterMillis {
+		return nil
+	}
+	// get server list from endpoint
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/nacos/serverlist", c.config.Endpoint), nil)
+	c.setHeader(req.Header)
+
+	resp, err := c.config.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error while requesting: %s. Server returned: %s", c.config.Endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error while requesting: %s. Server returned: %s", c.config.Endpoint, resp.Status)
+	}
+	// one server per line
+	br := bufio.NewReader(resp.Body)
+	var serverList []string
+	for {
+		l, err := br.ReadSlice('\n')
+		if server := strings.TrimSpace(string(l)); server != "" {
+			serverList = append(serverList, server)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if len(serverList) == 0 {
+		return fmt.Errorf("Cannot acquire Nacos server")
+	}
+	c.serversFromEndpoint = serverList
+	c.lastServerRefreshTime = time.Now().Unix()
+
+	return nil
+}
+
+// getServerList returns Config.Hosts, or else the servers listed by
+// Config.Endpoint, fetched first if they are not yet
+func (c *client) getServerList() []string {
+	if len(c.config.Hosts) > 0 {
+		return c.config.Hosts
+	}
+	if err := c.refreshSrvIfNeed(); err != nil {
+		c.logger.Error("failed to get the server list, %v", err)
+	}
+	c.srvMu.Lock()
+	defer c.srvMu.Unlock()
+	return c.serversFromEndpoint
+}
+
 func (c *client) tryLogin(servers []string) bool {
 	if !c.token.lastRefreshTime.IsZero() || time.Now().Sub(c.token.lastRefreshTime).Milliseconds() < (time.Second*time.Duration(c.token.TokenTTL-c.token.tokenRefreshWindow)).Milliseconds() {
 		return true
@@ -272,7 +396,8 @@ func (r *Request) toHTTPRequest(host string) (*http.Request, error) {
 }
 
 func (c *client) DoRequest(r *Request) (resp *http.Response, err error) {
-	if c.config.Namespace != "" {
+	// the namespace API names its target by namespaceId
+	if c.config.Namespace != "" && r.params.Get("namespaceId") == "" {
 		r.params.Set("namespaceId", c.config.Namespace)
 	}
 	if c.token.AccessToken != "" {
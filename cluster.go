@@ -0,0 +1,203 @@
+package nacos
+
+import (
+	"errors"
+	"strconv"
+)
+
+type HealthCheckerType string
+
+const (
+	// HealthCheckerNone disables server side checks, health is then set
+	// through UpdateInstanceHealth
+	HealthCheckerNone  HealthCheckerType = "NONE"
+	HealthCheckerTCP   HealthCheckerType = "TCP"
+	HealthCheckerHTTP  HealthCheckerType = "HTTP"
+	HealthCheckerMySQL HealthCheckerType = "MYSQL"
+)
+
+// HealthChecker configures how the server checks the persistent instances of
+// a cluster
+type HealthChecker struct {
+	Type HealthCheckerType `json:"type"`
+	// HTTP
+	Path                 string `json:"path,omitempty"`
+	Headers              string `json:"headers,omitempty"`
+	ExpectedResponseCode int    `json:"expectedResponseCode,omitempty"`
+	// MYSQL
+	User string `json:"user,omitempty"`
+	Pwd  string `json:"pwd,omitempty"`
+	Cmd  string `json:"cmd,omitempty"`
+}
+
+// NewTCPHealthChecker returns a checker that connects to the check port
+func NewTCPHealthChecker() *HealthChecker {
+	return &HealthChecker{Type: HealthCheckerTCP}
+}
+
+// NewHTTPHealthChecker returns a checker that GETs path and expects
+// expectedResponseCode
+func NewHTTPHealthChecker(path string, expectedResponseCode int) *HealthChecker {
+	return &HealthChecker{Type: HealthCheckerHTTP, Path: path, ExpectedResponseCode: expectedResponseCode}
+}
+
+// NewMySQLHealthChecker returns a checker that runs cmd as user
+func NewMySQLHealthChecker(user, pwd, cmd string) *HealthChecker {
+	return &HealthChecker{Type: HealthCheckerMySQL, User: user, Pwd: pwd, Cmd: cmd}
+}
+
+// NewNoneHealthChecker returns a checker that leaves health to the client
+func NewNoneHealthChecker() *HealthChecker {
+	return &HealthChecker{Type: HealthCheckerNone}
+}
+
+// Cluster is a cluster of a service as held by the server
+type Cluster struct {
+	Name             string            `json:"name"`
+	ServiceName      string            `json:"serviceName,omitempty"`
+	Metadata         map[string]string `json:"metadata"`
+	HealthChecker    *HealthChecker    `json:"healthChecker"`
+	DefaultPort      int               `json:"defaultPort"`
+	DefaultCheckPort int               `json:"defaultCheckPort"`
+	UseIPPort4Check  bool              `json:"useIPPort4Check"`
+}
+
+// ClusterMap maps cluster names to clusters. It decodes from both the list
+// and the object form the server uses.
+type ClusterMap map[string]*Cluster
+
+func (m *ClusterMap) UnmarshalJSON(b []byte) error {
+	var list []*Cluster
+	if err := json.Unmarshal(b, &list); err == nil {
+		*m = make(ClusterMap, len(list))
+		for _, c := range list {
+			(*m)[c.Name] = c
+		}
+		return nil
+	}
+	var object map[string]*Cluster
+	if err := json.Unmarshal(b, &object); err != nil {
+		return err
+	}
+	for name, c := range object {
+		if c.Name == "" {
+			c.Name = name
+		}
+	}
+	*m = object
+	return nil
+}
+
+// ClusterOptions options. UpdateCluster keeps the settings of the cluster
+// left unset: a zero CheckPort and a nil UseIPPort4Check, HealthChecker or
+// Metadata.
+type ClusterOptions struct {
+	ServiceName string
+	GroupName   string
+	ClusterName string
+	// port checked by the server, used unless UseIPPort4Check is set
+	CheckPort int
+	// check the port each instance registered with
+	UseIPPort4Check *bool
+	HealthChecker   *HealthChecker
+	Metadata        *Metadata
+}
+
+// merge fills the settings left unset in q from the cluster held by the
+// server
+func (q *ClusterOptions) merge(cluster *Cluster) {
+	if q.CheckPort == 0 {
+		q.CheckPort = cluster.DefaultCheckPort
+	}
+	if q.UseIPPort4Check == nil {
+		useIPPort4Check := cluster.UseIPPort4Check
+		q.UseIPPort4Check = &useIPPort4Check
+	}
+	if q.HealthChecker == nil {
+		q.HealthChecker = cluster.HealthChecker
+	}
+	if q.Metadata == nil {
+		q.Metadata = NewMetadata(cluster.Metadata)
+	}
+}
+
+func checkClusterOptions(q *ClusterOptions) error {
+	if q.ServiceName == "" {
+		return errors.New("ERR: serviceName is required")
+	}
+	if q.GroupName == "" {
+		q.GroupName = DefaultGroup
+	}
+	if q.ClusterName == "" {
+		q.ClusterName = DefaultCluster
+	}
+	return nil
+}
+
+func setClusterOptions(r *Request, q *ClusterOptions) {
+	healthChecker := q.HealthChecker
+	if healthChecker == nil {
+		healthChecker = NewTCPHealthChecker()
+	}
+	var useIPPort4Check bool
+	if q.UseIPPort4Check != nil {
+		useIPPort4Check = *q.UseIPPort4Check
+	}
+	r.params.Set("serviceName", q.GroupName+serviceInfoSpliter+q.ServiceName)
+	r.params.Set("groupName", q.GroupName)
+	r.params.Set("clusterName", q.ClusterName)
+	r.params.Set("checkPort", strconv.Itoa(q.CheckPort))
+	r.params.Set("useInstancePort4Check", strconv.FormatBool(useIPPort4Check))
+	r.params.Set("healthChecker", encode(healthChecker))
+	r.params.Set("metadata", q.Metadata.Encode())
+}
+
+// CreateCluster creates a cluster of an existing service, checked by TCP
+// unless HealthChecker is set. The server treats an update of a missing
+// cluster as its creation.
+func (ns *namingClient) CreateCluster(q ClusterOptions) (*Response, error) {
+	if err := checkClusterOptions(&q); err != nil {
+		return nil, err
+	}
+	r := ns.NewRequest(PUT, "/cluster")
+	setClusterOptions(r, &q)
+	return callServer(ns.c, r)
+}
+
+// UpdateCluster updates the health check settings of a cluster. The server
+// replaces them all, so the cluster is read first for the settings left
+// unset; a missing cluster is created as by CreateCluster.
+func (ns *namingClient) UpdateCluster(q ClusterOptions) (*Response, error) {
+	if err := checkClusterOptions(&q); err != nil {
+		return nil, err
+	}
+	service, err := ns.GetService(q.ServiceName, q.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	if cluster, ok := service.Clusters[q.ClusterName]; ok {
+		q.merge(cluster)
+	}
+	r := ns.NewRequest(PUT, "/cluster")
+	setClusterOptions(r, &q)
+	return callServer(ns.c, r)
+}
+
+// UpdateInstanceHealth sets the health of a persistent instance whose
+// cluster is checked by HealthCheckerNone
+func (ns *namingClient) UpdateInstanceHealth(key InstanceKey, healthy bool) (*Response, error) {
+	if key.GroupName == "" {
+		key.GroupName = DefaultGroup
+	}
+	if key.ClusterName == "" {
+		key.ClusterName = DefaultCluster
+	}
+	r := ns.NewRequest(PUT, "/health/instance")
+	r.params.Set("serviceName", key.GroupName+serviceInfoSpliter+key.ServiceName)
+	r.params.Set("groupName", key.GroupName)
+	r.params.Set("clusterName", key.ClusterName)
+	r.params.Set("ip", key.IP)
+	r.params.Set("port", strconv.Itoa(key.Port))
+	r.params.Set("healthy", strconv.FormatBool(healthy))
+	return callServer(ns.c, r)
+}
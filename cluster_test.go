@@ -0,0 +1,160 @@
+package nacos
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "gopkg.in/check.v1"
+)
+
+type ClusterSuite struct {
+	srv    *httptest.Server
+	ns     *namingClient
+	method string
+	path   string
+	query  url.Values
+}
+
+var _ = Suite(&ClusterSuite{})
+
+func (s *ClusterSuite) SetUpTest(c *C) {
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.method, s.path, s.query = r.Method, r.URL.Path, r.URL.Query()
+		switch r.URL.Path {
+		case "/nacos/v1/ns/service":
+			w.Write([]byte(`{"name":"svc","groupName":"DEFAULT_GROUP","protectThreshold":0.5,"metadata":{"foo":"bar"},"selector":{"type":"none"},
+				"clusters":[{"name":"DEFAULT","healthChecker":{"type":"TCP"},"metadata":{}},{"name":"db","healthChecker":{"type":"MYSQL","user":"root","cmd":"select 1"},"metadata":{"k":"v"}}]}`))
+		case "/nacos/v1/ns/catalog/service":
+			w.Write([]byte(`{"service":{"name":"svc","protectThreshold":0.5,"metadata":{},"selector":{"type":"none"}},
+				"clusters":[{"name":"web","serviceName":"DEFAULT_GROUP@@svc","healthChecker":{"type":"HTTP","path":"/health","headers":"","expectedResponseCode":200},"defaultPort":80,"defaultCheckPort":8080,"useIPPort4Check":true,"metadata":{}}]}`))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	u, _ := url.Parse(s.srv.URL)
+	s.ns = newOfflineNamingClient(c)
+	s.ns.c.config.Scheme = "http"
+	s.ns.c.config.Hosts = []string{u.Host}
+	s.ns.c.config.ContextPath = "/nacos"
+	s.ns.c.config.HttpClient = DefaultPooledClient()
+}
+
+func (s *ClusterSuite) TearDownTest(c *C) {
+	s.ns.c.cancel()
+	s.srv.Close()
+}
+
+func (s *ClusterSuite) TestCreateCluster(c *C) {
+	_, err := s.ns.CreateCluster(ClusterOptions{
+		ServiceName:   "svc",
+		ClusterName:   "web",
+		CheckPort:     8080,
+		HealthChecker: NewHTTPHealthChecker("/health", 200),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(s.method, Equals, PUT)
+	c.Assert(s.path, Equals, "/nacos/v1/ns/cluster")
+	c.Assert(s.query.Get("serviceName"), Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(s.query.Get("clusterName"), Equals, "web")
+	c.Assert(s.query.Get("checkPort"), Equals, "8080")
+	c.Assert(s.query.Get("useInstancePort4Check"), Equals, "false")
+	c.Assert(s.query.Get("healthChecker"), Equals, `{"type":"HTTP","path":"/health","expectedResponseCode":200}`)
+
+	_, err = s.ns.CreateCluster(ClusterOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("clusterName"), Equals, DefaultCluster)
+	c.Assert(s.query.Get("healthChecker"), Equals, `{"type":"TCP"}`)
+
+	// the settings the server has for the cluster are not kept
+	_, err = s.ns.CreateCluster(ClusterOptions{ServiceName: "svc", ClusterName: "web"})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("healthChecker"), Equals, `{"type":"TCP"}`)
+	c.Assert(s.query.Get("metadata"), Equals, "{}")
+
+	_, err = s.ns.CreateCluster(ClusterOptions{})
+	c.Assert(err, ErrorMatches, ".*serviceName is required")
+}
+
+func (s *ClusterSuite) TestUpdateInstanceHealth(c *C) {
+	_, err := s.ns.UpdateInstanceHealth(InstanceKey{ServiceName: "svc", IP: "10.0.0.1", Port: 80}, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.method, Equals, PUT)
+	c.Assert(s.path, Equals, "/nacos/v1/ns/health/instance")
+	for key, value := range map[string]string{
+		"serviceName": "DEFAULT_GROUP@@svc",
+		"groupName":   DefaultGroup,
+		"clusterName": DefaultCluster,
+		"ip":          "10.0.0.1",
+		"port":        "80",
+		"healthy":     "false",
+	} {
+		c.Assert(s.query.Get(key), Equals, value, Commentf(key))
+	}
+}
+
+func (s *ClusterSuite) TestSelectServiceClusters(c *C) {
+	service, err := s.ns.SelectService(ServiceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	c.Assert(service.Clusters, HasLen, 2)
+	c.Assert(service.Clusters["DEFAULT"].HealthChecker.Type, Equals, HealthCheckerTCP)
+	c.Assert(service.Clusters["db"].HealthChecker, DeepEquals, NewMySQLHealthChecker("root", "", "select 1"))
+	c.Assert(service.Clusters["db"].Metadata["k"], Equals, "v")
+}
+
+func (s *ClusterSuite) TestGetService(c *C) {
+	service, err := s.ns.GetService("svc", "")
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("groupName"), Equals, DefaultGroup)
+	c.Assert(service.Name, Equals, "svc")
+	c.Assert(service.GroupName, Equals, DefaultGroup)
+	c.Assert(service.Clusters["web"], DeepEquals, &Cluster{
+		Name:             "web",
+		ServiceName:      "DEFAULT_GROUP@@svc",
+		Metadata:         map[string]string{},
+		HealthChecker:    NewHTTPHealthChecker("/health", 200),
+		DefaultPort:      80,
+		DefaultCheckPort: 8080,
+		UseIPPort4Check:  true,
+	})
+}
+
+func (s *ClusterSuite) TestUpdateCluster(c *C) {
+	useIPPort4Check := false
+	_, err := s.ns.UpdateCluster(ClusterOptions{
+		ServiceName:     "svc",
+		ClusterName:     "web",
+		CheckPort:       8080,
+		UseIPPort4Check: &useIPPort4Check,
+		HealthChecker:   NewHTTPHealthChecker("/health", 200),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("serviceName"), Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(s.query.Get("checkPort"), Equals, "8080")
+	c.Assert(s.query.Get("useInstancePort4Check"), Equals, "false")
+	c.Assert(s.query.Get("healthChecker"), Equals, `{"type":"HTTP","path":"/health","expectedResponseCode":200}`)
+
+	_, err = s.ns.UpdateCluster(ClusterOptions{})
+	c.Assert(err, ErrorMatches, ".*serviceName is required")
+}
+
+func (s *ClusterSuite) TestUpdateClusterKeepsUnsetSettings(c *C) {
+	_, err := s.ns.UpdateCluster(ClusterOptions{
+		ServiceName: "svc",
+		ClusterName: "web",
+		Metadata:    NewMetadata(nil).Put("k", "v"),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("clusterName"), Equals, "web")
+	c.Assert(s.query.Get("checkPort"), Equals, "8080")
+	c.Assert(s.query.Get("useInstancePort4Check"), Equals, "true")
+	c.Assert(s.query.Get("healthChecker"), Equals, `{"type":"HTTP","path":"/health","expectedResponseCode":200}`)
+	c.Assert(s.query.Get("metadata"), Equals, "{\"k\":\"v\"}\n")
+
+	// a cluster the server does not have yet gets the defaults
+	_, err = s.ns.UpdateCluster(ClusterOptions{ServiceName: "svc", ClusterName: "new"})
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("checkPort"), Equals, "0")
+	c.Assert(s.query.Get("useInstancePort4Check"), Equals, "false")
+	c.Assert(s.query.Get("healthChecker"), Equals, `{"type":"TCP"}`)
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"gopkg.in/yaml.v3"
+)
+
+// configPageSize is the page size of the configs listed and exported
+const configPageSize = 100
+
+// configFlags are the flags of the config commands
+type configFlags struct {
+	group     string
+	dataID    string
+	blur      bool
+	content   string
+	file      string
+	count     int
+	id        string
+	page      int
+	size      int
+	overwrite bool
+}
+
+func (f *configFlags) search(fs *flag.FlagSet) {
+	fs.StringVar(&f.dataID, "data-id", "", "data id of the configs, all if empty")
+	fs.StringVar(&f.group, "group", "", "group of the configs, all if empty")
+	fs.BoolVar(&f.blur, "blur", false, "match --data-id and --group with * wildcards")
+}
+
+var configCommands = map[string]*command{
+	"list": {
+		flags: func(c *cli, fs *flag.FlagSet) { c.config.search(fs) },
+		run:   listConfigs,
+	},
+	"get": {
+		flags: func(c *cli, fs *flag.FlagSet) { groupFlag(fs, &c.config.group, "config") },
+		run:   getConfig,
+	},
+	"publish": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			groupFlag(fs, &c.config.group, "config")
+			fs.StringVar(&c.config.content, "content", "", "content of the config")
+			fs.StringVar(&c.config.file, "file", "", "file of the content, - for the standard input")
+		},
+		run: publishConfig,
+	},
+	"delete": {
+		flags: func(c *cli, fs *flag.FlagSet) { groupFlag(fs, &c.config.group, "config") },
+		run:   deleteConfig,
+	},
+	"watch": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			groupFlag(fs, &c.config.group, "config")
+			fs.IntVar(&c.config.count, "count", 0, "exit after that many changes, 0 to watch until interrupted")
+		},
+		run: watchConfig,
+	},
+	"history": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			groupFlag(fs, &c.config.group, "config")
+			fs.StringVar(&c.config.id, "id", "", "show the change of that id with its content")
+			fs.IntVar(&c.config.page, "page", 1, "page of the changes")
+			fs.IntVar(&c.config.size, "size", 20, "changes per page")
+		},
+		run: configHistory,
+	},
+	"export": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			c.config.search(fs)
+			fs.StringVar(&c.config.file, "file", "", "file to export to, the standard output if empty")
+		},
+		run: exportConfigs,
+	},
+	"import": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			fs.BoolVar(&c.config.overwrite, "overwrite", true, "overwrite the existing configs, they are skipped otherwise")
+		},
+		run: importConfigs,
+	},
+}
+
+// configView is a config as printed, exported and imported
+type configView struct {
+	DataID  string `json:"dataId" yaml:"dataId"`
+	Group   string `json:"group" yaml:"group"`
+	Content string `json:"content" yaml:"content"`
+}
+
+// exportFile holds the configs exported from a namespace, read as YAML by
+// the import
+type exportFile struct {
+	Namespace string       `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Configs   []configView `json:"configs" yaml:"configs"`
+}
+
+// searchConfigs returns every config matching the flags, page by page
+func (c *cli) searchConfigs(config nacos.ConfigClient) ([]*nacos.ConfigItem, error) {
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	q := nacos.ConfigSearchOptions{
+		Size:   configPageSize,
+		DataID: c.config.dataID,
+		Group:  c.config.group,
+		Blur:   c.config.blur,
+	}
+	var items []*nacos.ConfigItem
+	for q.Page = 1; ; q.Page++ {
+		list, err := config.SearchConfigs(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, list.Configs...)
+		if len(list.Configs) < configPageSize || len(items) >= list.Count {
+			return items, nil
+		}
+	}
+}
+
+func listConfigs(c *cli, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	items, err := c.searchConfigs(client.Config())
+	if err != nil {
+		return err
+	}
+	views := make([]configView, 0, len(items))
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		views = append(views, configView{DataID: item.DataID, Group: item.Group, Content: item.Content})
+		rows = append(rows, []string{item.DataID, item.Group, item.Type, item.MD5})
+	}
+	return c.print(views, []string{"DATA-ID", "GROUP", "TYPE", "MD5"}, rows)
+}
+
+// printConfig writes the content as is in a table, where it is not framed
+func (c *cli) printConfig(v configView) error {
+	if c.output == "table" {
+		_, err := io.WriteString(c.stdout, v.Content)
+		if err == nil && !strings.HasSuffix(v.Content, "\n") {
+			_, err = io.WriteString(c.stdout, "\n")
+		}
+		return err
+	}
+	return c.print(v, nil, nil)
+}
+
+func getConfig(c *cli, args []string) error {
+	dataID, err := arg(args, "the data id")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	content, err := client.Config().GetConfig(dataID, c.config.group)
+	if err != nil {
+		return err
+	}
+	return c.printConfig(configView{DataID: dataID, Group: c.config.group, Content: content})
+}
+
+func publishConfig(c *cli, args []string) error {
+	dataID, err := arg(args, "the data id")
+	if err != nil {
+		return err
+	}
+	content := c.config.content
+	switch {
+	case c.config.file != "" && c.set["content"]:
+		return errors.New("--content and --file are exclusive")
+	case c.config.file == "-":
+		b, err := ioutil.ReadAll(c.stdin)
+		if err != nil {
+			return err
+		}
+		content = string(b)
+	case c.config.file != "":
+		b, err := ioutil.ReadFile(c.config.file)
+		if err != nil {
+			return err
+		}
+		content = string(b)
+	}
+	if content == "" {
+		return errors.New("the content is empty, set --content or --file")
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	if err := client.Config().PublishConfig(dataID, c.config.group, content); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "config %s of %s published\n", dataID, c.config.group)
+	return nil
+}
+
+func deleteConfig(c *cli, args []string) error {
+	dataID, err := arg(args, "the data id")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	if err := client.Config().RemoveConfig(dataID, c.config.group); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "config %s of %s deleted\n", dataID, c.config.group)
+	return nil
+}
+
+// configChanges queues the contents the listener is notified of, dropping
+// them once full rather than blocking the client
+type configChanges chan configView
+
+func (ch configChanges) OnChange(namespace, group, dataID, content string) {
+	select {
+	case ch <- configView{DataID: dataID, Group: group, Content: content}:
+	default:
+	}
+}
+
+// watchConfig prints the content each time it changes, starting with the
+// current one; a removed config prints empty
+func watchConfig(c *cli, args []string) error {
+	dataID, err := arg(args, "the data id")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	changes := make(configChanges, 16)
+	config := client.Config()
+	if err := config.AddListener(dataID, c.config.group, changes); err != nil {
+		return err
+	}
+	defer config.RemoveListener(dataID, c.config.group)
+	for n := 0; c.config.count == 0 || n < c.config.count; n++ {
+		select {
+		case change := <-changes:
+			if err := c.printConfig(change); err != nil {
+				return err
+			}
+		case <-c.ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func configHistory(c *cli, args []string) error {
+	dataID, err := arg(args, "the data id")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	if c.config.id != "" {
+		change, err := client.Config().HistoryDetail(ctx, dataID, c.config.group, c.config.id)
+		if err != nil {
+			return err
+		}
+		if c.output == "table" {
+			return c.printConfig(configView{DataID: change.DataID, Group: change.Group, Content: change.Content})
+		}
+		return c.print(change, nil, nil)
+	}
+	list, err := client.Config().History(ctx, nacos.ConfigHistoryOptions{
+		Page:   c.config.page,
+		Size:   c.config.size,
+		DataID: dataID,
+		Group:  c.config.group,
+	})
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(list.Changes))
+	for _, change := range list.Changes {
+		rows = append(rows, []string{change.ID, change.OpType, change.LastModifiedTime, change.SrcIP, change.SrcUser, change.MD5})
+	}
+	return c.print(list, []string{"ID", "OP", "MODIFIED", "SOURCE-IP", "SOURCE-USER", "MD5"}, rows)
+}
+
+// exportConfigs writes the configs matching the flags as YAML, or as JSON
+// with -o json
+func exportConfigs(c *cli, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	items, err := c.searchConfigs(client.Config())
+	if err != nil {
+		return err
+	}
+	export := exportFile{Configs: make([]configView, 0, len(items))}
+	if c.set["namespace"] {
+		export.Namespace = c.namespace
+	}
+	for _, item := range items {
+		export.Configs = append(export.Configs, configView{DataID: item.DataID, Group: item.Group, Content: item.Content})
+	}
+	out := c.stdout
+	if c.config.file != "" {
+		f, err := os.Create(c.config.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	format := c.output
+	if format == "table" {
+		format = "yaml"
+	}
+	if err := write(out, format, export, nil, nil); err != nil {
+		return err
+	}
+	if c.config.file != "" {
+		fmt.Fprintf(c.stdout, "%d configs exported to %s\n", len(export.Configs), c.config.file)
+	}
+	return nil
+}
+
+// importConfigs publishes the configs of an export, in YAML or JSON, into
+// the namespace of the client
+func importConfigs(c *cli, args []string) error {
+	path, err := arg(args, "the file to import, - for the standard input")
+	if err != nil {
+		return err
+	}
+	var b []byte
+	if path == "-" {
+		b, err = ioutil.ReadAll(c.stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	// JSON is YAML
+	var export exportFile
+	if err := yaml.Unmarshal(b, &export); err != nil {
+		return fmt.Errorf("failed to read %s, %v", path, err)
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	config := client.Config()
+	type result struct {
+		DataID string `json:"dataId"`
+		Group  string `json:"group"`
+		Result string `json:"result"`
+	}
+	results := make([]result, 0, len(export.Configs))
+	rows := make([][]string, 0, len(export.Configs))
+	var failed int
+	for _, v := range export.Configs {
+		if v.Group == "" {
+			v.Group = nacos.DefaultGroup
+		}
+		r := result{DataID: v.DataID, Group: v.Group, Result: "published"}
+		if !c.config.overwrite {
+			if _, err := config.GetConfig(v.DataID, v.Group); err == nil {
+				r.Result = "skipped"
+			} else if err != nacos.ErrConfigNotFound {
+				r.Result = "failed: " + err.Error()
+			}
+		}
+		if r.Result == "published" {
+			if err := config.PublishConfig(v.DataID, v.Group, v.Content); err != nil {
+				r.Result = "failed: " + err.Error()
+			}
+		}
+		if strings.HasPrefix(r.Result, "failed") {
+			failed++
+		}
+		results = append(results, r)
+		rows = append(rows, []string{r.DataID, r.Group, r.Result})
+	}
+	if err := c.print(results, []string{"DATA-ID", "GROUP", "RESULT"}, rows); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " configs failed to import")
+	}
+	return nil
+}
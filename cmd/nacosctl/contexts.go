@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"gopkg.in/yaml.v3"
+)
+
+// contextsFile is the file of the contexts, ~/.nacosctl.yaml by default
+type contextsFile struct {
+	CurrentContext string           `yaml:"current-context" json:"currentContext"`
+	Contexts       []*contextConfig `yaml:"contexts" json:"contexts"`
+}
+
+// contextConfig holds the connection to a cluster, as the Config of the
+// client
+type contextConfig struct {
+	Name      string   `yaml:"name" json:"name"`
+	Servers   []string `yaml:"servers" json:"servers"`
+	Namespace string   `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Username  string   `yaml:"username,omitempty" json:"username,omitempty"`
+	Password  string   `yaml:"password,omitempty" json:"password,omitempty"`
+	AccessKey string   `yaml:"access-key,omitempty" json:"accessKey,omitempty"`
+	SecretKey string   `yaml:"secret-key,omitempty" json:"secretKey,omitempty"`
+	AppName   string   `yaml:"app-name,omitempty" json:"appName,omitempty"`
+	Protocol  string   `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+}
+
+// loadContexts reads the contexts, a missing file has none
+func loadContexts(path string) (*contextsFile, error) {
+	file := &contextsFile{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, file); err != nil {
+		return nil, fmt.Errorf("failed to read %s, %v", path, err)
+	}
+	return file, nil
+}
+
+// save writes the file readable by its owner only, it holds passwords
+func (f *contextsFile) save(path string) error {
+	b, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+func (f *contextsFile) find(name string) *contextConfig {
+	for _, ctx := range f.Contexts {
+		if ctx.Name == name {
+			return ctx
+		}
+	}
+	return nil
+}
+
+// clientConfig returns the config of a client to the servers, which must
+// share their scheme and context path
+func (ctx *contextConfig) clientConfig() (*nacos.Config, error) {
+	config := &nacos.Config{
+		Namespace: ctx.Namespace,
+		Username:  ctx.Username,
+		Password:  ctx.Password,
+		AccessKey: ctx.AccessKey,
+		SecretKey: ctx.SecretKey,
+		AppName:   ctx.AppName,
+	}
+	switch ctx.Protocol {
+	case "", "http":
+	case "grpc":
+		config.Protocol = nacos.ProtocolGRPC
+	default:
+		return nil, fmt.Errorf("unknown protocol %q, expected http or grpc", ctx.Protocol)
+	}
+	for _, server := range ctx.Servers {
+		scheme, host, path, err := parseURL(server)
+		if err != nil {
+			return nil, err
+		}
+		if len(config.Hosts) > 0 && (scheme != config.Scheme || path != config.ContextPath) {
+			return nil, errors.New("the servers must share their scheme and context path")
+		}
+		config.Scheme, config.ContextPath = scheme, path
+		config.Hosts = append(config.Hosts, host)
+	}
+	return config, nil
+}
+
+// redacted returns a copy of the context without its secrets
+func (ctx *contextConfig) redacted() *contextConfig {
+	r := *ctx
+	if r.Password != "" {
+		r.Password = "*****"
+	}
+	if r.SecretKey != "" {
+		r.SecretKey = "*****"
+	}
+	return &r
+}
+
+var contextCommands = map[string]*command{
+	"list":    {run: listContexts},
+	"current": {run: currentContext},
+	"use":     {run: useContext},
+	"set":     {run: setContext},
+	"delete":  {run: deleteContext},
+}
+
+func listContexts(c *cli, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	file, err := loadContexts(c.configFile)
+	if err != nil {
+		return err
+	}
+	contexts := make([]*contextConfig, 0, len(file.Contexts))
+	rows := make([][]string, 0, len(file.Contexts))
+	for _, ctx := range file.Contexts {
+		current := ""
+		if ctx.Name == file.CurrentContext {
+			current = "*"
+		}
+		contexts = append(contexts, ctx.redacted())
+		rows = append(rows, []string{current, ctx.Name, strings.Join(ctx.Servers, ","), ctx.Namespace, ctx.Username})
+	}
+	return c.print(contexts, []string{"CURRENT", "NAME", "SERVERS", "NAMESPACE", "USERNAME"}, rows)
+}
+
+func currentContext(c *cli, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	file, err := loadContexts(c.configFile)
+	if err != nil {
+		return err
+	}
+	if file.CurrentContext == "" {
+		return errors.New("no current context")
+	}
+	ctx := file.find(file.CurrentContext)
+	if ctx == nil {
+		return fmt.Errorf("context %s not found", file.CurrentContext)
+	}
+	return c.print(ctx.redacted(), []string{"NAME", "SERVERS", "NAMESPACE", "USERNAME"},
+		[][]string{{ctx.Name, strings.Join(ctx.Servers, ","), ctx.Namespace, ctx.Username}})
+}
+
+func useContext(c *cli, args []string) error {
+	name, err := arg(args, "the context name")
+	if err != nil {
+		return err
+	}
+	file, err := loadContexts(c.configFile)
+	if err != nil {
+		return err
+	}
+	if file.find(name) == nil {
+		return fmt.Errorf("context %s not found", name)
+	}
+	file.CurrentContext = name
+	if err := file.save(c.configFile); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "switched to context %s\n", name)
+	return nil
+}
+
+// setContext creates or changes a context from the global flags, the first
+// context created becomes the current one
+func setContext(c *cli, args []string) error {
+	name, err := arg(args, "the context name")
+	if err != nil {
+		return err
+	}
+	file, err := loadContexts(c.configFile)
+	if err != nil {
+		return err
+	}
+	ctx := file.find(name)
+	if ctx == nil {
+		ctx = &contextConfig{Name: name}
+		file.Contexts = append(file.Contexts, ctx)
+	}
+	*ctx = *c.override(ctx)
+	if _, err := ctx.clientConfig(); err != nil {
+		return err
+	}
+	if file.CurrentContext == "" {
+		file.CurrentContext = name
+	}
+	if err := file.save(c.configFile); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "context %s set\n", name)
+	return nil
+}
+
+func deleteContext(c *cli, args []string) error {
+	name, err := arg(args, "the context name")
+	if err != nil {
+		return err
+	}
+	file, err := loadContexts(c.configFile)
+	if err != nil {
+		return err
+	}
+	for i, ctx := range file.Contexts {
+		if ctx.Name == name {
+			file.Contexts = append(file.Contexts[:i], file.Contexts[i+1:]...)
+			if file.CurrentContext == name {
+				file.CurrentContext = ""
+			}
+			if err := file.save(c.configFile); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.stdout, "context %s deleted\n", name)
+			return nil
+		}
+	}
+	return fmt.Errorf("context %s not found", name)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+// instanceFlags are the flags of the instance commands
+type instanceFlags struct {
+	group     string
+	cluster   string
+	clusters  string
+	ip        string
+	port      int
+	weight    float64
+	metadata  string
+	ephemeral bool
+	healthy   bool
+	count     int
+}
+
+func (f *instanceFlags) address(fs *flag.FlagSet) {
+	groupFlag(fs, &f.group, "service")
+	fs.StringVar(&f.cluster, "cluster", nacos.DefaultCluster, "cluster of the instance")
+	fs.StringVar(&f.ip, "ip", "", "IP of the instance")
+	fs.IntVar(&f.port, "port", 0, "port of the instance")
+	fs.BoolVar(&f.ephemeral, "ephemeral", false, "ephemeral instance, removed by the server once nacosctl exits as it sends no beat")
+}
+
+func (f *instanceFlags) query(fs *flag.FlagSet) {
+	groupFlag(fs, &f.group, "service")
+	fs.StringVar(&f.clusters, "clusters", nacos.DefaultCluster, "comma separated clusters")
+}
+
+var instanceCommands = map[string]*command{
+	"list": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			c.instance.query(fs)
+			fs.BoolVar(&c.instance.healthy, "healthy", false, "healthy instances only")
+		},
+		run: listInstances,
+	},
+	"register": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			c.instance.address(fs)
+			fs.Float64Var(&c.instance.weight, "weight", 1, "weight of the instance")
+			fs.StringVar(&c.instance.metadata, "metadata", "", "metadata as key=value,key=value")
+		},
+		run: registerInstance,
+	},
+	"deregister": {
+		flags: func(c *cli, fs *flag.FlagSet) { c.instance.address(fs) },
+		run:   deregisterInstance,
+	},
+	"watch": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			c.instance.query(fs)
+			fs.IntVar(&c.instance.count, "count", 0, "exit after that many changes, 0 to watch until interrupted")
+		},
+		run: watchInstances,
+	},
+}
+
+// instanceView is an instance as printed
+type instanceView struct {
+	IP        string            `json:"ip"`
+	Port      int               `json:"port"`
+	Cluster   string            `json:"cluster"`
+	Weight    float64           `json:"weight"`
+	Healthy   bool              `json:"healthy"`
+	Enabled   bool              `json:"enabled"`
+	Ephemeral bool              `json:"ephemeral"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+func (c *cli) printInstances(instances []*nacos.Instance) error {
+	views := make([]instanceView, 0, len(instances))
+	for _, i := range instances {
+		v := instanceView{
+			IP:        i.IP,
+			Port:      i.Port,
+			Cluster:   i.ClusterName,
+			Weight:    i.Weight,
+			Healthy:   i.Healthy,
+			Enabled:   i.Enable,
+			Ephemeral: i.Ephemeral,
+		}
+		if i.Metadata != nil {
+			v.Metadata = i.Metadata.Map()
+		}
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Cluster != views[j].Cluster {
+			return views[i].Cluster < views[j].Cluster
+		}
+		if views[i].IP != views[j].IP {
+			return views[i].IP < views[j].IP
+		}
+		return views[i].Port < views[j].Port
+	})
+	rows := make([][]string, 0, len(views))
+	for _, v := range views {
+		rows = append(rows, []string{
+			v.IP, strconv.Itoa(v.Port), v.Cluster, strconv.FormatFloat(v.Weight, 'f', -1, 64),
+			strconv.FormatBool(v.Healthy), strconv.FormatBool(v.Enabled), strconv.FormatBool(v.Ephemeral), formatMap(v.Metadata),
+		})
+	}
+	return c.print(views, []string{"IP", "PORT", "CLUSTER", "WEIGHT", "HEALTHY", "ENABLED", "EPHEMERAL", "METADATA"}, rows)
+}
+
+func listInstances(c *cli, args []string) error {
+	name, err := arg(args, "the service name")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	return c.printInstances(client.Naming().SelectInstance(nacos.InstanceQueryOptions{
+		ServiceName: name,
+		GroupName:   c.instance.group,
+		ClusterName: splitList(c.instance.clusters),
+		Healthy:     c.instance.healthy,
+	}))
+}
+
+func (f *instanceFlags) validate() error {
+	if f.ip == "" || f.port <= 0 {
+		return errors.New("--ip and --port are required")
+	}
+	return nil
+}
+
+func registerInstance(c *cli, args []string) error {
+	name, err := arg(args, "the service name")
+	if err != nil {
+		return err
+	}
+	f := &c.instance
+	if err := f.validate(); err != nil {
+		return err
+	}
+	metadata, err := parseMetadata(f.metadata)
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	instance := nacos.NewInstance(name, f.group, f.cluster, f.ip, f.port, f.weight, true, f.ephemeral, nacos.NewMetadata(metadata))
+	if _, err := client.Naming().RegisterInstance(instance); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "instance %s:%d of %s@@%s registered\n", f.ip, f.port, f.group, name)
+	return nil
+}
+
+func deregisterInstance(c *cli, args []string) error {
+	name, err := arg(args, "the service name")
+	if err != nil {
+		return err
+	}
+	f := &c.instance
+	if err := f.validate(); err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	if _, err := client.Naming().DeRegisterInstance(name, f.group, f.cluster, f.ip, f.port, f.ephemeral); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "instance %s:%d of %s@@%s deregistered\n", f.ip, f.port, f.group, name)
+	return nil
+}
+
+// serviceEvents queues the service infos the subscription is notified of,
+// dropping them once full rather than blocking the client
+type serviceEvents chan *nacos.ServiceInfo
+
+func (e serviceEvents) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	select {
+	case e <- serviceInfo:
+	default:
+	}
+}
+
+// watchInstances prints the instances each time they change, starting with
+// the current ones
+func watchInstances(c *cli, args []string) error {
+	name, err := arg(args, "the service name")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	clusters := splitList(c.instance.clusters)
+	events := make(serviceEvents, 16)
+	naming := client.Naming()
+	naming.Subscribe(name, c.instance.group, clusters, events)
+	defer naming.Unsubscribe(name, c.instance.group, clusters, events)
+	for n := 0; c.instance.count == 0 || n < c.instance.count; n++ {
+		select {
+		case serviceInfo := <-events:
+			if err := c.printInstances(serviceInfo.Hosts); err != nil {
+				return err
+			}
+		case <-c.ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
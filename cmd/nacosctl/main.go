@@ -0,0 +1,384 @@
+// Command nacosctl manages the services, instances, configs and namespaces
+// of a Nacos cluster. It only goes through the public Client API of the SDK,
+// so its commands also exercise the SDK against a real server.
+//
+//	nacosctl [flags] <resource> <command> [flags] [args]
+//
+// The connection is read from a context of ~/.nacosctl.yaml, which the
+// flags override:
+//
+//	current-context: dev
+//	contexts:
+//	  - name: dev
+//	    servers: [http://127.0.0.1:8848/nacos]
+//	    namespace: dev
+//	    username: nacos
+//	    password: nacos
+//
+// Run nacosctl help for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+const usage = `usage: nacosctl [flags] <resource> <command> [flags] [args]
+
+Resources and commands:
+  service   list | get NAME | create NAME | update NAME | delete NAME
+  instance  list SERVICE | register SERVICE | deregister SERVICE | watch SERVICE
+  config    list | get DATA_ID | publish DATA_ID | delete DATA_ID | watch DATA_ID
+            history DATA_ID | export | import FILE
+  namespace list | create NAME | update ID | delete ID
+  context   list | current | use NAME | set NAME | delete NAME
+
+Run nacosctl <resource> <command> -h for the flags of a command.
+
+Flags:
+`
+
+// errUsage reports a command line the usage was printed for
+var errUsage = errors.New("usage")
+
+// command runs a command of a resource with the arguments left once its
+// flags are parsed
+type command struct {
+	flags func(c *cli, fs *flag.FlagSet)
+	run   func(c *cli, args []string) error
+}
+
+var resources = map[string]map[string]*command{
+	"service":   serviceCommands,
+	"instance":  instanceCommands,
+	"config":    configCommands,
+	"namespace": namespaceCommands,
+	"context":   contextCommands,
+}
+
+// aliases of the resources
+var aliases = map[string]string{
+	"services":   "service",
+	"svc":        "service",
+	"instances":  "instance",
+	"configs":    "config",
+	"namespaces": "namespace",
+	"ns":         "namespace",
+	"contexts":   "context",
+}
+
+// globals are the flags accepted before and after the command
+type globals struct {
+	configFile  string
+	contextName string
+	servers     string
+	namespace   string
+	username    string
+	password    string
+	accessKey   string
+	secretKey   string
+	appName     string
+	protocol    string
+	output      string
+	timeout     time.Duration
+}
+
+type cli struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	globals
+	service    serviceFlags
+	instance   instanceFlags
+	config     configFlags
+	namespaces namespaceFlags
+	// set tells the global flags given on the command line
+	set    map[string]bool
+	client nacos.Client
+	// cacheDir is removed once the command ran
+	cacheDir string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command line and returns the exit code: 2 for a bad command
+// line, 1 for a failed command
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr, set: make(map[string]bool)}
+	defer c.close()
+	if err := c.run(args); err != nil {
+		if err == errUsage || err == flag.ErrHelp {
+			return 2
+		}
+		// the server errors may end with a new line
+		fmt.Fprintln(stderr, "error:", strings.TrimSpace(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+func (c *cli) run(args []string) error {
+	home, _ := os.UserHomeDir()
+	defaults := globals{
+		configFile: filepath.Join(home, ".nacosctl.yaml"),
+		output:     "table",
+		timeout:    10 * time.Second,
+	}
+	if env := os.Getenv("NACOSCTL_CONFIG"); env != "" {
+		defaults.configFile = env
+	}
+	fs := c.newFlagSet("nacosctl", defaults)
+	fs.Usage = func() {
+		fmt.Fprint(c.stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 || args[0] == "help" {
+		fs.Usage()
+		return errUsage
+	}
+	resource := args[0]
+	if alias, ok := aliases[resource]; ok {
+		resource = alias
+	}
+	commands, ok := resources[resource]
+	if !ok {
+		fmt.Fprintf(c.stderr, "unknown resource %q\n", args[0])
+		fs.Usage()
+		return errUsage
+	}
+	if len(args) < 2 {
+		fmt.Fprintf(c.stderr, "missing command of %s\n", resource)
+		fs.Usage()
+		return errUsage
+	}
+	cmd, ok := commands[args[1]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "unknown command %q of %s\n", args[1], resource)
+		fs.Usage()
+		return errUsage
+	}
+	// the flags given before the command are the defaults of the ones after
+	cfs := c.newFlagSet("nacosctl "+resource+" "+args[1], c.globals)
+	if cmd.flags != nil {
+		cmd.flags(c, cfs)
+	}
+	rest, err := parseInterspersed(cfs, args[2:])
+	if err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) { c.set[f.Name] = true })
+	cfs.Visit(func(f *flag.Flag) { c.set[f.Name] = true })
+	switch c.output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format %q, expected table, json or yaml", c.output)
+	}
+	return cmd.run(c, rest)
+}
+
+// newFlagSet returns a flag set of the global flags
+func (c *cli) newFlagSet(name string, d globals) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.configFile, "config", d.configFile, "contexts file, $NACOSCTL_CONFIG overrides the default")
+	fs.StringVar(&c.contextName, "context", d.contextName, "context to use instead of the current one")
+	fs.StringVar(&c.servers, "server", d.servers, "comma separated server URLs, such as http://127.0.0.1:8848/nacos")
+	fs.StringVar(&c.namespace, "namespace", d.namespace, "namespace ID")
+	fs.StringVar(&c.username, "username", d.username, "user to log in as")
+	fs.StringVar(&c.password, "password", d.password, "password of the user")
+	fs.StringVar(&c.accessKey, "access-key", d.accessKey, "access key signing the requests")
+	fs.StringVar(&c.secretKey, "secret-key", d.secretKey, "secret key signing the requests")
+	fs.StringVar(&c.appName, "app-name", d.appName, "application name sent to the server")
+	fs.StringVar(&c.protocol, "protocol", d.protocol, "http, or grpc for Nacos 2.x servers")
+	fs.StringVar(&c.output, "o", d.output, "output format: table, json or yaml")
+	fs.DurationVar(&c.timeout, "timeout", d.timeout, "timeout of the requests")
+	return fs
+}
+
+// parseInterspersed parses the flags found among the arguments, which the
+// flag package stops at, and returns the arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// requestContext bounds a request by the --timeout
+func (c *cli) requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.ctx, c.timeout)
+}
+
+// nacos returns the client of the context overridden by the flags
+func (c *cli) nacos() (nacos.Client, error) {
+	if c.client != nil {
+		return c.client, nil
+	}
+	file, err := loadContexts(c.configFile)
+	if err != nil {
+		return nil, err
+	}
+	ctx := &contextConfig{}
+	name := c.contextName
+	if name == "" {
+		name = file.CurrentContext
+	}
+	if name != "" {
+		if ctx = file.find(name); ctx == nil {
+			return nil, fmt.Errorf("context %s not found in %s", name, c.configFile)
+		}
+	}
+	ctx = c.override(ctx)
+	if len(ctx.Servers) == 0 {
+		return nil, errors.New("no server, set --server or a context")
+	}
+	config, err := ctx.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	// no cache is shared between runs, the command shows the server state
+	if c.cacheDir, err = os.MkdirTemp("", "nacosctl"); err != nil {
+		return nil, err
+	}
+	config.CacheDir = filepath.Join(c.cacheDir, "cache")
+	config.LogDir = filepath.Join(c.cacheDir, "log")
+	config.LogLevel = nacos.LogError
+	// registered instances outlive the command
+	config.KeepInstancesOnShutdown = true
+	client, err := nacos.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	// the naming client logs in
+	client.Naming()
+	c.client = client
+	return client, nil
+}
+
+// override returns a copy of the context with the global flags given
+func (c *cli) override(ctx *contextConfig) *contextConfig {
+	o := *ctx
+	if c.set["server"] {
+		o.Servers = splitList(c.servers)
+	}
+	for _, f := range []struct {
+		flag  string
+		field *string
+		value string
+	}{
+		{"namespace", &o.Namespace, c.namespace},
+		{"username", &o.Username, c.username},
+		{"password", &o.Password, c.password},
+		{"access-key", &o.AccessKey, c.accessKey},
+		{"secret-key", &o.SecretKey, c.secretKey},
+		{"app-name", &o.AppName, c.appName},
+		{"protocol", &o.Protocol, c.protocol},
+	} {
+		if c.set[f.flag] {
+			*f.field = f.value
+		}
+	}
+	return &o
+}
+
+func (c *cli) close() {
+	if c.client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		c.client.Naming().Shutdown(ctx)
+		cancel()
+		c.client.Config().Shutdown()
+	}
+	if c.cacheDir != "" {
+		os.RemoveAll(c.cacheDir)
+	}
+}
+
+// splitList splits a comma separated list, dropping the empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseMetadata parses k=v,k=v
+func parseMetadata(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range splitList(s) {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid metadata %q, expected key=value", pair)
+		}
+		m[pair[:i]] = pair[i+1:]
+	}
+	return m, nil
+}
+
+// arg returns the only argument of a command, named name in the error
+func arg(args []string, name string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected %s as the only argument, got %d arguments", name, len(args))
+	}
+	return args[0], nil
+}
+
+// noArgs fails if the command was given arguments
+func noArgs(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %s", strings.Join(args, " "))
+	}
+	return nil
+}
+
+// parseURL splits a server URL into the scheme, host and context path of
+// the client config
+func parseURL(server string) (scheme, host, path string, err error) {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", "", "", err
+	}
+	if u.Host == "" {
+		return "", "", "", fmt.Errorf("invalid server %q", server)
+	}
+	path = strings.TrimSuffix(u.Path, "/")
+	if path == "" {
+		path = "/nacos"
+	}
+	return u.Scheme, u.Host, path, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/litgh/nacos-go-sdk/nacostest"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type CtlSuite struct {
+	server     *nacostest.Server
+	configFile string
+}
+
+var _ = Suite(&CtlSuite{})
+
+func (s *CtlSuite) SetUpTest(c *C) {
+	s.server = nacostest.NewServer(nacostest.Options{Username: "nacos", Password: "secret"})
+	s.configFile = filepath.Join(c.MkDir(), "nacosctl.yaml")
+}
+
+func (s *CtlSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// syncBuffer is written by a command running in another goroutine
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+// connect are the flags connecting to the server
+func (s *CtlSuite) connect() []string {
+	return []string{"--config", s.configFile, "--server", s.server.URL, "--username", "nacos", "--password", "secret"}
+}
+
+// run runs nacosctl connected to the server, and returns its exit code and
+// output
+func (s *CtlSuite) run(c *C, args ...string) (int, string, string) {
+	return s.runWith(context.Background(), "", append(s.connect(), args...)...)
+}
+
+func (s *CtlSuite) runWith(ctx context.Context, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// mustRun fails unless the command succeeds, and returns its output
+func (s *CtlSuite) mustRun(c *C, args ...string) string {
+	code, stdout, stderr := s.run(c, args...)
+	c.Assert(code, Equals, 0, Commentf("%s", stderr))
+	return stdout
+}
+
+func (s *CtlSuite) TestUsage(c *C) {
+	code, _, stderr := s.runWith(context.Background(), "")
+	c.Assert(code, Equals, 2)
+	c.Assert(stderr, Matches, "(?s)usage: nacosctl.*")
+	code, _, stderr = s.run(c, "cluster", "list")
+	c.Assert(code, Equals, 2)
+	c.Assert(stderr, Matches, `(?s)unknown resource "cluster".*`)
+	code, _, stderr = s.run(c, "service", "list", "-o", "xml")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: unknown output format \"xml\", expected table, json or yaml\n")
+	code, _, stderr = s.run(c, "service", "get")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Matches, "error: expected the service name as the only argument.*\n")
+}
+
+func (s *CtlSuite) TestServices(c *C) {
+	c.Assert(s.mustRun(c, "service", "create", "orders", "--metadata", "team=a,tier=1"), Equals, "service DEFAULT_GROUP@@orders created\n")
+	s.mustRun(c, "service", "create", "billing", "--group", "pay")
+	code, _, stderr := s.run(c, "service", "create", "orders")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: specified service already exists, serviceName : DEFAULT_GROUP@@orders\n")
+
+	c.Assert(s.mustRun(c, "service", "list"), Equals, ""+
+		"NAME    GROUP          CLUSTERS  INSTANCES  HEALTHY\n"+
+		"orders  DEFAULT_GROUP  0         0          0\n")
+	// the flags go before or after the arguments
+	s.mustRun(c, "service", "update", "orders", "--protect-threshold", "0.5")
+	var service serviceView
+	c.Assert(json.Unmarshal([]byte(s.mustRun(c, "-o", "json", "service", "get", "orders")), &service), IsNil)
+	c.Assert(service.ProtectThreshold, Equals, 0.5)
+	c.Assert(service.Metadata, DeepEquals, map[string]string{"team": "a", "tier": "1"})
+
+	c.Assert(s.mustRun(c, "service", "get", "--group", "pay", "billing", "-o", "yaml"), Equals, ""+
+		"name: billing\n"+
+		"groupName: pay\n"+
+		"protectThreshold: 0\n"+
+		"clusters: []\n")
+	s.mustRun(c, "service", "delete", "orders")
+	c.Assert(s.mustRun(c, "service", "list"), Equals, "NAME  GROUP  CLUSTERS  INSTANCES  HEALTHY\n")
+}
+
+func (s *CtlSuite) TestInstances(c *C) {
+	c.Assert(s.mustRun(c, "instance", "register", "orders", "--ip", "10.0.0.1", "--port", "80", "--metadata", "zone=a"),
+		Equals, "instance 10.0.0.1:80 of DEFAULT_GROUP@@orders registered\n")
+	s.mustRun(c, "instance", "register", "orders", "--ip", "10.0.0.2", "--port", "80", "--weight", "2")
+	code, _, stderr := s.run(c, "instance", "register", "orders", "--ip", "10.0.0.3")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: --ip and --port are required\n")
+
+	c.Assert(s.mustRun(c, "instance", "list", "orders"), Equals, ""+
+		"IP        PORT  CLUSTER  WEIGHT  HEALTHY  ENABLED  EPHEMERAL  METADATA\n"+
+		"10.0.0.1  80    DEFAULT  1       true     true     false      zone=a\n"+
+		"10.0.0.2  80    DEFAULT  2       true     true     false      \n")
+	// persistent instances outlive nacosctl
+	c.Assert(s.server.Instances("", "", "orders"), HasLen, 2)
+	c.Assert(s.mustRun(c, "service", "list"), Matches, "(?s).*orders  DEFAULT_GROUP  1         2          2\n")
+
+	out := s.mustRun(c, "instance", "watch", "orders", "--count", "1", "-o", "json")
+	var instances []instanceView
+	c.Assert(json.Unmarshal([]byte(out), &instances), IsNil)
+	c.Assert(instances, HasLen, 2)
+	c.Assert(instances[0].Metadata, DeepEquals, map[string]string{"zone": "a"})
+
+	s.mustRun(c, "instance", "deregister", "orders", "--ip", "10.0.0.1", "--port", "80")
+	c.Assert(s.mustRun(c, "instance", "list", "orders", "-o", "yaml"), Equals, ""+
+		"- ip: 10.0.0.2\n"+
+		"  port: 80\n"+
+		"  cluster: DEFAULT\n"+
+		"  weight: 2\n"+
+		"  healthy: true\n"+
+		"  enabled: true\n"+
+		"  ephemeral: false\n")
+}
+
+func (s *CtlSuite) TestConfigs(c *C) {
+	c.Assert(s.mustRun(c, "config", "publish", "app.yaml", "--content", "a: 1"), Equals, "config app.yaml of DEFAULT_GROUP published\n")
+	code, _, _ := s.runWith(context.Background(), "a: 2\nb: true\n", append(s.connect(), "config", "publish", "app.yaml", "--file", "-")...)
+	c.Assert(code, Equals, 0)
+
+	c.Assert(s.mustRun(c, "config", "get", "app.yaml"), Equals, "a: 2\nb: true\n")
+	c.Assert(s.mustRun(c, "config", "get", "app.yaml", "-o", "yaml"), Equals, ""+
+		"dataId: app.yaml\n"+
+		"group: DEFAULT_GROUP\n"+
+		"content: |\n"+
+		"    a: 2\n"+
+		"    b: true\n")
+	c.Assert(s.mustRun(c, "config", "list"), Matches, "DATA-ID +GROUP +TYPE +MD5\napp.yaml +DEFAULT_GROUP +text +[0-9a-f]{32}\n")
+
+	out := s.mustRun(c, "config", "history", "app.yaml")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	c.Assert(lines, HasLen, 3)
+	c.Assert(lines[1], Matches, "2 +U .*")
+	c.Assert(lines[2], Matches, "1 +I .*")
+	c.Assert(s.mustRun(c, "config", "history", "app.yaml", "--id", "1"), Equals, "a: 1\n")
+
+	s.mustRun(c, "config", "delete", "app.yaml")
+	code, _, stderr := s.run(c, "config", "get", "app.yaml")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: config not found\n")
+}
+
+func (s *CtlSuite) TestConfigWatch(c *C) {
+	s.mustRun(c, "config", "publish", "app.yaml", "--content", "a: 1")
+	var stdout, stderr syncBuffer
+	done := make(chan int)
+	go func() {
+		done <- run(context.Background(), append(s.connect(), "config", "watch", "app.yaml", "--count", "2"), nil, &stdout, &stderr)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); stdout.String() == ""; time.Sleep(10 * time.Millisecond) {
+		c.Assert(time.Now().Before(deadline), Equals, true, Commentf("%s", stderr.String()))
+	}
+	s.mustRun(c, "config", "publish", "app.yaml", "--content", "a: 2")
+	select {
+	case code := <-done:
+		c.Assert(code, Equals, 0)
+	case <-time.After(10 * time.Second):
+		c.Fatal("change not received")
+	}
+	c.Assert(stdout.String(), Equals, "a: 1\na: 2\n")
+}
+
+func (s *CtlSuite) TestExportImport(c *C) {
+	s.mustRun(c, "config", "publish", "app.yaml", "--content", "a: 1\n")
+	s.mustRun(c, "config", "publish", "db.yaml", "--group", "infra", "--content", "url: x")
+	file := filepath.Join(c.MkDir(), "export.yaml")
+	c.Assert(s.mustRun(c, "config", "export", "--file", file), Equals, "2 configs exported to "+file+"\n")
+	b, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, ""+
+		"configs:\n"+
+		"    - dataId: app.yaml\n"+
+		"      group: DEFAULT_GROUP\n"+
+		"      content: |\n"+
+		"        a: 1\n"+
+		"    - dataId: db.yaml\n"+
+		"      group: infra\n"+
+		"      content: 'url: x'\n")
+	c.Assert(s.mustRun(c, "config", "export", "--group", "inf*", "--blur", "-o", "json"), Equals, `{
+  "configs": [
+    {
+      "dataId": "db.yaml",
+      "group": "infra",
+      "content": "url: x"
+    }
+  ]
+}
+`)
+
+	s.mustRun(c, "namespace", "create", "Dev", "--id", "dev")
+	c.Assert(s.mustRun(c, "--namespace", "dev", "config", "import", file), Equals, ""+
+		"DATA-ID   GROUP          RESULT\n"+
+		"app.yaml  DEFAULT_GROUP  published\n"+
+		"db.yaml   infra          published\n")
+	content, ok := s.server.Config("dev", "infra", "db.yaml")
+	c.Assert(ok, Equals, true)
+	c.Assert(content, Equals, "url: x")
+
+	s.mustRun(c, "--namespace", "dev", "config", "publish", "app.yaml", "--content", "a: 2")
+	s.mustRun(c, "--namespace", "dev", "config", "import", file, "--overwrite=false")
+	content, _ = s.server.Config("dev", "", "app.yaml")
+	c.Assert(content, Equals, "a: 2")
+}
+
+func (s *CtlSuite) TestNamespaces(c *C) {
+	c.Assert(s.mustRun(c, "namespace", "create", "Dev", "--id", "dev", "--description", "shared"), Equals, "namespace Dev created\n")
+	s.mustRun(c, "--namespace", "dev", "config", "publish", "app.yaml", "--content", "a: 1")
+	s.mustRun(c, "namespace", "update", "dev", "--name", "Development")
+	c.Assert(s.mustRun(c, "ns", "list"), Equals, ""+
+		"ID   NAME         DESCRIPTION  CONFIGS  QUOTA\n"+
+		"     public                    0        200\n"+
+		"dev  Development  shared       1        200\n")
+	code, _, stderr := s.run(c, "namespace", "update", "prod", "--name", "Prod")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: namespace prod not found\n")
+	s.mustRun(c, "namespace", "delete", "dev")
+	c.Assert(s.mustRun(c, "namespace", "list", "-o", "json"), Matches, `(?s)\[\n  \{\n    "namespace": "",\n    "namespaceShowName": "public".*\]\n`)
+}
+
+func (s *CtlSuite) TestContexts(c *C) {
+	code, _, stderr := s.runWith(context.Background(), "", "--config", s.configFile, "service", "list")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: no server, set --server or a context\n")
+
+	c.Assert(s.mustRun(c, "context", "set", "test"), Equals, "context test set\n")
+	s.mustRun(c, "context", "set", "other", "--server", "http://10.0.0.1:8848/nacos", "--namespace", "dev")
+	c.Assert(s.mustRun(c, "context", "list"), Matches, ""+
+		"CURRENT +NAME +SERVERS +NAMESPACE +USERNAME\n"+
+		"\\* +test +"+s.server.URL+" +nacos\n"+
+		" +other +http://10.0.0.1:8848/nacos +dev +nacos\n")
+	c.Assert(s.mustRun(c, "context", "current", "-o", "yaml"), Equals, ""+
+		"name: test\n"+
+		"servers:\n"+
+		"    - "+s.server.URL+"\n"+
+		"username: nacos\n"+
+		"password: '*****'\n")
+
+	// the current context connects without flags
+	code, stdout, stderr := s.runWith(context.Background(), "", "--config", s.configFile, "service", "create", "orders")
+	c.Assert(code, Equals, 0, Commentf("%s", stderr))
+	c.Assert(stdout, Equals, "service DEFAULT_GROUP@@orders created\n")
+
+	s.mustRun(c, "context", "use", "other")
+	code, _, stderr = s.run(c, "context", "use", "prod")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: context prod not found\n")
+	s.mustRun(c, "context", "delete", "other")
+	code, _, stderr = s.run(c, "context", "current")
+	c.Assert(code, Equals, 1)
+	c.Assert(stderr, Equals, "error: no current context\n")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+// namespaceFlags are the flags of the namespace commands
+type namespaceFlags struct {
+	id          string
+	name        string
+	description string
+}
+
+var namespaceCommands = map[string]*command{
+	"list": {run: listNamespaces},
+	"create": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			fs.StringVar(&c.namespaces.id, "id", "", "ID of the namespace, generated by the server if empty")
+			fs.StringVar(&c.namespaces.description, "description", "", "description of the namespace")
+		},
+		run: createNamespace,
+	},
+	"update": {
+		flags: func(c *cli, fs *flag.FlagSet) {
+			fs.StringVar(&c.namespaces.name, "name", "", "new name of the namespace")
+			fs.StringVar(&c.namespaces.description, "description", "", "new description of the namespace")
+		},
+		run: updateNamespace,
+	},
+	"delete": {run: deleteNamespace},
+}
+
+func listNamespaces(c *cli, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	namespaces, err := client.Namespaces().List(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		rows = append(rows, []string{ns.ID, ns.Name, ns.Description, strconv.Itoa(ns.ConfigCount), strconv.Itoa(ns.Quota)})
+	}
+	return c.print(namespaces, []string{"ID", "NAME", "DESCRIPTION", "CONFIGS", "QUOTA"}, rows)
+}
+
+func createNamespace(c *cli, args []string) error {
+	name, err := arg(args, "the namespace name")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	ns := nacos.NamespaceOptions{ID: c.namespaces.id, Name: name, Description: c.namespaces.description}
+	if err := client.Namespaces().Create(ctx, ns); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "namespace %s created\n", name)
+	return nil
+}
+
+// updateNamespace keeps the name or description not given as flags
+func updateNamespace(c *cli, args []string) error {
+	id, err := arg(args, "the namespace id")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	namespaces, err := client.Namespaces().List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, ns := range namespaces {
+		if ns.ID != id {
+			continue
+		}
+		opts := nacos.NamespaceOptions{ID: id, Name: ns.Name, Description: ns.Description}
+		if c.set["name"] {
+			opts.Name = c.namespaces.name
+		}
+		if c.set["description"] {
+			opts.Description = c.namespaces.description
+		}
+		if err := client.Namespaces().Update(ctx, opts); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "namespace %s updated\n", id)
+		return nil
+	}
+	return fmt.Errorf("namespace %s not found", id)
+}
+
+func deleteNamespace(c *cli, args []string) error {
+	id, err := arg(args, "the namespace id")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	if err := client.Namespaces().Delete(ctx, id); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "namespace %s deleted\n", id)
+	return nil
+}
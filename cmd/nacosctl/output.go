@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// print writes v in the output format, the rows under the header for a
+// table
+func (c *cli) print(v interface{}, header []string, rows [][]string) error {
+	return write(c.stdout, c.output, v, header, rows)
+}
+
+// write writes v as JSON or YAML, or the rows under the header as a table
+func write(out io.Writer, format string, v interface{}, header []string, rows [][]string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", b)
+		return err
+	case "yaml":
+		// through JSON, so that both formats share the field names
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(b, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+		if b, err = yaml.Marshal(&node); err != nil {
+			return err
+		}
+		_, err = out.Write(b)
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// blockStyle drops the flow style and quotes of a node read from JSON
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		blockStyle(n)
+	}
+}
+
+// formatMap formats a map as k=v,k=v sorted by key
+func formatMap(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+// serviceFlags are the flags of the service commands
+type serviceFlags struct {
+	group            string
+	protectThreshold float64
+	metadata         string
+	selector         string
+}
+
+func groupFlag(fs *flag.FlagSet, group *string, of string) {
+	fs.StringVar(group, "group", nacos.DefaultGroup, "group of the "+of)
+}
+
+func serviceOptionFlags(c *cli, fs *flag.FlagSet) {
+	groupFlag(fs, &c.service.group, "service")
+	fs.Float64Var(&c.service.protectThreshold, "protect-threshold", 0, "protect threshold, between 0 and 1")
+	fs.StringVar(&c.service.metadata, "metadata", "", "metadata as key=value,key=value")
+	fs.StringVar(&c.service.selector, "selector", "", "label selector expression, such as CONSUMER.label.env = PROVIDER.label.env")
+}
+
+var serviceCommands = map[string]*command{
+	"list":   {flags: func(c *cli, fs *flag.FlagSet) { groupFlag(fs, &c.service.group, "service") }, run: listServices},
+	"get":    {flags: func(c *cli, fs *flag.FlagSet) { groupFlag(fs, &c.service.group, "service") }, run: getService},
+	"create": {flags: serviceOptionFlags, run: createService},
+	"update": {flags: serviceOptionFlags, run: updateService},
+	"delete": {flags: func(c *cli, fs *flag.FlagSet) { groupFlag(fs, &c.service.group, "service") }, run: deleteService},
+}
+
+// serviceView is a service as printed
+type serviceView struct {
+	Name             string            `json:"name"`
+	GroupName        string            `json:"groupName"`
+	ProtectThreshold float64           `json:"protectThreshold"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Selector         string            `json:"selector,omitempty"`
+	Clusters         []string          `json:"clusters"`
+}
+
+func listServices(c *cli, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	it := client.Naming().ServiceIterator(ctx, nacos.ServiceIteratorOptions{GroupName: c.service.group, WithCounts: true})
+	entries := []nacos.ServiceEntry{}
+	var rows [][]string
+	for it.Next() {
+		e := it.Service()
+		entries = append(entries, e)
+		rows = append(rows, []string{e.Name, e.GroupName, strconv.Itoa(e.ClusterCount), strconv.Itoa(e.IPCount), strconv.Itoa(e.HealthyInstanceCount)})
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return c.print(entries, []string{"NAME", "GROUP", "CLUSTERS", "INSTANCES", "HEALTHY"}, rows)
+}
+
+func getService(c *cli, args []string) error {
+	name, err := arg(args, "the service name")
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	s, err := client.Naming().SelectService(nacos.ServiceQueryOptions{ServiceName: name, GroupName: c.service.group})
+	if err != nil {
+		return err
+	}
+	v := serviceView{
+		Name:             s.Name,
+		GroupName:        s.GroupName,
+		ProtectThreshold: s.ProtectThreshold,
+		Metadata:         s.Metadata,
+		Clusters:         []string{},
+	}
+	if v.GroupName == "" {
+		v.GroupName = c.service.group
+	}
+	if s.Selector != nil && s.Selector.Expression != "" {
+		v.Selector = s.Selector.Expression
+	}
+	for cluster := range s.Clusters {
+		v.Clusters = append(v.Clusters, cluster)
+	}
+	sort.Strings(v.Clusters)
+	return c.print(v, []string{"NAME", "GROUP", "PROTECT-THRESHOLD", "CLUSTERS", "METADATA", "SELECTOR"}, [][]string{{
+		v.Name, v.GroupName, strconv.FormatFloat(v.ProtectThreshold, 'f', -1, 64),
+		strings.Join(v.Clusters, ","), formatMap(v.Metadata), v.Selector,
+	}})
+}
+
+func (c *cli) serviceOptions(name string) (nacos.ServiceOptions, error) {
+	opts := nacos.ServiceOptions{
+		ServiceName:      name,
+		GroupName:        c.service.group,
+		ProtectThreshold: c.service.protectThreshold,
+	}
+	if c.service.metadata != "" {
+		m, err := parseMetadata(c.service.metadata)
+		if err != nil {
+			return opts, err
+		}
+		opts.Metadata = nacos.NewMetadata(m)
+	}
+	if c.service.selector != "" {
+		opts.Selector = &nacos.Selector{Type: nacos.SelectorTypeLabel, Expression: c.service.selector}
+	}
+	return opts, nil
+}
+
+func createService(c *cli, args []string) error {
+	return changeService(c, args, "created", nacos.NamingClient.CreateService)
+}
+
+// updateService keeps the options of the service not given as flags
+func updateService(c *cli, args []string) error {
+	return changeService(c, args, "updated", func(naming nacos.NamingClient, opts nacos.ServiceOptions) (*nacos.Response, error) {
+		s, err := naming.SelectService(nacos.ServiceQueryOptions{ServiceName: opts.ServiceName, GroupName: opts.GroupName})
+		if err != nil {
+			return nil, err
+		}
+		if !c.set["protect-threshold"] {
+			opts.ProtectThreshold = s.ProtectThreshold
+		}
+		if !c.set["metadata"] {
+			opts.Metadata = nacos.NewMetadata(s.Metadata)
+		}
+		if !c.set["selector"] {
+			opts.Selector = s.Selector
+		}
+		return naming.UpdateService(opts)
+	})
+}
+
+func deleteService(c *cli, args []string) error {
+	return changeService(c, args, "deleted", nacos.NamingClient.DeleteService)
+}
+
+func changeService(c *cli, args []string, done string, change func(nacos.NamingClient, nacos.ServiceOptions) (*nacos.Response, error)) error {
+	name, err := arg(args, "the service name")
+	if err != nil {
+		return err
+	}
+	opts, err := c.serviceOptions(name)
+	if err != nil {
+		return err
+	}
+	client, err := c.nacos()
+	if err != nil {
+		return err
+	}
+	if _, err := change(client.Naming(), opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "service %s@@%s %s\n", opts.GroupName, name, done)
+	return nil
+}
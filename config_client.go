@@ -1,32 +1,275 @@
 package nacos
 
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
 var _ ConfigClient = new(configClient)
 
+// ErrConfigNotFound is returned for a config that does not exist
+var ErrConfigNotFound = errors.New("config not found")
+
+const (
+	// configListenTimeout bounds one listen round, a long polling request
+	// is held by the server up to this long
+	configListenTimeout = 30 * time.Second
+	configRetryDelay    = 2 * time.Second
+)
+
+type configKey struct {
+	dataID string
+	group  string
+}
+
+// cacheData holds a listened config and the md5 of the content its
+// listeners were last notified with
+type cacheData struct {
+	configKey
+	content   string
+	md5       string
+	listeners []ConfigListener
+}
+
+// configClient keeps listened configs in sync by running listen rounds on
+// the transport: each round blocks until the server reports changed configs,
+// which are then fetched and dispatched to their listeners.
 type configClient struct {
-	c *client
+	sync.Mutex
+	c         *client
+	transport configTransport
+	ctx       context.Context
+	cancel    context.CancelFunc
+	caches    map[configKey]*cacheData
+	listening bool
+	wakeup    chan struct{}
+	// cancels the running listen round, so added configs join the next one
+	cancelRound context.CancelFunc
 }
 
-func (cs *configClient) GetConfig(dataID, group string) string {
-	return ""
+func newConfigClient(c *client) *configClient {
+	cs := &configClient{
+		c:      c,
+		caches: make(map[configKey]*cacheData),
+		wakeup: make(chan struct{}, 1),
+	}
+	cs.ctx, cs.cancel = context.WithCancel(c.ctx)
+	cs.transport = newConfigTransport(c)
+	return cs
 }
-func (cs *configClient) GetConfigAndSignListener(dataID, group string, listener EventListener) string {
-	return ""
+
+func (cs *configClient) tenant() string {
+	return configTenant(cs.c)
 }
-func (cs *configClient) AddListener(dataID, group string, listener EventListener) {
 
+// configTenant returns the tenant of the config API, which names the public
+// namespace by the empty string
+func configTenant(c *client) string {
+	if c.config.Namespace == "public" {
+		return ""
+	}
+	return c.config.Namespace
 }
-func (cs *configClient) PublishConfig(dataID, group, content string) {
 
+func md5Hex(content string) string {
+	if content == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
 }
-func (cs *configClient) RemoveConfig(dataID, group string) {
 
+func (cs *configClient) GetConfig(dataID, group string) (string, error) {
+	if group == "" {
+		group = DefaultGroup
+	}
+	return cs.transport.getConfig(cs.ctx, dataID, group)
+}
+
+func (cs *configClient) GetConfigAndSignListener(dataID, group string, listener ConfigListener) (string, error) {
+	if group == "" {
+		group = DefaultGroup
+	}
+	content, err := cs.transport.getConfig(cs.ctx, dataID, group)
+	if err != nil && err != ErrConfigNotFound {
+		return "", err
+	}
+	cs.addListener(configKey{dataID: dataID, group: group}, listener, &content)
+	return content, err
+}
+
+func (cs *configClient) AddListener(dataID, group string, listener ConfigListener) error {
+	if group == "" {
+		group = DefaultGroup
+	}
+	cs.addListener(configKey{dataID: dataID, group: group}, listener, nil)
+	return nil
+}
+
+// addListener adds a listener to a config, content is the content known to
+// the listener if any. A listener added to a config already fetched is
+// notified with its content before joining the other listeners, so no older
+// content reaches it after a newer one; otherwise it is notified with the
+// current content by the next listen round
+func (cs *configClient) addListener(key configKey, listener ConfigListener, content *string) {
+	cs.Lock()
+	defer cs.Unlock()
+	cache, ok := cs.caches[key]
+	for ok && cache.md5 != "" && (content == nil || *content != cache.content) {
+		known := cache.content
+		content = &known
+		cs.Unlock()
+		cs.notify(listener, key, known)
+		cs.Lock()
+		cache, ok = cs.caches[key]
+	}
+	if !ok {
+		cache = &cacheData{configKey: key}
+		if content != nil {
+			cache.content = *content
+			cache.md5 = md5Hex(*content)
+		}
+		cs.caches[key] = cache
+	}
+	cache.listeners = append(cache.listeners, listener)
+	if !cs.listening {
+		cs.listening = true
+		go cs.listen()
+	}
+	if !ok {
+		if cs.cancelRound != nil {
+			cs.cancelRound()
+		}
+		select {
+		case cs.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (cs *configClient) PublishConfig(dataID, group, content string) error {
+	if group == "" {
+		group = DefaultGroup
+	}
+	if content == "" {
+		return errors.New("ERR: content is required")
+	}
+	return cs.transport.publishConfig(cs.ctx, dataID, group, content)
 }
-func (cs *configClient) RemoveListener(dataID, group string) {
 
+func (cs *configClient) RemoveConfig(dataID, group string) error {
+	if group == "" {
+		group = DefaultGroup
+	}
+	return cs.transport.removeConfig(cs.ctx, dataID, group)
 }
+
+func (cs *configClient) RemoveListener(dataID, group string) {
+	if group == "" {
+		group = DefaultGroup
+	}
+	key := configKey{dataID: dataID, group: group}
+	cs.Lock()
+	_, ok := cs.caches[key]
+	delete(cs.caches, key)
+	cs.Unlock()
+	if !ok {
+		return
+	}
+	if err := cs.transport.unlisten(cs.ctx, key); err != nil {
+		cs.c.logger.Warn("failed to stop listening %s %s, %v", dataID, group, err)
+	}
+}
+
 func (cs *configClient) GetServerStatus() string {
-	return ""
+	return newOperatorClient(cs.c).serverStatus(cs.c.ctx)
 }
+
 func (cs *configClient) Shutdown() {
+	cs.cancel()
+	cs.transport.close()
+}
+
+func (cs *configClient) listen() {
+	for {
+		cs.Lock()
+		contexts := make([]configListenContext, 0, len(cs.caches))
+		for _, cache := range cs.caches {
+			contexts = append(contexts, configListenContext{
+				DataID: cache.dataID,
+				Group:  cache.group,
+				Tenant: cs.tenant(),
+				MD5:    cache.md5,
+			})
+		}
+		ctx, cancel := context.WithCancel(cs.ctx)
+		cs.cancelRound = cancel
+		cs.Unlock()
+
+		if len(contexts) == 0 {
+			select {
+			case <-cs.wakeup:
+				cancel()
+				continue
+			case <-cs.ctx.Done():
+				cancel()
+				return
+			}
+		}
+		changed, err := cs.transport.listen(ctx, contexts)
+		roundCanceled := ctx.Err() != nil
+		cancel()
+		if cs.ctx.Err() != nil {
+			return
+		}
+		if err != nil && !roundCanceled {
+			cs.c.logger.Error("failed to listen configs, %v", err)
+			select {
+			case <-time.After(configRetryDelay):
+			case <-cs.ctx.Done():
+				return
+			}
+			continue
+		}
+		for _, key := range changed {
+			cs.refresh(key)
+		}
+	}
+}
+
+// refresh fetches a changed config and notifies its listeners if the
+// content differs from the one they know
+func (cs *configClient) refresh(key configKey) {
+	content, err := cs.transport.getConfig(cs.ctx, key.dataID, key.group)
+	if err != nil && err != ErrConfigNotFound {
+		cs.c.logger.Error("failed to get config %s %s, %v", key.dataID, key.group, err)
+		return
+	}
+	sum := md5Hex(content)
+	cs.Lock()
+	cache, ok := cs.caches[key]
+	if !ok || cache.md5 == sum {
+		cs.Unlock()
+		return
+	}
+	cache.content = content
+	cache.md5 = sum
+	listeners := append([]ConfigListener(nil), cache.listeners...)
+	cs.Unlock()
+	for _, listener := range listeners {
+		cs.notify(listener, key, content)
+	}
+}
 
+func (cs *configClient) notify(listener ConfigListener, key configKey, content string) {
+	defer func() {
+		if r := recover(); r != nil {
+			cs.c.logger.Error("config listener of %s %s panicked, %v", key.dataID, key.group, r)
+		}
+	}()
+	listener.OnChange(cs.c.config.Namespace, key.group, key.dataID, content)
 }
@@ -0,0 +1,330 @@
+package nacos
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type configFunc func(namespace, group, dataID, content string)
+
+func (f configFunc) OnChange(namespace, group, dataID, content string) {
+	f(namespace, group, dataID, content)
+}
+
+// configStore holds configs for the stand-in servers
+type configStore struct {
+	sync.Mutex
+	configs map[string]string
+	changed chan struct{}
+}
+
+func newConfigStore() *configStore {
+	return &configStore{configs: make(map[string]string), changed: make(chan struct{})}
+}
+
+func (s *configStore) get(dataID, group string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	content, ok := s.configs[dataID+"+"+group]
+	return content, ok
+}
+
+func (s *configStore) put(dataID, group, content string) {
+	s.Lock()
+	defer s.Unlock()
+	if content == "" {
+		delete(s.configs, dataID+"+"+group)
+	} else {
+		s.configs[dataID+"+"+group] = content
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *configStore) changes() <-chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+	return s.changed
+}
+
+type ConfigSuite struct {
+	srv   *httptest.Server
+	store *configStore
+	cs    *configClient
+	form  url.Values
+}
+
+var _ = Suite(&ConfigSuite{})
+
+func (s *ConfigSuite) SetUpTest(c *C) {
+	s.store = newConfigStore()
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.URL.Path == "/nacos/v1/cs/configs" && r.Method == GET:
+			content, ok := s.store.get(r.Form.Get("dataId"), r.Form.Get("group"))
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("config data not exist"))
+				return
+			}
+			w.Write([]byte(content))
+		case r.URL.Path == "/nacos/v1/cs/configs" && r.Method == POST:
+			s.form = r.Form
+			s.store.put(r.Form.Get("dataId"), r.Form.Get("group"), r.Form.Get("content"))
+			w.Write([]byte("true"))
+		case r.URL.Path == "/nacos/v1/cs/configs" && r.Method == DELETE:
+			s.store.put(r.Form.Get("dataId"), r.Form.Get("group"), "")
+			w.Write([]byte("true"))
+		case r.URL.Path == "/nacos/v1/cs/configs/listener":
+			changes := s.store.changes()
+			for {
+				var changed []string
+				for _, line := range strings.Split(r.Form.Get("Listening-Configs"), "\x01") {
+					fields := strings.Split(line, "\x02")
+					if len(fields) < 3 {
+						continue
+					}
+					content, _ := s.store.get(fields[0], fields[1])
+					if md5Hex(content) != fields[2] {
+						changed = append(changed, fields[0]+"\x02"+fields[1]+"\x01")
+					}
+				}
+				if len(changed) > 0 {
+					w.Write([]byte(url.QueryEscape(strings.Join(changed, ""))))
+					return
+				}
+				select {
+				case <-changes:
+					changes = s.store.changes()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+	}))
+	u, _ := url.Parse(s.srv.URL)
+	ns := newOfflineNamingClient(c)
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.Namespace = "public"
+	ns.c.config.HttpClient = DefaultPooledClient()
+	s.cs = newConfigClient(ns.c)
+}
+
+func (s *ConfigSuite) TearDownTest(c *C) {
+	s.cs.Shutdown()
+	s.cs.c.cancel()
+	s.srv.Close()
+}
+
+func (s *ConfigSuite) TestGetPublishRemove(c *C) {
+	_, err := s.cs.GetConfig("app.yaml", "")
+	c.Assert(err, Equals, ErrConfigNotFound)
+
+	c.Assert(s.cs.PublishConfig("app.yaml", "", `{"code":1,"data":"x"}`), IsNil)
+	c.Assert(s.form.Get("group"), Equals, DefaultGroup)
+	c.Assert(s.form.Get("tenant"), Equals, "")
+	content, err := s.cs.GetConfig("app.yaml", "")
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, `{"code":1,"data":"x"}`)
+
+	c.Assert(s.cs.RemoveConfig("app.yaml", ""), IsNil)
+	_, err = s.cs.GetConfig("app.yaml", "")
+	c.Assert(err, Equals, ErrConfigNotFound)
+}
+
+func (s *ConfigSuite) TestListen(c *C) {
+	testConfigListen(c, s.cs, s.store)
+}
+
+// testConfigListen checks a listener is notified with the current content
+// and then with every change, on any transport
+func testConfigListen(c *C, cs *configClient, store *configStore) {
+	store.put("app.yaml", DefaultGroup, "a: 1")
+	changes := make(chan string, 4)
+	c.Assert(cs.AddListener("app.yaml", "", configFunc(func(namespace, group, dataID, content string) {
+		changes <- dataID + ":" + content
+	})), IsNil)
+	expect := func(change string) {
+		select {
+		case got := <-changes:
+			c.Assert(got, Equals, change)
+		case <-time.After(2 * time.Second):
+			c.Fatalf("%s not notified", change)
+		}
+	}
+	expect("app.yaml:a: 1")
+
+	c.Assert(cs.PublishConfig("app.yaml", "", "a: 2"), IsNil)
+	expect("app.yaml:a: 2")
+
+	content, err := cs.GetConfigAndSignListener("db.yaml", "", configFunc(func(namespace, group, dataID, content string) {
+		changes <- dataID + ":" + content
+	}))
+	c.Assert(err, Equals, ErrConfigNotFound)
+	c.Assert(content, Equals, "")
+	c.Assert(cs.PublishConfig("db.yaml", "", "url: x"), IsNil)
+	expect("db.yaml:url: x")
+
+	c.Assert(cs.RemoveConfig("app.yaml", ""), IsNil)
+	expect("app.yaml:")
+
+	cs.RemoveListener("app.yaml", "")
+	c.Assert(cs.PublishConfig("app.yaml", "", "a: 3"), IsNil)
+	select {
+	case got := <-changes:
+		c.Fatalf("unexpected %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (s *ConfigSuite) TestSecondListener(c *C) {
+	s.store.put("app.yaml", DefaultGroup, "a: 1")
+	first := make(chan string, 4)
+	c.Assert(s.cs.AddListener("app.yaml", "", configFunc(func(namespace, group, dataID, content string) {
+		first <- content
+	})), IsNil)
+	expect := func(changes chan string, content string) {
+		select {
+		case got := <-changes:
+			c.Assert(got, Equals, content)
+		case <-time.After(2 * time.Second):
+			c.Fatalf("%s not notified", content)
+		}
+	}
+	expect(first, "a: 1")
+
+	second := make(chan string, 4)
+	c.Assert(s.cs.AddListener("app.yaml", "", configFunc(func(namespace, group, dataID, content string) {
+		second <- content
+	})), IsNil)
+	expect(second, "a: 1")
+
+	// a listener knowing the content is not notified again
+	third := make(chan string, 4)
+	content, err := s.cs.GetConfigAndSignListener("app.yaml", "", configFunc(func(namespace, group, dataID, content string) {
+		third <- content
+	}))
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "a: 1")
+
+	c.Assert(s.cs.PublishConfig("app.yaml", "", "a: 2"), IsNil)
+	expect(first, "a: 2")
+	expect(second, "a: 2")
+	expect(third, "a: 2")
+	c.Assert(first, HasLen, 0)
+	c.Assert(second, HasLen, 0)
+	c.Assert(third, HasLen, 0)
+}
+
+type GrpcConfigSuite struct {
+	standIn *grpcStandIn
+	store   *configStore
+	cs      *configClient
+}
+
+var _ = Suite(&GrpcConfigSuite{})
+
+func (s *GrpcConfigSuite) SetUpTest(c *C) {
+	s.store = newConfigStore()
+	s.standIn = newGrpcStandIn(c)
+	s.standIn.handle("ConfigQueryRequest", func(p *payload) interface{} {
+		var req configRequest
+		json.Unmarshal(p.Body, &req)
+		content, ok := s.store.get(req.DataID, req.Group)
+		if !ok {
+			return &grpcResponse{ResultCode: 500, ErrorCode: codeConfigNotFound, Message: "config data not exist"}
+		}
+		return map[string]interface{}{"resultCode": 200, "content": content, "md5": md5Hex(content)}
+	})
+	update := func(p *payload, remove bool) interface{} {
+		var req configRequest
+		json.Unmarshal(p.Body, &req)
+		if remove {
+			req.Content = ""
+		}
+		s.store.put(req.DataID, req.Group, req.Content)
+		go s.standIn.push("ConfigChangeNotifyRequest", map[string]interface{}{"dataId": req.DataID, "group": req.Group, "tenant": req.Tenant})
+		return nil
+	}
+	s.standIn.handle("ConfigPublishRequest", func(p *payload) interface{} { return update(p, false) })
+	s.standIn.handle("ConfigRemoveRequest", func(p *payload) interface{} { return update(p, true) })
+	s.standIn.handle("ConfigBatchListenRequest", func(p *payload) interface{} {
+		var req configBatchListenRequest
+		json.Unmarshal(p.Body, &req)
+		var changed []configListenContext
+		for _, ctx := range req.ConfigListenContexts {
+			content, _ := s.store.get(ctx.DataID, ctx.Group)
+			if req.Listen && md5Hex(content) != ctx.MD5 {
+				changed = append(changed, ctx)
+			}
+		}
+		return map[string]interface{}{"resultCode": 200, "changedConfigs": changed}
+	})
+
+	ns := newOfflineNamingClient(c)
+	ns.c.config.Protocol = ProtocolGRPC
+	ns.c.config.Hosts = []string{s.standIn.host()}
+	s.cs = newConfigClient(ns.c)
+}
+
+func (s *GrpcConfigSuite) TearDownTest(c *C) {
+	s.cs.Shutdown()
+	s.cs.c.cancel()
+	s.standIn.stop()
+}
+
+func (s *GrpcConfigSuite) TestGetPublishRemove(c *C) {
+	_, err := s.cs.GetConfig("app.yaml", "")
+	c.Assert(err, Equals, ErrConfigNotFound)
+	c.Assert(s.cs.PublishConfig("app.yaml", "", "a: 1"), IsNil)
+	content, err := s.cs.GetConfig("app.yaml", "")
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "a: 1")
+	c.Assert(s.cs.RemoveConfig("app.yaml", ""), IsNil)
+	_, err = s.cs.GetConfig("app.yaml", "")
+	c.Assert(err, Equals, ErrConfigNotFound)
+}
+
+func (s *GrpcConfigSuite) TestListen(c *C) {
+	testConfigListen(c, s.cs, s.store)
+	var unlistened []interface{}
+	for _, req := range s.standIn.received("ConfigBatchListenRequest") {
+		if req["listen"] == false {
+			unlistened = append(unlistened, req["configListenContexts"])
+		}
+	}
+	c.Assert(unlistened, HasLen, 1)
+	c.Assert(encode(unlistened[0]), Equals, `[{"dataId":"app.yaml","group":"DEFAULT_GROUP","md5":"","tenant":""}]`)
+}
+
+func (s *GrpcConfigSuite) TestServersFromEndpoint(c *C) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/nacos/serverlist")
+		w.Write([]byte(s.standIn.host()))
+	}))
+	defer endpoint.Close()
+	u, _ := url.Parse(endpoint.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Protocol = ProtocolGRPC
+	ns.c.config.Endpoint = u.Host
+	ns.c.config.HttpClient = DefaultPooledClient()
+	cs := newConfigClient(ns.c)
+	defer cs.Shutdown()
+
+	s.store.put("app.yaml", DefaultGroup, "a: 1")
+	content, err := cs.GetConfig("app.yaml", "")
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "a: 1")
+	c.Assert(ns.c.getServerList(), DeepEquals, []string{s.standIn.host()})
+}
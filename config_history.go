@@ -0,0 +1,178 @@
+package nacos
+
+import (
+	"context"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ConfigSearchOptions select the configs listed by SearchConfigs, empty
+// fields match every config
+type ConfigSearchOptions struct {
+	Page int
+	Size int
+	// matched exactly, or with * wildcards when Blur is set
+	DataID string
+	// matched exactly, or with * wildcards when Blur is set
+	Group string
+	Blur  bool
+}
+
+// ConfigItem is a config listed by SearchConfigs
+type ConfigItem struct {
+	ID      string `json:"id"`
+	DataID  string `json:"dataId"`
+	Group   string `json:"group"`
+	Content string `json:"content"`
+	MD5     string `json:"md5"`
+	Tenant  string `json:"tenant"`
+	AppName string `json:"appName"`
+	Type    string `json:"type"`
+}
+
+// ConfigList is one page of configs
+type ConfigList struct {
+	Count   int           `json:"totalCount"`
+	Configs []*ConfigItem `json:"pageItems"`
+}
+
+// ConfigHistoryOptions select the config whose changes History lists
+type ConfigHistoryOptions struct {
+	Page   int
+	Size   int
+	DataID string
+	Group  string
+}
+
+// ConfigHistoryItem is a past change of a config, the content is only
+// returned by HistoryDetail
+type ConfigHistoryItem struct {
+	ID      string `json:"id"`
+	DataID  string `json:"dataId"`
+	Group   string `json:"group"`
+	Tenant  string `json:"tenant"`
+	AppName string `json:"appName"`
+	MD5     string `json:"md5"`
+	Content string `json:"content"`
+	SrcIP   string `json:"srcIp"`
+	SrcUser string `json:"srcUser"`
+	// I, U or D for an insert, an update or a delete
+	OpType           string `json:"opType"`
+	CreatedTime      string `json:"createdTime"`
+	LastModifiedTime string `json:"lastModifiedTime"`
+}
+
+// ConfigHistoryList is one page of config changes
+type ConfigHistoryList struct {
+	Count   int                  `json:"totalCount"`
+	Changes []*ConfigHistoryItem `json:"pageItems"`
+}
+
+// the servers send ids as numbers or as strings depending on their version
+type configItemJSON struct {
+	ConfigItem
+	ID jsoniter.Number `json:"id"`
+}
+
+type configHistoryItemJSON struct {
+	ConfigHistoryItem
+	ID jsoniter.Number `json:"id"`
+}
+
+func (h *configHistoryItemJSON) item() *ConfigHistoryItem {
+	item := h.ConfigHistoryItem
+	item.ID = h.ID.String()
+	return &item
+}
+
+func setPage(r *Request, page, size int) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+	r.params.Set("pageNo", strconv.Itoa(page))
+	r.params.Set("pageSize", strconv.Itoa(size))
+}
+
+// call goes over the HTTP API, whatever the transport of the listeners
+func (cs *configClient) call(r *Request, out interface{}) error {
+	if tenant := cs.tenant(); tenant != "" {
+		r.params.Set("tenant", tenant)
+	}
+	rs, err := callServer(cs.c, r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(rs.Data), out)
+}
+
+func (cs *configClient) newRequest(ctx context.Context, method, path string) *Request {
+	return (&httpConfigTransport{c: cs.c}).newRequest(ctx, method, path)
+}
+
+func (cs *configClient) SearchConfigs(ctx context.Context, q ConfigSearchOptions) (*ConfigList, error) {
+	r := cs.newRequest(ctx, GET, "/configs")
+	if q.Blur {
+		r.params.Set("search", "blur")
+	} else {
+		r.params.Set("search", "accurate")
+	}
+	r.params.Set("dataId", q.DataID)
+	r.params.Set("group", q.Group)
+	setPage(r, q.Page, q.Size)
+	var page struct {
+		Count   int               `json:"totalCount"`
+		Configs []*configItemJSON `json:"pageItems"`
+	}
+	if err := cs.call(r, &page); err != nil {
+		return nil, err
+	}
+	list := &ConfigList{Count: page.Count, Configs: make([]*ConfigItem, 0, len(page.Configs))}
+	for _, c := range page.Configs {
+		item := c.ConfigItem
+		item.ID = c.ID.String()
+		list.Configs = append(list.Configs, &item)
+	}
+	return list, nil
+}
+
+func (cs *configClient) History(ctx context.Context, q ConfigHistoryOptions) (*ConfigHistoryList, error) {
+	if q.Group == "" {
+		q.Group = DefaultGroup
+	}
+	r := cs.newRequest(ctx, GET, "/history")
+	r.params.Set("search", "accurate")
+	r.params.Set("dataId", q.DataID)
+	r.params.Set("group", q.Group)
+	setPage(r, q.Page, q.Size)
+	var page struct {
+		Count   int                      `json:"totalCount"`
+		Changes []*configHistoryItemJSON `json:"pageItems"`
+	}
+	if err := cs.call(r, &page); err != nil {
+		return nil, err
+	}
+	list := &ConfigHistoryList{Count: page.Count, Changes: make([]*ConfigHistoryItem, 0, len(page.Changes))}
+	for _, c := range page.Changes {
+		list.Changes = append(list.Changes, c.item())
+	}
+	return list, nil
+}
+
+func (cs *configClient) HistoryDetail(ctx context.Context, dataID, group, id string) (*ConfigHistoryItem, error) {
+	if group == "" {
+		group = DefaultGroup
+	}
+	r := cs.newRequest(ctx, GET, "/history")
+	r.params.Set("nid", id)
+	r.params.Set("dataId", dataID)
+	r.params.Set("group", group)
+	var change configHistoryItemJSON
+	if err := cs.call(r, &change); err != nil {
+		return nil, err
+	}
+	return change.item(), nil
+}
@@ -0,0 +1,289 @@
+package nacos
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configTransport carries the calls of the config client, over the 1.x
+// HTTP API with long polling or over a 2.x gRPC connection with pushes
+type configTransport interface {
+	getConfig(ctx context.Context, dataID, group string) (string, error)
+
+	publishConfig(ctx context.Context, dataID, group, content string) error
+
+	removeConfig(ctx context.Context, dataID, group string) error
+
+	// listen blocks until some of the configs differ from the md5 given,
+	// configListenTimeout elapses or ctx is done, and returns the changed
+	// ones
+	listen(ctx context.Context, contexts []configListenContext) ([]configKey, error)
+
+	unlisten(ctx context.Context, key configKey) error
+
+	close()
+}
+
+var (
+	_ configTransport = new(httpConfigTransport)
+	_ configTransport = new(grpcConfigTransport)
+)
+
+type configListenContext struct {
+	DataID string `json:"dataId"`
+	Group  string `json:"group"`
+	Tenant string `json:"tenant"`
+	MD5    string `json:"md5"`
+}
+
+func newConfigTransport(c *client) configTransport {
+	if c.config.Protocol == ProtocolGRPC {
+		return newGrpcConfigTransport(c)
+	}
+	return &httpConfigTransport{c: c}
+}
+
+type httpConfigTransport struct {
+	c *client
+}
+
+func (t *httpConfigTransport) newRequest(ctx context.Context, method, path string) *Request {
+	return &Request{
+		config: &t.c.config,
+		method: method,
+		path:   "/v1/cs" + path,
+		params: make(url.Values),
+		header: make(http.Header),
+		ctx:    ctx,
+	}
+}
+
+func (t *httpConfigTransport) getConfig(ctx context.Context, dataID, group string) (string, error) {
+	r := t.newRequest(ctx, GET, "/configs")
+	r.params.Set("dataId", dataID)
+	r.params.Set("group", group)
+	if tenant := configTenant(t.c); tenant != "" {
+		r.params.Set("tenant", tenant)
+	}
+	resp, err := t.c.DoRequest(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	// the content is returned as is, it must not go through decode
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return string(b), nil
+	case http.StatusNotFound:
+		return "", ErrConfigNotFound
+	}
+	return "", errors.New(string(b))
+}
+
+func (t *httpConfigTransport) publishConfig(ctx context.Context, dataID, group, content string) error {
+	r := t.newRequest(ctx, POST, "/configs")
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form := make(url.Values)
+	form.Set("dataId", dataID)
+	form.Set("group", group)
+	form.Set("content", content)
+	if tenant := configTenant(t.c); tenant != "" {
+		form.Set("tenant", tenant)
+	}
+	r.body = strings.NewReader(form.Encode())
+	_, err := callServer(t.c, r)
+	return err
+}
+
+func (t *httpConfigTransport) removeConfig(ctx context.Context, dataID, group string) error {
+	r := t.newRequest(ctx, DELETE, "/configs")
+	r.params.Set("dataId", dataID)
+	r.params.Set("group", group)
+	if tenant := configTenant(t.c); tenant != "" {
+		r.params.Set("tenant", tenant)
+	}
+	_, err := callServer(t.c, r)
+	return err
+}
+
+// listen long polls the configs, the server answers once one of them changed
+// or the timeout elapsed with the changed keys, URL encoded as
+// dataId%02group[%02tenant]%01...
+func (t *httpConfigTransport) listen(ctx context.Context, contexts []configListenContext) ([]configKey, error) {
+	var b strings.Builder
+	for _, c := range contexts {
+		b.WriteString(c.DataID)
+		b.WriteByte(2)
+		b.WriteString(c.Group)
+		b.WriteByte(2)
+		b.WriteString(c.MD5)
+		if c.Tenant != "" {
+			b.WriteByte(2)
+			b.WriteString(c.Tenant)
+		}
+		b.WriteByte(1)
+	}
+	r := t.newRequest(ctx, POST, "/configs/listener")
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.header.Set("Long-Pulling-Timeout", strconv.FormatInt(configListenTimeout.Milliseconds(), 10))
+	form := make(url.Values)
+	form.Set("Listening-Configs", b.String())
+	r.body = strings.NewReader(form.Encode())
+	rs, err := callServer(t.c, r)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := url.QueryUnescape(strings.TrimSpace(rs.Data))
+	if err != nil {
+		return nil, err
+	}
+	var keys []configKey
+	for _, line := range strings.Split(changed, "\x01") {
+		fields := strings.Split(line, "\x02")
+		if len(fields) < 2 {
+			continue
+		}
+		keys = append(keys, configKey{dataID: fields[0], group: fields[1]})
+	}
+	return keys, nil
+}
+
+func (t *httpConfigTransport) unlisten(ctx context.Context, key configKey) error {
+	return nil
+}
+
+func (t *httpConfigTransport) close() {
+}
+
+// grpcConfigTransport listens configs by a batch listen request, the server
+// then pushes a ConfigChangeNotifyRequest for each change. A reconnect ends
+// the listen round, the next one listens on the new connection.
+type grpcConfigTransport struct {
+	c       *client
+	gc      *grpcClient
+	changes chan configKey
+	resync  chan struct{}
+}
+
+func newGrpcConfigTransport(c *client) *grpcConfigTransport {
+	t := &grpcConfigTransport{
+		c:       c,
+		gc:      newGrpcClient(c, grpcModuleConfig, c.getServerList),
+		changes: make(chan configKey, 64),
+		resync:  make(chan struct{}, 1),
+	}
+	t.gc.handle("ConfigChangeNotifyRequest", t.onChange)
+	t.gc.onReconnected(func() {
+		select {
+		case t.resync <- struct{}{}:
+		default:
+		}
+	})
+	return t
+}
+
+const codeConfigNotFound = 300
+
+type configRequest struct {
+	DataID  string `json:"dataId"`
+	Group   string `json:"group"`
+	Tenant  string `json:"tenant"`
+	Content string `json:"content,omitempty"`
+}
+
+type configBatchListenRequest struct {
+	Listen               bool                  `json:"listen"`
+	ConfigListenContexts []configListenContext `json:"configListenContexts"`
+}
+
+func (t *grpcConfigTransport) getConfig(ctx context.Context, dataID, group string) (string, error) {
+	var resp struct {
+		grpcResponse
+		Content string `json:"content"`
+	}
+	err := t.gc.request(ctx, "ConfigQueryRequest", &configRequest{DataID: dataID, Group: group, Tenant: configTenant(t.c)}, &resp)
+	if e, ok := err.(*grpcError); ok && e.code == codeConfigNotFound {
+		return "", ErrConfigNotFound
+	}
+	return resp.Content, err
+}
+
+func (t *grpcConfigTransport) publishConfig(ctx context.Context, dataID, group, content string) error {
+	return t.gc.request(ctx, "ConfigPublishRequest", &configRequest{DataID: dataID, Group: group, Tenant: configTenant(t.c), Content: content}, nil)
+}
+
+func (t *grpcConfigTransport) removeConfig(ctx context.Context, dataID, group string) error {
+	return t.gc.request(ctx, "ConfigRemoveRequest", &configRequest{DataID: dataID, Group: group, Tenant: configTenant(t.c)}, nil)
+}
+
+func (t *grpcConfigTransport) listen(ctx context.Context, contexts []configListenContext) ([]configKey, error) {
+	var resp struct {
+		grpcResponse
+		ChangedConfigs []configListenContext `json:"changedConfigs"`
+	}
+	err := t.gc.request(ctx, "ConfigBatchListenRequest", &configBatchListenRequest{Listen: true, ConfigListenContexts: contexts}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	var keys []configKey
+	for _, c := range resp.ChangedConfigs {
+		keys = append(keys, configKey{dataID: c.DataID, group: c.Group})
+	}
+	if len(keys) > 0 {
+		return keys, nil
+	}
+	timer := time.NewTimer(configListenTimeout)
+	defer timer.Stop()
+	select {
+	case key := <-t.changes:
+		keys = append(keys, key)
+	case <-timer.C:
+		return nil, nil
+	case <-t.resync:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, nil
+	}
+	for {
+		select {
+		case key := <-t.changes:
+			keys = append(keys, key)
+		default:
+			return keys, nil
+		}
+	}
+}
+
+func (t *grpcConfigTransport) unlisten(ctx context.Context, key configKey) error {
+	return t.gc.request(ctx, "ConfigBatchListenRequest", &configBatchListenRequest{
+		ConfigListenContexts: []configListenContext{{DataID: key.dataID, Group: key.group, Tenant: configTenant(t.c)}},
+	}, nil)
+}
+
+func (t *grpcConfigTransport) onChange(body []byte) string {
+	var req configRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.c.logger.Error("failed to process pushed config change, %v", err)
+	} else {
+		select {
+		case t.changes <- configKey{dataID: req.DataID, group: req.Group}:
+		default:
+			// the next listen round compares every md5 again
+		}
+	}
+	return "ConfigChangeNotifyResponse"
+}
+
+func (t *grpcConfigTransport) close() {
+	t.gc.close()
+}
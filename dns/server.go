@@ -0,0 +1,264 @@
+// Package dns answers DNS queries for the instances of Nacos services, for
+// tools that only speak DNS. Services are named
+//
+//	<service>.<group>.<namespace>.nacos.
+//
+// and answered with A, AAAA and SRV records of their healthy and enabled
+// instances, taken from the subscribed services of the naming client of the
+// namespace; answers keep coming from the cache, or the failover snapshot,
+// while Nacos is unreachable. The TTL is the CacheMillis of the service.
+//
+// The target of a SRV record is the address of the instance encoded as
+// <ip>.addr.nacos., with dashes for the dots of an IPv4 address or 32 hex
+// digits for an IPv6 one; its A or AAAA record is added to the answer.
+package dns
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultAddr is the address listened on when Server.Addr is empty
+	DefaultAddr = "127.0.0.1:8600"
+	// Domain is the domain of the names answered
+	Domain = "nacos."
+
+	addrDomain = "addr." + Domain
+	// udpSize is the size of a response over UDP without EDNS
+	udpSize = 512
+)
+
+// Server is a DNS server over UDP
+type Server struct {
+	// Addr is the UDP address to listen on, DefaultAddr if empty
+	Addr string
+	// Naming maps each namespace answered to its naming client, names of
+	// other namespaces do not exist
+	Naming map[string]nacos.NamingClient
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	closed bool
+}
+
+// ListenAndServe listens on Addr and serves queries until Close
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve serves queries received on conn until Close, each in its goroutine
+// as answering may subscribe the service first
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return errors.New("dns server closed")
+	}
+	s.conn = conn
+	s.mu.Unlock()
+	buf := make([]byte, math.MaxUint16)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := s.answer(query); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+// Close stops serving
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// answer returns the packed response to a query, nil if it cannot be parsed
+func (s *Server) answer(query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil || h.Response {
+		return nil
+	}
+	resp := dnsmessage.Message{Header: dnsmessage.Header{
+		ID:               h.ID,
+		Response:         true,
+		OpCode:           h.OpCode,
+		Authoritative:    true,
+		RecursionDesired: h.RecursionDesired,
+	}}
+	q, err := p.Question()
+	if err != nil {
+		resp.RCode = dnsmessage.RCodeFormatError
+		b, _ := resp.Pack()
+		return b
+	}
+	resp.Questions = []dnsmessage.Question{q}
+	size := udpSize
+	if p.SkipAllQuestions() == nil && p.SkipAllAnswers() == nil && p.SkipAllAuthorities() == nil {
+		if additionals, err := p.AllAdditionals(); err == nil {
+			for _, r := range additionals {
+				if r.Header.Type == dnsmessage.TypeOPT && int(r.Header.Class) > size {
+					size = int(r.Header.Class)
+				}
+			}
+		}
+	}
+	if h.OpCode != 0 {
+		resp.RCode = dnsmessage.RCodeNotImplemented
+	} else {
+		resp.RCode, resp.Answers, resp.Additionals = s.resolve(q)
+	}
+	b, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	if len(b) > size {
+		resp.Truncated = true
+		resp.Answers, resp.Additionals = nil, nil
+		b, _ = resp.Pack()
+	}
+	return b
+}
+
+func (s *Server) resolve(q dnsmessage.Question) (dnsmessage.RCode, []dnsmessage.Resource, []dnsmessage.Resource) {
+	name := q.Name.String()
+	lower := strings.ToLower(name)
+	if !strings.HasSuffix(lower, "."+Domain) {
+		return dnsmessage.RCodeRefused, nil, nil
+	}
+	if strings.HasSuffix(lower, "."+addrDomain) {
+		ip := decodeIP(name[:len(name)-len(addrDomain)-1])
+		if ip == nil {
+			return dnsmessage.RCodeNameError, nil, nil
+		}
+		var answers []dnsmessage.Resource
+		if r, ok := addressRecord(q.Name, ip, 0, q.Type); ok {
+			answers = append(answers, r)
+		}
+		return dnsmessage.RCodeSuccess, answers, nil
+	}
+
+	labels := strings.Split(name[:len(name)-len(Domain)-1], ".")
+	if len(labels) < 3 {
+		return dnsmessage.RCodeNameError, nil, nil
+	}
+	namespace := labels[len(labels)-1]
+	groupName := labels[len(labels)-2]
+	serviceName := strings.Join(labels[:len(labels)-2], ".")
+	client, ok := s.Naming[namespace]
+	if !ok {
+		return dnsmessage.RCodeNameError, nil, nil
+	}
+	serviceInfo := client.GetServiceInfo(serviceName, groupName, nil)
+	if serviceInfo == nil {
+		return dnsmessage.RCodeServerFailure, nil, nil
+	}
+	if len(serviceInfo.Hosts) == 0 {
+		return dnsmessage.RCodeNameError, nil, nil
+	}
+	ttl := uint32(serviceInfo.CacheMillis / 1000)
+	if ttl == 0 {
+		ttl = 1
+	}
+
+	var answers, additionals []dnsmessage.Resource
+	for _, instance := range serviceInfo.Hosts {
+		if !instance.Healthy || !instance.Enable {
+			continue
+		}
+		ip := net.ParseIP(instance.IP)
+		if ip == nil {
+			continue
+		}
+		if q.Type != dnsmessage.TypeSRV {
+			if r, ok := addressRecord(q.Name, ip, ttl, q.Type); ok {
+				answers = append(answers, r)
+			}
+			continue
+		}
+		target := dnsmessage.MustNewName(encodeIP(ip) + "." + addrDomain)
+		answers = append(answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body: &dnsmessage.SRVResource{
+				Weight: uint16(math.Min(math.Round(instance.Weight*100), math.MaxUint16)),
+				Port:   uint16(instance.Port),
+				Target: target,
+			},
+		})
+		if r, ok := addressRecord(target, ip, ttl, dnsmessage.TypeALL); ok {
+			additionals = append(additionals, r)
+		}
+	}
+	return dnsmessage.RCodeSuccess, answers, additionals
+}
+
+// addressRecord returns the A or AAAA record of ip if the type asked for
+// matches, TypeALL matches both
+func addressRecord(name dnsmessage.Name, ip net.IP, ttl uint32, typ dnsmessage.Type) (dnsmessage.Resource, bool) {
+	header := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: ttl}
+	if ip4 := ip.To4(); ip4 != nil {
+		if typ != dnsmessage.TypeA && typ != dnsmessage.TypeALL {
+			return dnsmessage.Resource{}, false
+		}
+		r := &dnsmessage.AResource{}
+		copy(r.A[:], ip4)
+		return dnsmessage.Resource{Header: header, Body: r}, true
+	}
+	if typ != dnsmessage.TypeAAAA && typ != dnsmessage.TypeALL {
+		return dnsmessage.Resource{}, false
+	}
+	r := &dnsmessage.AAAAResource{}
+	copy(r.AAAA[:], ip.To16())
+	return dnsmessage.Resource{Header: header, Body: r}, true
+}
+
+func encodeIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return strings.ReplaceAll(ip4.String(), ".", "-")
+	}
+	return hex.EncodeToString(ip.To16())
+}
+
+func decodeIP(label string) net.IP {
+	if strings.Contains(label, "-") {
+		return net.ParseIP(strings.ReplaceAll(label, "-", ".")).To4()
+	}
+	b, err := hex.DecodeString(label)
+	if err != nil || len(b) != net.IPv6len {
+		return nil
+	}
+	return net.IP(b)
+}
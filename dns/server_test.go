@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"golang.org/x/net/dns/dnsmessage"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ServerSuite struct {
+	naming   *fakeNaming
+	server   *Server
+	resolver *net.Resolver
+	addr     string
+}
+
+var _ = Suite(&ServerSuite{})
+
+// fakeNaming holds the services by grouped name
+type fakeNaming struct {
+	nacos.NamingClient
+	services map[string]*nacos.ServiceInfo
+}
+
+func (f *fakeNaming) GetServiceInfo(serviceName, groupName string, clusters []string) *nacos.ServiceInfo {
+	return f.services[groupName+"@@"+serviceName]
+}
+
+func instance(ip string, port int, weight float64, healthy, enable bool) *nacos.Instance {
+	i := nacos.NewInstance("svc", nacos.DefaultGroup, nacos.DefaultCluster, ip, port, weight, enable, true, nil)
+	i.Healthy = healthy
+	return i
+}
+
+func (s *ServerSuite) SetUpTest(c *C) {
+	s.naming = &fakeNaming{services: map[string]*nacos.ServiceInfo{
+		"DEFAULT_GROUP@@svc": {CacheMillis: 10000, Hosts: []*nacos.Instance{
+			instance("10.0.0.1", 8080, 1, true, true),
+			instance("10.0.0.2", 8081, 0.5, true, true),
+			instance("10.0.0.3", 8080, 1, false, true),
+			instance("10.0.0.4", 8080, 1, true, false),
+			instance("fd00::1", 8080, 1, true, true),
+		}},
+		"g@@api.v1": {Hosts: []*nacos.Instance{instance("10.0.1.1", 80, 1, true, true)}},
+		"g@@empty":  {},
+	}}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.addr = conn.LocalAddr().String()
+	s.server = &Server{Naming: map[string]nacos.NamingClient{"public": s.naming}}
+	go s.server.Serve(conn)
+	s.resolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "udp", s.addr)
+	}}
+}
+
+func (s *ServerSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *ServerSuite) TestLookupHost(c *C) {
+	addrs, err := s.resolver.LookupHost(context.Background(), "svc.DEFAULT_GROUP.public.nacos.")
+	c.Assert(err, IsNil)
+	sort.Strings(addrs)
+	c.Assert(addrs, DeepEquals, []string{"10.0.0.1", "10.0.0.2", "fd00::1"})
+
+	addrs, err = s.resolver.LookupHost(context.Background(), "api.v1.g.public.nacos.")
+	c.Assert(err, IsNil)
+	c.Assert(addrs, DeepEquals, []string{"10.0.1.1"})
+}
+
+func (s *ServerSuite) TestLookupSRV(c *C) {
+	_, srvs, err := s.resolver.LookupSRV(context.Background(), "", "", "svc.DEFAULT_GROUP.public.nacos.")
+	c.Assert(err, IsNil)
+	c.Assert(srvs, HasLen, 3)
+	targets := make(map[string]net.SRV)
+	for _, srv := range srvs {
+		targets[srv.Target] = *srv
+	}
+	c.Assert(targets["10-0-0-2.addr.nacos."], Equals, net.SRV{Target: "10-0-0-2.addr.nacos.", Port: 8081, Weight: 50})
+	c.Assert(targets["10-0-0-1.addr.nacos."].Weight, Equals, uint16(100))
+	c.Assert(targets["fd000000000000000000000000000001.addr.nacos."].Port, Equals, uint16(8080))
+
+	addrs, err := s.resolver.LookupHost(context.Background(), "10-0-0-2.addr.nacos.")
+	c.Assert(err, IsNil)
+	c.Assert(addrs, DeepEquals, []string{"10.0.0.2"})
+}
+
+func (s *ServerSuite) TestNotFound(c *C) {
+	for _, name := range []string{
+		"svc.DEFAULT_GROUP.prod.nacos.",
+		"empty.g.public.nacos.",
+		"g.public.nacos.",
+	} {
+		_, err := s.resolver.LookupHost(context.Background(), name)
+		dnsErr, ok := err.(*net.DNSError)
+		c.Assert(ok, Equals, true, Commentf("%s: %v", name, err))
+		c.Assert(dnsErr.IsNotFound, Equals, true, Commentf("%s: %v", name, err))
+	}
+}
+
+func (s *ServerSuite) TestAnswer(c *C) {
+	query := func(name string, typ dnsmessage.Type) dnsmessage.Message {
+		q := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: 7, RecursionDesired: true},
+			Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}},
+		}
+		b, err := q.Pack()
+		c.Assert(err, IsNil)
+		var resp dnsmessage.Message
+		c.Assert(resp.Unpack(s.server.answer(b)), IsNil)
+		return resp
+	}
+
+	resp := query("svc.DEFAULT_GROUP.public.nacos.", dnsmessage.TypeA)
+	c.Assert(resp.ID, Equals, uint16(7))
+	c.Assert(resp.Authoritative, Equals, true)
+	c.Assert(resp.RecursionDesired, Equals, true)
+	c.Assert(resp.Answers, HasLen, 2)
+	c.Assert(resp.Answers[0].Header.TTL, Equals, uint32(10))
+
+	resp = query("api.v1.g.public.nacos.", dnsmessage.TypeSRV)
+	c.Assert(resp.Answers, HasLen, 1)
+	c.Assert(resp.Answers[0].Header.TTL, Equals, uint32(1))
+	c.Assert(resp.Additionals, HasLen, 1)
+	c.Assert(resp.Additionals[0].Header.Name.String(), Equals, "10-0-1-1.addr.nacos.")
+
+	resp = query("svc.DEFAULT_GROUP.public.nacos.", dnsmessage.TypeTXT)
+	c.Assert(resp.RCode, Equals, dnsmessage.RCodeSuccess)
+	c.Assert(resp.Answers, HasLen, 0)
+
+	resp = query("example.com.", dnsmessage.TypeA)
+	c.Assert(resp.RCode, Equals, dnsmessage.RCodeRefused)
+}
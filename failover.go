@@ -7,6 +7,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,13 +16,14 @@ var failoverSwitchFile = "00-00---000-VIPSRV_FAILOVER_SWITCH-000---00-00"
 type failover struct {
 	ns           *namingClient
 	failoverDir  string
-	failoverMode bool
-	serviceMap   map[string]*ServiceInfo
+	failoverMode int32
+	services     *ServiceInfoHolder
 }
 
 func newFailover(ns *namingClient) *failover {
 	f := &failover{
-		ns: ns,
+		ns:       ns,
+		services: NewServiceInfoHolder(),
 	}
 	f.init()
 	return f
@@ -76,13 +78,21 @@ func (f *failover) init() {
 }
 
 func (f *failover) isFailoverSwitch() bool {
-	return f.failoverMode
+	return atomic.LoadInt32(&f.failoverMode) == 1
+}
+
+func (f *failover) setFailoverSwitch(on bool) {
+	if on {
+		atomic.StoreInt32(&f.failoverMode, 1)
+	} else {
+		atomic.StoreInt32(&f.failoverMode, 0)
+	}
 }
 
 func (f *failover) switchRefresher() {
 	switchFile, err := os.Stat(path.Join(f.failoverDir, failoverSwitchFile))
 	if os.IsNotExist(err) {
-		f.failoverMode = false
+		f.setFailoverSwitch(false)
 		return
 	}
 	modified := switchFile.ModTime()
@@ -96,13 +106,11 @@ func (f *failover) switchRefresher() {
 			if lastModified < modified.Unix() {
 				lastModified = modified.Unix()
 				b, _ := ioutil.ReadFile(path.Join(f.failoverDir, failoverSwitchFile))
-				if string(b) == "" {
-					f.failoverMode = false
-				} else if string(b) == "1" {
-					f.failoverMode = true
+				if string(b) == "1" {
 					f.readFile()
+					f.setFailoverSwitch(true)
 				} else {
-					f.failoverMode = false
+					f.setFailoverSwitch(false)
 				}
 			}
 		}
@@ -110,6 +118,7 @@ func (f *failover) switchRefresher() {
 }
 
 func (f *failover) readFile() {
+	serviceMap := make(map[string]*ServiceInfo)
 	filepath.Walk(f.failoverDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil || info.IsDir() || strings.HasSuffix(info.Name(), failoverSwitchFile) {
 			return nil
@@ -118,14 +127,15 @@ func (f *failover) readFile() {
 		var serviceInfo ServiceInfo
 		err = json.Unmarshal(b, &serviceInfo)
 		if err == nil {
-			f.serviceMap[serviceInfo.GetKey()] = &serviceInfo
+			serviceMap[serviceInfo.GetKey()] = serviceInfo.splitHostNames()
 		}
 		return nil
 	})
+	f.services.replace(serviceMap)
 }
 
 func (f *failover) writeFile() {
-	for _, v := range f.ns.serviceInfoMap {
+	for _, v := range f.ns.serviceInfoHolder.Snapshot() {
 		if v.GetKey() == "000--00-ALL_IPS--00--000" ||
 			v.Name == "envList" ||
 			v.Name == "00-00---000-ENV_CONFIGS-000---00-00" ||
@@ -142,5 +152,6 @@ func (f *failover) writeFile() {
 }
 
 func (f *failover) getService(key string) *ServiceInfo {
-	return f.serviceMap[key]
+	serviceInfo, _ := f.services.Get(key)
+	return serviceInfo
 }
@@ -0,0 +1,47 @@
+package nacos
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path"
+
+	. "gopkg.in/check.v1"
+)
+
+type FailoverSuite struct{}
+
+var _ = Suite(&FailoverSuite{})
+
+func (s *FailoverSuite) TestInstanceEnabled(c *C) {
+	var instance Instance
+	c.Assert(json.Unmarshal([]byte(`{"ip":"10.0.0.1","port":80,"enabled":true}`), &instance), IsNil)
+	c.Assert(instance.Enable, Equals, true)
+
+	b, err := json.Marshal(&instance)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Matches, `.*"enabled":true.*`)
+}
+
+func (s *FailoverSuite) TestReadFile(c *C) {
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+
+	key := "DEFAULT_GROUP@@svc"
+	data := `{"name":"DEFAULT_GROUP@@svc","clusters":"","hosts":[{"ip":"10.0.0.1","port":80,"serviceName":"DEFAULT_GROUP@@svc","healthy":true,"enabled":true}]}`
+	c.Assert(ioutil.WriteFile(path.Join(ns.failover.failoverDir, url.PathEscape(key)), []byte(data), 0666), IsNil)
+	c.Assert(ioutil.WriteFile(path.Join(ns.failover.failoverDir, failoverSwitchFile), []byte("1"), 0666), IsNil)
+
+	ns.failover.readFile()
+	ns.failover.setFailoverSwitch(true)
+	c.Assert(ns.failover.isFailoverSwitch(), Equals, true)
+	serviceInfo := ns.failover.getService(key)
+	c.Assert(serviceInfo, NotNil)
+	c.Assert(serviceInfo.Hosts, HasLen, 1)
+	c.Assert(serviceInfo.Hosts[0].Enable, Equals, true)
+	c.Assert(serviceInfo.Hosts[0].GroupName, Equals, DefaultGroup)
+	c.Assert(serviceInfo.Hosts[0].ServiceName, Equals, "svc")
+	c.Assert(ns.failover.getService("DEFAULT_GROUP@@other"), IsNil)
+
+	ns.failover.setFailoverSwitch(false)
+	c.Assert(ns.failover.isFailoverSwitch(), Equals, false)
+}
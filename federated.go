@@ -0,0 +1,243 @@
+package nacos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MetadataKeyRegion holds the region an instance returned by FederatedClient
+// was found in
+const MetadataKeyRegion = "nacos.region"
+
+// Region is one of the Nacos clusters of a FederatedClient
+type Region struct {
+	Name   string
+	Client Client
+}
+
+// FederatedOptions configures a FederatedClient
+type FederatedOptions struct {
+	// Regions are the clusters in order of priority, the local one first
+	Regions []Region
+	// Home is the name of the region instances are registered in, the
+	// first region if empty
+	Home string
+}
+
+// FederatedClient gives a view of services across the Nacos clusters of
+// several regions: instances are selected from every region and tagged with
+// it, and registered into the home region
+type FederatedClient struct {
+	regions []Region
+	home    Region
+
+	mu            sync.Mutex
+	subscriptions map[federatedKey]*federatedSubscription
+}
+
+// NewFederatedClient returns a FederatedClient of the regions, the clients
+// stay owned by the caller
+func NewFederatedClient(opts FederatedOptions) (*FederatedClient, error) {
+	if len(opts.Regions) == 0 {
+		return nil, errors.New("no region")
+	}
+	f := &FederatedClient{
+		regions:       opts.Regions,
+		subscriptions: make(map[federatedKey]*federatedSubscription),
+	}
+	names := make(map[string]bool)
+	for _, region := range opts.Regions {
+		if region.Name == "" || names[region.Name] {
+			return nil, fmt.Errorf("region name %q is empty or repeated", region.Name)
+		}
+		names[region.Name] = true
+		if region.Name == opts.Home || (opts.Home == "" && f.home.Client == nil) {
+			f.home = region
+		}
+	}
+	if f.home.Client == nil {
+		return nil, fmt.Errorf("home region %s not found", opts.Home)
+	}
+	return f, nil
+}
+
+// Home returns the region instances are registered in
+func (f *FederatedClient) Home() Region {
+	return f.home
+}
+
+// Regions returns the regions in order of priority
+func (f *FederatedClient) Regions() []Region {
+	return append([]Region(nil), f.regions...)
+}
+
+func (f *FederatedClient) RegisterInstance(instance *Instance) (*Response, error) {
+	return f.home.Client.Naming().RegisterInstance(instance)
+}
+
+func (f *FederatedClient) DeRegisterInstance(serviceName, groupName, clusterName, ip string, port int, ephemeral bool) (*Response, error) {
+	return f.home.Client.Naming().DeRegisterInstance(serviceName, groupName, clusterName, ip, port, ephemeral)
+}
+
+// tagged returns copies of the instances with the region in their metadata
+func tagged(region string, instances []*Instance) []*Instance {
+	tagged := make([]*Instance, len(instances))
+	for i, instance := range instances {
+		c := instance.clone()
+		if c.Metadata == nil {
+			c.Metadata = NewMetadata(nil)
+		}
+		c.Metadata.Put(MetadataKeyRegion, region)
+		tagged[i] = c
+	}
+	return tagged
+}
+
+// SelectInstance returns the instances of the service in every region, of
+// every zone
+func (f *FederatedClient) SelectInstance(q InstanceQueryOptions) []*Instance {
+	var instances []*Instance
+	for _, region := range f.regions {
+		instances = append(instances, tagged(region.Name, region.Client.Naming().SelectInstance(q))...)
+	}
+	return instances
+}
+
+// SelectHealthyInstances returns the instances SelectHealthyInstances of
+// the first region having some returns, so with the zone preference and
+// outlier ejection of its client
+func (f *FederatedClient) SelectHealthyInstances(q InstanceQueryOptions) []*Instance {
+	for _, region := range f.regions {
+		if instances := region.Client.Naming().SelectHealthyInstances(q); len(instances) > 0 {
+			return tagged(region.Name, instances)
+		}
+	}
+	return nil
+}
+
+// SelectOneHealthyInstance picks a healthy instance in the first region
+// having one, with the zone preference and outlier ejection of its client
+func (f *FederatedClient) SelectOneHealthyInstance(q InstanceQueryOptions) (*Instance, error) {
+	for _, region := range f.regions {
+		instance, err := region.Client.Naming().SelectOneHealthyInstance(q)
+		if err == nil {
+			return tagged(region.Name, []*Instance{instance})[0], nil
+		}
+		if err != ErrNoInstanceAvailable {
+			return nil, fmt.Errorf("region %s: %w", region.Name, err)
+		}
+	}
+	return nil, ErrNoInstanceAvailable
+}
+
+// federatedKey identifies a subscription, the listener by ==
+type federatedKey struct {
+	serviceName string
+	groupName   string
+	clusters    string
+	listener    EventListener
+}
+
+// federatedSubscription merges the services pushed by each region into one
+// ServiceInfo for the listener
+type federatedSubscription struct {
+	sync.Mutex
+	key       federatedKey
+	listeners []*regionListener
+	hosts     map[string][]*Instance
+	latest    map[string]*ServiceInfo
+	merges    uint64
+
+	// notifyMu orders the calls of the listener, which are made without
+	// the lock held
+	notifyMu  sync.Mutex
+	delivered uint64
+}
+
+type regionListener struct {
+	s      *federatedSubscription
+	region string
+}
+
+func (l *regionListener) OnEvent(serviceInfo *ServiceInfo) {
+	l.s.update(l.region, serviceInfo)
+}
+
+// update calls the listener with the hosts of every region, the regions are
+// merged in order of priority; a merge older than the one the listener was
+// last called with is dropped
+func (s *federatedSubscription) update(region string, serviceInfo *ServiceInfo) {
+	s.Lock()
+	s.hosts[region] = tagged(region, serviceInfo.Hosts)
+	s.latest[region] = serviceInfo
+	merged := &ServiceInfo{
+		Name:      serviceInfo.Name,
+		GroupName: serviceInfo.GroupName,
+		Clusters:  serviceInfo.Clusters,
+	}
+	for _, l := range s.listeners {
+		latest, ok := s.latest[l.region]
+		if !ok {
+			continue
+		}
+		merged.Hosts = append(merged.Hosts, s.hosts[l.region]...)
+		if merged.CacheMillis == 0 || latest.CacheMillis < merged.CacheMillis {
+			merged.CacheMillis = latest.CacheMillis
+		}
+		if latest.LastRefTime > merged.LastRefTime {
+			merged.LastRefTime = latest.LastRefTime
+		}
+	}
+	s.merges++
+	seq := s.merges
+	s.Unlock()
+
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	if seq > s.delivered {
+		s.delivered = seq
+		s.key.listener.OnEvent(merged)
+	}
+}
+
+// Subscribe subscribes to the service in every region, listener is called
+// with the instances of all the regions each time one of them changes. The
+// listener is identified by ==, as Unsubscribe finds it, so it must be
+// comparable such as a pointer.
+func (f *FederatedClient) Subscribe(serviceName, groupName string, clusters []string, listener EventListener) {
+	key := federatedKey{serviceName, groupName, strings.Join(clusters, ","), listener}
+	f.mu.Lock()
+	if _, ok := f.subscriptions[key]; ok {
+		f.mu.Unlock()
+		return
+	}
+	s := &federatedSubscription{
+		key:    key,
+		hosts:  make(map[string][]*Instance),
+		latest: make(map[string]*ServiceInfo),
+	}
+	for _, region := range f.regions {
+		s.listeners = append(s.listeners, &regionListener{s: s, region: region.Name})
+	}
+	f.subscriptions[key] = s
+	f.mu.Unlock()
+	for i, region := range f.regions {
+		region.Client.Naming().Subscribe(serviceName, groupName, clusters, s.listeners[i])
+	}
+}
+
+func (f *FederatedClient) Unsubscribe(serviceName, groupName string, clusters []string, listener EventListener) {
+	key := federatedKey{serviceName, groupName, strings.Join(clusters, ","), listener}
+	f.mu.Lock()
+	s, ok := f.subscriptions[key]
+	delete(f.subscriptions, key)
+	f.mu.Unlock()
+	if !ok {
+		return
+	}
+	for i, region := range f.regions {
+		region.Client.Naming().Unsubscribe(serviceName, groupName, clusters, s.listeners[i])
+	}
+}
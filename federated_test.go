@@ -0,0 +1,224 @@
+package nacos
+
+import (
+	"errors"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// regionNaming holds the instances of one service in one region
+type regionNaming struct {
+	NamingClient
+	sync.Mutex
+	instances  []*Instance
+	registered []*Instance
+	listeners  []EventListener
+	err        error
+}
+
+func (n *regionNaming) SelectInstance(q InstanceQueryOptions) []*Instance {
+	n.Lock()
+	defer n.Unlock()
+	return cloneInstances(n.instances)
+}
+
+func (n *regionNaming) SelectHealthyInstances(q InstanceQueryOptions) []*Instance {
+	return healthyInstances(n.SelectInstance(q))
+}
+
+func (n *regionNaming) SelectOneHealthyInstance(q InstanceQueryOptions) (*Instance, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	instances := healthyInstances(n.SelectInstance(q))
+	if len(instances) == 0 {
+		return nil, ErrNoInstanceAvailable
+	}
+	return instances[0], nil
+}
+
+func (n *regionNaming) RegisterInstance(instance *Instance) (*Response, error) {
+	n.Lock()
+	defer n.Unlock()
+	n.registered = append(n.registered, instance)
+	return &Response{}, nil
+}
+
+func (n *regionNaming) Subscribe(serviceName, groupName string, clusters []string, listener EventListener) {
+	n.Lock()
+	defer n.Unlock()
+	n.listeners = append(n.listeners, listener)
+}
+
+func (n *regionNaming) Unsubscribe(serviceName, groupName string, clusters []string, listener EventListener) {
+	n.Lock()
+	defer n.Unlock()
+	for i, l := range n.listeners {
+		if l == listener {
+			n.listeners = append(n.listeners[:i], n.listeners[i+1:]...)
+			break
+		}
+	}
+}
+
+func (n *regionNaming) push(cacheMillis int64, instances ...*Instance) {
+	n.Lock()
+	n.instances = instances
+	listeners := append([]EventListener(nil), n.listeners...)
+	n.Unlock()
+	for _, l := range listeners {
+		l.OnEvent(&ServiceInfo{Name: "DEFAULT_GROUP@@svc", CacheMillis: cacheMillis, Hosts: cloneInstances(instances)})
+	}
+}
+
+type regionClient struct {
+	Client
+	naming *regionNaming
+}
+
+func (c *regionClient) Naming() NamingClient { return c.naming }
+
+type serviceRecorder struct {
+	sync.Mutex
+	events []*ServiceInfo
+}
+
+func (r *serviceRecorder) OnEvent(serviceInfo *ServiceInfo) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, serviceInfo)
+}
+
+type FederatedSuite struct {
+	local, remote *regionNaming
+	f             *FederatedClient
+}
+
+var _ = Suite(&FederatedSuite{})
+
+func regionInstance(ip string, healthy bool) *Instance {
+	return &Instance{ServiceName: "svc", IP: ip, Port: 80, Weight: 1, Healthy: healthy, Enable: true}
+}
+
+func (s *FederatedSuite) SetUpTest(c *C) {
+	s.local = &regionNaming{instances: []*Instance{regionInstance("10.0.0.1", false)}}
+	s.remote = &regionNaming{instances: []*Instance{regionInstance("10.1.0.1", true)}}
+	var err error
+	s.f, err = NewFederatedClient(FederatedOptions{
+		Regions: []Region{
+			{Name: "hz", Client: &regionClient{naming: s.local}},
+			{Name: "sh", Client: &regionClient{naming: s.remote}},
+		},
+		Home: "sh",
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *FederatedSuite) TestNewFederatedClient(c *C) {
+	region := Region{Name: "hz", Client: &regionClient{naming: s.local}}
+	f, err := NewFederatedClient(FederatedOptions{Regions: []Region{region}})
+	c.Assert(err, IsNil)
+	c.Assert(f.Home().Name, Equals, "hz")
+
+	_, err = NewFederatedClient(FederatedOptions{})
+	c.Assert(err, ErrorMatches, "no region")
+	_, err = NewFederatedClient(FederatedOptions{Regions: []Region{region, region}})
+	c.Assert(err, ErrorMatches, `region name "hz" is empty or repeated`)
+	_, err = NewFederatedClient(FederatedOptions{Regions: []Region{region}, Home: "bj"})
+	c.Assert(err, ErrorMatches, "home region bj not found")
+}
+
+func (s *FederatedSuite) TestSelect(c *C) {
+	instances := s.f.SelectInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(instances, HasLen, 2)
+	c.Assert(instances[0].Metadata.Get(MetadataKeyRegion), Equals, "hz")
+	c.Assert(instances[1].Metadata.Get(MetadataKeyRegion), Equals, "sh")
+	c.Assert(s.local.instances[0].Metadata, IsNil)
+
+	instance, err := s.f.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	c.Assert(instance.IP, Equals, "10.1.0.1")
+	c.Assert(instance.Metadata.Get(MetadataKeyRegion), Equals, "sh")
+
+	s.local.instances[0].Healthy = true
+	instance, err = s.f.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	c.Assert(instance.IP, Equals, "10.0.0.1")
+
+	s.local.err = errors.New("boom")
+	_, err = s.f.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, ErrorMatches, "region hz: boom")
+
+	s.local.err = nil
+	s.local.instances, s.remote.instances = nil, nil
+	_, err = s.f.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, Equals, ErrNoInstanceAvailable)
+}
+
+func (s *FederatedSuite) TestSelectHealthyInstances(c *C) {
+	instances := s.f.SelectHealthyInstances(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(instances, HasLen, 1)
+	c.Assert(instances[0].IP, Equals, "10.1.0.1")
+	c.Assert(instances[0].Metadata.Get(MetadataKeyRegion), Equals, "sh")
+
+	s.local.instances[0].Healthy = true
+	instances = s.f.SelectHealthyInstances(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(instances, HasLen, 1)
+	c.Assert(instances[0].IP, Equals, "10.0.0.1")
+
+	s.local.instances, s.remote.instances = nil, nil
+	c.Assert(s.f.SelectHealthyInstances(InstanceQueryOptions{ServiceName: "svc"}), HasLen, 0)
+}
+
+func (s *FederatedSuite) TestRegisterIntoHome(c *C) {
+	_, err := s.f.RegisterInstance(regionInstance("10.1.0.2", true))
+	c.Assert(err, IsNil)
+	c.Assert(s.remote.registered, HasLen, 1)
+	c.Assert(s.local.registered, HasLen, 0)
+}
+
+func (s *FederatedSuite) TestSubscribe(c *C) {
+	r := &serviceRecorder{}
+	s.f.Subscribe("svc", "", nil, r)
+	s.f.Subscribe("svc", "", nil, r)
+	c.Assert(s.local.listeners, HasLen, 1)
+	c.Assert(s.remote.listeners, HasLen, 1)
+
+	s.remote.push(3000, regionInstance("10.1.0.1", true))
+	s.local.push(10000, regionInstance("10.0.0.1", true), regionInstance("10.0.0.2", true))
+	c.Assert(r.events, HasLen, 2)
+	c.Assert(ips(r.events[0].Hosts), DeepEquals, []string{"10.1.0.1"})
+	merged := r.events[1]
+	c.Assert(ips(merged.Hosts), DeepEquals, []string{"10.0.0.1", "10.0.0.2", "10.1.0.1"})
+	c.Assert(merged.CacheMillis, Equals, int64(3000))
+	c.Assert(merged.Hosts[2].Metadata.Get(MetadataKeyRegion), Equals, "sh")
+
+	s.f.Unsubscribe("svc", "", nil, r)
+	c.Assert(s.local.listeners, HasLen, 0)
+	c.Assert(s.remote.listeners, HasLen, 0)
+}
+
+type lockProbe struct {
+	f      *FederatedClient
+	locked []bool
+}
+
+func (p *lockProbe) OnEvent(serviceInfo *ServiceInfo) {
+	for _, s := range p.f.subscriptions {
+		if s.TryLock() {
+			s.Unlock()
+			p.locked = append(p.locked, false)
+		} else {
+			p.locked = append(p.locked, true)
+		}
+	}
+}
+
+func (s *FederatedSuite) TestListenerCalledWithoutLock(c *C) {
+	p := &lockProbe{f: s.f}
+	s.f.Subscribe("svc", "", nil, p)
+	s.local.push(1000, regionInstance("10.0.0.1", true))
+	s.remote.push(1000, regionInstance("10.1.0.1", true))
+	c.Assert(p.locked, DeepEquals, []bool{false, false})
+}
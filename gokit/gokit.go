@@ -0,0 +1,147 @@
+// Package gokit implements the go-kit sd.Instancer and sd.Registrar on top of
+// a NamingClient. It is a module of its own, so the SDK does not depend on
+// go-kit.
+//
+// Instances are reported to go-kit as their host:port, go-kit having no
+// metadata; the Registrar registers the Nacos instance it is given as is.
+package gokit
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/log"
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+var (
+	_ sd.Instancer = new(Instancer)
+	_ sd.Registrar = new(Registrar)
+)
+
+// Instancer yields the healthy and enabled instances of a service, updated by
+// a subscription of the naming client
+type Instancer struct {
+	client      nacos.NamingClient
+	logger      log.Logger
+	serviceName string
+	groupName   string
+	clusters    []string
+
+	mu    sync.Mutex
+	state sd.Event
+	chans map[chan<- sd.Event]struct{}
+}
+
+// NewInstancer returns an Instancer of the service in the given group, and
+// clusters if any
+func NewInstancer(client nacos.NamingClient, logger log.Logger, serviceName, groupName string, clusters []string) *Instancer {
+	i := &Instancer{
+		client:      client,
+		logger:      logger,
+		serviceName: serviceName,
+		groupName:   groupName,
+		clusters:    clusters,
+		chans:       make(map[chan<- sd.Event]struct{}),
+	}
+	i.update(client.SelectInstance(nacos.InstanceQueryOptions{
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		ClusterName: clusters,
+		Subscribe:   true,
+	}))
+	client.Subscribe(serviceName, groupName, clusters, i)
+	return i
+}
+
+// OnEvent implements nacos.EventListener
+func (i *Instancer) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	i.update(serviceInfo.Hosts)
+}
+
+func (i *Instancer) update(hosts []*nacos.Instance) {
+	instances := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host.Healthy && host.Enable {
+			instances = append(instances, net.JoinHostPort(host.IP, strconv.Itoa(host.Port)))
+		}
+	}
+	sort.Strings(instances)
+	event := sd.Event{Instances: instances}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if reflect.DeepEqual(i.state, event) {
+		return
+	}
+	i.logger.Log("service", i.serviceName, "group", i.groupName, "instances", len(instances))
+	i.state = event
+	for ch := range i.chans {
+		ch <- copyEvent(event)
+	}
+}
+
+func copyEvent(e sd.Event) sd.Event {
+	return sd.Event{Instances: append([]string{}, e.Instances...), Err: e.Err}
+}
+
+// Register implements sd.Instancer, the current instances are sent to ch
+// right away
+func (i *Instancer) Register(ch chan<- sd.Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.chans[ch] = struct{}{}
+	ch <- copyEvent(i.state)
+}
+
+// Deregister implements sd.Instancer
+func (i *Instancer) Deregister(ch chan<- sd.Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.chans, ch)
+}
+
+// Stop unsubscribes from the service
+func (i *Instancer) Stop() {
+	i.client.Unsubscribe(i.serviceName, i.groupName, i.clusters, i)
+}
+
+// Registrar registers an instance with the naming client
+type Registrar struct {
+	client   nacos.NamingClient
+	instance *nacos.Instance
+	logger   log.Logger
+}
+
+// NewRegistrar returns a Registrar of the instance
+func NewRegistrar(client nacos.NamingClient, instance *nacos.Instance, logger log.Logger) *Registrar {
+	return &Registrar{
+		client:   client,
+		instance: instance,
+		logger: log.With(logger, "service", instance.ServiceName, "group", instance.GroupName,
+			"address", net.JoinHostPort(instance.IP, strconv.Itoa(instance.Port))),
+	}
+}
+
+// Register implements sd.Registrar, failures are logged
+func (r *Registrar) Register() {
+	if _, err := r.client.RegisterInstance(r.instance); err != nil {
+		r.logger.Log("err", err)
+	} else {
+		r.logger.Log("action", "register")
+	}
+}
+
+// Deregister implements sd.Registrar, failures are logged
+func (r *Registrar) Deregister() {
+	i := r.instance
+	if _, err := r.client.DeRegisterInstance(i.ServiceName, i.GroupName, i.ClusterName, i.IP, i.Port, i.Ephemeral); err != nil {
+		r.logger.Log("err", err)
+	} else {
+		r.logger.Log("action", "deregister")
+	}
+}
@@ -0,0 +1,143 @@
+package gokit
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/log"
+	nacos "github.com/litgh/nacos-go-sdk"
+	"github.com/litgh/nacos-go-sdk/nacosmock"
+	"github.com/litgh/nacos-go-sdk/nacostest"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type GokitSuite struct {
+	naming *nacosmock.Naming
+}
+
+var _ = Suite(&GokitSuite{})
+
+func (s *GokitSuite) SetUpTest(c *C) {
+	s.naming = nacosmock.NewNaming()
+}
+
+func instance(ip string, port int) *nacos.Instance {
+	return nacos.NewInstance("svc", "g", "", ip, port, 1, true, true, nil)
+}
+
+func next(c *C, events chan sd.Event) sd.Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(3 * time.Second):
+		c.Fatal("no event")
+	}
+	return sd.Event{}
+}
+
+func (s *GokitSuite) TestRegistrarAndInstancer(c *C) {
+	logger := log.NewNopLogger()
+	a := NewRegistrar(s.naming, instance("10.0.0.1", 80), logger)
+	a.Register()
+
+	instancer := NewInstancer(s.naming, logger, "svc", "g", nil)
+	events := make(chan sd.Event, 8)
+	instancer.Register(events)
+	c.Assert(next(c, events).Instances, DeepEquals, []string{"10.0.0.1:80"})
+
+	b := NewRegistrar(s.naming, instance("10.0.0.2", 80), logger)
+	b.Register()
+	c.Assert(next(c, events).Instances, DeepEquals, []string{"10.0.0.1:80", "10.0.0.2:80"})
+
+	s.naming.SetHealthy("svc", "g", "10.0.0.1", 80, false)
+	c.Assert(next(c, events).Instances, DeepEquals, []string{"10.0.0.2:80"})
+
+	b.Deregister()
+	c.Assert(next(c, events).Instances, DeepEquals, []string{})
+
+	instancer.Deregister(events)
+	instancer.Stop()
+	c.Assert(s.naming.Listeners("svc", "g"), Equals, 0)
+}
+
+func (s *GokitSuite) TestEndpointer(c *C) {
+	NewRegistrar(s.naming, instance("10.0.0.1", 80), log.NewNopLogger()).Register()
+	instancer := NewInstancer(s.naming, log.NewNopLogger(), "svc", "g", nil)
+	defer instancer.Stop()
+
+	factory := func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		return func(context.Context, interface{}) (interface{}, error) { return instance, nil }, nil, nil
+	}
+	endpointer := sd.NewEndpointer(instancer, factory, log.NewNopLogger())
+	defer endpointer.Close()
+	endpoints, err := endpointer.Endpoints()
+	c.Assert(err, IsNil)
+	c.Assert(endpoints, HasLen, 1)
+	resp, err := endpoints[0](context.Background(), nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp, Equals, "10.0.0.1:80")
+
+	NewRegistrar(s.naming, instance("10.0.0.2", 80), log.NewNopLogger()).Register()
+	for i := 0; i < 100 && len(endpoints) != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		endpoints, _ = endpointer.Endpoints()
+	}
+	c.Assert(endpoints, HasLen, 2)
+}
+
+// GokitServerSuite runs the adapter on a naming client of a nacostest server
+type GokitServerSuite struct {
+	server *nacostest.Server
+	client nacos.Client
+}
+
+var _ = Suite(&GokitServerSuite{})
+
+func (s *GokitServerSuite) SetUpTest(c *C) {
+	s.server = nacostest.NewServer(nacostest.Options{})
+	client, err := nacos.NewClient(&nacos.Config{
+		Scheme:      "http",
+		ContextPath: nacostest.ContextPath,
+		Hosts:       []string{s.server.Addr},
+		CacheDir:    c.MkDir(),
+		LogDir:      c.MkDir(),
+	})
+	c.Assert(err, IsNil)
+	s.client = client
+}
+
+func (s *GokitServerSuite) TearDownTest(c *C) {
+	s.client.Naming().Shutdown(context.Background())
+	s.server.Close()
+}
+
+func (s *GokitServerSuite) TestRegistrarAndInstancer(c *C) {
+	naming := s.client.Naming()
+	logger := log.NewNopLogger()
+	a := NewRegistrar(naming, instance("10.0.0.1", 80), logger)
+	a.Register()
+
+	instancer := NewInstancer(naming, logger, "svc", "g", nil)
+	events := make(chan sd.Event, 8)
+	instancer.Register(events)
+	c.Assert(next(c, events).Instances, DeepEquals, []string{"10.0.0.1:80"})
+
+	b := NewRegistrar(naming, instance("10.0.0.2", 80), logger)
+	b.Register()
+	c.Assert(next(c, events).Instances, DeepEquals, []string{"10.0.0.1:80", "10.0.0.2:80"})
+
+	a.Deregister()
+	c.Assert(next(c, events).Instances, DeepEquals, []string{"10.0.0.2:80"})
+
+	c.Assert(s.server.RemoveInstance("", "g", "svc", "", "10.0.0.2", 80), Equals, true)
+	c.Assert(next(c, events).Instances, DeepEquals, []string{})
+
+	instancer.Deregister(events)
+	instancer.Stop()
+}
@@ -0,0 +1,334 @@
+// Package gomicro implements the go-micro registry.Registry on top of a
+// NamingClient. It is a module of its own, go-micro bringing in many
+// dependencies.
+//
+// Every node of a go-micro service is registered as an ephemeral Nacos
+// instance of the service, with the metadata of the service and of the node
+// and the keys nacos.MetadataKeyID and nacos.MetadataKeyVersion set to the id
+// of the node and the version of the service; the protocol of the node is
+// already in its metadata under nacos.MetadataKeyProtocol. The endpoints of
+// the service are not registered. Discovery returns a service per version,
+// with the metadata on the nodes.
+package gomicro
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"go-micro.dev/v4/registry"
+)
+
+var _ registry.Registry = new(Registry)
+
+// Registry registers and discovers go-micro services
+type Registry struct {
+	Naming nacos.NamingClient
+	// GroupName is the group of the services, DEFAULT_GROUP if empty
+	GroupName string
+	// ClusterName is the cluster nodes are registered in, DEFAULT if empty
+	ClusterName string
+	// Clusters restricts discovery to the given clusters
+	Clusters []string
+	// Weight is the weight of the nodes registered, 1 if zero
+	Weight float64
+
+	opts registry.Options
+}
+
+// Init applies the options, which are kept for Options only
+func (r *Registry) Init(opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&r.opts)
+	}
+	return nil
+}
+
+func (r *Registry) Options() registry.Options {
+	return r.opts
+}
+
+func (r *Registry) String() string {
+	return "nacos"
+}
+
+func splitAddress(address string) (string, int, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", 0, fmt.Errorf("address %s: invalid port", address)
+	}
+	return host, p, nil
+}
+
+// Register registers an instance per node of s
+func (r *Registry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	weight := r.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	for _, node := range s.Nodes {
+		host, port, err := splitAddress(node.Address)
+		if err != nil {
+			return err
+		}
+		metadata := nacos.NewMetadata(nil)
+		for k, v := range s.Metadata {
+			metadata.Put(k, v)
+		}
+		for k, v := range node.Metadata {
+			metadata.Put(k, v)
+		}
+		metadata.Put(nacos.MetadataKeyID, node.Id)
+		metadata.Put(nacos.MetadataKeyVersion, s.Version)
+		instance := nacos.NewInstance(s.Name, r.GroupName, r.ClusterName, host, port, weight, true, true, metadata)
+		if _, err := r.Naming.RegisterInstance(instance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deregister deregisters the instances of the nodes of s
+func (r *Registry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	for _, node := range s.Nodes {
+		host, port, err := splitAddress(node.Address)
+		if err != nil {
+			return err
+		}
+		if _, err := r.Naming.DeRegisterInstance(s.Name, r.GroupName, r.ClusterName, host, port, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) selectInstances(name string) []*nacos.Instance {
+	return r.Naming.SelectInstance(nacos.InstanceQueryOptions{
+		ServiceName: name,
+		GroupName:   r.GroupName,
+		ClusterName: r.Clusters,
+		Subscribe:   true,
+	})
+}
+
+// GetService returns the healthy and enabled nodes of the service, by
+// version; registry.ErrNotFound if there is none
+func (r *Registry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	services := toServices(name, r.selectInstances(name))
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+// ListServices returns the names of the services of the group
+func (r *Registry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var options registry.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	names, err := r.Naming.SelectAllServices(ctx, r.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]*registry.Service, len(names))
+	for i, name := range names {
+		services[i] = &registry.Service{Name: name}
+	}
+	return services, nil
+}
+
+// toServices returns the healthy and enabled hosts as nodes of a service per
+// version, ordered by version and id
+func toServices(name string, hosts []*nacos.Instance) []*registry.Service {
+	byVersion := make(map[string]*registry.Service)
+	services := make([]*registry.Service, 0)
+	for _, host := range hosts {
+		if !host.Healthy || !host.Enable {
+			continue
+		}
+		metadata := host.Metadata.Map()
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		address := net.JoinHostPort(host.IP, strconv.Itoa(host.Port))
+		node := &registry.Node{Id: metadata[nacos.MetadataKeyID], Address: address, Metadata: metadata}
+		if node.Id == "" {
+			node.Id = address
+		}
+		version := metadata[nacos.MetadataKeyVersion]
+		delete(metadata, nacos.MetadataKeyID)
+		delete(metadata, nacos.MetadataKeyVersion)
+		service, ok := byVersion[version]
+		if !ok {
+			service = &registry.Service{Name: name, Version: version}
+			byVersion[version] = service
+			services = append(services, service)
+		}
+		service.Nodes = append(service.Nodes, node)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Version < services[j].Version })
+	for _, service := range services {
+		sort.Slice(service.Nodes, func(i, j int) bool { return service.Nodes[i].Id < service.Nodes[j].Id })
+	}
+	return services
+}
+
+// Watch subscribes to the service of the options, or to every service of the
+// group at the time of the call if none
+func (r *Registry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	var options registry.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	names := []string{options.Service}
+	if options.Service == "" {
+		ctx := options.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var err error
+		if names, err = r.Naming.SelectAllServices(ctx, r.GroupName); err != nil {
+			return nil, err
+		}
+	}
+	w := &watcher{
+		r:       r,
+		nodes:   make(map[string]map[string]versionNode),
+		changed: make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	for _, name := range names {
+		w.nodes[name] = flatten(toServices(name, r.selectInstances(name)))
+		l := &serviceListener{w: w, name: name}
+		w.listeners = append(w.listeners, l)
+		r.Naming.Subscribe(name, r.GroupName, r.Clusters, l)
+	}
+	return w, nil
+}
+
+type versionNode struct {
+	version string
+	node    *registry.Node
+}
+
+// flatten returns the nodes of services by version and id
+func flatten(services []*registry.Service) map[string]versionNode {
+	nodes := make(map[string]versionNode)
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			nodes[service.Version+"/"+node.Id] = versionNode{service.Version, node}
+		}
+	}
+	return nodes
+}
+
+type serviceListener struct {
+	w    *watcher
+	name string
+}
+
+func (l *serviceListener) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	l.w.update(l.name, serviceInfo.Hosts)
+}
+
+// watcher turns the instances pushed into the nodes created, updated and
+// deleted since the previous push
+type watcher struct {
+	r         *Registry
+	listeners []*serviceListener
+	changed   chan struct{}
+	stopped   chan struct{}
+	once      sync.Once
+
+	mu      sync.Mutex
+	nodes   map[string]map[string]versionNode
+	results []*registry.Result
+}
+
+func (w *watcher) update(name string, hosts []*nacos.Instance) {
+	nodes := flatten(toServices(name, hosts))
+	w.mu.Lock()
+	previous := w.nodes[name]
+	w.nodes[name] = nodes
+	versions := make(map[string]bool)
+	for _, n := range previous {
+		versions[n.version] = true
+	}
+	changed := make(map[string][]*registry.Node)
+	for key, n := range nodes {
+		if p, ok := previous[key]; !ok || !reflect.DeepEqual(p.node, n.node) {
+			changed[n.version] = append(changed[n.version], n.node)
+		}
+	}
+	deleted := make(map[string][]*registry.Node)
+	for key, p := range previous {
+		if _, ok := nodes[key]; !ok {
+			deleted[p.version] = append(deleted[p.version], p.node)
+		}
+	}
+	for version, nodes := range changed {
+		action := "update"
+		if !versions[version] {
+			action = "create"
+		}
+		w.results = append(w.results, &registry.Result{Action: action, Service: &registry.Service{Name: name, Version: version, Nodes: nodes}})
+	}
+	for version, nodes := range deleted {
+		w.results = append(w.results, &registry.Result{Action: "delete", Service: &registry.Service{Name: name, Version: version, Nodes: nodes}})
+	}
+	notify := len(w.results) > 0
+	w.mu.Unlock()
+	if notify {
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Next returns the next change, registry.ErrWatcherStopped once stopped
+func (w *watcher) Next() (*registry.Result, error) {
+	for {
+		select {
+		case <-w.stopped:
+			return nil, registry.ErrWatcherStopped
+		default:
+		}
+		w.mu.Lock()
+		if len(w.results) > 0 {
+			result := w.results[0]
+			w.results = w.results[1:]
+			w.mu.Unlock()
+			return result, nil
+		}
+		w.mu.Unlock()
+		select {
+		case <-w.stopped:
+			return nil, registry.ErrWatcherStopped
+		case <-w.changed:
+		}
+	}
+}
+
+func (w *watcher) Stop() {
+	w.once.Do(func() {
+		close(w.stopped)
+		for _, l := range w.listeners {
+			w.r.Naming.Unsubscribe(l.name, w.r.GroupName, w.r.Clusters, l)
+		}
+	})
+}
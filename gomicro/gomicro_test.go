@@ -0,0 +1,186 @@
+package gomicro
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"github.com/litgh/nacos-go-sdk/nacosmock"
+	"github.com/litgh/nacos-go-sdk/nacostest"
+	"go-micro.dev/v4/registry"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type GomicroSuite struct {
+	naming *nacosmock.Naming
+	r      *Registry
+}
+
+var _ = Suite(&GomicroSuite{})
+
+func (s *GomicroSuite) SetUpTest(c *C) {
+	s.naming = nacosmock.NewNaming()
+	s.r = &Registry{Naming: s.naming, GroupName: "g"}
+}
+
+func service(version string, nodes ...*registry.Node) *registry.Service {
+	return &registry.Service{
+		Name:     "greeter",
+		Version:  version,
+		Metadata: map[string]string{"zone": "a"},
+		Nodes:    nodes,
+	}
+}
+
+func node(id, address string) *registry.Node {
+	return &registry.Node{Id: id, Address: address, Metadata: map[string]string{"protocol": "grpc"}}
+}
+
+func next(c *C, w registry.Watcher) *registry.Result {
+	results := make(chan *registry.Result, 1)
+	go func() {
+		result, err := w.Next()
+		c.Check(err, IsNil)
+		results <- result
+	}()
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(3 * time.Second):
+		c.Fatal("no change")
+	}
+	return nil
+}
+
+func (s *GomicroSuite) TestRegisterAndGetService(c *C) {
+	c.Assert(s.r.Register(service("1.0", node("a", "10.0.0.1:8080"), node("b", "10.0.0.2:8080"))), IsNil)
+	c.Assert(s.r.Register(service("2.0", node("c", "10.0.0.3:8080"))), IsNil)
+
+	instances := s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "greeter", GroupName: "g"})
+	c.Assert(instances, HasLen, 3)
+	c.Assert(instances[0].Metadata.Map(), DeepEquals, map[string]string{"zone": "a", "protocol": "grpc", "id": "a", "version": "1.0"})
+
+	services, err := s.r.GetService("greeter")
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 2)
+	c.Assert(services[0].Version, Equals, "1.0")
+	c.Assert(services[0].Nodes, DeepEquals, []*registry.Node{
+		{Id: "a", Address: "10.0.0.1:8080", Metadata: map[string]string{"zone": "a", "protocol": "grpc"}},
+		{Id: "b", Address: "10.0.0.2:8080", Metadata: map[string]string{"zone": "a", "protocol": "grpc"}},
+	})
+	c.Assert(services[1].Version, Equals, "2.0")
+
+	list, err := s.r.ListServices()
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []*registry.Service{{Name: "greeter"}})
+
+	c.Assert(s.r.Deregister(service("1.0", node("a", "10.0.0.1:8080"), node("b", "10.0.0.2:8080"))), IsNil)
+	c.Assert(s.r.Deregister(service("2.0", node("c", "10.0.0.3:8080"))), IsNil)
+	_, err = s.r.GetService("greeter")
+	c.Assert(err, Equals, registry.ErrNotFound)
+
+	c.Assert(s.r.Register(service("1.0", node("d", "10.0.0.4"))), NotNil)
+}
+
+func (s *GomicroSuite) TestWatch(c *C) {
+	c.Assert(s.r.Register(service("1.0", node("a", "10.0.0.1:8080"))), IsNil)
+
+	w, err := s.r.Watch(registry.WatchService("greeter"))
+	c.Assert(err, IsNil)
+
+	c.Assert(s.r.Register(service("1.0", node("b", "10.0.0.2:8080"))), IsNil)
+	result := next(c, w)
+	c.Assert(result.Action, Equals, "update")
+	c.Assert(result.Service.Version, Equals, "1.0")
+	c.Assert(result.Service.Nodes, HasLen, 1)
+	c.Assert(result.Service.Nodes[0].Id, Equals, "b")
+
+	c.Assert(s.r.Register(service("2.0", node("c", "10.0.0.3:8080"))), IsNil)
+	result = next(c, w)
+	c.Assert(result.Action, Equals, "create")
+	c.Assert(result.Service.Version, Equals, "2.0")
+
+	s.naming.SetHealthy("greeter", "g", "10.0.0.1", 8080, false)
+	result = next(c, w)
+	c.Assert(result.Action, Equals, "delete")
+	c.Assert(result.Service.Nodes[0].Id, Equals, "a")
+
+	w.Stop()
+	_, err = w.Next()
+	c.Assert(err, Equals, registry.ErrWatcherStopped)
+	c.Assert(s.naming.Listeners("greeter", "g"), Equals, 0)
+}
+
+func (s *GomicroSuite) TestWatchAll(c *C) {
+	c.Assert(s.r.Register(service("1.0", node("a", "10.0.0.1:8080"))), IsNil)
+	w, err := s.r.Watch()
+	c.Assert(err, IsNil)
+	defer w.Stop()
+	c.Assert(s.naming.Listeners("greeter", "g"), Equals, 1)
+}
+
+// GomicroServerSuite runs the registry on a naming client of a nacostest
+// server
+type GomicroServerSuite struct {
+	server *nacostest.Server
+	client nacos.Client
+	r      *Registry
+}
+
+var _ = Suite(&GomicroServerSuite{})
+
+func (s *GomicroServerSuite) SetUpTest(c *C) {
+	s.server = nacostest.NewServer(nacostest.Options{})
+	client, err := nacos.NewClient(&nacos.Config{
+		Scheme:      "http",
+		ContextPath: nacostest.ContextPath,
+		Hosts:       []string{s.server.Addr},
+		CacheDir:    c.MkDir(),
+		LogDir:      c.MkDir(),
+	})
+	c.Assert(err, IsNil)
+	s.client = client
+	s.r = &Registry{Naming: client.Naming(), GroupName: "g"}
+}
+
+func (s *GomicroServerSuite) TearDownTest(c *C) {
+	s.client.Naming().Shutdown(context.Background())
+	s.server.Close()
+}
+
+func (s *GomicroServerSuite) TestRegisterAndWatch(c *C) {
+	c.Assert(s.r.Register(service("1.0", node("a", "10.0.0.1:8080"))), IsNil)
+	c.Assert(s.server.Instances("", "g", "greeter"), HasLen, 1)
+
+	services, err := s.r.GetService("greeter")
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 1)
+	c.Assert(services[0].Nodes, DeepEquals, []*registry.Node{
+		{Id: "a", Address: "10.0.0.1:8080", Metadata: map[string]string{"zone": "a", "protocol": "grpc"}},
+	})
+
+	w, err := s.r.Watch(registry.WatchService("greeter"))
+	c.Assert(err, IsNil)
+
+	c.Assert(s.r.Register(service("2.0", node("b", "10.0.0.2:8080"))), IsNil)
+	result := next(c, w)
+	c.Assert(result.Action, Equals, "create")
+	c.Assert(result.Service.Version, Equals, "2.0")
+
+	c.Assert(s.r.Deregister(service("1.0", node("a", "10.0.0.1:8080"))), IsNil)
+	result = next(c, w)
+	c.Assert(result.Action, Equals, "delete")
+	c.Assert(result.Service.Nodes[0].Id, Equals, "a")
+
+	c.Assert(s.server.RemoveInstance("", "g", "greeter", "", "10.0.0.2", 8080), Equals, true)
+	result = next(c, w)
+	c.Assert(result.Action, Equals, "delete")
+	c.Assert(result.Service.Version, Equals, "2.0")
+
+	w.Stop()
+	_, err = s.r.GetService("greeter")
+	c.Assert(err, Equals, registry.ErrNotFound)
+}
@@ -0,0 +1,574 @@
+package nacos
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+
+	// defaultGrpcPortOffset is the offset of the gRPC port of a Nacos 2.x
+	// server from its HTTP port
+	defaultGrpcPortOffset = 1000
+	defaultServerPort     = 8848
+	grpcRequestTimeout    = 3 * time.Second
+	// the server registers the connection asynchronously after the setup
+	// request, requests sent before are rejected
+	grpcSetupWait = 100 * time.Millisecond
+	// an idle connection is checked this often, and dropped after as many
+	// failed checks in a row
+	grpcHealthCheckInterval = 5 * time.Second
+	grpcHealthCheckRetries  = 3
+	// reconnect attempts back off by grpcReconnectDelay more each time, up
+	// to grpcReconnectMaxDelay, plus up to half of that of jitter
+	grpcReconnectDelay    = 100 * time.Millisecond
+	grpcReconnectMaxDelay = 5 * time.Second
+
+	grpcModuleNaming   = "naming"
+	grpcModuleConfig   = "config"
+	grpcResultSuccess  = 200
+	grpcRequestMethod  = "/Request/request"
+	grpcBiStreamMethod = "/BiRequestStream/requestBiStream"
+)
+
+// grpcResponse is the part shared by every response of the gRPC API
+type grpcResponse struct {
+	ResultCode int    `json:"resultCode"`
+	ErrorCode  int    `json:"errorCode"`
+	Message    string `json:"message"`
+	RequestID  string `json:"requestId"`
+}
+
+type grpcError struct {
+	requestType string
+	code        int
+	message     string
+}
+
+func (e *grpcError) Error() string {
+	return fmt.Sprintf("%s failed, code: %d, message: %s", e.requestType, e.code, e.message)
+}
+
+// ConnectionState is the state of a connection to a Nacos 2.x server
+type ConnectionState int
+
+const (
+	ConnectionDisconnected ConnectionState = iota
+	ConnectionConnected
+)
+
+func (s ConnectionState) String() string {
+	if s == ConnectionConnected {
+		return "CONNECTED"
+	}
+	return "DISCONNECTED"
+}
+
+// ConnectionEvent reports a change of state of a gRPC connection
+type ConnectionEvent struct {
+	// Module is "naming" or "config", each one has its own connection
+	Module string
+	State  ConnectionState
+	// Server is the server connected to, or last connected to once
+	// disconnected, as listed in Config.Hosts
+	Server       string
+	ConnectionID string
+}
+
+// pushHandler handles a request pushed by the server and returns the type
+// of the response acknowledging it
+type pushHandler func(body []byte) string
+
+// grpcClient is one connection to a Nacos 2.x server: unary requests go
+// through the Request service and the server pushes requests through the
+// BiRequestStream opened at connect.
+//
+// The first request connects, from there a goroutine keeps the connection
+// alive: it checks the health of an idle connection and reconnects, to the
+// next server of the list, once the check fails, the stream breaks or the
+// server asks for it by a ConnectResetRequest. Requests fail while
+// disconnected, the owners of the client redo their state on reconnect.
+type grpcClient struct {
+	sync.Mutex
+	c        *client
+	module   string
+	servers  func() []string
+	handlers map[string]pushHandler
+	redo     []func()
+
+	healthCheckInterval time.Duration
+	started             bool
+	server              string
+	conn                *grpc.ClientConn
+	stream              grpc.ClientStream
+	cancel              context.CancelFunc
+	connectionID        string
+	closed              bool
+	// last time the server answered, in unix nanoseconds
+	lastActive atomic.Int64
+	// reconnect requests, to the given server or to the next one if empty
+	resets chan string
+	done   chan struct{}
+	// serializes sends on the stream
+	sendMu sync.Mutex
+}
+
+func newGrpcClient(c *client, module string, servers func() []string) *grpcClient {
+	return &grpcClient{
+		c:                   c,
+		module:              module,
+		servers:             servers,
+		handlers:            make(map[string]pushHandler),
+		healthCheckInterval: grpcHealthCheckInterval,
+		resets:              make(chan string, 1),
+		done:                make(chan struct{}),
+	}
+}
+
+// handle registers the handler of a request type pushed by the server, it
+// must be called before the first request
+func (gc *grpcClient) handle(requestType string, h pushHandler) {
+	gc.handlers[requestType] = h
+}
+
+// onReconnected registers a function called once connected again, it must
+// be called before the first request
+func (gc *grpcClient) onReconnected(redo func()) {
+	gc.redo = append(gc.redo, redo)
+}
+
+func (gc *grpcClient) grpcAddress(server string) string {
+	host, port := server, defaultServerPort
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host = h
+		if n, err := strconv.Atoi(p); err == nil {
+			port = n
+		}
+	}
+	offset := gc.c.config.GrpcPortOffset
+	if offset == 0 {
+		offset = defaultGrpcPortOffset
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port+offset))
+}
+
+// start connects on the first call and starts keeping the connection alive,
+// the error of the first connect is returned
+func (gc *grpcClient) start() error {
+	gc.Lock()
+	defer gc.Unlock()
+	if gc.closed {
+		return errors.New("grpc client closed")
+	}
+	if gc.started {
+		return nil
+	}
+	gc.started = true
+	err := gc.connect()
+	go gc.keepAlive(err == nil)
+	return err
+}
+
+// connect opens a connection to the first server answering, starting from
+// a random one
+func (gc *grpcClient) connect() error {
+	servers := gc.servers()
+	if len(servers) == 0 {
+		return errors.New("no server available")
+	}
+	var err error
+	idx := rand.Intn(len(servers))
+	for i := 0; i < len(servers); i++ {
+		server := servers[(idx+i)%len(servers)]
+		if err = gc.connectTo(server); err == nil {
+			return nil
+		}
+		gc.c.logger.Warn("failed to connect to %s, %v", server, err)
+	}
+	return errors.New("failed to connect after all servers(" + fmt.Sprint(servers) + ") tried: " + err.Error())
+}
+
+// nextServer returns the server following current in the list
+func (gc *grpcClient) nextServer(current string) (string, error) {
+	servers := gc.servers()
+	if len(servers) == 0 {
+		return "", errors.New("no server available")
+	}
+	idx := rand.Intn(len(servers))
+	for i, server := range servers {
+		if server == current {
+			idx = i + 1
+			break
+		}
+	}
+	return servers[idx%len(servers)], nil
+}
+
+// grpcConnection is a connection set up with a server, not in use yet
+type grpcConnection struct {
+	server       string
+	conn         *grpc.ClientConn
+	stream       grpc.ClientStream
+	cancel       context.CancelFunc
+	connectionID string
+}
+
+func (gconn *grpcConnection) close() {
+	gconn.cancel()
+	gconn.conn.Close()
+}
+
+// connectTo connects to server, the lock is held
+func (gc *grpcClient) connectTo(server string) error {
+	gconn, err := gc.dial(server)
+	if err != nil {
+		return err
+	}
+	gc.use(gconn)
+	return nil
+}
+
+// dial sets a connection up with server, it does not need the lock
+func (gc *grpcClient) dial(server string) (*grpcConnection, error) {
+	creds := insecure.NewCredentials()
+	if gc.c.config.Scheme == "https" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(gc.grpcAddress(server),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(payloadCodec{})))
+	if err != nil {
+		return nil, err
+	}
+	var check struct {
+		grpcResponse
+		ConnectionID string `json:"connectionId"`
+	}
+	if err := gc.invoke(context.Background(), conn, "ServerCheckRequest", map[string]interface{}{"module": "internal"}, &check); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(gc.c.ctx)
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, grpcBiStreamMethod)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+	labels := map[string]string{"source": "sdk", "module": gc.module}
+	if gc.c.config.AppName != "" {
+		labels["AppName"] = gc.c.config.AppName
+	}
+	setup := map[string]interface{}{
+		"clientVersion": "Nacos-Go-Client:v" + ClientVersion,
+		"tenant":        gc.c.config.Namespace,
+		"labels":        labels,
+		"abilities":     map[string]interface{}{},
+	}
+	if err := stream.SendMsg(gc.newPayload("ConnectionSetupRequest", setup)); err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+	time.Sleep(grpcSetupWait)
+	return &grpcConnection{server: server, conn: conn, stream: stream, cancel: cancel, connectionID: check.ConnectionID}, nil
+}
+
+// use makes gconn the connection of the client, the lock is held
+func (gc *grpcClient) use(gconn *grpcConnection) {
+	gc.server = gconn.server
+	gc.conn = gconn.conn
+	gc.stream = gconn.stream
+	gc.cancel = gconn.cancel
+	gc.connectionID = gconn.connectionID
+	gc.c.logger.Info("grpc connection %s to %s established", gc.connectionID, gc.server)
+	go gc.receive(gconn.stream)
+}
+
+// keepAlive reconnects when asked to or when the health check of an idle
+// connection fails, until the client is closed
+func (gc *grpcClient) keepAlive(connected bool) {
+	if connected {
+		gc.notify(ConnectionConnected)
+	} else {
+		gc.reconnect("")
+	}
+	ticker := time.NewTicker(gc.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-gc.done:
+			return
+		case server := <-gc.resets:
+			gc.reconnect(server)
+		case <-ticker.C:
+			if time.Since(time.Unix(0, gc.lastActive.Load())) < gc.healthCheckInterval {
+				continue
+			}
+			if !gc.healthCheck() {
+				gc.reconnect("")
+			}
+		}
+	}
+}
+
+func (gc *grpcClient) healthCheck() bool {
+	gc.Lock()
+	conn := gc.conn
+	gc.Unlock()
+	if conn == nil {
+		return false
+	}
+	for i := 0; i < grpcHealthCheckRetries; i++ {
+		err := gc.invoke(context.Background(), conn, "HealthCheckRequest", map[string]interface{}{}, nil)
+		if err == nil {
+			return true
+		}
+		gc.c.logger.Warn("health check of grpc connection %s failed, %v", gc.connectionID, err)
+	}
+	return false
+}
+
+// reconnect drops the connection and connects to server, or to the next
+// servers of the list, backing off with jitter until one answers. The lock
+// is only held to swap the connection in, not while dialing
+func (gc *grpcClient) reconnect(server string) {
+	if gc.disconnect() {
+		gc.notify(ConnectionDisconnected)
+	}
+	for attempt := 1; ; attempt++ {
+		gc.Lock()
+		closed, current := gc.closed, gc.server
+		gc.Unlock()
+		if closed {
+			return
+		}
+		target := server
+		server = ""
+		var err error
+		if target == "" {
+			target, err = gc.nextServer(current)
+		}
+		var gconn *grpcConnection
+		if err == nil {
+			gconn, err = gc.dial(target)
+		}
+		if err == nil {
+			gc.Lock()
+			closed = gc.closed
+			if !closed {
+				gc.use(gconn)
+			}
+			gc.Unlock()
+			if closed {
+				gconn.close()
+				return
+			}
+			break
+		}
+		gc.c.logger.Warn("failed to reconnect, attempt %d, %v", attempt, err)
+		delay := grpcReconnectDelay * time.Duration(attempt)
+		if delay > grpcReconnectMaxDelay {
+			delay = grpcReconnectMaxDelay
+		}
+		delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+		select {
+		case <-time.After(delay):
+		case <-gc.done:
+			return
+		}
+	}
+	// a reset asked for while reconnecting is served by now
+	select {
+	case <-gc.resets:
+	default:
+	}
+	gc.notify(ConnectionConnected)
+	for _, redo := range gc.redo {
+		redo()
+	}
+}
+
+// disconnect drops the connection, it returns whether there was one
+func (gc *grpcClient) disconnect() bool {
+	gc.Lock()
+	defer gc.Unlock()
+	if gc.conn == nil {
+		return false
+	}
+	gc.cancel()
+	gc.conn.Close()
+	gc.conn = nil
+	gc.stream = nil
+	return true
+}
+
+// reset asks keepAlive to reconnect, unless the stream is not the one of the
+// current connection anymore
+func (gc *grpcClient) reset(stream grpc.ClientStream, server string) {
+	gc.Lock()
+	current := gc.stream == stream && !gc.closed
+	gc.Unlock()
+	if !current {
+		return
+	}
+	select {
+	case gc.resets <- server:
+	default:
+	}
+}
+
+func (gc *grpcClient) notify(state ConnectionState) {
+	gc.Lock()
+	event := ConnectionEvent{Module: gc.module, State: state, Server: gc.server, ConnectionID: gc.connectionID}
+	gc.Unlock()
+	gc.c.connectionChanged(event)
+}
+
+// receive serves the requests pushed by the server until the stream breaks
+func (gc *grpcClient) receive(stream grpc.ClientStream) {
+	for {
+		var p payload
+		if err := stream.RecvMsg(&p); err != nil {
+			if !gc.isClosed() {
+				gc.c.logger.Warn("grpc stream of %s closed, %v", gc.connectionID, err)
+			}
+			gc.reset(stream, "")
+			return
+		}
+		gc.lastActive.Store(time.Now().UnixNano())
+		var req struct {
+			grpcResponse
+			ServerIP   string `json:"serverIp"`
+			ServerPort string `json:"serverPort"`
+		}
+		json.Unmarshal(p.Body, &req)
+		var typ string
+		if h, ok := gc.handlers[p.Type]; ok {
+			typ = h(p.Body)
+		} else if p.Type == "ClientDetectionRequest" {
+			typ = "ClientDetectionResponse"
+		} else if p.Type == "ConnectResetRequest" {
+			typ = "ConnectResetResponse"
+		} else {
+			gc.c.logger.Warn("unknown request %s pushed by server", p.Type)
+			continue
+		}
+		ack := &grpcResponse{ResultCode: grpcResultSuccess, RequestID: req.RequestID}
+		gc.sendMu.Lock()
+		err := stream.SendMsg(gc.newPayload(typ, ack))
+		gc.sendMu.Unlock()
+		if err != nil {
+			gc.c.logger.Warn("failed to ack %s, %v", p.Type, err)
+		}
+		if p.Type == "ConnectResetRequest" {
+			var server string
+			if req.ServerIP != "" {
+				server = net.JoinHostPort(req.ServerIP, req.ServerPort)
+			}
+			gc.c.logger.Info("server asked grpc connection %s to reconnect to %q", gc.connectionID, server)
+			gc.reset(stream, server)
+		}
+	}
+}
+
+func (gc *grpcClient) newPayload(requestType string, body interface{}) *payload {
+	headers := map[string]string{
+		"Client-Version": ClientVersion,
+		"app":            "unknown",
+	}
+	if gc.c.config.AppName != "" {
+		headers["app"] = gc.c.config.AppName
+	}
+	if gc.c.token.AccessToken != "" {
+		headers["accessToken"] = gc.c.token.AccessToken
+	}
+	return &payload{
+		Type:     requestType,
+		ClientIP: GetLocalIP(),
+		Headers:  headers,
+		Body:     []byte(encode(body)),
+	}
+}
+
+// request sends a request of the given type and decodes the response into
+// resp, which may be nil
+func (gc *grpcClient) request(ctx context.Context, requestType string, req, resp interface{}) error {
+	if err := gc.start(); err != nil {
+		return err
+	}
+	gc.Lock()
+	conn := gc.conn
+	gc.Unlock()
+	if conn == nil {
+		return errors.New("grpc connection lost, reconnecting")
+	}
+	return gc.invoke(ctx, conn, requestType, req, resp)
+}
+
+func (gc *grpcClient) invoke(ctx context.Context, conn *grpc.ClientConn, requestType string, req, resp interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grpcRequestTimeout)
+		defer cancel()
+	}
+	var out payload
+	if err := conn.Invoke(ctx, grpcRequestMethod, gc.newPayload(requestType, req), &out); err != nil {
+		return err
+	}
+	gc.lastActive.Store(time.Now().UnixNano())
+	if gc.c.logger.IsDebugEnable() {
+		gc.c.logger.Debug("%s: %s", out.Type, string(out.Body))
+	}
+	var r grpcResponse
+	if err := json.Unmarshal(out.Body, &r); err != nil {
+		return err
+	}
+	if r.ResultCode != grpcResultSuccess {
+		return &grpcError{requestType: requestType, code: r.ErrorCode, message: r.Message}
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(out.Body, resp)
+}
+
+func (gc *grpcClient) isClosed() bool {
+	gc.Lock()
+	defer gc.Unlock()
+	return gc.closed
+}
+
+func (gc *grpcClient) close() {
+	gc.Lock()
+	defer gc.Unlock()
+	if gc.closed {
+		return
+	}
+	gc.closed = true
+	close(gc.done)
+	if gc.conn != nil {
+		gc.cancel()
+		gc.conn.Close()
+		gc.conn = nil
+		gc.stream = nil
+	}
+}
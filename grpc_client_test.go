@@ -0,0 +1,379 @@
+package nacos
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	. "gopkg.in/check.v1"
+)
+
+// grpcStandIn is an in-process stand-in for the gRPC API of a Nacos 2.x
+// server. Requests are answered by the handler of their type, or with a
+// bare success; every request received is recorded.
+type grpcStandIn struct {
+	sync.Mutex
+	srv      *grpc.Server
+	lis      net.Listener
+	nextID   int
+	streams  map[string]grpc.ServerStream
+	requests []*payload
+	handlers map[string]func(*payload) interface{}
+	acks     chan *payload
+}
+
+func newGrpcStandIn(c *C) *grpcStandIn {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s := &grpcStandIn{
+		lis:      lis,
+		srv:      grpc.NewServer(grpc.ForceServerCodec(payloadCodec{})),
+		streams:  make(map[string]grpc.ServerStream),
+		handlers: make(map[string]func(*payload) interface{}),
+		acks:     make(chan *payload, 16),
+	}
+	s.srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "Request",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "request",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var p payload
+				if err := dec(&p); err != nil {
+					return nil, err
+				}
+				return s.request(ctx, &p), nil
+			},
+		}},
+	}, s)
+	s.srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "BiRequestStream",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "requestBiStream",
+			ServerStreams: true,
+			ClientStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				return s.biStream(stream)
+			},
+		}},
+	}, s)
+	go s.srv.Serve(lis)
+	return s
+}
+
+// host returns the HTTP address of the stand-in for Config.Hosts
+func (s *grpcStandIn) host() string {
+	port := s.lis.Addr().(*net.TCPAddr).Port
+	return "127.0.0.1:" + strconv.Itoa(port-defaultGrpcPortOffset)
+}
+
+func (s *grpcStandIn) handle(requestType string, h func(*payload) interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.handlers[requestType] = h
+}
+
+func (s *grpcStandIn) request(ctx context.Context, p *payload) *payload {
+	responseType := strings.TrimSuffix(p.Type, "Request") + "Response"
+	if p.Type == "ServerCheckRequest" {
+		s.Lock()
+		s.nextID++
+		id := s.nextID
+		h := s.handlers[p.Type]
+		s.Unlock()
+		if h != nil {
+			h(p)
+		}
+		return &payload{Type: responseType, Body: []byte(fmt.Sprintf(`{"resultCode":200,"connectionId":"conn-%d"}`, id))}
+	}
+	pr, _ := peer.FromContext(ctx)
+	s.Lock()
+	_, registered := s.streams[pr.Addr.String()]
+	s.requests = append(s.requests, p)
+	h := s.handlers[p.Type]
+	s.Unlock()
+	if !registered {
+		return &payload{Type: "ErrorResponse", Body: []byte(`{"resultCode":500,"errorCode":301,"message":"connection is unregistered"}`)}
+	}
+	var body interface{} = &grpcResponse{ResultCode: grpcResultSuccess}
+	if h != nil {
+		if b := h(p); b != nil {
+			body = b
+		}
+	}
+	return &payload{Type: responseType, Body: []byte(encode(body))}
+}
+
+func (s *grpcStandIn) biStream(stream grpc.ServerStream) error {
+	var setup payload
+	if err := stream.RecvMsg(&setup); err != nil {
+		return err
+	}
+	if setup.Type != "ConnectionSetupRequest" {
+		return fmt.Errorf("unexpected %s", setup.Type)
+	}
+	pr, _ := peer.FromContext(stream.Context())
+	addr := pr.Addr.String()
+	s.Lock()
+	s.streams[addr] = stream
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.streams, addr)
+		s.Unlock()
+	}()
+	for {
+		var ack payload
+		if err := stream.RecvMsg(&ack); err != nil {
+			return nil
+		}
+		s.acks <- &ack
+	}
+}
+
+// push sends a request to every connected client
+func (s *grpcStandIn) push(requestType string, body map[string]interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.nextID++
+	body["requestId"] = strconv.Itoa(s.nextID)
+	for _, stream := range s.streams {
+		stream.SendMsg(&payload{Type: requestType, Body: []byte(encode(body))})
+	}
+}
+
+// received returns the requests of a type received so far
+func (s *grpcStandIn) received(requestType string) []map[string]interface{} {
+	s.Lock()
+	defer s.Unlock()
+	var bodies []map[string]interface{}
+	for _, p := range s.requests {
+		if p.Type == requestType {
+			var body map[string]interface{}
+			json.Unmarshal(p.Body, &body)
+			bodies = append(bodies, body)
+		}
+	}
+	return bodies
+}
+
+func (s *grpcStandIn) connections() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.streams)
+}
+
+func (s *grpcStandIn) stop() {
+	s.srv.Stop()
+}
+
+type GrpcClientSuite struct{}
+
+var _ = Suite(&GrpcClientSuite{})
+
+func (s *GrpcClientSuite) TestPayloadCodec(c *C) {
+	p := &payload{
+		Type:     "InstanceRequest",
+		ClientIP: "10.0.0.1",
+		Headers:  map[string]string{"accessToken": "t", "app": "web"},
+		Body:     []byte(`{"namespace":"public"}`),
+	}
+	b, err := payloadCodec{}.Marshal(p)
+	c.Assert(err, IsNil)
+	var out payload
+	c.Assert(payloadCodec{}.Unmarshal(b, &out), IsNil)
+	c.Assert(out, DeepEquals, *p)
+}
+
+func (s *GrpcClientSuite) TestRequestAndPush(c *C) {
+	standIn := newGrpcStandIn(c)
+	defer standIn.stop()
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Hosts = []string{standIn.host()}
+	ns.c.token.AccessToken = "token"
+
+	pushed := make(chan string, 1)
+	gc := newGrpcClient(ns.c, grpcModuleNaming, ns.getServerList)
+	defer gc.close()
+	gc.handle("NotifySubscriberRequest", func(body []byte) string {
+		pushed <- string(body)
+		return "NotifySubscriberResponse"
+	})
+	standIn.handle("ServiceQueryRequest", func(p *payload) interface{} {
+		return map[string]interface{}{"resultCode": 500, "errorCode": 20404, "message": "not found"}
+	})
+
+	c.Assert(gc.request(context.Background(), "InstanceRequest", map[string]string{"namespace": "public"}, nil), IsNil)
+	c.Assert(standIn.received("InstanceRequest"), HasLen, 1)
+	standIn.Lock()
+	c.Assert(standIn.requests[0].Headers["accessToken"], Equals, "token")
+	standIn.Unlock()
+	c.Assert(gc.connectionID, Equals, "conn-1")
+
+	err := gc.request(context.Background(), "ServiceQueryRequest", map[string]string{}, nil)
+	c.Assert(err, ErrorMatches, "ServiceQueryRequest failed, code: 20404, message: not found")
+
+	standIn.push("NotifySubscriberRequest", map[string]interface{}{"serviceInfo": map[string]string{"name": "svc"}})
+	select {
+	case body := <-pushed:
+		c.Assert(strings.Contains(body, `"name":"svc"`), Equals, true)
+	case <-time.After(time.Second):
+		c.Fatal("push not received")
+	}
+	select {
+	case ack := <-standIn.acks:
+		c.Assert(ack.Type, Equals, "NotifySubscriberResponse")
+		c.Assert(strings.Contains(string(ack.Body), `"requestId":"2"`), Equals, true)
+	case <-time.After(time.Second):
+		c.Fatal("push not acknowledged")
+	}
+}
+
+func (s *GrpcClientSuite) TestNoServer(c *C) {
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Hosts = []string{"127.0.0.1:1"}
+	gc := newGrpcClient(ns.c, grpcModuleNaming, ns.getServerList)
+	err := gc.request(context.Background(), "InstanceRequest", nil, nil)
+	c.Assert(err, ErrorMatches, "failed to connect after all servers.*")
+}
+
+type connectionFunc func(ConnectionEvent)
+
+func (f connectionFunc) OnConnectionChange(event ConnectionEvent) {
+	f(event)
+}
+
+// connectToEither connects a client to either stand-in, it returns the
+// client, the one connected to, the other and the state changes to come
+func connectToEither(c *C, standIns [2]*grpcStandIn, healthCheckInterval time.Duration) (*grpcClient, *grpcStandIn, *grpcStandIn, chan ConnectionEvent) {
+	ns := newOfflineNamingClient(c)
+	ns.c.config.Hosts = []string{standIns[0].host(), standIns[1].host()}
+	events := make(chan ConnectionEvent, 8)
+	ns.c.AddConnectionListener(connectionFunc(func(event ConnectionEvent) { events <- event }))
+	gc := newGrpcClient(ns.c, grpcModuleNaming, ns.getServerList)
+	gc.healthCheckInterval = healthCheckInterval
+	c.Assert(gc.request(context.Background(), "InstanceRequest", nil, nil), IsNil)
+	event := expectConnection(c, events, ConnectionConnected)
+	if event.Server == standIns[0].host() {
+		return gc, standIns[0], standIns[1], events
+	}
+	return gc, standIns[1], standIns[0], events
+}
+
+func expectConnection(c *C, events chan ConnectionEvent, state ConnectionState) ConnectionEvent {
+	select {
+	case event := <-events:
+		c.Assert(event.State, Equals, state)
+		c.Assert(event.Module, Equals, grpcModuleNaming)
+		return event
+	case <-time.After(3 * time.Second):
+		c.Fatalf("not %s", state)
+	}
+	return ConnectionEvent{}
+}
+
+func (s *GrpcClientSuite) TestReconnectToNextServer(c *C) {
+	standIns := [2]*grpcStandIn{newGrpcStandIn(c), newGrpcStandIn(c)}
+	defer standIns[0].stop()
+	defer standIns[1].stop()
+	gc, first, next, events := connectToEither(c, standIns, time.Minute)
+	defer gc.c.cancel()
+	defer gc.close()
+	redone := make(chan struct{}, 1)
+	gc.onReconnected(func() { redone <- struct{}{} })
+
+	first.stop()
+	c.Assert(expectConnection(c, events, ConnectionDisconnected).Server, Equals, first.host())
+	c.Assert(expectConnection(c, events, ConnectionConnected).Server, Equals, next.host())
+	select {
+	case <-redone:
+	case <-time.After(time.Second):
+		c.Fatal("not redone")
+	}
+	c.Assert(gc.request(context.Background(), "InstanceRequest", nil, nil), IsNil)
+	c.Assert(next.received("InstanceRequest"), HasLen, 1)
+}
+
+func (s *GrpcClientSuite) TestConnectReset(c *C) {
+	standIns := [2]*grpcStandIn{newGrpcStandIn(c), newGrpcStandIn(c)}
+	defer standIns[0].stop()
+	defer standIns[1].stop()
+	gc, first, next, events := connectToEither(c, standIns, time.Minute)
+	defer gc.c.cancel()
+	defer gc.close()
+
+	ip, port, _ := net.SplitHostPort(next.host())
+	first.push("ConnectResetRequest", map[string]interface{}{"serverIp": ip, "serverPort": port})
+	select {
+	case ack := <-first.acks:
+		c.Assert(ack.Type, Equals, "ConnectResetResponse")
+	case <-time.After(time.Second):
+		c.Fatal("reset not acknowledged")
+	}
+	expectConnection(c, events, ConnectionDisconnected)
+	c.Assert(expectConnection(c, events, ConnectionConnected).Server, Equals, next.host())
+	c.Assert(next.connections(), Equals, 1)
+}
+
+func (s *GrpcClientSuite) TestHealthCheck(c *C) {
+	standIns := [2]*grpcStandIn{newGrpcStandIn(c), newGrpcStandIn(c)}
+	defer standIns[0].stop()
+	defer standIns[1].stop()
+	gc, first, next, events := connectToEither(c, standIns, 50*time.Millisecond)
+	defer gc.c.cancel()
+	defer gc.close()
+
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(len(first.received("HealthCheckRequest")) > 0, Equals, true)
+	select {
+	case event := <-events:
+		c.Fatalf("unexpected %s", event.State)
+	default:
+	}
+
+	first.handle("HealthCheckRequest", func(*payload) interface{} {
+		return &grpcResponse{ResultCode: 500, ErrorCode: 500, Message: "unhealthy"}
+	})
+	expectConnection(c, events, ConnectionDisconnected)
+	c.Assert(expectConnection(c, events, ConnectionConnected).Server, Equals, next.host())
+}
+
+func (s *GrpcClientSuite) TestReconnectWithoutLock(c *C) {
+	standIns := [2]*grpcStandIn{newGrpcStandIn(c), newGrpcStandIn(c)}
+	defer standIns[0].stop()
+	defer standIns[1].stop()
+	gc, first, next, events := connectToEither(c, standIns, time.Minute)
+	defer gc.c.cancel()
+	defer gc.close()
+
+	release := make(chan struct{})
+	next.handle("ServerCheckRequest", func(*payload) interface{} {
+		<-release
+		return nil
+	})
+	first.stop()
+	expectConnection(c, events, ConnectionDisconnected)
+
+	// requests fail fast while the reconnect waits for the server check
+	failed := make(chan error, 1)
+	go func() {
+		failed <- gc.request(context.Background(), "InstanceRequest", nil, nil)
+	}()
+	select {
+	case err := <-failed:
+		c.Assert(err, ErrorMatches, "grpc connection lost, reconnecting")
+	case <-time.After(time.Second):
+		c.Fatal("request blocked by the reconnect")
+	}
+	close(release)
+	c.Assert(expectConnection(c, events, ConnectionConnected).Server, Equals, next.host())
+}
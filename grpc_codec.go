@@ -0,0 +1,146 @@
+package nacos
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// payload is the only message of the Nacos 2.x gRPC services:
+//
+//	message Metadata {
+//	  string type = 3;
+//	  string clientIp = 8;
+//	  map<string, string> headers = 7;
+//	}
+//	message Payload {
+//	  Metadata metadata = 2;
+//	  google.protobuf.Any body = 3;
+//	}
+//
+// The body is the JSON of the request or response named by type, carried in
+// the value of the Any without a type url.
+type payload struct {
+	Type     string
+	ClientIP string
+	Headers  map[string]string
+	Body     []byte
+}
+
+// payloadCodec encodes payloads without generated code. It is passed to
+// each call instead of being registered, so it does not replace the proto
+// codec of other gRPC clients in the process; its name keeps the standard
+// application/grpc+proto content type.
+type payloadCodec struct{}
+
+func (payloadCodec) Name() string {
+	return "proto"
+}
+
+func (payloadCodec) Marshal(v interface{}) ([]byte, error) {
+	p, ok := v.(*payload)
+	if !ok {
+		return nil, fmt.Errorf("payloadCodec: cannot marshal %T", v)
+	}
+	var metadata []byte
+	metadata = protowire.AppendTag(metadata, 3, protowire.BytesType)
+	metadata = protowire.AppendString(metadata, p.Type)
+	for k, v := range p.Headers {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+		metadata = protowire.AppendTag(metadata, 7, protowire.BytesType)
+		metadata = protowire.AppendBytes(metadata, entry)
+	}
+	metadata = protowire.AppendTag(metadata, 8, protowire.BytesType)
+	metadata = protowire.AppendString(metadata, p.ClientIP)
+
+	var body []byte
+	body = protowire.AppendTag(body, 2, protowire.BytesType)
+	body = protowire.AppendBytes(body, p.Body)
+
+	var b []byte
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, metadata)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, body)
+	return b, nil
+}
+
+func (payloadCodec) Unmarshal(data []byte, v interface{}) error {
+	p, ok := v.(*payload)
+	if !ok {
+		return fmt.Errorf("payloadCodec: cannot unmarshal into %T", v)
+	}
+	*p = payload{}
+	return walkFields(data, func(num protowire.Number, b []byte) error {
+		switch num {
+		case 2:
+			return walkFields(b, func(num protowire.Number, b []byte) error {
+				switch num {
+				case 3:
+					p.Type = string(b)
+				case 8:
+					p.ClientIP = string(b)
+				case 7:
+					var k, v string
+					err := walkFields(b, func(num protowire.Number, b []byte) error {
+						if num == 1 {
+							k = string(b)
+						} else if num == 2 {
+							v = string(b)
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					if p.Headers == nil {
+						p.Headers = make(map[string]string)
+					}
+					p.Headers[k] = v
+				}
+				return nil
+			})
+		case 3:
+			return walkFields(b, func(num protowire.Number, b []byte) error {
+				if num == 2 {
+					p.Body = append([]byte(nil), b...)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// walkFields calls fn with every length delimited field of a message and
+// skips the others, none of the payload fields are scalars
+func walkFields(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := fn(num, v); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
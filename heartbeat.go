@@ -1,151 +1,451 @@
 package nacos
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var beatSignal = struct{}{}
+const (
+	beatWorkers = 8
+	// codeResourceNotFound is returned by the server for a beat of an
+	// instance it does not know about
+	codeResourceNotFound = 20404
+)
 
+// heartbeat sends the beats of all ephemeral instances registered by this
+// client. The beats of one service are coalesced into a beatGroup, groups
+// are kept in a heap ordered by their next due time and fired by a single
+// scheduler goroutine; at most beatWorkers beats are in flight.
 type heartbeat struct {
+	sync.Mutex
 	nc               *namingClient
 	dom2Beat         map[string]*beat
-	lightBeatEnabled bool
+	groups           map[string]*beatGroup
+	queue            beatQueue
+	wakeup           chan struct{}
+	workers          chan struct{}
+	lightBeatEnabled int32
 }
 
 func newHeartbeat(nc *namingClient) *heartbeat {
-	return &heartbeat{
+	h := &heartbeat{
 		nc:       nc,
 		dom2Beat: make(map[string]*beat),
+		groups:   make(map[string]*beatGroup),
+		wakeup:   make(chan struct{}, 1),
+		workers:  make(chan struct{}, beatWorkers),
 	}
+	go h.run(nc.c.ctx)
+	return h
 }
 
 type beat struct {
+	key         string
 	serviceName string
 	cluster     string
 	ip          string
 	port        int
 	weight      float64
 	metadata    *Metadata
-	scheduled   bool
-	stop        context.CancelFunc
-	next        chan struct{}
-	period      int64
+	instance    *Instance
+	period      time.Duration
+	stopped     bool
+	inflight    bool
+	stats       BeatStats
+}
+
+// beatGroup holds the beats of one service, which share a schedule
+type beatGroup struct {
+	serviceName string
+	beats       map[string]*beat
+	next        time.Time
+	// index in the beat queue, -1 while the group is not queued
+	index int
+}
+
+// BeatStats describes the heartbeat of one registered instance
+type BeatStats struct {
+	ServiceName  string
+	IP           string
+	Port         int
+	Period       time.Duration
+	Sent         int64
+	Failed       int64
+	Reregistered int64
+	LastBeat     time.Time
+	LastError    string
+}
+
+type beatResult struct {
+	Code               int   `json:"code"`
+	ClientBeatInterval int64 `json:"clientBeatInterval"`
+	LightBeatEnabled   bool  `json:"lightBeatEnabled"`
 }
 
 func newBeat(groupedServiceName string, instance *Instance) *beat {
+	period := metaKeyHeartBeatIntervalDefault
+	if instance.Metadata != nil {
+		period = instance.Metadata.GetWithDefault(metaKeyHeartBeatInterval, metaKeyHeartBeatIntervalDefault, func(value string) (interface{}, error) {
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return time.Duration(ms) * time.Millisecond, nil
+			}
+			return time.ParseDuration(value)
+		}).(time.Duration)
+	}
 	return &beat{
+		key:         buildKey(groupedServiceName, instance.IP, instance.Port),
 		serviceName: groupedServiceName,
 		cluster:     instance.ClusterName,
 		ip:          instance.IP,
 		port:        instance.Port,
 		weight:      instance.Weight,
-		metadata:    instance.Metadata,
-		scheduled:   false,
-		next:        make(chan struct{}),
-		period: instance.Metadata.GetWithDefault(metaKeyHeartBeatInterval, metaKeyHeartBeatIntervalDefault.Milliseconds(), func(value string) (interface{}, error) {
-			d, err := time.ParseDuration(value)
-			if err != nil {
-				return nil, err
-			}
-			return d.Milliseconds(), nil
-		}).(int64),
+		metadata:    instance.Metadata.clone(),
+		instance:    instance.clone(),
+		period:      period,
 	}
 }
 
+func (b *beat) encode() string {
+	return encode(map[string]interface{}{
+		"serviceName": b.serviceName,
+		"cluster":     b.cluster,
+		"ip":          b.ip,
+		"port":        b.port,
+		"weight":      b.weight,
+		"metadata":    b.metadata,
+		"period":      b.period.Milliseconds(),
+		"scheduled":   false,
+		"stopped":     b.stopped,
+	})
+}
+
 func (h *heartbeat) addBeat(beatInfo *beat) {
-	key := buildKey(beatInfo.serviceName, beatInfo.ip, beatInfo.port)
+	h.Lock()
+	defer h.Unlock()
+	if b, ok := h.dom2Beat[beatInfo.key]; ok {
+		// an instance registered again keeps its stats
+		beatInfo.stats = b.stats
+		h.stopLocked(b)
+	}
+	beatInfo.stats.ServiceName = beatInfo.serviceName
+	beatInfo.stats.IP = beatInfo.ip
+	beatInfo.stats.Port = beatInfo.port
+	h.dom2Beat[beatInfo.key] = beatInfo
+	g, ok := h.groups[beatInfo.serviceName]
+	if !ok {
+		g = &beatGroup{
+			serviceName: beatInfo.serviceName,
+			beats:       make(map[string]*beat),
+			index:       -1,
+		}
+		h.groups[beatInfo.serviceName] = g
+		g.beats[beatInfo.key] = beatInfo
+		h.pushLocked(g, beatInfo.period)
+		return
+	}
+	// the instance joins the next round of its service
+	g.beats[beatInfo.key] = beatInfo
+}
 
+func (h *heartbeat) removeBeat(serviceName, ip string, port int) {
+	h.Lock()
+	defer h.Unlock()
+	key := buildKey(serviceName, ip, port)
 	if b, ok := h.dom2Beat[key]; ok {
-		b.stop()
-		delete(h.dom2Beat, key)
+		h.stopLocked(b)
+	}
+}
+
+func (h *heartbeat) stopLocked(b *beat) {
+	b.stopped = true
+	delete(h.dom2Beat, b.key)
+	g, ok := h.groups[b.serviceName]
+	if !ok {
+		return
 	}
+	delete(g.beats, b.key)
+	if len(g.beats) == 0 {
+		delete(h.groups, b.serviceName)
+		if g.index >= 0 {
+			heap.Remove(&h.queue, g.index)
+		}
+	}
+}
 
-	h.dom2Beat[key] = beatInfo
-	ctx, cancel := context.WithCancel(context.Background())
-	beatInfo.stop = cancel
+func (h *heartbeat) pushLocked(g *beatGroup, d time.Duration) {
+	g.next = time.Now().Add(d)
+	heap.Push(&h.queue, g)
+	select {
+	case h.wakeup <- struct{}{}:
+	default:
+	}
+}
 
-	go func(ctx context.Context, beatInfo *beat) {
-		for {
+func (h *heartbeat) run(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		h.Lock()
+		now := time.Now()
+		for len(h.queue) > 0 && !h.queue[0].next.After(now) {
+			g := heap.Pop(&h.queue).(*beatGroup)
+			go h.fire(ctx, g)
+		}
+		wait := time.Hour
+		if len(h.queue) > 0 {
+			wait = h.queue[0].next.Sub(now)
+		}
+		h.Unlock()
+
+		if !timer.Stop() {
 			select {
-			case <-ctx.Done():
-				return
-			case <-beatInfo.next:
-				h.sendBeat(beatInfo)
+			case <-timer.C:
+			default:
 			}
 		}
-	}(ctx, beatInfo)
-	go h.schedule(beatInfo, time.Millisecond*time.Duration(beatInfo.period))
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.wakeup:
+		case <-timer.C:
+		}
+	}
 }
 
-func (h *heartbeat) removeBeat(serviceName, ip string, port int) {
-	key := buildKey(serviceName, ip, port)
-	if beatInfo, ok := h.dom2Beat[key]; ok {
-		beatInfo.stop()
+// fire schedules the next round of g after the shortest period of its
+// beats, then sends every beat not still in flight from the last round
+// concurrently, so that a slow beat holds back neither the other instances
+// of the service nor their next round
+func (h *heartbeat) fire(ctx context.Context, g *beatGroup) {
+	h.Lock()
+	beats := make([]*beat, 0, len(g.beats))
+	var next time.Duration
+	for _, b := range g.beats {
+		period := b.stats.Period
+		if period == 0 {
+			period = b.period
+		}
+		if next == 0 || period < next {
+			next = period
+		}
+		if !b.inflight {
+			b.inflight = true
+			beats = append(beats, b)
+		}
+	}
+	if h.groups[g.serviceName] == g && g.index < 0 {
+		h.pushLocked(g, next)
+	}
+	h.Unlock()
+
+	for i, b := range beats {
+		select {
+		case h.workers <- struct{}{}:
+		case <-ctx.Done():
+			h.Lock()
+			for _, b := range beats[i:] {
+				b.inflight = false
+			}
+			h.Unlock()
+			return
+		}
+		go func(b *beat) {
+			defer func() { <-h.workers }()
+			h.sendBeat(b)
+			h.Lock()
+			b.inflight = false
+			h.Unlock()
+		}(b)
 	}
 }
 
-func (h *heartbeat) sendBeat(beat *beat) {
+// sendBeat sends one beat and records the period the server asks for
+func (h *heartbeat) sendBeat(b *beat) {
+	h.Lock()
+	b.stats.LastBeat = time.Now()
+	b.stats.Sent++
+	period := b.period
 	r := h.nc.NewRequest(PUT, "/instance/beat")
-	r.params.Set("namespaceId", h.nc.c.config.Namespace)
-	r.params.Set("serviceName", beat.serviceName)
-	r.params.Set("clusterName", beat.cluster)
-	r.params.Set("ip", beat.ip)
-	r.params.Set("port", strconv.Itoa(beat.port))
-	if !h.lightBeatEnabled {
-		r.body = strings.NewReader(encode(map[string]string{
-			"beat": encode(beat),
-		}))
-	}
-	result, _ := callServer(h.nc.c, r)
-	if result.Ok() {
-		var m = make(map[string]interface{})
-		json.Unmarshal([]byte(result.Data), &m)
-		if v, ok := m["lightBeatEnabled"]; ok {
-			h.lightBeatEnabled = v.(bool)
+	r.params.Set("serviceName", b.serviceName)
+	r.params.Set("clusterName", b.cluster)
+	r.params.Set("ip", b.ip)
+	r.params.Set("port", strconv.Itoa(b.port))
+	if atomic.LoadInt32(&h.lightBeatEnabled) == 0 {
+		r.params.Set("beat", b.encode())
+	}
+	h.Unlock()
+
+	result, err := h.doBeat(r)
+	if err != nil {
+		h.beatFailed(b, err)
+		return
+	}
+	if result.LightBeatEnabled {
+		atomic.StoreInt32(&h.lightBeatEnabled, 1)
+	} else {
+		atomic.StoreInt32(&h.lightBeatEnabled, 0)
+	}
+	if result.ClientBeatInterval > 0 {
+		period = time.Duration(result.ClientBeatInterval) * time.Millisecond
+	}
+	if result.Code == codeResourceNotFound {
+		h.reregister(b)
+	}
+	h.Lock()
+	b.stats.Period = period
+	h.Unlock()
+}
+
+func (h *heartbeat) doBeat(r *Request) (*beatResult, error) {
+	resp, err := h.nc.c.DoRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("beat failed with status %d: %s", resp.StatusCode, string(b))
+	}
+	var result beatResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (h *heartbeat) beatFailed(b *beat, err error) {
+	h.nc.c.logger.Error("failed to send beat of %s %s:%d, %v", b.serviceName, b.ip, b.port, err)
+	h.Lock()
+	defer h.Unlock()
+	b.stats.Failed++
+	b.stats.LastError = err.Error()
+}
+
+// reregister registers the instance of b again after the server has
+// forgotten it
+func (h *heartbeat) reregister(b *beat) {
+	h.Lock()
+	if b.stopped {
+		h.Unlock()
+		return
+	}
+	instance := b.instance.clone()
+	h.Unlock()
+	h.nc.c.logger.Warn("instance %s %s:%d not found by server, register again", b.serviceName, b.ip, b.port)
+	_, err := h.nc.registerService(instance)
+	h.nc.redo.recovered(RedoEvent{Type: RedoRegister, ServiceName: b.serviceName, Instance: instance, Err: err})
+	if err != nil {
+		h.beatFailed(b, err)
+		return
+	}
+	h.Lock()
+	b.stats.Reregistered++
+	h.Unlock()
+}
+
+// stop stops all beats and returns the instances they were sent for
+func (h *heartbeat) stop() []*Instance {
+	h.Lock()
+	defer h.Unlock()
+	instances := make([]*Instance, 0, len(h.dom2Beat))
+	for _, b := range h.dom2Beat {
+		h.stopLocked(b)
+		instances = append(instances, b.instance.clone())
+	}
+	return instances
+}
+
+func (h *heartbeat) updateBeatInfo(groupedServiceName string, hosts []*Instance) {
+	h.Lock()
+	defer h.Unlock()
+	for _, host := range hosts {
+		if !host.Ephemeral {
+			continue
 		}
-		if v, ok := m["clientBeatInterval"]; ok {
-			go h.schedule(beat, time.Millisecond*time.Duration(v.(int64)))
+		if b, ok := h.dom2Beat[buildKey(groupedServiceName, host.IP, host.Port)]; ok {
+			b.weight = host.Weight
+			b.metadata = host.Metadata.clone()
 		}
 	}
-	// else if result.Code == 20404 {
-	// 	// register instance
-	// 	beat.stop()
-	// 	ins := NewInstance(beat.ip, beat.port, beat.weight, beat.cluster, beat.metadata)
-	// 	ins.ServiceName = beat.serviceName
-	// 	ins.Ephemeral = true
-	// 	h.nc.RegisterInstance(ins)
-	// } else {
-	// 	// TODO log error
+}
 
-	// }
+// updateInstance replaces the instance a beat is sent for, so the next beat
+// carries its weight and metadata
+func (h *heartbeat) updateInstance(groupedServiceName string, instance *Instance) {
+	h.Lock()
+	defer h.Unlock()
+	if b, ok := h.dom2Beat[buildKey(groupedServiceName, instance.IP, instance.Port)]; ok {
+		b.weight = instance.Weight
+		b.metadata = instance.Metadata.clone()
+		b.instance = instance.clone()
+	}
 }
 
-func (h *heartbeat) schedule(beatInfo *beat, d time.Duration) {
-	t := time.NewTimer(d)
-	for {
-		select {
-		case <-t.C:
-			beatInfo.next <- beatSignal
-			t.Stop()
-			return
-		}
+func (h *heartbeat) patchMetadata(groupedServiceName, ip string, port int, add map[string]string, remove []string) {
+	h.Lock()
+	defer h.Unlock()
+	b, ok := h.dom2Beat[buildKey(groupedServiceName, ip, port)]
+	if !ok {
+		return
 	}
+	metadata := b.metadata.patched(add, remove)
+	b.metadata = metadata
+	b.instance.Metadata = metadata.clone()
 }
 
-func (h *heartbeat) updateBeatInfo(hosts []*Instance) {
-	for _, host := range hosts {
-		key := buildKey(host.ServiceName, host.IP, host.Port)
-		if _, ok := h.dom2Beat[key]; ok && host.Ephemeral {
-			beat := newBeat(host.ServiceName, host)
-			h.addBeat(beat)
+func (h *heartbeat) beatStats() []BeatStats {
+	h.Lock()
+	defer h.Unlock()
+	stats := make([]BeatStats, 0, len(h.dom2Beat))
+	for _, b := range h.dom2Beat {
+		s := b.stats
+		if s.Period == 0 {
+			s.Period = b.period
 		}
+		stats = append(stats, s)
 	}
+	return stats
 }
 
 func buildKey(serviceName, ip string, port int) string {
 	return fmt.Sprintf("%s#%s#%d", serviceName, ip, port)
 }
+
+// beatQueue is a min-heap of beat groups ordered by next due time
+type beatQueue []*beatGroup
+
+func (q beatQueue) Len() int { return len(q) }
+
+func (q beatQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q beatQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *beatQueue) Push(x interface{}) {
+	g := x.(*beatGroup)
+	g.index = len(*q)
+	*q = append(*q, g)
+}
+
+func (q *beatQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	g := old[n-1]
+	old[n-1] = nil
+	g.index = -1
+	*q = old[:n-1]
+	return g
+}
@@ -0,0 +1,291 @@
+package nacos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type HeartbeatSuite struct{}
+
+var _ = Suite(&HeartbeatSuite{})
+
+func (s *HeartbeatSuite) TestBeatScheduling(c *C) {
+	var beats, registers, lightBeats int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nacos/v1/ns/instance":
+			atomic.AddInt32(&registers, 1)
+			w.Write([]byte("ok"))
+		case "/nacos/v1/ns/instance/beat":
+			n := atomic.AddInt32(&beats, 1)
+			if r.URL.Query().Get("beat") == "" {
+				atomic.AddInt32(&lightBeats, 1)
+			}
+			if n == 2 {
+				w.Write([]byte(`{"code":20404,"clientBeatInterval":20,"lightBeatEnabled":true}`))
+				return
+			}
+			w.Write([]byte(`{"code":10200,"clientBeatInterval":20,"lightBeatEnabled":true}`))
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+
+	instance := NewInstance("svc", DefaultGroup, DefaultCluster, "10.0.0.1", 8080, 1, true, true, NewMetadata(nil).Put(metaKeyHeartBeatInterval, "10"))
+	_, err := ns.RegisterInstance(instance)
+	c.Assert(err, IsNil)
+
+	time.Sleep(300 * time.Millisecond)
+	stats := ns.BeatStats()
+	c.Assert(stats, HasLen, 1)
+	c.Assert(stats[0].ServiceName, Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(stats[0].Period, Equals, 20*time.Millisecond)
+	c.Assert(stats[0].Sent > 5, Equals, true)
+	c.Assert(stats[0].Reregistered, Equals, int64(1))
+	c.Assert(atomic.LoadInt32(&registers), Equals, int32(2))
+	c.Assert(atomic.LoadInt32(&lightBeats) > 0, Equals, true)
+
+	_, err = ns.DeRegisterInstance("svc", DefaultGroup, DefaultCluster, "10.0.0.1", 8080, true)
+	c.Assert(err, IsNil)
+	c.Assert(ns.BeatStats(), HasLen, 0)
+	time.Sleep(50 * time.Millisecond)
+	sent := atomic.LoadInt32(&beats)
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&beats), Equals, sent)
+}
+
+func (s *HeartbeatSuite) TestShutdown(c *C) {
+	var deregistered int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nacos/v1/ns/instance" && r.Method == DELETE {
+			atomic.AddInt32(&deregistered, 1)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+	ns.pushReceiver = newPushRecevier(ns)
+
+	for port := 8080; port < 8083; port++ {
+		_, err := ns.RegisterInstance(NewInstance("svc", DefaultGroup, DefaultCluster, "10.0.0.1", port, 1, true, true, nil))
+		c.Assert(err, IsNil)
+	}
+	block := make(chan struct{})
+	ns.listeners.addListener("DEFAULT_GROUP@@svc", "", &funcListener{func(*ServiceInfo) { <-block }}, nil)
+	ns.listeners.serviceChange(&ServiceInfo{Name: "DEFAULT_GROUP@@svc"})
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Assert(ns.Shutdown(ctx), Equals, context.DeadlineExceeded)
+	c.Assert(atomic.LoadInt32(&deregistered), Equals, int32(3))
+	c.Assert(ns.BeatStats(), HasLen, 0)
+
+	close(block)
+	c.Assert(ns.Shutdown(context.Background()), IsNil)
+	c.Assert(atomic.LoadInt32(&deregistered), Equals, int32(3))
+}
+
+func (s *HeartbeatSuite) TestUpdateInstanceKeepsBeatInSync(c *C) {
+	beats := make(chan string, 100)
+	var patches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nacos/v1/ns/instance/beat":
+			select {
+			case beats <- r.URL.Query().Get("beat"):
+			default:
+			}
+			w.Write([]byte(`{"code":10200,"clientBeatInterval":20}`))
+		case "/nacos/v1/ns/instance/metadata/batch":
+			atomic.AddInt32(&patches, 1)
+			c.Check(r.URL.Query().Get("consistencyType"), Equals, "ephemeral")
+			w.Write([]byte(`{"updated":["10.0.0.1:8080:unknown:DEFAULT:ephemeral"]}`))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+
+	instance := NewInstance("svc", DefaultGroup, DefaultCluster, "10.0.0.1", 8080, 1, true, true, NewMetadata(nil).Put("version", "1").Put(metaKeyHeartBeatInterval, "10"))
+	_, err := ns.RegisterInstance(instance)
+	c.Assert(err, IsNil)
+
+	instance.Weight = 3
+	instance.Metadata = NewMetadata(nil).Put("version", "2").Put("stale", "x")
+	_, err = ns.UpdateInstance(instance)
+	c.Assert(err, IsNil)
+	_, err = ns.PatchInstanceMetadata(instance.Key(), map[string]string{"zone": "a"}, []string{"stale"})
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt32(&patches), Equals, int32(2))
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case b := <-beats:
+			var info struct {
+				Weight   float64
+				Metadata map[string]string
+			}
+			c.Assert(json.Unmarshal([]byte(b), &info), IsNil)
+			if info.Metadata["zone"] != "a" {
+				continue
+			}
+			c.Assert(info.Weight, Equals, 3.0)
+			c.Assert(info.Metadata, DeepEquals, map[string]string{"version": "2", "zone": "a"})
+			return
+		case <-deadline:
+			c.Fatal("beat did not pick up the update")
+		}
+	}
+}
+
+func (s *HeartbeatSuite) TestBatchRegisterSharesSchedule(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nacos/v1/ns/instance" && r.URL.Query().Get("port") == "9005" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("caused: port rejected"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+
+	var instances []*Instance
+	for port := 9000; port < 9020; port++ {
+		instances = append(instances, NewInstance("", "", DefaultCluster, "10.0.0.1", port, 1, true, true, nil))
+	}
+	results := ns.BatchRegisterInstances("gateway", "", instances)
+	c.Assert(results, HasLen, 20)
+	for i, r := range results {
+		c.Assert(r.Instance, Equals, instances[i])
+		if r.Instance.Port == 9005 {
+			c.Assert(r.Err, NotNil)
+		} else {
+			c.Assert(r.Err, IsNil)
+		}
+	}
+	c.Assert(ns.BeatStats(), HasLen, 19)
+	ns.heartbeat.Lock()
+	c.Assert(ns.heartbeat.groups, HasLen, 1)
+	c.Assert(ns.heartbeat.queue, HasLen, 1)
+	ns.heartbeat.Unlock()
+
+	results = ns.BatchDeregisterInstances("gateway", "", instances)
+	c.Assert(results, HasLen, 20)
+	c.Assert(ns.BeatStats(), HasLen, 0)
+	ns.heartbeat.Lock()
+	c.Assert(ns.heartbeat.groups, HasLen, 0)
+	c.Assert(ns.heartbeat.queue, HasLen, 0)
+	ns.heartbeat.Unlock()
+}
+
+func (s *HeartbeatSuite) TestSlowBeatDoesNotHoldBackGroup(c *C) {
+	var mu sync.Mutex
+	beats := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nacos/v1/ns/instance/beat" {
+			port := r.URL.Query().Get("port")
+			if port == "9001" {
+				time.Sleep(400 * time.Millisecond)
+			}
+			mu.Lock()
+			beats[port]++
+			mu.Unlock()
+			w.Write([]byte(`{"code":10200,"clientBeatInterval":20}`))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+
+	var instances []*Instance
+	for port := 9000; port < 9003; port++ {
+		instances = append(instances, NewInstance("", "", DefaultCluster, "10.0.0.1", port, 1, true, true, NewMetadata(nil).Put(metaKeyHeartBeatInterval, "20")))
+	}
+	for _, r := range ns.BatchRegisterInstances("gateway", "", instances) {
+		c.Assert(r.Err, IsNil)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(beats["9000"] > 5, Equals, true)
+	c.Assert(beats["9002"] > 5, Equals, true)
+	c.Assert(beats["9001"], Equals, 0)
+}
+
+func (s *HeartbeatSuite) TestServerUpdateReachesBeat(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+
+	_, err := ns.RegisterInstance(NewInstance("svc", DefaultGroup, DefaultCluster, "10.0.0.1", 8080, 1, true, true, nil))
+	c.Assert(err, IsNil)
+
+	host := `{"ip":"10.0.0.1","port":8080,"serviceName":"DEFAULT_GROUP@@svc","clusterName":"DEFAULT","weight":%d,"healthy":true,"enabled":true,"ephemeral":true,"metadata":{"version":"%d"}}`
+	for gen := 1; gen <= 2; gen++ {
+		ns.updateServiceMap(fmt.Sprintf(`{"name":"DEFAULT_GROUP@@svc","clusters":"","lastRefTime":%d,"hosts":[`+host+`]}`, gen, gen, gen))
+	}
+
+	ns.heartbeat.Lock()
+	defer ns.heartbeat.Unlock()
+	b := ns.heartbeat.dom2Beat[buildKey("DEFAULT_GROUP@@svc", "10.0.0.1", 8080)]
+	c.Assert(b, NotNil)
+	c.Assert(b.weight, Equals, 2.0)
+	c.Assert(b.metadata.Get("version"), Equals, "2")
+}
@@ -0,0 +1,225 @@
+// Package kratos implements the Kratos registry.Registrar and
+// registry.Discovery on top of a NamingClient. It is a module of its own, so
+// the SDK does not depend on Kratos.
+//
+// Every endpoint of a Kratos instance is registered as an ephemeral Nacos
+// instance of the service, with the metadata of the Kratos instance and the
+// keys nacos.MetadataKeyID, nacos.MetadataKeyVersion and
+// nacos.MetadataKeyProtocol set to its id, its version and the scheme of the
+// endpoint. Discovery puts the instances sharing an id back together, and
+// takes instances registered by other clients as Kratos instances with one
+// endpoint, of the protocol in their metadata or http.
+package kratos
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+var (
+	_ registry.Registrar = new(Registry)
+	_ registry.Discovery = new(Registry)
+)
+
+// Registry registers and discovers Kratos instances
+type Registry struct {
+	Naming nacos.NamingClient
+	// GroupName is the group of the services, DEFAULT_GROUP if empty
+	GroupName string
+	// ClusterName is the cluster instances are registered in, DEFAULT if
+	// empty
+	ClusterName string
+	// Clusters restricts discovery to the given clusters
+	Clusters []string
+	// Weight is the weight of the instances registered, 1 if zero
+	Weight float64
+}
+
+func splitEndpoint(endpoint string) (string, string, int, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", 0, err
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("endpoint %s: %w", endpoint, err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("endpoint %s: invalid port", endpoint)
+	}
+	return u.Scheme, host, p, nil
+}
+
+// Register registers an instance per endpoint of service
+func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	weight := r.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	for _, endpoint := range service.Endpoints {
+		scheme, host, port, err := splitEndpoint(endpoint)
+		if err != nil {
+			return err
+		}
+		metadata := nacos.NewMetadata(nil)
+		for k, v := range service.Metadata {
+			metadata.Put(k, v)
+		}
+		metadata.Put(nacos.MetadataKeyID, service.ID)
+		metadata.Put(nacos.MetadataKeyVersion, service.Version)
+		metadata.Put(nacos.MetadataKeyProtocol, scheme)
+		instance := nacos.NewInstance(service.Name, r.GroupName, r.ClusterName, host, port, weight, true, true, metadata)
+		if _, err := r.Naming.RegisterInstance(instance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deregister deregisters the instances of the endpoints of service
+func (r *Registry) Deregister(ctx context.Context, service *registry.ServiceInstance) error {
+	for _, endpoint := range service.Endpoints {
+		_, host, port, err := splitEndpoint(endpoint)
+		if err != nil {
+			return err
+		}
+		if _, err := r.Naming.DeRegisterInstance(service.Name, r.GroupName, r.ClusterName, host, port, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) query(serviceName string) nacos.InstanceQueryOptions {
+	return nacos.InstanceQueryOptions{
+		ServiceName: serviceName,
+		GroupName:   r.GroupName,
+		ClusterName: r.Clusters,
+		Subscribe:   true,
+	}
+}
+
+// GetService returns the instances of the service which are healthy and
+// enabled
+func (r *Registry) GetService(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	return serviceInstances(serviceName, r.Naming.SelectInstance(r.query(serviceName))), nil
+}
+
+// serviceInstances puts the endpoints of the healthy and enabled hosts back
+// into Kratos instances, ordered by id
+func serviceInstances(serviceName string, hosts []*nacos.Instance) []*registry.ServiceInstance {
+	byID := make(map[string]*registry.ServiceInstance)
+	services := make([]*registry.ServiceInstance, 0, len(hosts))
+	for _, host := range hosts {
+		if !host.Healthy || !host.Enable {
+			continue
+		}
+		metadata := host.Metadata.Map()
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		id := metadata[nacos.MetadataKeyID]
+		if id == "" {
+			id = net.JoinHostPort(host.IP, strconv.Itoa(host.Port))
+		}
+		protocol := metadata[nacos.MetadataKeyProtocol]
+		if protocol == "" {
+			protocol = "http"
+		}
+		endpoint := protocol + "://" + net.JoinHostPort(host.IP, strconv.Itoa(host.Port))
+		if service, ok := byID[id]; ok {
+			service.Endpoints = append(service.Endpoints, endpoint)
+			continue
+		}
+		service := &registry.ServiceInstance{
+			ID:        id,
+			Name:      serviceName,
+			Version:   metadata[nacos.MetadataKeyVersion],
+			Metadata:  metadata,
+			Endpoints: []string{endpoint},
+		}
+		delete(metadata, nacos.MetadataKeyID)
+		delete(metadata, nacos.MetadataKeyVersion)
+		delete(metadata, nacos.MetadataKeyProtocol)
+		byID[id] = service
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].ID < services[j].ID })
+	for _, service := range services {
+		sort.Strings(service.Endpoints)
+	}
+	return services
+}
+
+// Watch subscribes to the service until the watcher is stopped or ctx is done
+func (r *Registry) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
+	w := &watcher{
+		r:           r,
+		serviceName: serviceName,
+		changed:     make(chan struct{}, 1),
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	w.OnEvent(&nacos.ServiceInfo{Hosts: r.Naming.SelectInstance(r.query(serviceName))})
+	r.Naming.Subscribe(serviceName, r.GroupName, r.Clusters, w)
+	return w, nil
+}
+
+type watcher struct {
+	r           *Registry
+	serviceName string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	changed     chan struct{}
+
+	mu       sync.Mutex
+	services []*registry.ServiceInstance
+	returned []*registry.ServiceInstance
+}
+
+func (w *watcher) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	w.mu.Lock()
+	w.services = serviceInstances(w.serviceName, serviceInfo.Hosts)
+	w.mu.Unlock()
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the instances when they differ from the last ones returned,
+// the first time when there are some
+func (w *watcher) Next() ([]*registry.ServiceInstance, error) {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case <-w.changed:
+		}
+		w.mu.Lock()
+		services := w.services
+		first := w.returned == nil
+		if (first && len(services) == 0) || (!first && reflect.DeepEqual(services, w.returned)) {
+			w.mu.Unlock()
+			continue
+		}
+		w.returned = services
+		w.mu.Unlock()
+		return services, nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	w.r.Naming.Unsubscribe(w.serviceName, w.r.GroupName, w.r.Clusters, w)
+	return nil
+}
@@ -0,0 +1,176 @@
+package kratos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	nacos "github.com/litgh/nacos-go-sdk"
+	"github.com/litgh/nacos-go-sdk/nacosmock"
+	"github.com/litgh/nacos-go-sdk/nacostest"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type KratosSuite struct {
+	naming *nacosmock.Naming
+	r      *Registry
+}
+
+var _ = Suite(&KratosSuite{})
+
+func (s *KratosSuite) SetUpTest(c *C) {
+	s.naming = nacosmock.NewNaming()
+	s.r = &Registry{Naming: s.naming, GroupName: "g"}
+}
+
+func service(id string, endpoints ...string) *registry.ServiceInstance {
+	return &registry.ServiceInstance{
+		ID:        id,
+		Name:      "helloworld",
+		Version:   "v1",
+		Metadata:  map[string]string{"zone": "a"},
+		Endpoints: endpoints,
+	}
+}
+
+func next(c *C, w registry.Watcher) []*registry.ServiceInstance {
+	result := make(chan []*registry.ServiceInstance, 1)
+	go func() {
+		services, err := w.Next()
+		c.Check(err, IsNil)
+		result <- services
+	}()
+	select {
+	case services := <-result:
+		return services
+	case <-time.After(3 * time.Second):
+		c.Fatal("no change")
+	}
+	return nil
+}
+
+func (s *KratosSuite) TestRegisterAndGetService(c *C) {
+	ctx := context.Background()
+	a := service("a", "http://10.0.0.1:8000?isSecure=false", "grpc://10.0.0.1:9000")
+	c.Assert(s.r.Register(ctx, a), IsNil)
+
+	instances := s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "helloworld", GroupName: "g"})
+	c.Assert(instances, HasLen, 2)
+	c.Assert(instances[0].Metadata.Map(), DeepEquals, map[string]string{"zone": "a", "id": "a", "version": "v1", "protocol": "http"})
+	c.Assert(instances[1].Metadata.Get(nacos.MetadataKeyProtocol), Equals, "grpc")
+
+	s.naming.RegisterInstance(nacos.NewInstance("helloworld", "g", "", "10.0.0.9", 80, 1, true, true, nil))
+
+	services, err := s.r.GetService(ctx, "helloworld")
+	c.Assert(err, IsNil)
+	c.Assert(services, DeepEquals, []*registry.ServiceInstance{
+		{ID: "10.0.0.9:80", Name: "helloworld", Metadata: map[string]string{}, Endpoints: []string{"http://10.0.0.9:80"}},
+		{ID: "a", Name: "helloworld", Version: "v1", Metadata: map[string]string{"zone": "a"}, Endpoints: []string{"grpc://10.0.0.1:9000", "http://10.0.0.1:8000"}},
+	})
+
+	c.Assert(s.r.Deregister(ctx, a), IsNil)
+	services, err = s.r.GetService(ctx, "helloworld")
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 1)
+
+	c.Assert(s.r.Register(ctx, service("b", "grpc://10.0.0.2")), ErrorMatches, "endpoint grpc://10.0.0.2: .*missing port.*")
+}
+
+func (s *KratosSuite) TestWatch(c *C) {
+	ctx := context.Background()
+	c.Assert(s.r.Register(ctx, service("a", "grpc://10.0.0.1:9000")), IsNil)
+
+	w, err := s.r.Watch(ctx, "helloworld")
+	c.Assert(err, IsNil)
+	services := next(c, w)
+	c.Assert(services, HasLen, 1)
+	c.Assert(services[0].Equal(service("a", "grpc://10.0.0.1:9000")), Equals, true)
+
+	c.Assert(s.r.Register(ctx, service("b", "grpc://10.0.0.2:9000")), IsNil)
+	c.Assert(next(c, w), HasLen, 2)
+
+	s.naming.SetHealthy("helloworld", "g", "10.0.0.1", 9000, false)
+	services = next(c, w)
+	c.Assert(services, HasLen, 1)
+	c.Assert(services[0].ID, Equals, "b")
+
+	c.Assert(w.Stop(), IsNil)
+	_, err = w.Next()
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(s.naming.Listeners("helloworld", "g"), Equals, 0)
+}
+
+func (s *KratosSuite) TestWatchEmpty(c *C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w, err := s.r.Watch(ctx, "helloworld")
+	c.Assert(err, IsNil)
+	defer w.Stop()
+	_, err = w.Next()
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
+
+// KratosServerSuite runs the registry on a naming client of a nacostest
+// server
+type KratosServerSuite struct {
+	server *nacostest.Server
+	client nacos.Client
+	r      *Registry
+}
+
+var _ = Suite(&KratosServerSuite{})
+
+func (s *KratosServerSuite) SetUpTest(c *C) {
+	s.server = nacostest.NewServer(nacostest.Options{})
+	client, err := nacos.NewClient(&nacos.Config{
+		Scheme:      "http",
+		ContextPath: nacostest.ContextPath,
+		Hosts:       []string{s.server.Addr},
+		CacheDir:    c.MkDir(),
+		LogDir:      c.MkDir(),
+	})
+	c.Assert(err, IsNil)
+	s.client = client
+	s.r = &Registry{Naming: client.Naming(), GroupName: "g"}
+}
+
+func (s *KratosServerSuite) TearDownTest(c *C) {
+	s.client.Naming().Shutdown(context.Background())
+	s.server.Close()
+}
+
+func (s *KratosServerSuite) TestRegisterAndWatch(c *C) {
+	ctx := context.Background()
+	a := service("a", "http://10.0.0.1:8000?isSecure=false", "grpc://10.0.0.1:9000")
+	c.Assert(s.r.Register(ctx, a), IsNil)
+	c.Assert(s.server.Instances("", "g", "helloworld"), HasLen, 2)
+
+	services, err := s.r.GetService(ctx, "helloworld")
+	c.Assert(err, IsNil)
+	c.Assert(services, DeepEquals, []*registry.ServiceInstance{
+		{ID: "a", Name: "helloworld", Version: "v1", Metadata: map[string]string{"zone": "a"}, Endpoints: []string{"grpc://10.0.0.1:9000", "http://10.0.0.1:8000"}},
+	})
+
+	w, err := s.r.Watch(ctx, "helloworld")
+	c.Assert(err, IsNil)
+	c.Assert(next(c, w), HasLen, 1)
+
+	c.Assert(s.r.Register(ctx, service("b", "grpc://10.0.0.2:9000")), IsNil)
+	c.Assert(next(c, w), HasLen, 2)
+
+	// each endpoint of a is deregistered, and pushed, on its own
+	c.Assert(s.r.Deregister(ctx, a), IsNil)
+	services = next(c, w)
+	if len(services) == 2 {
+		services = next(c, w)
+	}
+	c.Assert(services, HasLen, 1)
+	c.Assert(services[0].ID, Equals, "b")
+
+	c.Assert(s.server.RemoveInstance("", "g", "helloworld", "", "10.0.0.2", 9000), Equals, true)
+	c.Assert(next(c, w), HasLen, 0)
+	c.Assert(w.Stop(), IsNil)
+}
@@ -11,6 +11,20 @@ const (
 	metaKeyHeartBeatIntervalDefault = time.Second * 5
 )
 
+// Metadata keys of the instances registered by the framework adapters, which
+// register one instance per endpoint of a framework instance; the other
+// entries are the metadata of the framework instance unchanged
+const (
+	// MetadataKeyID holds the id the framework gave the instance, shared by
+	// the instances of its endpoints
+	MetadataKeyID = "id"
+	// MetadataKeyVersion holds the version of the service
+	MetadataKeyVersion = "version"
+	// MetadataKeyProtocol holds the protocol served on the port, such as
+	// http or grpc; http if missing
+	MetadataKeyProtocol = "protocol"
+)
+
 type Metadata struct {
 	sync.Mutex
 	m map[string]string
@@ -32,7 +46,19 @@ func (m *Metadata) Put(key, value string) *Metadata {
 	return m
 }
 
+func (m *Metadata) Remove(key string) *Metadata {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.m, key)
+	return m
+}
+
 func (m *Metadata) Encode() string {
+	if m == nil {
+		return "{}"
+	}
+	m.Lock()
+	defer m.Unlock()
 	var buf bytes.Buffer
 	encoder := json.NewEncoder(&buf)
 	encoder.Encode(m.m)
@@ -69,9 +95,66 @@ func (m *Metadata) GetWithDefault(key string, defaultValue interface{}, convertF
 	return defaultValue
 }
 
-func (m Metadata) Contains(key string) bool {
+func (m *Metadata) Contains(key string) bool {
 	m.Lock()
 	defer m.Unlock()
 	_, ok := m.m[key]
 	return ok
 }
+
+// Map returns a copy of the entries
+func (m *Metadata) Map() map[string]string {
+	if m == nil {
+		return nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	c := make(map[string]string, len(m.m))
+	for k, v := range m.m {
+		c[k] = v
+	}
+	return c
+}
+
+func (m *Metadata) clone() *Metadata {
+	if m == nil {
+		return nil
+	}
+	return &Metadata{m: m.Map()}
+}
+
+// patched returns a copy of m with the entries of add put and the keys in
+// remove deleted
+func (m *Metadata) patched(add map[string]string, remove []string) *Metadata {
+	p := m.clone()
+	if p == nil {
+		p = NewMetadata(nil)
+	}
+	for k, v := range add {
+		p.Put(k, v)
+	}
+	for _, k := range remove {
+		p.Remove(k)
+	}
+	return p
+}
+
+func (m *Metadata) MarshalJSON() ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	return json.Marshal(m.m)
+}
+
+func (m *Metadata) UnmarshalJSON(b []byte) error {
+	var v map[string]string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v == nil {
+		v = make(map[string]string)
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.m = v
+	return nil
+}
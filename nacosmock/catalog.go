@@ -0,0 +1,125 @@
+package nacosmock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+var _ nacos.CatalogClient = new(catalog)
+
+// catalog reads the registry of a Naming, its calls are recorded by it
+type catalog struct {
+	n *Naming
+}
+
+func page(q nacos.CatalogQueryOptions, count int) (int, int) {
+	return pageOf(q.Page, q.Size, count)
+}
+
+func pageOf(pageNo, size, count int) (int, int) {
+	if pageNo <= 0 {
+		pageNo = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+	start := (pageNo - 1) * size
+	if start > count {
+		start = count
+	}
+	end := start + size
+	if end > count {
+		end = count
+	}
+	return start, end
+}
+
+func (c *catalog) Services(ctx context.Context, q nacos.CatalogQueryOptions) (*nacos.CatalogServiceList, error) {
+	if err := c.n.record("Catalog.Services", ctx, q); err != nil {
+		return nil, err
+	}
+	c.n.mu.Lock()
+	var entries []nacos.ServiceEntry
+	for _, s := range c.n.services {
+		if !strings.Contains(s.info.Name, q.ServiceName) || !strings.Contains(s.info.GroupName, q.GroupName) {
+			continue
+		}
+		e := nacos.ServiceEntry{Name: s.info.Name, GroupName: s.info.GroupName, IPCount: len(s.instances)}
+		clusters := make(map[string]bool)
+		for name := range s.clusters {
+			clusters[name] = true
+		}
+		for _, i := range s.instances {
+			clusters[i.ClusterName] = true
+			if i.Healthy {
+				e.HealthyInstanceCount++
+			}
+		}
+		e.ClusterCount = len(clusters)
+		entries = append(entries, e)
+	}
+	c.n.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].GroupName != entries[j].GroupName {
+			return entries[i].GroupName < entries[j].GroupName
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	start, end := page(q, len(entries))
+	return &nacos.CatalogServiceList{Count: len(entries), Services: entries[start:end]}, nil
+}
+
+// Subscribers lists one subscriber per subscription to the service, at
+// the loopback address
+func (c *catalog) Subscribers(ctx context.Context, q nacos.CatalogQueryOptions) (*nacos.SubscriberList, error) {
+	if err := c.n.record("Catalog.Subscribers", ctx, q); err != nil {
+		return nil, err
+	}
+	c.n.mu.Lock()
+	name := grouped(q.ServiceName, q.GroupName)
+	var subscribers []*nacos.Subscriber
+	for _, s := range c.n.subscriptions[name] {
+		subscribers = append(subscribers, &nacos.Subscriber{
+			AddrStr:     "127.0.0.1",
+			Agent:       "nacosmock",
+			IP:          "127.0.0.1",
+			ServiceName: name,
+			Cluster:     strings.Join(s.clusters, ","),
+		})
+	}
+	c.n.mu.Unlock()
+	start, end := page(q, len(subscribers))
+	return &nacos.SubscriberList{Count: len(subscribers), Subscribers: subscribers[start:end]}, nil
+}
+
+func (c *catalog) Instances(ctx context.Context, q nacos.CatalogQueryOptions) (*nacos.CatalogInstanceList, error) {
+	if err := c.n.record("Catalog.Instances", ctx, q); err != nil {
+		return nil, err
+	}
+	c.n.mu.Lock()
+	instances := c.n.hostsLocked(grouped(q.ServiceName, q.GroupName), []string{q.ClusterName})
+	c.n.mu.Unlock()
+	start, end := page(q, len(instances))
+	return &nacos.CatalogInstanceList{Count: len(instances), Instances: instances[start:end]}, nil
+}
+
+func (c *catalog) Instance(ctx context.Context, key nacos.InstanceKey) (*nacos.Instance, error) {
+	if err := c.n.record("Catalog.Instance", ctx, key); err != nil {
+		return nil, err
+	}
+	if key.ClusterName == "" {
+		key.ClusterName = nacos.DefaultCluster
+	}
+	c.n.mu.Lock()
+	defer c.n.mu.Unlock()
+	for _, i := range c.n.hostsLocked(grouped(key.ServiceName, key.GroupName), []string{key.ClusterName}) {
+		if i.IP == key.IP && i.Port == key.Port {
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("instance %s:%d of %s not found", key.IP, key.Port, grouped(key.ServiceName, key.GroupName))
+}
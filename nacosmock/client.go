@@ -0,0 +1,101 @@
+package nacosmock
+
+import (
+	"fmt"
+	"sync"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+var (
+	_ nacos.Client = new(Client)
+	_ nacos.Logger = new(Logger)
+)
+
+// Client is a Client of a Naming, a Config and a Namespaces fake
+type Client struct {
+	recorder
+	NamingClient    *Naming
+	ConfigClient    *Config
+	NamespaceClient *Namespaces
+	Log             *Logger
+
+	mu        sync.Mutex
+	listeners []nacos.ConnectionListener
+}
+
+// NewClient returns a Client of new fakes
+func NewClient() *Client {
+	return &Client{
+		NamingClient:    NewNaming(),
+		ConfigClient:    NewConfig(),
+		NamespaceClient: NewNamespaces(),
+		Log:             new(Logger),
+	}
+}
+
+func (c *Client) Naming() nacos.NamingClient {
+	c.record("Naming")
+	return c.NamingClient
+}
+
+func (c *Client) Config() nacos.ConfigClient {
+	c.record("Config")
+	return c.ConfigClient
+}
+
+func (c *Client) Namespaces() nacos.NamespaceClient {
+	c.record("Namespaces")
+	return c.NamespaceClient
+}
+
+func (c *Client) Logger() nacos.Logger {
+	c.record("Logger")
+	return c.Log
+}
+
+func (c *Client) AddConnectionListener(listener nacos.ConnectionListener) {
+	c.record("AddConnectionListener", listener)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// EmitConnection calls the connection listeners with event
+func (c *Client) EmitConnection(event nacos.ConnectionEvent) {
+	c.mu.Lock()
+	listeners := append([]nacos.ConnectionListener(nil), c.listeners...)
+	c.mu.Unlock()
+	for _, listener := range listeners {
+		listener.OnConnectionChange(event)
+	}
+}
+
+// Logger keeps the lines logged at every level
+type Logger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *Logger) log(tag, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, tag+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Error(format string, args ...interface{}) { l.log("[ERROR]", format, args...) }
+func (l *Logger) Warn(format string, args ...interface{})  { l.log("[WARN ]", format, args...) }
+func (l *Logger) Info(format string, args ...interface{})  { l.log("[INFO ]", format, args...) }
+func (l *Logger) Debug(format string, args ...interface{}) { l.log("[DEBUG]", format, args...) }
+func (l *Logger) IsDebugEnable() bool                      { return true }
+func (l *Logger) IsInfoEnable() bool                       { return true }
+func (l *Logger) IsErrorEnable() bool                      { return true }
+func (l *Logger) IsWarnEnable() bool                       { return true }
+
+// Lines returns the lines logged so far, prefixed by their level as in
+// LogTag
+func (l *Logger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
@@ -0,0 +1,262 @@
+package nacosmock
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+var _ nacos.ConfigClient = new(Config)
+
+// Config is a ConfigClient over an in-memory store. The listeners of a
+// config are notified of each change, made by the client or by SetConfig.
+// The methods of ConfigClient are recorded, the ones setting the fake up
+// are not.
+type Config struct {
+	recorder
+	// Namespace is the namespace given to the listeners
+	Namespace string
+
+	mu        sync.Mutex
+	configs   map[configKey]string
+	listeners map[configKey][]nacos.ConfigListener
+	history   []*nacos.ConfigHistoryItem
+	status    string
+}
+
+type configKey struct {
+	dataID string
+	group  string
+}
+
+func keyOf(dataID, group string) configKey {
+	return configKey{dataID, groupOrDefault(group)}
+}
+
+func md5Hex(content string) string {
+	if content == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewConfig returns a Config without configs
+func NewConfig() *Config {
+	return &Config{
+		configs:   make(map[configKey]string),
+		listeners: make(map[configKey][]nacos.ConfigListener),
+		status:    nacos.ServerStatusUp,
+	}
+}
+
+// GetConfig returns ErrConfigNotFound if the config does not exist
+func (c *Config) GetConfig(dataID, group string) (string, error) {
+	if err := c.record("GetConfig", dataID, group); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	content, ok := c.configs[keyOf(dataID, group)]
+	if !ok {
+		return "", nacos.ErrConfigNotFound
+	}
+	return content, nil
+}
+
+func (c *Config) GetConfigAndSignListener(dataID, group string, listener nacos.ConfigListener) (string, error) {
+	if err := c.record("GetConfigAndSignListener", dataID, group, listener); err != nil {
+		return "", err
+	}
+	key := keyOf(dataID, group)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners[key] = append(c.listeners[key], listener)
+	content, ok := c.configs[key]
+	if !ok {
+		return "", nacos.ErrConfigNotFound
+	}
+	return content, nil
+}
+
+// AddListener notifies the listener with the content right away if the
+// config exists
+func (c *Config) AddListener(dataID, group string, listener nacos.ConfigListener) error {
+	if err := c.record("AddListener", dataID, group, listener); err != nil {
+		return err
+	}
+	key := keyOf(dataID, group)
+	c.mu.Lock()
+	c.listeners[key] = append(c.listeners[key], listener)
+	content, ok := c.configs[key]
+	c.mu.Unlock()
+	if ok {
+		listener.OnChange(c.Namespace, key.group, key.dataID, content)
+	}
+	return nil
+}
+
+func (c *Config) PublishConfig(dataID, group, content string) error {
+	if err := c.record("PublishConfig", dataID, group, content); err != nil {
+		return err
+	}
+	c.SetConfig(dataID, group, content)
+	return nil
+}
+
+func (c *Config) RemoveConfig(dataID, group string) error {
+	if err := c.record("RemoveConfig", dataID, group); err != nil {
+		return err
+	}
+	c.SetConfig(dataID, group, "")
+	return nil
+}
+
+func (c *Config) RemoveListener(dataID, group string) {
+	c.record("RemoveListener", dataID, group)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.listeners, keyOf(dataID, group))
+}
+
+// GetServerStatus returns ServerStatusUp unless changed by SetServerStatus
+func (c *Config) GetServerStatus() string {
+	c.record("GetServerStatus")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Shutdown removes the listeners
+func (c *Config) Shutdown() {
+	c.record("Shutdown")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = make(map[configKey][]nacos.ConfigListener)
+}
+
+// SetConfig changes a config, as published by another client, and notifies
+// its listeners if the content changed; an empty content removes it
+func (c *Config) SetConfig(dataID, group, content string) {
+	key := keyOf(dataID, group)
+	c.mu.Lock()
+	if c.configs[key] == content {
+		c.mu.Unlock()
+		return
+	}
+	_, existed := c.configs[key]
+	change := &nacos.ConfigHistoryItem{
+		ID:      strconv.Itoa(len(c.history) + 1),
+		DataID:  key.dataID,
+		Group:   key.group,
+		Tenant:  c.Namespace,
+		Content: content,
+		OpType:  "U",
+	}
+	if content == "" {
+		change.Content, change.OpType = c.configs[key], "D"
+		delete(c.configs, key)
+	} else {
+		if !existed {
+			change.OpType = "I"
+		}
+		c.configs[key] = content
+	}
+	change.MD5 = md5Hex(change.Content)
+	c.history = append(c.history, change)
+	listeners := append([]nacos.ConfigListener(nil), c.listeners[key]...)
+	c.mu.Unlock()
+	for _, listener := range listeners {
+		listener.OnChange(c.Namespace, key.group, key.dataID, content)
+	}
+}
+
+// SearchConfigs lists the configs sorted by group and data id, Blur
+// matches the fields as substrings once their * wildcards removed
+func (c *Config) SearchConfigs(ctx context.Context, q nacos.ConfigSearchOptions) (*nacos.ConfigList, error) {
+	if err := c.record("SearchConfigs", ctx, q); err != nil {
+		return nil, err
+	}
+	match := func(pattern, s string) bool { return pattern == "" || pattern == s }
+	if q.Blur {
+		match = func(pattern, s string) bool { return strings.Contains(s, strings.ReplaceAll(pattern, "*", "")) }
+	}
+	c.mu.Lock()
+	var configs []*nacos.ConfigItem
+	for key, content := range c.configs {
+		if match(q.DataID, key.dataID) && match(q.Group, key.group) {
+			configs = append(configs, &nacos.ConfigItem{
+				DataID:  key.dataID,
+				Group:   key.group,
+				Content: content,
+				MD5:     md5Hex(content),
+				Tenant:  c.Namespace,
+			})
+		}
+	}
+	c.mu.Unlock()
+	sort.Slice(configs, func(i, j int) bool {
+		if configs[i].Group != configs[j].Group {
+			return configs[i].Group < configs[j].Group
+		}
+		return configs[i].DataID < configs[j].DataID
+	})
+	start, end := pageOf(q.Page, q.Size, len(configs))
+	return &nacos.ConfigList{Count: len(configs), Configs: configs[start:end]}, nil
+}
+
+// History lists the changes made by the client and by SetConfig
+func (c *Config) History(ctx context.Context, q nacos.ConfigHistoryOptions) (*nacos.ConfigHistoryList, error) {
+	if err := c.record("History", ctx, q); err != nil {
+		return nil, err
+	}
+	key := keyOf(q.DataID, q.Group)
+	c.mu.Lock()
+	var changes []*nacos.ConfigHistoryItem
+	for i := len(c.history) - 1; i >= 0; i-- {
+		if change := c.history[i]; change.DataID == key.dataID && change.Group == key.group {
+			item := *change
+			item.Content = ""
+			changes = append(changes, &item)
+		}
+	}
+	c.mu.Unlock()
+	start, end := pageOf(q.Page, q.Size, len(changes))
+	return &nacos.ConfigHistoryList{Count: len(changes), Changes: changes[start:end]}, nil
+}
+
+func (c *Config) HistoryDetail(ctx context.Context, dataID, group, id string) (*nacos.ConfigHistoryItem, error) {
+	if err := c.record("HistoryDetail", ctx, dataID, group, id); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, change := range c.history {
+		if change.ID == id {
+			item := *change
+			return &item, nil
+		}
+	}
+	return nil, fmt.Errorf("history %s of %s not found", id, dataID)
+}
+
+// SetServerStatus sets the status returned by GetServerStatus
+func (c *Config) SetServerStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+// Listeners returns the number of listeners of the config
+func (c *Config) Listeners(dataID, group string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.listeners[keyOf(dataID, group)])
+}
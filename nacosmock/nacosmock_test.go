@@ -0,0 +1,273 @@
+package nacosmock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type MockSuite struct {
+	naming *Naming
+	config *Config
+}
+
+var _ = Suite(&MockSuite{})
+
+func (s *MockSuite) SetUpTest(c *C) {
+	s.naming = NewNaming()
+	s.config = NewConfig()
+}
+
+// eventRecorder is a pointer, which Unsubscribe can compare
+type eventRecorder struct {
+	events []*nacos.ServiceInfo
+}
+
+func (r *eventRecorder) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	r.events = append(r.events, serviceInfo)
+}
+
+type listenerFunc func(serviceInfo *nacos.ServiceInfo)
+
+func (f listenerFunc) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	f(serviceInfo)
+}
+
+type configFunc func(namespace, group, dataID, content string)
+
+func (f configFunc) OnChange(namespace, group, dataID, content string) {
+	f(namespace, group, dataID, content)
+}
+
+type connectionFunc func(event nacos.ConnectionEvent)
+
+func (f connectionFunc) OnConnectionChange(event nacos.ConnectionEvent) {
+	f(event)
+}
+
+func (s *MockSuite) TestSubscribe(c *C) {
+	listener := new(eventRecorder)
+	s.naming.Subscribe("svc", "", nil, listener)
+	c.Assert(listener.events, HasLen, 0)
+	c.Assert(s.naming.Listeners("svc", ""), Equals, 1)
+
+	_, err := s.naming.RegisterInstance(nacos.NewInstance("svc", "", "", "10.0.0.1", 80, 1, true, true, nil))
+	c.Assert(err, IsNil)
+	c.Assert(listener.events, HasLen, 1)
+	c.Assert(listener.events[0].Name, Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(listener.events[0].Hosts, HasLen, 1)
+	c.Assert(listener.events[0].Hosts[0].Healthy, Equals, true)
+	c.Assert(listener.events[0].Hosts[0].ClusterName, Equals, nacos.DefaultCluster)
+
+	s.naming.SetHealthy("svc", "", "10.0.0.1", 80, false)
+	c.Assert(listener.events, HasLen, 2)
+	c.Assert(listener.events[1].Hosts[0].Healthy, Equals, false)
+	_, err = s.naming.SelectOneHealthyInstance(nacos.InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, Equals, nacos.ErrNoInstanceAvailable)
+
+	s.naming.Emit("svc", "", &nacos.ServiceInfo{Name: "DEFAULT_GROUP@@svc"})
+	c.Assert(listener.events, HasLen, 3)
+	c.Assert(listener.events[2].Hosts, HasLen, 0)
+	c.Assert(s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc"}), HasLen, 1)
+
+	s.naming.Unsubscribe("svc", "", nil, listener)
+	c.Assert(s.naming.Listeners("svc", ""), Equals, 0)
+	s.naming.SetInstances("svc", "", nil)
+	c.Assert(listener.events, HasLen, 3)
+	c.Assert(s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc"}), HasLen, 0)
+}
+
+func (s *MockSuite) TestSelect(c *C) {
+	s.naming.SetInstances("svc", "g", []*nacos.Instance{
+		{IP: "10.0.0.1", Port: 80, Weight: 1, Healthy: true, Enable: true, ClusterName: "a"},
+		{IP: "10.0.0.2", Port: 80, Weight: 1, Healthy: false, Enable: true, ClusterName: "b"},
+	})
+	c.Assert(s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc", GroupName: "g"}), HasLen, 2)
+	c.Assert(s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc", GroupName: "g", Healthy: true}), HasLen, 1)
+	c.Assert(s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc", GroupName: "g", ClusterName: []string{"b"}}), HasLen, 1)
+	instance, err := s.naming.SelectOneHealthyInstance(nacos.InstanceQueryOptions{ServiceName: "svc", GroupName: "g"})
+	c.Assert(err, IsNil)
+	c.Assert(instance.IP, Equals, "10.0.0.1")
+
+	_, err = s.naming.PatchInstanceMetadata(nacos.InstanceKey{ServiceName: "svc", GroupName: "g", ClusterName: "a", IP: "10.0.0.1", Port: 80}, map[string]string{"k": "v"}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc", GroupName: "g", ClusterName: []string{"a"}})[0].Metadata.Get("k"), Equals, "v")
+	_, err = s.naming.UpdateInstanceHealth(nacos.InstanceKey{ServiceName: "svc", GroupName: "g", IP: "10.0.0.9", Port: 80}, true)
+	c.Assert(err, NotNil)
+
+	services, err := s.naming.SelectAllServices(context.Background(), "g")
+	c.Assert(err, IsNil)
+	c.Assert(services, DeepEquals, []string{"svc"})
+}
+
+func (s *MockSuite) TestServices(c *C) {
+	_, err := s.naming.CreateService(nacos.ServiceOptions{ServiceName: "a", Metadata: nacos.NewMetadata(nil).Put("foo", "bar")})
+	c.Assert(err, IsNil)
+	_, err = s.naming.CreateService(nacos.ServiceOptions{ServiceName: "a"})
+	c.Assert(err, NotNil)
+	s.naming.SetInstances("b", "", []*nacos.Instance{{IP: "10.0.0.1", Port: 80, Healthy: true}})
+
+	service, err := s.naming.SelectService(nacos.ServiceQueryOptions{ServiceName: "a"})
+	c.Assert(err, IsNil)
+	c.Assert(service.Metadata["foo"], Equals, "bar")
+	service, err = s.naming.GetService("b", "")
+	c.Assert(err, IsNil)
+	c.Assert(service.Clusters[nacos.DefaultCluster], NotNil)
+
+	it := s.naming.ServiceIterator(context.Background(), nacos.ServiceIteratorOptions{PageSize: 1, WithCounts: true})
+	var entries []nacos.ServiceEntry
+	for it.Next() {
+		entries = append(entries, it.Service())
+	}
+	c.Assert(it.Err(), IsNil)
+	c.Assert(entries, DeepEquals, []nacos.ServiceEntry{
+		{Name: "a", GroupName: nacos.DefaultGroup},
+		{Name: "b", GroupName: nacos.DefaultGroup, ClusterCount: 1, IPCount: 1, HealthyInstanceCount: 1},
+	})
+
+	_, err = s.naming.DeleteService(nacos.ServiceOptions{ServiceName: "b"})
+	c.Assert(err, NotNil)
+	_, err = s.naming.DeleteService(nacos.ServiceOptions{ServiceName: "a"})
+	c.Assert(err, IsNil)
+	// b goes away with its last instance
+	s.naming.SetInstances("b", "", nil)
+	list, err := s.naming.SelectServices(nacos.ServiceQueryOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list.Count, Equals, 0)
+}
+
+func (s *MockSuite) TestCalls(c *C) {
+	instance := nacos.NewInstance("svc", "", "", "10.0.0.1", 80, 1, true, true, nil)
+	failure := errors.New("failure")
+	s.naming.SetError("RegisterInstance", failure)
+	_, err := s.naming.RegisterInstance(instance)
+	c.Assert(err, Equals, failure)
+	c.Assert(s.naming.SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc"}), HasLen, 0)
+
+	s.naming.SetError("RegisterInstance", nil)
+	_, err = s.naming.RegisterInstance(instance)
+	c.Assert(err, IsNil)
+	s.naming.Report("DEFAULT_GROUP@@svc", instance, failure)
+
+	c.Assert(s.naming.CallsTo("RegisterInstance"), HasLen, 2)
+	c.Assert(s.naming.CallsTo("Report"), DeepEquals, []Call{{Method: "Report", Args: []interface{}{"DEFAULT_GROUP@@svc", instance, failure}}})
+	c.Assert(s.naming.Calls(), HasLen, 4)
+	s.naming.ResetCalls()
+	c.Assert(s.naming.Calls(), HasLen, 0)
+}
+
+func (s *MockSuite) TestStats(c *C) {
+	s.naming.RegisterInstance(nacos.NewInstance("svc", "", "", "10.0.0.1", 80, 1, true, true, nil))
+	s.naming.RegisterInstance(nacos.NewInstance("svc", "", "", "10.0.0.2", 80, 1, true, false, nil))
+	s.naming.Subscribe("svc", "", nil, listenerFunc(func(*nacos.ServiceInfo) {}))
+	c.Assert(s.naming.BeatStats(), HasLen, 1)
+	stats := s.naming.RedoStats()
+	c.Assert(stats.Instances, Equals, 1)
+	c.Assert(stats.Subscriptions, Equals, 1)
+}
+
+type redoFunc func(event nacos.RedoEvent)
+
+func (f redoFunc) OnRedo(event nacos.RedoEvent) {
+	f(event)
+}
+
+type outlierFunc func(event nacos.OutlierEvent)
+
+func (f outlierFunc) OnOutlier(event nacos.OutlierEvent) {
+	f(event)
+}
+
+func (s *MockSuite) TestEmitEvents(c *C) {
+	var redone []nacos.RedoEvent
+	var ejected []nacos.OutlierEvent
+	s.naming.AddRedoListener(redoFunc(func(event nacos.RedoEvent) { redone = append(redone, event) }))
+	s.naming.AddOutlierListener(outlierFunc(func(event nacos.OutlierEvent) { ejected = append(ejected, event) }))
+	s.naming.EmitRedo(nacos.RedoEvent{Type: nacos.RedoSubscribe})
+	s.naming.EmitOutlier(nacos.OutlierEvent{Type: nacos.OutlierEjected})
+	c.Assert(redone, HasLen, 1)
+	c.Assert(ejected, HasLen, 1)
+
+	client := NewClient()
+	var events []nacos.ConnectionEvent
+	client.AddConnectionListener(connectionFunc(func(event nacos.ConnectionEvent) { events = append(events, event) }))
+	client.EmitConnection(nacos.ConnectionEvent{Module: "naming"})
+	c.Assert(events, HasLen, 1)
+	client.Logger().Info("hello %s", "world")
+	c.Assert(client.Log.Lines(), DeepEquals, []string{"[INFO ] hello world"})
+}
+
+func (s *MockSuite) TestConfig(c *C) {
+	var contents []string
+	listener := configFunc(func(namespace, group, dataID, content string) {
+		c.Assert(group, Equals, nacos.DefaultGroup)
+		c.Assert(dataID, Equals, "app.yaml")
+		contents = append(contents, content)
+	})
+	_, err := s.config.GetConfigAndSignListener("app.yaml", "", listener)
+	c.Assert(err, Equals, nacos.ErrConfigNotFound)
+
+	c.Assert(s.config.PublishConfig("app.yaml", "", "a: 1"), IsNil)
+	s.config.SetConfig("app.yaml", "", "a: 1")
+	s.config.SetConfig("app.yaml", "", "a: 2")
+	content, err := s.config.GetConfig("app.yaml", "")
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "a: 2")
+	c.Assert(s.config.RemoveConfig("app.yaml", ""), IsNil)
+	c.Assert(contents, DeepEquals, []string{"a: 1", "a: 2", ""})
+
+	s.config.SetConfig("app.yaml", "", "a: 3")
+	var added []string
+	s.config.AddListener("app.yaml", "", configFunc(func(namespace, group, dataID, content string) {
+		added = append(added, content)
+	}))
+	c.Assert(added, DeepEquals, []string{"a: 3"})
+	c.Assert(s.config.Listeners("app.yaml", ""), Equals, 2)
+	s.config.RemoveListener("app.yaml", "")
+	c.Assert(s.config.Listeners("app.yaml", ""), Equals, 0)
+	c.Assert(s.config.CallsTo("PublishConfig"), HasLen, 1)
+}
+
+func (s *MockSuite) TestConfigHistory(c *C) {
+	ctx := context.Background()
+	s.config.SetConfig("app.yaml", "", "a: 1")
+	c.Assert(s.config.PublishConfig("app.yaml", "", "a: 2"), IsNil)
+	c.Assert(s.config.PublishConfig("db.yaml", "infra", "url: x"), IsNil)
+
+	list, err := s.config.SearchConfigs(ctx, nacos.ConfigSearchOptions{DataID: "*.yaml", Blur: true})
+	c.Assert(err, IsNil)
+	c.Assert(list.Count, Equals, 2)
+	c.Assert(list.Configs[0].Content, Equals, "a: 2")
+	list, err = s.config.SearchConfigs(ctx, nacos.ConfigSearchOptions{Group: "infra"})
+	c.Assert(err, IsNil)
+	c.Assert(list.Configs, HasLen, 1)
+
+	history, err := s.config.History(ctx, nacos.ConfigHistoryOptions{DataID: "app.yaml"})
+	c.Assert(err, IsNil)
+	c.Assert(history.Changes, HasLen, 2)
+	c.Assert(history.Changes[0].OpType, Equals, "U")
+	c.Assert(history.Changes[0].Content, Equals, "")
+	change, err := s.config.HistoryDetail(ctx, "app.yaml", "", history.Changes[1].ID)
+	c.Assert(err, IsNil)
+	c.Assert(change.Content, Equals, "a: 1")
+}
+
+func (s *MockSuite) TestNamespaces(c *C) {
+	ctx := context.Background()
+	namespaces := NewNamespaces()
+	c.Assert(namespaces.Create(ctx, nacos.NamespaceOptions{Name: "dev"}), IsNil)
+	c.Assert(namespaces.Update(ctx, nacos.NamespaceOptions{ID: "ns-1", Name: "Dev"}), IsNil)
+	list, err := namespaces.List(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 2)
+	c.Assert(list[1].Name, Equals, "Dev")
+	c.Assert(namespaces.Delete(ctx, "ns-1"), IsNil)
+	c.Assert(namespaces.CallsTo("Create"), HasLen, 1)
+}
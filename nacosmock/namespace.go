@@ -0,0 +1,91 @@
+package nacosmock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+var _ nacos.NamespaceClient = new(Namespaces)
+
+// Namespaces is a NamespaceClient over an in-memory list, which starts
+// with the public namespace
+type Namespaces struct {
+	recorder
+
+	mu         sync.Mutex
+	namespaces map[string]*nacos.Namespace
+	generated  int
+}
+
+// NewNamespaces returns Namespaces holding the public namespace only
+func NewNamespaces() *Namespaces {
+	return &Namespaces{
+		namespaces: map[string]*nacos.Namespace{
+			"": {Name: "public", Quota: 200},
+		},
+	}
+}
+
+// List returns the public namespace first, then the others by ID
+func (n *Namespaces) List(ctx context.Context) ([]*nacos.Namespace, error) {
+	if err := n.record("List", ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	namespaces := make([]*nacos.Namespace, 0, len(n.namespaces))
+	for _, ns := range n.namespaces {
+		c := *ns
+		namespaces = append(namespaces, &c)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].ID < namespaces[j].ID })
+	return namespaces, nil
+}
+
+// Create names the namespace ns-1, ns-2... when the ID is empty
+func (n *Namespaces) Create(ctx context.Context, ns nacos.NamespaceOptions) error {
+	if err := n.record("Create", ctx, ns); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if ns.ID == "" {
+		n.generated++
+		ns.ID = fmt.Sprintf("ns-%d", n.generated)
+	}
+	if _, ok := n.namespaces[ns.ID]; ok {
+		return fmt.Errorf("failed to create namespace %s", ns.Name)
+	}
+	n.namespaces[ns.ID] = &nacos.Namespace{ID: ns.ID, Name: ns.Name, Description: ns.Description, Quota: 200, Type: 2}
+	return nil
+}
+
+func (n *Namespaces) Update(ctx context.Context, ns nacos.NamespaceOptions) error {
+	if err := n.record("Update", ctx, ns); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	namespace, ok := n.namespaces[ns.ID]
+	if !ok || ns.ID == "" {
+		return fmt.Errorf("failed to update namespace %s", ns.ID)
+	}
+	namespace.Name, namespace.Description = ns.Name, ns.Description
+	return nil
+}
+
+func (n *Namespaces) Delete(ctx context.Context, id string) error {
+	if err := n.record("Delete", ctx, id); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if id != "" {
+		delete(n.namespaces, id)
+	}
+	return nil
+}
@@ -0,0 +1,751 @@
+package nacosmock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+)
+
+const cacheMillis = 10000
+
+var _ nacos.NamingClient = new(Naming)
+
+// Naming is a NamingClient over an in-memory registry. Registered instances
+// are healthy, and the subscriptions of a service are notified of each
+// change. The methods of NamingClient are recorded, the ones setting the
+// fake up are not.
+type Naming struct {
+	recorder
+	// OperatorClient is returned by Operator
+	OperatorClient nacos.OperatorClient
+
+	mu               sync.Mutex
+	services         map[string]*service
+	subscriptions    map[string][]subscription
+	outlierListeners []nacos.OutlierListener
+	redoListeners    []nacos.RedoListener
+	lastRefTime      int64
+}
+
+type service struct {
+	info nacos.Service
+	// created is set for the services created explicitly, the others go
+	// away with their last instance
+	created   bool
+	clusters  map[string]*nacos.Cluster
+	instances []*nacos.Instance
+}
+
+type subscription struct {
+	clusters []string
+	listener nacos.EventListener
+}
+
+// NewNaming returns a Naming without services
+func NewNaming() *Naming {
+	return &Naming{
+		services:      make(map[string]*service),
+		subscriptions: make(map[string][]subscription),
+	}
+}
+
+func groupOrDefault(groupName string) string {
+	if groupName == "" {
+		return nacos.DefaultGroup
+	}
+	return groupName
+}
+
+func grouped(serviceName, groupName string) string {
+	return groupOrDefault(groupName) + "@@" + serviceName
+}
+
+func instanceKey(i *nacos.Instance) string {
+	return i.ClusterName + "#" + i.IP + "#" + strconv.Itoa(i.Port)
+}
+
+func clone(i *nacos.Instance) *nacos.Instance {
+	c := *i
+	c.Metadata = nacos.NewMetadata(i.Metadata.Map())
+	return &c
+}
+
+func inClusters(i *nacos.Instance, clusters []string) bool {
+	if len(clusters) == 0 {
+		return true
+	}
+	for _, c := range clusters {
+		if c == "" || c == i.ClusterName {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceLocked returns the service, created if create is true
+func (n *Naming) serviceLocked(serviceName, groupName string, create bool) *service {
+	name := grouped(serviceName, groupName)
+	s, ok := n.services[name]
+	if !ok && create {
+		s = &service{
+			info:     nacos.Service{Name: serviceName, GroupName: groupOrDefault(groupName), Metadata: map[string]string{}},
+			clusters: make(map[string]*nacos.Cluster),
+		}
+		n.services[name] = s
+	}
+	return s
+}
+
+func (n *Naming) hostsLocked(name string, clusters []string) []*nacos.Instance {
+	hosts := []*nacos.Instance{}
+	if s, ok := n.services[name]; ok {
+		for _, i := range s.instances {
+			if inClusters(i, clusters) {
+				hosts = append(hosts, clone(i))
+			}
+		}
+	}
+	return hosts
+}
+
+func (n *Naming) serviceInfoLocked(serviceName, groupName string, clusters []string) *nacos.ServiceInfo {
+	name := grouped(serviceName, groupName)
+	return &nacos.ServiceInfo{
+		Name:        name,
+		GroupName:   groupOrDefault(groupName),
+		Clusters:    strings.Join(clusters, ","),
+		CacheMillis: cacheMillis,
+		Hosts:       n.hostsLocked(name, clusters),
+		LastRefTime: n.lastRefTime,
+	}
+}
+
+// changed calls the listeners of the service, n.mu is held and released
+func (n *Naming) changed(serviceName, groupName string) {
+	name := grouped(serviceName, groupName)
+	if s, ok := n.services[name]; ok && !s.created && len(s.instances) == 0 {
+		delete(n.services, name)
+	}
+	n.lastRefTime = time.Now().UnixNano() / int64(time.Millisecond)
+	type event struct {
+		listener    nacos.EventListener
+		serviceInfo *nacos.ServiceInfo
+	}
+	var events []event
+	for _, s := range n.subscriptions[name] {
+		events = append(events, event{s.listener, n.serviceInfoLocked(serviceName, groupName, s.clusters)})
+	}
+	n.mu.Unlock()
+	for _, e := range events {
+		e.listener.OnEvent(e.serviceInfo)
+	}
+}
+
+func okResponse() *nacos.Response {
+	return &nacos.Response{Code: 200, Data: "ok"}
+}
+
+func (n *Naming) serviceNamesLocked(groupName string) []string {
+	groupName = groupOrDefault(groupName)
+	names := []string{}
+	for _, s := range n.services {
+		if s.info.GroupName == groupName {
+			names = append(names, s.info.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n *Naming) SelectServices(q nacos.ServiceQueryOptions) (*nacos.ServiceList, error) {
+	if err := n.record("SelectServices", q); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	names := n.serviceNamesLocked(q.GroupName)
+	n.mu.Unlock()
+	page, size := q.Page, q.Size
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+	list := &nacos.ServiceList{Count: len(names), Service: []string{}}
+	if start := (page - 1) * size; start < len(names) {
+		end := start + size
+		if end > len(names) {
+			end = len(names)
+		}
+		list.Service = names[start:end]
+	}
+	return list, nil
+}
+
+func (n *Naming) SelectAllServices(ctx context.Context, groupName string) ([]string, error) {
+	if err := n.record("SelectAllServices", ctx, groupName); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.serviceNamesLocked(groupName), nil
+}
+
+func (n *Naming) ServiceIterator(ctx context.Context, opts nacos.ServiceIteratorOptions) *nacos.ServiceIterator {
+	n.record("ServiceIterator", ctx, opts)
+	return nacos.NewServiceIterator(ctx, n, opts)
+}
+
+func notFound(serviceName, groupName string) error {
+	return fmt.Errorf("service %s not found", grouped(serviceName, groupName))
+}
+
+func (n *Naming) SelectService(q nacos.ServiceQueryOptions) (*nacos.Service, error) {
+	if err := n.record("SelectService", q); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s := n.serviceLocked(q.ServiceName, q.GroupName, false)
+	if s == nil {
+		return nil, notFound(q.ServiceName, q.GroupName)
+	}
+	return s.copy(false), nil
+}
+
+// copy returns the service, with its clusters if withClusters is set
+func (s *service) copy(withClusters bool) *nacos.Service {
+	c := s.info
+	c.Metadata = make(map[string]string, len(s.info.Metadata))
+	for k, v := range s.info.Metadata {
+		c.Metadata[k] = v
+	}
+	c.Clusters = nil
+	if withClusters {
+		c.Clusters = make(nacos.ClusterMap)
+		for _, i := range s.instances {
+			c.Clusters[i.ClusterName] = &nacos.Cluster{Name: i.ClusterName, Metadata: map[string]string{}, HealthChecker: nacos.NewTCPHealthChecker()}
+		}
+		for name, cluster := range s.clusters {
+			cc := *cluster
+			c.Clusters[name] = &cc
+		}
+	}
+	return &c
+}
+
+func (n *Naming) GetService(serviceName, groupName string) (*nacos.Service, error) {
+	if err := n.record("GetService", serviceName, groupName); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s := n.serviceLocked(serviceName, groupName, false)
+	if s == nil {
+		return nil, notFound(serviceName, groupName)
+	}
+	return s.copy(true), nil
+}
+
+func (s *service) setOptions(opts nacos.ServiceOptions) {
+	s.info.ProtectThreshold = opts.ProtectThreshold
+	if opts.Metadata != nil {
+		s.info.Metadata = opts.Metadata.Map()
+	}
+	if opts.Selector != nil {
+		selector := *opts.Selector
+		s.info.Selector = &selector
+	}
+}
+
+func (n *Naming) CreateService(opts nacos.ServiceOptions) (*nacos.Response, error) {
+	if err := n.record("CreateService", opts); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	if n.serviceLocked(opts.ServiceName, opts.GroupName, false) != nil {
+		n.mu.Unlock()
+		return nil, fmt.Errorf("service %s already exists", grouped(opts.ServiceName, opts.GroupName))
+	}
+	s := n.serviceLocked(opts.ServiceName, opts.GroupName, true)
+	s.created = true
+	s.setOptions(opts)
+	n.changed(opts.ServiceName, opts.GroupName)
+	return okResponse(), nil
+}
+
+func (n *Naming) DeleteService(opts nacos.ServiceOptions) (*nacos.Response, error) {
+	if err := n.record("DeleteService", opts); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s := n.serviceLocked(opts.ServiceName, opts.GroupName, false)
+	switch {
+	case s == nil:
+		return nil, notFound(opts.ServiceName, opts.GroupName)
+	case len(s.instances) > 0:
+		return nil, fmt.Errorf("service %s has instances", grouped(opts.ServiceName, opts.GroupName))
+	}
+	delete(n.services, grouped(opts.ServiceName, opts.GroupName))
+	return okResponse(), nil
+}
+
+func (n *Naming) UpdateService(opts nacos.ServiceOptions) (*nacos.Response, error) {
+	if err := n.record("UpdateService", opts); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	s := n.serviceLocked(opts.ServiceName, opts.GroupName, false)
+	if s == nil {
+		n.mu.Unlock()
+		return nil, notFound(opts.ServiceName, opts.GroupName)
+	}
+	s.setOptions(opts)
+	n.changed(opts.ServiceName, opts.GroupName)
+	return okResponse(), nil
+}
+
+// setCluster stores the cluster of opts; an update keeps the settings opts
+// leaves unset
+func (n *Naming) setCluster(opts nacos.ClusterOptions, update bool) (*nacos.Response, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s := n.serviceLocked(opts.ServiceName, opts.GroupName, false)
+	if s == nil {
+		return nil, notFound(opts.ServiceName, opts.GroupName)
+	}
+	clusterName := opts.ClusterName
+	if clusterName == "" {
+		clusterName = nacos.DefaultCluster
+	}
+	cluster := &nacos.Cluster{
+		Name:          clusterName,
+		ServiceName:   opts.ServiceName,
+		HealthChecker: nacos.NewTCPHealthChecker(),
+	}
+	if old, ok := s.clusters[clusterName]; ok && update {
+		c := *old
+		cluster = &c
+	}
+	if opts.CheckPort != 0 || !update {
+		cluster.DefaultCheckPort = opts.CheckPort
+	}
+	if opts.UseIPPort4Check != nil {
+		cluster.UseIPPort4Check = *opts.UseIPPort4Check
+	}
+	if opts.HealthChecker != nil {
+		cluster.HealthChecker = opts.HealthChecker
+	}
+	if opts.Metadata != nil || !update {
+		cluster.Metadata = opts.Metadata.Map()
+	}
+	s.clusters[clusterName] = cluster
+	return okResponse(), nil
+}
+
+func (n *Naming) CreateCluster(opts nacos.ClusterOptions) (*nacos.Response, error) {
+	if err := n.record("CreateCluster", opts); err != nil {
+		return nil, err
+	}
+	return n.setCluster(opts, false)
+}
+
+func (n *Naming) UpdateCluster(opts nacos.ClusterOptions) (*nacos.Response, error) {
+	if err := n.record("UpdateCluster", opts); err != nil {
+		return nil, err
+	}
+	return n.setCluster(opts, true)
+}
+
+// register stores the instance, healthy, in place of the one at the same
+// address
+func (n *Naming) register(instance *nacos.Instance) {
+	instance.GroupName = groupOrDefault(instance.GroupName)
+	if instance.ClusterName == "" {
+		instance.ClusterName = nacos.DefaultCluster
+	}
+	n.mu.Lock()
+	s := n.serviceLocked(instance.ServiceName, instance.GroupName, true)
+	registered := clone(instance)
+	registered.Healthy = true
+	for i, existing := range s.instances {
+		if instanceKey(existing) == instanceKey(registered) {
+			s.instances = append(s.instances[:i], s.instances[i+1:]...)
+			break
+		}
+	}
+	s.instances = append(s.instances, registered)
+	sort.Slice(s.instances, func(i, j int) bool { return instanceKey(s.instances[i]) < instanceKey(s.instances[j]) })
+	n.changed(instance.ServiceName, instance.GroupName)
+}
+
+func (n *Naming) deregister(serviceName, groupName, clusterName, ip string, port int) {
+	if clusterName == "" {
+		clusterName = nacos.DefaultCluster
+	}
+	n.mu.Lock()
+	if s := n.serviceLocked(serviceName, groupName, false); s != nil {
+		instances := s.instances[:0]
+		for _, i := range s.instances {
+			if i.ClusterName != clusterName || i.IP != ip || i.Port != port {
+				instances = append(instances, i)
+			}
+		}
+		s.instances = instances
+	}
+	n.changed(serviceName, groupName)
+}
+
+func (n *Naming) RegisterInstance(instance *nacos.Instance) (*nacos.Response, error) {
+	if err := n.record("RegisterInstance", instance); err != nil {
+		return nil, err
+	}
+	n.register(instance)
+	return okResponse(), nil
+}
+
+func (n *Naming) DeRegisterInstance(serviceName, groupName, clusterName, ip string, port int, ephemeral bool) (*nacos.Response, error) {
+	if err := n.record("DeRegisterInstance", serviceName, groupName, clusterName, ip, port, ephemeral); err != nil {
+		return nil, err
+	}
+	n.deregister(serviceName, groupName, clusterName, ip, port)
+	return okResponse(), nil
+}
+
+func (n *Naming) BatchRegisterInstances(serviceName, groupName string, instances []*nacos.Instance) []nacos.InstanceResult {
+	err := n.record("BatchRegisterInstances", serviceName, groupName, instances)
+	results := make([]nacos.InstanceResult, len(instances))
+	for i, instance := range instances {
+		results[i] = nacos.InstanceResult{Instance: instance, Err: err}
+		if err == nil {
+			instance.ServiceName, instance.GroupName = serviceName, groupName
+			n.register(instance)
+			results[i].Response = okResponse()
+		}
+	}
+	return results
+}
+
+func (n *Naming) BatchDeregisterInstances(serviceName, groupName string, instances []*nacos.Instance) []nacos.InstanceResult {
+	err := n.record("BatchDeregisterInstances", serviceName, groupName, instances)
+	results := make([]nacos.InstanceResult, len(instances))
+	for i, instance := range instances {
+		results[i] = nacos.InstanceResult{Instance: instance, Err: err}
+		if err == nil {
+			n.deregister(serviceName, groupName, instance.ClusterName, instance.IP, instance.Port)
+			results[i].Response = okResponse()
+		}
+	}
+	return results
+}
+
+// update applies fn to the registered instance of the key and notifies the
+// listeners, n.mu is released
+func (n *Naming) update(key nacos.InstanceKey, fn func(instance *nacos.Instance)) (*nacos.Response, error) {
+	if key.ClusterName == "" {
+		key.ClusterName = nacos.DefaultCluster
+	}
+	n.mu.Lock()
+	if s := n.serviceLocked(key.ServiceName, key.GroupName, false); s != nil {
+		for _, i := range s.instances {
+			if i.ClusterName == key.ClusterName && i.IP == key.IP && i.Port == key.Port {
+				fn(i)
+				n.changed(key.ServiceName, key.GroupName)
+				return okResponse(), nil
+			}
+		}
+	}
+	n.mu.Unlock()
+	return nil, fmt.Errorf("instance %s:%d of %s not found", key.IP, key.Port, grouped(key.ServiceName, key.GroupName))
+}
+
+func (n *Naming) UpdateInstance(instance *nacos.Instance) (*nacos.Response, error) {
+	if err := n.record("UpdateInstance", instance); err != nil {
+		return nil, err
+	}
+	key := nacos.InstanceKey{
+		ServiceName: instance.ServiceName,
+		GroupName:   instance.GroupName,
+		ClusterName: instance.ClusterName,
+		IP:          instance.IP,
+		Port:        instance.Port,
+	}
+	return n.update(key, func(i *nacos.Instance) {
+		i.Weight = instance.Weight
+		i.Enable = instance.Enable
+		i.Metadata = nacos.NewMetadata(instance.Metadata.Map())
+	})
+}
+
+func (n *Naming) PatchInstanceMetadata(key nacos.InstanceKey, add map[string]string, remove []string) (*nacos.Response, error) {
+	if err := n.record("PatchInstanceMetadata", key, add, remove); err != nil {
+		return nil, err
+	}
+	return n.update(key, func(i *nacos.Instance) {
+		metadata := nacos.NewMetadata(i.Metadata.Map())
+		for k, v := range add {
+			metadata.Put(k, v)
+		}
+		for _, k := range remove {
+			metadata.Remove(k)
+		}
+		i.Metadata = metadata
+	})
+}
+
+func (n *Naming) UpdateInstanceHealth(key nacos.InstanceKey, healthy bool) (*nacos.Response, error) {
+	if err := n.record("UpdateInstanceHealth", key, healthy); err != nil {
+		return nil, err
+	}
+	return n.update(key, func(i *nacos.Instance) {
+		i.Healthy = healthy
+	})
+}
+
+func (n *Naming) SelectInstance(q nacos.InstanceQueryOptions) []*nacos.Instance {
+	n.record("SelectInstance", q)
+	return n.selectInstance(q)
+}
+
+func (n *Naming) selectInstance(q nacos.InstanceQueryOptions) []*nacos.Instance {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var instances []*nacos.Instance
+	for _, i := range n.hostsLocked(grouped(q.ServiceName, q.GroupName), q.ClusterName) {
+		if !q.Healthy || i.Healthy {
+			instances = append(instances, i)
+		}
+	}
+	return instances
+}
+
+// SelectHealthyInstances returns the healthy and enabled instances with a
+// weight
+func (n *Naming) SelectHealthyInstances(q nacos.InstanceQueryOptions) []*nacos.Instance {
+	n.record("SelectHealthyInstances", q)
+	return n.healthyInstances(q)
+}
+
+func (n *Naming) healthyInstances(q nacos.InstanceQueryOptions) []*nacos.Instance {
+	var instances []*nacos.Instance
+	for _, i := range n.selectInstance(q) {
+		if i.Healthy && i.Enable && i.Weight > 0 {
+			instances = append(instances, i)
+		}
+	}
+	return instances
+}
+
+// SelectOneHealthyInstance picks a healthy and enabled instance by weighted
+// random
+func (n *Naming) SelectOneHealthyInstance(q nacos.InstanceQueryOptions) (*nacos.Instance, error) {
+	if err := n.record("SelectOneHealthyInstance", q); err != nil {
+		return nil, err
+	}
+	instances := n.healthyInstances(q)
+	if len(instances) == 0 {
+		return nil, nacos.ErrNoInstanceAvailable
+	}
+	return nacos.NewWeightedRandomBalancer().Pick(instances), nil
+}
+
+// Report only records the call, see CallsTo
+func (n *Naming) Report(groupedServiceName string, instance *nacos.Instance, err error) {
+	n.record("Report", groupedServiceName, instance, err)
+}
+
+func (n *Naming) AddOutlierListener(listener nacos.OutlierListener) {
+	n.record("AddOutlierListener", listener)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.outlierListeners = append(n.outlierListeners, listener)
+}
+
+// EmitOutlier calls the outlier listeners with event
+func (n *Naming) EmitOutlier(event nacos.OutlierEvent) {
+	n.mu.Lock()
+	listeners := append([]nacos.OutlierListener(nil), n.outlierListeners...)
+	n.mu.Unlock()
+	for _, listener := range listeners {
+		listener.OnOutlier(event)
+	}
+}
+
+func (n *Naming) GetServiceInfo(serviceName, groupName string, clusters []string) *nacos.ServiceInfo {
+	n.record("GetServiceInfo", serviceName, groupName, clusters)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.serviceInfoLocked(serviceName, groupName, clusters)
+}
+
+// Subscribe calls the listener with the instances of the service right away
+// if there are some, as the naming client does once they are known
+func (n *Naming) Subscribe(serviceName, groupName string, clusters []string, listener nacos.EventListener) {
+	n.record("Subscribe", serviceName, groupName, clusters, listener)
+	n.mu.Lock()
+	name := grouped(serviceName, groupName)
+	n.subscriptions[name] = append(n.subscriptions[name], subscription{clusters, listener})
+	serviceInfo := n.serviceInfoLocked(serviceName, groupName, clusters)
+	n.mu.Unlock()
+	if len(serviceInfo.Hosts) > 0 {
+		listener.OnEvent(serviceInfo)
+	}
+}
+
+func (n *Naming) Unsubscribe(serviceName, groupName string, clusters []string, listener nacos.EventListener) {
+	n.record("Unsubscribe", serviceName, groupName, clusters, listener)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	name := grouped(serviceName, groupName)
+	subscriptions := n.subscriptions[name][:0]
+	for _, s := range n.subscriptions[name] {
+		if s.listener != listener || strings.Join(s.clusters, ",") != strings.Join(clusters, ",") {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	n.subscriptions[name] = subscriptions
+}
+
+// Catalog returns a CatalogClient over the registry
+func (n *Naming) Catalog() nacos.CatalogClient {
+	n.record("Catalog")
+	return &catalog{n: n}
+}
+
+// Operator returns OperatorClient, nil unless set
+func (n *Naming) Operator() nacos.OperatorClient {
+	n.record("Operator")
+	return n.OperatorClient
+}
+
+// BeatStats returns an entry per ephemeral instance registered, no beat is
+// sent
+func (n *Naming) BeatStats() []nacos.BeatStats {
+	n.record("BeatStats")
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var stats []nacos.BeatStats
+	for name, s := range n.services {
+		for _, i := range s.instances {
+			if i.Ephemeral {
+				stats = append(stats, nacos.BeatStats{ServiceName: name, IP: i.IP, Port: i.Port, Period: 5 * time.Second})
+			}
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.ServiceName != b.ServiceName {
+			return a.ServiceName < b.ServiceName
+		}
+		if a.IP != b.IP {
+			return a.IP < b.IP
+		}
+		return a.Port < b.Port
+	})
+	return stats
+}
+
+func (n *Naming) AddRedoListener(listener nacos.RedoListener) {
+	n.record("AddRedoListener", listener)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.redoListeners = append(n.redoListeners, listener)
+}
+
+// EmitRedo calls the redo listeners with event
+func (n *Naming) EmitRedo(event nacos.RedoEvent) {
+	n.mu.Lock()
+	listeners := append([]nacos.RedoListener(nil), n.redoListeners...)
+	n.mu.Unlock()
+	for _, listener := range listeners {
+		listener.OnRedo(event)
+	}
+}
+
+// RedoStats returns the number of ephemeral instances registered and of
+// subscriptions, nothing is ever redone
+func (n *Naming) RedoStats() nacos.RedoStats {
+	n.record("RedoStats")
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var stats nacos.RedoStats
+	for _, s := range n.services {
+		for _, i := range s.instances {
+			if i.Ephemeral {
+				stats.Instances++
+			}
+		}
+	}
+	for _, subscriptions := range n.subscriptions {
+		stats.Subscriptions += len(subscriptions)
+	}
+	return stats
+}
+
+// Shutdown removes the subscriptions, the instances stay registered
+func (n *Naming) Shutdown(ctx context.Context) error {
+	if err := n.record("Shutdown", ctx); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.subscriptions = make(map[string][]subscription)
+	return nil
+}
+
+// SetInstances replaces the instances of the service, as registered by
+// other clients, and notifies the subscriptions
+func (n *Naming) SetInstances(serviceName, groupName string, instances []*nacos.Instance) {
+	n.mu.Lock()
+	s := n.serviceLocked(serviceName, groupName, true)
+	s.instances = nil
+	for _, instance := range instances {
+		c := clone(instance)
+		c.ServiceName, c.GroupName = serviceName, groupOrDefault(groupName)
+		if c.ClusterName == "" {
+			c.ClusterName = nacos.DefaultCluster
+		}
+		s.instances = append(s.instances, c)
+	}
+	sort.Slice(s.instances, func(i, j int) bool { return instanceKey(s.instances[i]) < instanceKey(s.instances[j]) })
+	n.changed(serviceName, groupName)
+}
+
+// SetHealthy changes the health of the instances of the service at ip:port
+// and notifies the subscriptions
+func (n *Naming) SetHealthy(serviceName, groupName, ip string, port int, healthy bool) {
+	n.mu.Lock()
+	if s := n.serviceLocked(serviceName, groupName, false); s != nil {
+		for _, i := range s.instances {
+			if i.IP == ip && i.Port == port {
+				i.Healthy = healthy
+			}
+		}
+	}
+	n.changed(serviceName, groupName)
+}
+
+// Emit calls the listeners subscribed to the service with serviceInfo as
+// is, leaving the registry unchanged
+func (n *Naming) Emit(serviceName, groupName string, serviceInfo *nacos.ServiceInfo) {
+	n.mu.Lock()
+	subscriptions := append([]subscription(nil), n.subscriptions[grouped(serviceName, groupName)]...)
+	n.mu.Unlock()
+	for _, s := range subscriptions {
+		s.listener.OnEvent(serviceInfo)
+	}
+}
+
+// Listeners returns the number of subscriptions to the service
+func (n *Naming) Listeners(serviceName, groupName string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.subscriptions[grouped(serviceName, groupName)])
+}
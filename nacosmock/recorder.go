@@ -0,0 +1,73 @@
+// Package nacosmock provides in-memory fakes of the clients of the SDK, to
+// unit test code depending on them without a server. Naming holds an
+// instance registry whose subscriptions can be made to emit events, Config
+// a config store whose changes can be triggered, and every call to them is
+// recorded for assertions. Listeners are called synchronously, by the
+// goroutine making the change.
+package nacosmock
+
+import "sync"
+
+// Call is a call to a fake, with its arguments as given
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// recorder records the calls of a fake and the errors set for its methods
+type recorder struct {
+	mu     sync.Mutex
+	calls  []Call
+	errors map[string]error
+}
+
+// record records a call and returns the error set for the method
+func (r *recorder) record(method string, args ...interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+	return r.errors[method]
+}
+
+// Calls returns the calls made so far, in order
+func (r *recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the calls made so far to the method, in order
+func (r *recorder) CallsTo(method string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls []Call
+	for _, call := range r.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ResetCalls forgets the calls made so far
+func (r *recorder) ResetCalls() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// SetError makes the method, such as "RegisterInstance", fail with err and
+// leave the state unchanged until it is set back to nil; methods without an
+// error result are not affected
+func (r *recorder) SetError(method string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.errors == nil {
+		r.errors = make(map[string]error)
+	}
+	if err == nil {
+		delete(r.errors, method)
+	} else {
+		r.errors[method] = err
+	}
+}
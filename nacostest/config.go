@@ -0,0 +1,322 @@
+package nacostest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultListenTimeout = 30 * time.Second
+
+type configKey struct {
+	// tenant is the namespace, empty for the public one
+	tenant string
+	group  string
+	dataID string
+}
+
+func configKeyOf(params url.Values) configKey {
+	tenant := params.Get("tenant")
+	if tenant == defaultNamespace {
+		tenant = ""
+	}
+	group := params.Get("group")
+	if group == "" {
+		group = defaultGroup
+	}
+	return configKey{tenant, group, params.Get("dataId")}
+}
+
+// md5Hex returns the md5 of the content as the clients compute it, empty
+// for a missing config
+func md5Hex(content string) string {
+	if content == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) getConfig(w http.ResponseWriter, params url.Values) {
+	s.mu.Lock()
+	content, ok := s.configs[configKeyOf(params)]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "config data not exist", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-MD5", md5Hex(content))
+	writeText(w, content)
+}
+
+func (s *Server) publishConfig(w http.ResponseWriter, params url.Values) {
+	key := configKeyOf(params)
+	content := params.Get("content")
+	if key.dataID == "" || content == "" {
+		http.Error(w, "dataId and content are required", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	op := "I"
+	if _, ok := s.configs[key]; ok {
+		op = "U"
+	}
+	s.configs[key] = content
+	s.recordLocked(key, content, op, params)
+	s.configChangedLocked()
+	s.mu.Unlock()
+	writeText(w, "true")
+}
+
+func (s *Server) removeConfig(w http.ResponseWriter, params url.Values) {
+	key := configKeyOf(params)
+	s.mu.Lock()
+	if content, ok := s.configs[key]; ok {
+		delete(s.configs, key)
+		s.recordLocked(key, content, "D", params)
+		s.configChangedLocked()
+	}
+	s.mu.Unlock()
+	writeText(w, "true")
+}
+
+// Config returns the content of a config, in the public namespace if
+// namespace is empty and DEFAULT_GROUP if group is
+func (s *Server) Config(namespace, group, dataID string) (string, bool) {
+	if namespace == defaultNamespace {
+		namespace = ""
+	}
+	if group == "" {
+		group = defaultGroup
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.configs[configKey{namespace, group, dataID}]
+	return content, ok
+}
+
+func (s *Server) configChangedLocked() {
+	close(s.configChanged)
+	s.configChanged = make(chan struct{})
+}
+
+type listenedConfig struct {
+	key configKey
+	md5 string
+}
+
+// parseListeningConfigs parses dataId^2group^2md5[^2tenant]^1...
+func parseListeningConfigs(s string) []listenedConfig {
+	var configs []listenedConfig
+	for _, line := range strings.Split(s, "\x01") {
+		fields := strings.Split(line, "\x02")
+		if len(fields) < 3 {
+			continue
+		}
+		c := listenedConfig{key: configKey{group: fields[1], dataID: fields[0]}, md5: fields[2]}
+		if len(fields) > 3 {
+			c.key.tenant = fields[3]
+		}
+		configs = append(configs, c)
+	}
+	return configs
+}
+
+// listenConfigs answers once some of the configs differ from the md5 given
+// or the timeout elapsed, with the keys of the changed configs URL encoded
+// as dataId%02group[%02tenant]%01...
+func (s *Server) listenConfigs(w http.ResponseWriter, r *http.Request, params url.Values) {
+	configs := parseListeningConfigs(params.Get("Listening-Configs"))
+	timeout := defaultListenTimeout
+	if ms, err := strconv.ParseInt(r.Header.Get("Long-Pulling-Timeout"), 10, 64); err == nil {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		var changed strings.Builder
+		for _, c := range configs {
+			if md5Hex(s.configs[c.key]) == c.md5 {
+				continue
+			}
+			changed.WriteString(c.key.dataID + "\x02" + c.key.group)
+			if c.key.tenant != "" {
+				changed.WriteString("\x02" + c.key.tenant)
+			}
+			changed.WriteString("\x01")
+		}
+		wait := s.configChanged
+		s.mu.Unlock()
+		if changed.Len() > 0 {
+			writeText(w, url.QueryEscape(changed.String()))
+			return
+		}
+		select {
+		case <-wait:
+		case <-timer.C:
+			writeText(w, "")
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// configChange is an entry of the history of the configs, with the content
+// published or removed
+type configChange struct {
+	id       int
+	key      configKey
+	content  string
+	op       string
+	appName  string
+	modified time.Time
+}
+
+func (c *configChange) json(withContent bool) map[string]interface{} {
+	m := map[string]interface{}{
+		"id":               strconv.Itoa(c.id),
+		"lastId":           -1,
+		"dataId":           c.key.dataID,
+		"group":            c.key.group,
+		"tenant":           c.key.tenant,
+		"appName":          c.appName,
+		"md5":              md5Hex(c.content),
+		"srcIp":            "127.0.0.1",
+		"srcUser":          nil,
+		"opType":           c.op,
+		"createdTime":      "2010-05-04T16:00:00.000+0000",
+		"lastModifiedTime": c.modified.UTC().Format("2006-01-02T15:04:05.000+0000"),
+	}
+	if withContent {
+		m["content"] = c.content
+	}
+	return m
+}
+
+func (s *Server) recordLocked(key configKey, content, op string, params url.Values) {
+	s.history = append(s.history, &configChange{
+		id:       len(s.history) + 1,
+		key:      key,
+		content:  content,
+		op:       op,
+		appName:  params.Get("appName"),
+		modified: time.Now(),
+	})
+}
+
+// matchBlur matches s against a pattern of * wildcards, an empty pattern
+// matching everything
+func matchBlur(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 {
+			return strings.HasSuffix(s, part)
+		}
+		j := strings.Index(s, part)
+		if j < 0 {
+			return false
+		}
+		s = s[j+len(part):]
+	}
+	return s == ""
+}
+
+// searchConfigs lists the configs of the tenant, matched exactly or by
+// wildcards with search=blur; empty fields match every config
+func (s *Server) searchConfigs(w http.ResponseWriter, params url.Values) {
+	tenant := params.Get("tenant")
+	if tenant == defaultNamespace {
+		tenant = ""
+	}
+	dataID, group := params.Get("dataId"), params.Get("group")
+	match := func(pattern, s string) bool { return pattern == "" || pattern == s }
+	if params.Get("search") == "blur" {
+		match = matchBlur
+	}
+	s.mu.Lock()
+	var keys []configKey
+	for key := range s.configs {
+		if key.tenant == tenant && match(dataID, key.dataID) && match(group, key.group) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].dataID < keys[j].dataID
+	})
+	start, end := pageOf(params, len(keys))
+	items := []map[string]interface{}{}
+	for _, key := range keys[start:end] {
+		content := s.configs[key]
+		items = append(items, map[string]interface{}{
+			"id":      0,
+			"dataId":  key.dataID,
+			"group":   key.group,
+			"content": content,
+			"md5":     md5Hex(content),
+			"tenant":  key.tenant,
+			"appName": "",
+			"type":    "text",
+		})
+	}
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"totalCount":     len(keys),
+		"pageNumber":     1,
+		"pagesAvailable": 1,
+		"pageItems":      items,
+	})
+}
+
+// configHistory lists the changes of a config, the latest first
+func (s *Server) configHistory(w http.ResponseWriter, params url.Values) {
+	key := configKeyOf(params)
+	s.mu.Lock()
+	var changes []*configChange
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].key == key {
+			changes = append(changes, s.history[i])
+		}
+	}
+	start, end := pageOf(params, len(changes))
+	items := []map[string]interface{}{}
+	for _, c := range changes[start:end] {
+		items = append(items, c.json(false))
+	}
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"totalCount":     len(changes),
+		"pageNumber":     1,
+		"pagesAvailable": 1,
+		"pageItems":      items,
+	})
+}
+
+func (s *Server) configHistoryDetail(w http.ResponseWriter, params url.Values) {
+	id, _ := strconv.Atoi(params.Get("nid"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.history) {
+		http.Error(w, "history not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s.history[id-1].json(true))
+}
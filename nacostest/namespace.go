@@ -0,0 +1,96 @@
+package nacostest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+type namespace struct {
+	name        string
+	description string
+}
+
+func (s *Server) configCountLocked(tenant string) int {
+	count := 0
+	for key := range s.configs {
+		if key.tenant == tenant {
+			count++
+		}
+	}
+	return count
+}
+
+// listNamespaces lists the public namespace, then the custom ones by id
+func (s *Server) listNamespaces(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	namespaces := []map[string]interface{}{{
+		"namespace":         "",
+		"namespaceShowName": defaultNamespace,
+		"namespaceDesc":     nil,
+		"quota":             200,
+		"configCount":       s.configCountLocked(""),
+		"type":              0,
+	}}
+	ids := make([]string, 0, len(s.namespaces))
+	for id := range s.namespaces {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ns := s.namespaces[id]
+		namespaces = append(namespaces, map[string]interface{}{
+			"namespace":         id,
+			"namespaceShowName": ns.name,
+			"namespaceDesc":     ns.description,
+			"quota":             200,
+			"configCount":       s.configCountLocked(id),
+			"type":              2,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"code": 200, "message": nil, "data": namespaces})
+}
+
+func (s *Server) createNamespace(w http.ResponseWriter, params url.Values) {
+	id, name := params.Get("customNamespaceId"), params.Get("namespaceName")
+	if name == "" {
+		http.Error(w, "namespaceName is required", http.StatusBadRequest)
+		return
+	}
+	if id == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.namespaces[id]; ok || id == defaultNamespace {
+		writeText(w, "false")
+		return
+	}
+	s.namespaces[id] = &namespace{name: name, description: params.Get("namespaceDesc")}
+	writeText(w, "true")
+}
+
+func (s *Server) updateNamespace(w http.ResponseWriter, params url.Values) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns, ok := s.namespaces[params.Get("namespace")]
+	if !ok {
+		writeText(w, "false")
+		return
+	}
+	ns.name = params.Get("namespaceShowName")
+	ns.description = params.Get("namespaceDesc")
+	writeText(w, "true")
+}
+
+func (s *Server) deleteNamespace(w http.ResponseWriter, params url.Values) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.namespaces, params.Get("namespaceId"))
+	writeText(w, "true")
+}
@@ -0,0 +1,610 @@
+package nacostest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNamespace = "public"
+	defaultGroup     = "DEFAULT_GROUP"
+	defaultCluster   = "DEFAULT"
+	groupSplitter    = "@@"
+
+	codeBeatOK          = 10200
+	codeResourceMissing = 20404
+
+	// pushes larger than that are gzipped, as the server does
+	pushGzipSize = 1024
+)
+
+// Instance is an instance as held by the server
+type Instance struct {
+	InstanceID string  `json:"instanceId"`
+	IP         string  `json:"ip"`
+	Port       int     `json:"port"`
+	Weight     float64 `json:"weight"`
+	Healthy    bool    `json:"healthy"`
+	Enabled    bool    `json:"enabled"`
+	Ephemeral  bool    `json:"ephemeral"`
+	// ClusterName is DEFAULT if the instance was registered without
+	ClusterName string `json:"clusterName"`
+	// ServiceName is the grouped service name, GROUP@@name
+	ServiceName string            `json:"serviceName"`
+	Metadata    map[string]string `json:"metadata"`
+
+	lastBeat time.Time
+}
+
+type serviceKey struct {
+	namespace string
+	// name is the grouped service name
+	name string
+}
+
+type service struct {
+	groupName        string
+	name             string
+	protectThreshold float64
+	metadata         map[string]string
+	selector         json.RawMessage
+	instances        map[string]*Instance
+	lastRefTime      int64
+}
+
+// subscriber is a client listing a service with its UDP port
+type subscriber struct {
+	addr     string
+	clusters string
+}
+
+type serviceInfo struct {
+	Name        string     `json:"name"`
+	GroupName   string     `json:"groupName"`
+	Clusters    string     `json:"clusters"`
+	CacheMillis int64      `json:"cacheMillis"`
+	Hosts       []Instance `json:"hosts"`
+	LastRefTime int64      `json:"lastRefTime"`
+	Checksum    string     `json:"checksum"`
+	AllIPs      bool       `json:"allIPs"`
+	Valid       bool       `json:"valid"`
+}
+
+func namespaceOf(params url.Values) string {
+	if namespace := params.Get("namespaceId"); namespace != "" {
+		return namespace
+	}
+	return defaultNamespace
+}
+
+// serviceOf returns the key of the service and its group, the service name
+// may be grouped
+func serviceOf(params url.Values) (serviceKey, string) {
+	name, group := params.Get("serviceName"), params.Get("groupName")
+	if i := strings.Index(name, groupSplitter); i >= 0 {
+		group, name = name[:i], name[i+len(groupSplitter):]
+	}
+	if group == "" {
+		group = defaultGroup
+	}
+	return serviceKey{namespaceOf(params), group + groupSplitter + name}, group
+}
+
+func instanceKey(ip string, port int, cluster string) string {
+	return fmt.Sprintf("%s#%d#%s", ip, port, cluster)
+}
+
+func clusterOf(params url.Values) string {
+	if cluster := params.Get("clusterName"); cluster != "" {
+		return cluster
+	}
+	return defaultCluster
+}
+
+func parseMetadata(s string) map[string]string {
+	m := make(map[string]string)
+	json.Unmarshal([]byte(s), &m)
+	return m
+}
+
+func parseBool(s string, defaultValue bool) bool {
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return defaultValue
+}
+
+// serviceLocked returns the service, created if create is true
+func (s *Server) serviceLocked(key serviceKey, group string, create bool) *service {
+	svc, ok := s.services[key]
+	if !ok && create {
+		svc = &service{
+			groupName: group,
+			name:      strings.TrimPrefix(key.name, group+groupSplitter),
+			metadata:  make(map[string]string),
+			instances: make(map[string]*Instance),
+		}
+		s.services[key] = svc
+	}
+	return svc
+}
+
+// changedLocked records a change of the service and pushes it to the
+// subscribers
+func (s *Server) changedLocked(key serviceKey) {
+	svc := s.services[key]
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if now <= svc.lastRefTime {
+		now = svc.lastRefTime + 1
+	}
+	svc.lastRefTime = now
+	for sub := range s.subscribers[key] {
+		data, _ := json.Marshal(s.serviceInfoLocked(key, svc, sub.clusters, false))
+		push, _ := json.Marshal(map[string]interface{}{
+			"type":        "dom",
+			"data":        string(data),
+			"lastRefTime": time.Now().UnixNano(),
+		})
+		if len(push) > pushGzipSize {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(push)
+			zw.Close()
+			push = buf.Bytes()
+		}
+		if addr, err := net.ResolveUDPAddr("udp", sub.addr); err == nil {
+			s.udp.WriteToUDP(push, addr)
+		}
+	}
+}
+
+func (s *Server) serviceInfoLocked(key serviceKey, svc *service, clusters string, healthyOnly bool) *serviceInfo {
+	info := &serviceInfo{
+		Name:        key.name,
+		GroupName:   svc.groupName,
+		Clusters:    clusters,
+		CacheMillis: s.opts.CacheMillis,
+		Hosts:       []Instance{},
+		LastRefTime: svc.lastRefTime,
+		Valid:       true,
+	}
+	wanted := make(map[string]bool)
+	for _, cluster := range strings.Split(clusters, ",") {
+		if cluster != "" {
+			wanted[cluster] = true
+		}
+	}
+	for _, instance := range svc.instances {
+		if len(wanted) > 0 && !wanted[instance.ClusterName] {
+			continue
+		}
+		if healthyOnly && !instance.Healthy {
+			continue
+		}
+		info.Hosts = append(info.Hosts, instance.copy())
+	}
+	sort.Slice(info.Hosts, func(i, j int) bool { return info.Hosts[i].InstanceID < info.Hosts[j].InstanceID })
+	return info
+}
+
+func (i *Instance) copy() Instance {
+	c := *i
+	c.Metadata = make(map[string]string, len(i.Metadata))
+	for k, v := range i.Metadata {
+		c.Metadata[k] = v
+	}
+	return c
+}
+
+func (s *Server) createService(w http.ResponseWriter, params url.Values) {
+	key, group := serviceOf(params)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if svc := s.services[key]; svc != nil {
+		http.Error(w, "specified service already exists, serviceName : "+key.name, http.StatusBadRequest)
+		return
+	}
+	svc := s.serviceLocked(key, group, true)
+	svc.setOptions(params)
+	s.changedLocked(key)
+	writeText(w, "ok")
+}
+
+func (svc *service) setOptions(params url.Values) {
+	if threshold, err := strconv.ParseFloat(params.Get("protectThreshold"), 64); err == nil {
+		svc.protectThreshold = threshold
+	}
+	if metadata := params.Get("metadata"); metadata != "" {
+		svc.metadata = parseMetadata(metadata)
+	}
+	if selector := params.Get("selector"); json.Valid([]byte(selector)) {
+		svc.selector = json.RawMessage(selector)
+	}
+}
+
+func (s *Server) updateService(w http.ResponseWriter, params url.Values) {
+	key, _ := serviceOf(params)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	svc := s.services[key]
+	if svc == nil {
+		http.Error(w, "specified service not exist, serviceName : "+key.name, http.StatusBadRequest)
+		return
+	}
+	svc.setOptions(params)
+	s.changedLocked(key)
+	writeText(w, "ok")
+}
+
+func (s *Server) deleteService(w http.ResponseWriter, params url.Values) {
+	key, _ := serviceOf(params)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	svc := s.services[key]
+	if svc == nil {
+		http.Error(w, "specified service not exist, serviceName : "+key.name, http.StatusBadRequest)
+		return
+	}
+	if len(svc.instances) > 0 {
+		http.Error(w, "specified service has instances, serviceName : "+key.name, http.StatusBadRequest)
+		return
+	}
+	delete(s.services, key)
+	writeText(w, "ok")
+}
+
+func (s *Server) getService(w http.ResponseWriter, params url.Values) {
+	key, _ := serviceOf(params)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	svc := s.services[key]
+	if svc == nil {
+		http.Error(w, "service "+key.name+" is not found!", http.StatusBadRequest)
+		return
+	}
+	selector := svc.selector
+	if selector == nil {
+		selector = json.RawMessage(`{"type":"none"}`)
+	}
+	clusters := []map[string]interface{}{}
+	seen := make(map[string]bool)
+	for _, instance := range svc.instances {
+		if !seen[instance.ClusterName] {
+			seen[instance.ClusterName] = true
+			clusters = append(clusters, map[string]interface{}{
+				"name":          instance.ClusterName,
+				"metadata":      map[string]string{},
+				"healthChecker": map[string]string{"type": "TCP"},
+			})
+		}
+	}
+	writeJSON(w, map[string]interface{}{
+		"namespaceId":      key.namespace,
+		"groupName":        svc.groupName,
+		"name":             svc.name,
+		"protectThreshold": svc.protectThreshold,
+		"metadata":         svc.metadata,
+		"selector":         selector,
+		"clusters":         clusters,
+	})
+}
+
+func (s *Server) listServices(w http.ResponseWriter, params url.Values) {
+	namespace := namespaceOf(params)
+	group := params.Get("groupName")
+	if group == "" {
+		group = defaultGroup
+	}
+	s.mu.Lock()
+	names := []string{}
+	for key, svc := range s.services {
+		if key.namespace == namespace && svc.groupName == group {
+			names = append(names, svc.name)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+	count := len(names)
+	start, end := pageOf(params, count)
+	writeJSON(w, map[string]interface{}{"count": count, "doms": names[start:end]})
+}
+
+// catalogServices lists the services of the namespace with their counts,
+// matching the name and group as substrings as the catalog does
+func (s *Server) catalogServices(w http.ResponseWriter, params url.Values) {
+	namespace := namespaceOf(params)
+	name, group := params.Get("serviceNameParam"), params.Get("groupNameParam")
+	s.mu.Lock()
+	entries := []map[string]interface{}{}
+	for key, svc := range s.services {
+		if key.namespace != namespace || !strings.Contains(svc.name, name) || !strings.Contains(svc.groupName, group) {
+			continue
+		}
+		clusters := make(map[string]bool)
+		healthy := 0
+		for _, instance := range svc.instances {
+			clusters[instance.ClusterName] = true
+			if instance.Healthy {
+				healthy++
+			}
+		}
+		entries = append(entries, map[string]interface{}{
+			"name":                 svc.name,
+			"groupName":            svc.groupName,
+			"clusterCount":         len(clusters),
+			"ipCount":              len(svc.instances),
+			"healthyInstanceCount": healthy,
+			"triggerFlag":          "false",
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		gi, gj := entries[i]["groupName"].(string), entries[j]["groupName"].(string)
+		if gi != gj {
+			return gi < gj
+		}
+		return entries[i]["name"].(string) < entries[j]["name"].(string)
+	})
+	start, end := pageOf(params, len(entries))
+	writeJSON(w, map[string]interface{}{"count": len(entries), "serviceList": entries[start:end]})
+}
+
+func (s *Server) registerInstance(w http.ResponseWriter, params url.Values) {
+	key, group := serviceOf(params)
+	port, err := strconv.Atoi(params.Get("port"))
+	if params.Get("ip") == "" || err != nil {
+		http.Error(w, "ip and port are required", http.StatusBadRequest)
+		return
+	}
+	weight, err := strconv.ParseFloat(params.Get("weight"), 64)
+	if err != nil {
+		weight = 1
+	}
+	instance := &Instance{
+		IP:          params.Get("ip"),
+		Port:        port,
+		Weight:      weight,
+		Healthy:     true,
+		Enabled:     parseBool(params.Get("enable"), true),
+		Ephemeral:   parseBool(params.Get("ephemeral"), true),
+		ClusterName: clusterOf(params),
+		ServiceName: key.name,
+		Metadata:    parseMetadata(params.Get("metadata")),
+		lastBeat:    time.Now(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registerLocked(key, group, instance)
+	writeText(w, "ok")
+}
+
+func (s *Server) registerLocked(key serviceKey, group string, instance *Instance) {
+	id := instanceKey(instance.IP, instance.Port, instance.ClusterName)
+	instance.InstanceID = id + "#" + key.name
+	s.serviceLocked(key, group, true).instances[id] = instance
+	s.changedLocked(key)
+}
+
+func (s *Server) updateInstance(w http.ResponseWriter, params url.Values) {
+	key, _ := serviceOf(params)
+	port, _ := strconv.Atoi(params.Get("port"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var instance *Instance
+	if svc := s.services[key]; svc != nil {
+		instance = svc.instances[instanceKey(params.Get("ip"), port, clusterOf(params))]
+	}
+	if instance == nil {
+		http.Error(w, "no instance to update", http.StatusBadRequest)
+		return
+	}
+	if weight, err := strconv.ParseFloat(params.Get("weight"), 64); err == nil {
+		instance.Weight = weight
+	}
+	instance.Enabled = parseBool(params.Get("enable"), instance.Enabled)
+	if metadata := params.Get("metadata"); metadata != "" {
+		instance.Metadata = parseMetadata(metadata)
+	}
+	s.changedLocked(key)
+	writeText(w, "ok")
+}
+
+func (s *Server) deregisterInstance(w http.ResponseWriter, params url.Values) {
+	key, _ := serviceOf(params)
+	port, _ := strconv.Atoi(params.Get("port"))
+	ephemeral := parseBool(params.Get("ephemeral"), true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if svc := s.services[key]; svc != nil {
+		id := instanceKey(params.Get("ip"), port, clusterOf(params))
+		// ephemeral and persistent instances are held apart by the server
+		if instance := svc.instances[id]; instance != nil && instance.Ephemeral == ephemeral {
+			delete(svc.instances, id)
+			s.changedLocked(key)
+		}
+	}
+	writeText(w, "ok")
+}
+
+type clientBeat struct {
+	ServiceName string            `json:"serviceName"`
+	Cluster     string            `json:"cluster"`
+	IP          string            `json:"ip"`
+	Port        int               `json:"port"`
+	Weight      float64           `json:"weight"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+func (s *Server) beat(w http.ResponseWriter, params url.Values) {
+	key, group := serviceOf(params)
+	port, _ := strconv.Atoi(params.Get("port"))
+	result := map[string]interface{}{
+		"code":               codeBeatOK,
+		"clientBeatInterval": s.opts.BeatInterval.Milliseconds(),
+		"lightBeatEnabled":   true,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beats++
+	if s.dropBeats {
+		writeJSON(w, result)
+		return
+	}
+	var instance *Instance
+	if svc := s.services[key]; svc != nil {
+		instance = svc.instances[instanceKey(params.Get("ip"), port, clusterOf(params))]
+	}
+	var beat *clientBeat
+	if b := params.Get("beat"); b != "" {
+		beat = new(clientBeat)
+		json.Unmarshal([]byte(b), beat)
+	}
+	switch {
+	case instance != nil:
+		instance.lastBeat = time.Now()
+		if !instance.Healthy {
+			instance.Healthy = true
+			s.changedLocked(key)
+		}
+	case beat != nil:
+		// the server registers an instance it does not know from the beat
+		cluster := beat.Cluster
+		if cluster == "" {
+			cluster = defaultCluster
+		}
+		s.registerLocked(key, group, &Instance{
+			IP:          params.Get("ip"),
+			Port:        port,
+			Weight:      beat.Weight,
+			Healthy:     true,
+			Enabled:     true,
+			Ephemeral:   true,
+			ClusterName: cluster,
+			ServiceName: key.name,
+			Metadata:    beat.Metadata,
+			lastBeat:    time.Now(),
+		})
+	default:
+		result["code"] = codeResourceMissing
+	}
+	writeJSON(w, result)
+}
+
+func (s *Server) listInstances(w http.ResponseWriter, params url.Values) {
+	key, group := serviceOf(params)
+	clusters := params.Get("clusters")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if port, _ := strconv.Atoi(params.Get("udpPort")); port > 0 {
+		ip := params.Get("clientIP")
+		if ip == "" {
+			ip = "127.0.0.1"
+		}
+		subs, ok := s.subscribers[key]
+		if !ok {
+			subs = make(map[subscriber]bool)
+			s.subscribers[key] = subs
+		}
+		subs[subscriber{net.JoinHostPort(ip, strconv.Itoa(port)), clusters}] = true
+	}
+	svc := s.services[key]
+	if svc == nil {
+		svc = &service{groupName: group}
+	}
+	writeJSON(w, s.serviceInfoLocked(key, svc, clusters, parseBool(params.Get("healthyOnly"), false)))
+}
+
+// expireInstances marks unhealthy and then removes the ephemeral instances
+// which stopped beating
+func (s *Server) expireInstances() {
+	defer s.wg.Done()
+	interval := s.opts.HeartbeatTimeout / 15
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		s.mu.Lock()
+		for key, svc := range s.services {
+			changed := false
+			for id, instance := range svc.instances {
+				if !instance.Ephemeral {
+					continue
+				}
+				switch silent := now.Sub(instance.lastBeat); {
+				case silent > s.opts.DeleteTimeout:
+					delete(svc.instances, id)
+					changed = true
+				case silent > s.opts.HeartbeatTimeout && instance.Healthy:
+					instance.Healthy = false
+					changed = true
+				}
+			}
+			if changed {
+				s.changedLocked(key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Instances returns the instances of the service, in the public namespace
+// if namespace is empty and DEFAULT_GROUP if groupName is
+func (s *Server) Instances(namespace, groupName, serviceName string) []Instance {
+	key := s.key(namespace, groupName, serviceName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	svc := s.services[key]
+	if svc == nil {
+		return nil
+	}
+	return s.serviceInfoLocked(key, svc, "", false).Hosts
+}
+
+// RemoveInstance removes an instance as if it was lost by the server, and
+// reports whether it was there
+func (s *Server) RemoveInstance(namespace, groupName, serviceName, clusterName, ip string, port int) bool {
+	key := s.key(namespace, groupName, serviceName)
+	if clusterName == "" {
+		clusterName = defaultCluster
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	svc := s.services[key]
+	if svc == nil {
+		return false
+	}
+	id := instanceKey(ip, port, clusterName)
+	if _, ok := svc.instances[id]; !ok {
+		return false
+	}
+	delete(svc.instances, id)
+	s.changedLocked(key)
+	return true
+}
+
+func (s *Server) key(namespace, groupName, serviceName string) serviceKey {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	if groupName == "" {
+		groupName = defaultGroup
+	}
+	return serviceKey{namespace, groupName + groupSplitter + serviceName}
+}
@@ -0,0 +1,361 @@
+// Package nacostest provides a Nacos server faking the 1.x HTTP API in
+// memory, to test clients without a Nacos cluster. It serves the login, the
+// naming services, instances, beats, instance lists and service catalog,
+// pushes the changes of the services listed over UDP, serves the configs
+// with long polling listeners, their search and history, and the
+// namespaces. Faults can be injected: latency, 500s, dropped beats and
+// expired tokens.
+package nacostest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContextPath is the path the API is served under in URL
+const ContextPath = "/nacos"
+
+const (
+	defaultTokenTTL         = 18000 * time.Second
+	defaultHeartbeatTimeout = 15 * time.Second
+	defaultDeleteTimeout    = 30 * time.Second
+	defaultBeatInterval     = 5 * time.Second
+	defaultCacheMillis      = 10000
+)
+
+// Options configures a Server
+type Options struct {
+	// Username and Password enable the authentication, every request but
+	// the login then needs a token the login gave
+	Username string
+	Password string
+	// TokenTTL is the life of the tokens, 18000s if zero
+	TokenTTL time.Duration
+	// HeartbeatTimeout marks an ephemeral instance unhealthy once it sent
+	// no beat for that long, 15s if zero
+	HeartbeatTimeout time.Duration
+	// DeleteTimeout removes an ephemeral instance once it sent no beat for
+	// that long, 30s if zero
+	DeleteTimeout time.Duration
+	// BeatInterval is the interval the beats are answered with, 5s if zero
+	BeatInterval time.Duration
+	// CacheMillis is the cacheMillis of the services listed, 10000 if zero
+	CacheMillis int64
+}
+
+func (o Options) withDefaults() Options {
+	if o.TokenTTL == 0 {
+		o.TokenTTL = defaultTokenTTL
+	}
+	if o.HeartbeatTimeout == 0 {
+		o.HeartbeatTimeout = defaultHeartbeatTimeout
+	}
+	if o.DeleteTimeout == 0 {
+		o.DeleteTimeout = defaultDeleteTimeout
+	}
+	if o.BeatInterval == 0 {
+		o.BeatInterval = defaultBeatInterval
+	}
+	if o.CacheMillis == 0 {
+		o.CacheMillis = defaultCacheMillis
+	}
+	return o
+}
+
+// Server is a fake Nacos server listening on the loopback interface
+type Server struct {
+	// URL is the base URL of the API, http://ipaddr:port/nacos
+	URL string
+	// Addr is the ipaddr:port of the server, the host of the client config
+	Addr string
+
+	opts Options
+	http *httptest.Server
+	udp  *net.UDPConn
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu          sync.Mutex
+	services    map[serviceKey]*service
+	subscribers map[serviceKey]map[subscriber]bool
+	configs     map[configKey]string
+	history     []*configChange
+	namespaces  map[string]*namespace
+	// configChanged is closed and replaced on each change of the configs
+	configChanged chan struct{}
+	tokens        map[string]time.Time
+	latency       time.Duration
+	failPath      string
+	failures      int
+	dropBeats     bool
+	beats         int
+}
+
+// NewServer starts a Server, which must be closed
+func NewServer(opts Options) *Server {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		panic("nacostest: failed to listen on a UDP port: " + err.Error())
+	}
+	s := &Server{
+		opts:          opts.withDefaults(),
+		udp:           udp,
+		done:          make(chan struct{}),
+		services:      make(map[serviceKey]*service),
+		subscribers:   make(map[serviceKey]map[subscriber]bool),
+		configs:       make(map[configKey]string),
+		namespaces:    make(map[string]*namespace),
+		configChanged: make(chan struct{}),
+		tokens:        make(map[string]time.Time),
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.http.URL + ContextPath
+	s.Addr = s.http.Listener.Addr().String()
+	s.wg.Add(2)
+	go s.drainAcks()
+	go s.expireInstances()
+	return s
+}
+
+// Close stops the server, ending the long polls in progress
+func (s *Server) Close() {
+	close(s.done)
+	s.http.Close()
+	s.udp.Close()
+	s.wg.Wait()
+}
+
+// SetLatency delays every response by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailRequests answers the next n requests whose path ends with path, such
+// as /v1/ns/instance/list, with a 500; every path if empty and every request
+// from now on if n is negative. Zero stops the failures.
+func (s *Server) FailRequests(path string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failPath, s.failures = path, n
+}
+
+// DropBeats makes the server ignore the beats while drop is true, they are
+// answered as usual but the instances time out
+func (s *Server) DropBeats(drop bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropBeats = drop
+}
+
+// ExpireTokens expires the tokens given so far
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for token := range s.tokens {
+		s.tokens[token] = now
+	}
+}
+
+// Beats returns the number of beats received, dropped ones included
+func (s *Server) Beats() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beats
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latency := s.latency
+	fail := s.failures != 0 && strings.HasSuffix(r.URL.Path, s.failPath)
+	if fail && s.failures > 0 {
+		s.failures--
+	}
+	s.mu.Unlock()
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+		}
+	}
+	if fail {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	path := r.URL.Path
+	if i := strings.Index(path, "/v1/"); i >= 0 {
+		path = path[i:]
+	}
+	params := requestParams(r)
+	if path == "/v1/auth/login" || path == "/v1/auth/users/login" {
+		s.login(w, params)
+		return
+	}
+	if msg := s.checkToken(params.Get("accessToken")); msg != "" {
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+	switch r.Method + " " + path {
+	case "POST /v1/ns/service":
+		s.createService(w, params)
+	case "PUT /v1/ns/service":
+		s.updateService(w, params)
+	case "DELETE /v1/ns/service":
+		s.deleteService(w, params)
+	case "GET /v1/ns/service":
+		s.getService(w, params)
+	case "GET /v1/ns/service/list":
+		s.listServices(w, params)
+	case "GET /v1/ns/catalog/services":
+		s.catalogServices(w, params)
+	case "POST /v1/ns/instance":
+		s.registerInstance(w, params)
+	case "PUT /v1/ns/instance":
+		s.updateInstance(w, params)
+	case "DELETE /v1/ns/instance":
+		s.deregisterInstance(w, params)
+	case "PUT /v1/ns/instance/beat":
+		s.beat(w, params)
+	case "GET /v1/ns/instance/list":
+		s.listInstances(w, params)
+	case "GET /v1/cs/configs":
+		if params.Get("search") != "" {
+			s.searchConfigs(w, params)
+		} else {
+			s.getConfig(w, params)
+		}
+	case "POST /v1/cs/configs":
+		s.publishConfig(w, params)
+	case "DELETE /v1/cs/configs":
+		s.removeConfig(w, params)
+	case "POST /v1/cs/configs/listener":
+		s.listenConfigs(w, r, params)
+	case "GET /v1/cs/history":
+		if params.Get("nid") != "" {
+			s.configHistoryDetail(w, params)
+		} else {
+			s.configHistory(w, params)
+		}
+	case "GET /v1/console/namespaces":
+		s.listNamespaces(w)
+	case "POST /v1/console/namespaces":
+		s.createNamespace(w, params)
+	case "PUT /v1/console/namespaces":
+		s.updateNamespace(w, params)
+	case "DELETE /v1/console/namespaces":
+		s.deleteNamespace(w, params)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// requestParams returns the query parameters followed by the form of the
+// body, which the clients also send with DELETE
+func requestParams(r *http.Request) url.Values {
+	params := r.URL.Query()
+	if b, err := ioutil.ReadAll(r.Body); err == nil && len(b) > 0 {
+		if form, err := url.ParseQuery(string(b)); err == nil {
+			for k, v := range form {
+				params[k] = append(params[k], v...)
+			}
+		}
+	}
+	return params
+}
+
+func (s *Server) login(w http.ResponseWriter, params url.Values) {
+	if s.opts.Username != "" && (params.Get("username") != s.opts.Username || params.Get("password") != s.opts.Password) {
+		http.Error(w, "unknown user!", http.StatusForbidden)
+		return
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(s.opts.TokenTTL)
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"accessToken": token,
+		"tokenTtl":    int64(s.opts.TokenTTL / time.Second),
+		"globalAdmin": true,
+	})
+}
+
+// checkToken returns why the token is refused, or an empty string
+func (s *Server) checkToken(token string) string {
+	if s.opts.Username == "" {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.tokens[token]
+	switch {
+	case !ok:
+		return "token invalid!"
+	case !time.Now().Before(expiry):
+		return "token expired!"
+	}
+	return ""
+}
+
+// pageOf returns the bounds of the page given by pageNo and pageSize among
+// count items, every item if pageSize is not set
+func pageOf(params url.Values, count int) (int, int) {
+	pageNo, _ := strconv.Atoi(params.Get("pageNo"))
+	pageSize, _ := strconv.Atoi(params.Get("pageSize"))
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	if pageSize <= 0 {
+		return 0, count
+	}
+	start := (pageNo - 1) * pageSize
+	if start > count {
+		start = count
+	}
+	end := start + pageSize
+	if end > count {
+		end = count
+	}
+	return start, end
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeText(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "text/plain;charset=UTF-8")
+	w.Write([]byte(text))
+}
+
+// drainAcks reads the acks of the pushes, which are not checked
+func (s *Server) drainAcks() {
+	defer s.wg.Done()
+	b := make([]byte, 64*1024)
+	for {
+		if _, _, err := s.udp.ReadFromUDP(b); err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package nacostest_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"github.com/litgh/nacos-go-sdk/nacostest"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type ServerSuite struct {
+	server *nacostest.Server
+	client nacos.Client
+}
+
+var _ = Suite(&ServerSuite{})
+
+func (s *ServerSuite) SetUpTest(c *C) {
+	s.server = nacostest.NewServer(nacostest.Options{
+		Username:         "nacos",
+		Password:         "secret",
+		HeartbeatTimeout: 200 * time.Millisecond,
+		DeleteTimeout:    400 * time.Millisecond,
+		BeatInterval:     50 * time.Millisecond,
+	})
+	s.client = s.newClient(c)
+}
+
+func (s *ServerSuite) TearDownTest(c *C) {
+	s.client.Naming().Shutdown(context.Background())
+	s.client.Config().Shutdown()
+	s.server.Close()
+}
+
+func (s *ServerSuite) newClient(c *C) nacos.Client {
+	client, err := nacos.NewClient(&nacos.Config{
+		Scheme:      "http",
+		ContextPath: nacostest.ContextPath,
+		Hosts:       []string{s.server.Addr},
+		Username:    "nacos",
+		Password:    "secret",
+		CacheDir:    c.MkDir(),
+		LogDir:      c.MkDir(),
+	})
+	c.Assert(err, IsNil)
+	// the naming client logs in
+	client.Naming()
+	return client
+}
+
+type listenerFunc func(serviceInfo *nacos.ServiceInfo)
+
+func (f listenerFunc) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	f(serviceInfo)
+}
+
+type configFunc func(namespace, group, dataID, content string)
+
+func (f configFunc) OnChange(namespace, group, dataID, content string) {
+	f(namespace, group, dataID, content)
+}
+
+func newInstance(port int) *nacos.Instance {
+	metadata := nacos.NewMetadata(nil).Put("preserved.heart.beat.interval", "50")
+	return nacos.NewInstance("svc", "", "", "10.0.0.1", port, 1, true, true, metadata)
+}
+
+func waitFor(c *C, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *ServerSuite) TestRegisterAndSelect(c *C) {
+	resp, err := s.client.Naming().RegisterInstance(newInstance(8080))
+	c.Assert(err, IsNil)
+	c.Assert(resp.Ok(), Equals, true)
+
+	instances := s.server.Instances("", "", "svc")
+	c.Assert(instances, HasLen, 1)
+	c.Assert(instances[0].ServiceName, Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(instances[0].Healthy, Equals, true)
+
+	selected := s.client.Naming().SelectInstance(nacos.InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(selected, HasLen, 1)
+	c.Assert(selected[0].ServiceName, Equals, "svc")
+	c.Assert(selected[0].GroupName, Equals, nacos.DefaultGroup)
+	c.Assert(selected[0].Port, Equals, 8080)
+
+	list, err := s.client.Naming().SelectServices(nacos.ServiceQueryOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list.Service, DeepEquals, []string{"svc"})
+
+	resp, err = s.client.Naming().DeRegisterInstance("svc", "", "", "10.0.0.1", 8080, true)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Ok(), Equals, true)
+	c.Assert(s.server.Instances("", "", "svc"), HasLen, 0)
+}
+
+func (s *ServerSuite) TestPush(c *C) {
+	changes := make(chan *nacos.ServiceInfo, 16)
+	s.client.Naming().Subscribe("svc", "", nil, listenerFunc(func(serviceInfo *nacos.ServiceInfo) {
+		changes <- serviceInfo
+	}))
+	// the listing is done by the subscription, the push follows the
+	// registration from another client
+	other := s.newClient(c)
+	defer other.Naming().Shutdown(context.Background())
+	_, err := other.Naming().RegisterInstance(newInstance(8081))
+	c.Assert(err, IsNil)
+
+	select {
+	case serviceInfo := <-changes:
+		c.Assert(serviceInfo.Hosts, HasLen, 1)
+		c.Assert(serviceInfo.Hosts[0].Port, Equals, 8081)
+	case <-time.After(5 * time.Second):
+		c.Fatal("no push received")
+	}
+}
+
+func (s *ServerSuite) TestDropBeats(c *C) {
+	_, err := s.client.Naming().RegisterInstance(newInstance(8082))
+	c.Assert(err, IsNil)
+	waitFor(c, func() bool { return s.server.Beats() > 0 })
+
+	s.server.DropBeats(true)
+	waitFor(c, func() bool { return len(s.server.Instances("", "", "svc")) == 0 })
+
+	// the beats are then answered as unknown, the client registers again
+	s.server.DropBeats(false)
+	waitFor(c, func() bool { return len(s.server.Instances("", "", "svc")) == 1 })
+}
+
+func (s *ServerSuite) TestRemoveInstance(c *C) {
+	_, err := s.client.Naming().RegisterInstance(newInstance(8083))
+	c.Assert(err, IsNil)
+	c.Assert(s.server.RemoveInstance("", "", "svc", "", "10.0.0.1", 8083), Equals, true)
+	c.Assert(s.server.RemoveInstance("", "", "svc", "", "10.0.0.1", 8083), Equals, false)
+	waitFor(c, func() bool { return len(s.server.Instances("", "", "svc")) == 1 })
+}
+
+func (s *ServerSuite) TestConfig(c *C) {
+	_, err := s.client.Config().GetConfig("app.yaml", "")
+	c.Assert(err, Equals, nacos.ErrConfigNotFound)
+
+	changes := make(chan string, 16)
+	err = s.client.Config().AddListener("app.yaml", "", configFunc(func(namespace, group, dataID, content string) {
+		changes <- content
+	}))
+	c.Assert(err, IsNil)
+	c.Assert(s.client.Config().PublishConfig("app.yaml", "", "a: 1"), IsNil)
+
+	content, ok := s.server.Config("", "", "app.yaml")
+	c.Assert(ok, Equals, true)
+	c.Assert(content, Equals, "a: 1")
+	deadline := time.After(5 * time.Second)
+	for content := ""; content != "a: 1"; {
+		select {
+		case content = <-changes:
+		case <-deadline:
+			c.Fatal("change not received")
+		}
+	}
+
+	c.Assert(s.client.Config().RemoveConfig("app.yaml", ""), IsNil)
+	_, ok = s.server.Config("", "", "app.yaml")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *ServerSuite) TestConfigSearchAndHistory(c *C) {
+	ctx := context.Background()
+	config := s.client.Config()
+	c.Assert(config.PublishConfig("app.yaml", "", "a: 1"), IsNil)
+	c.Assert(config.PublishConfig("app.yaml", "", "a: 2"), IsNil)
+	c.Assert(config.PublishConfig("db.yaml", "infra", "url: x"), IsNil)
+	c.Assert(config.RemoveConfig("app.yaml", ""), IsNil)
+	c.Assert(config.PublishConfig("app.yaml", "", "a: 3"), IsNil)
+
+	list, err := config.SearchConfigs(ctx, nacos.ConfigSearchOptions{Size: 100})
+	c.Assert(err, IsNil)
+	c.Assert(list.Count, Equals, 2)
+	c.Assert(list.Configs[0].DataID, Equals, "app.yaml")
+	c.Assert(list.Configs[0].Content, Equals, "a: 3")
+	c.Assert(list.Configs[1].Group, Equals, "infra")
+	list, err = config.SearchConfigs(ctx, nacos.ConfigSearchOptions{DataID: "db*", Blur: true})
+	c.Assert(err, IsNil)
+	c.Assert(list.Configs, HasLen, 1)
+	c.Assert(list.Configs[0].DataID, Equals, "db.yaml")
+
+	history, err := config.History(ctx, nacos.ConfigHistoryOptions{DataID: "app.yaml"})
+	c.Assert(err, IsNil)
+	c.Assert(history.Count, Equals, 4)
+	var ops []string
+	for _, change := range history.Changes {
+		ops = append(ops, change.OpType)
+	}
+	c.Assert(ops, DeepEquals, []string{"I", "D", "U", "I"})
+	change, err := config.HistoryDetail(ctx, "app.yaml", "", history.Changes[2].ID)
+	c.Assert(err, IsNil)
+	c.Assert(change.Content, Equals, "a: 2")
+}
+
+func (s *ServerSuite) TestNamespaces(c *C) {
+	ctx := context.Background()
+	namespaces := s.client.Namespaces()
+	c.Assert(namespaces.Create(ctx, nacos.NamespaceOptions{ID: "dev", Name: "Dev"}), IsNil)
+	c.Assert(namespaces.Create(ctx, nacos.NamespaceOptions{ID: "dev", Name: "Dev"}), ErrorMatches, "failed to create namespace Dev")
+	c.Assert(namespaces.Update(ctx, nacos.NamespaceOptions{ID: "dev", Name: "Development", Description: "shared"}), IsNil)
+	c.Assert(namespaces.Update(ctx, nacos.NamespaceOptions{ID: "prod", Name: "Prod"}), NotNil)
+
+	list, err := namespaces.List(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []*nacos.Namespace{
+		{Name: "public", Quota: 200},
+		{ID: "dev", Name: "Development", Description: "shared", Quota: 200, Type: 2},
+	})
+	c.Assert(namespaces.Delete(ctx, "dev"), IsNil)
+	list, err = namespaces.List(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+}
+
+func (s *ServerSuite) TestFailRequests(c *C) {
+	s.server.FailRequests("/v1/cs/configs", 1)
+	_, err := s.client.Config().GetConfig("app.yaml", "")
+	c.Assert(err, ErrorMatches, "injected failure\n?")
+	_, err = s.client.Config().GetConfig("app.yaml", "")
+	c.Assert(err, Equals, nacos.ErrConfigNotFound)
+}
+
+func (s *ServerSuite) TestLatency(c *C) {
+	s.server.SetLatency(100 * time.Millisecond)
+	start := time.Now()
+	s.client.Config().GetConfig("app.yaml", "")
+	c.Assert(time.Since(start) >= 100*time.Millisecond, Equals, true)
+}
+
+func (s *ServerSuite) TestExpireTokens(c *C) {
+	s.server.ExpireTokens()
+	_, err := s.client.Config().GetConfig("app.yaml", "")
+	c.Assert(err, ErrorMatches, "token expired!\n?")
+}
+
+func (s *ServerSuite) TestLoginRefused(c *C) {
+	resp, err := http.PostForm(s.server.URL+"/v1/auth/login", url.Values{"username": {"nacos"}, "password": {"wrong"}})
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+}
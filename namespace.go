@@ -0,0 +1,111 @@
+package nacos
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+var _ NamespaceClient = new(namespaceClient)
+
+// Namespace is a namespace of the server, the public one has an empty ID
+type Namespace struct {
+	ID          string `json:"namespace"`
+	Name        string `json:"namespaceShowName"`
+	Description string `json:"namespaceDesc"`
+	Quota       int    `json:"quota"`
+	ConfigCount int    `json:"configCount"`
+	// 0 for the public namespace, 2 for the custom ones
+	Type int `json:"type"`
+}
+
+// NamespaceOptions create or update a namespace
+type NamespaceOptions struct {
+	// generated by the server on Create when empty
+	ID          string
+	Name        string
+	Description string
+}
+
+type namespaceClient struct {
+	c *client
+}
+
+func (c *client) Namespaces() NamespaceClient {
+	return &namespaceClient{c: c}
+}
+
+func (nc *namespaceClient) newRequest(ctx context.Context, method string) *Request {
+	return &Request{
+		config: &nc.c.config,
+		method: method,
+		path:   "/v1/console/namespaces",
+		params: make(url.Values),
+		header: make(http.Header),
+		ctx:    ctx,
+	}
+}
+
+// call expects the server to answer true
+func (nc *namespaceClient) call(r *Request, action, id string) error {
+	rs, err := callServer(nc.c, r)
+	if err != nil {
+		return err
+	}
+	if rs.Data != "true" {
+		return fmt.Errorf("failed to %s namespace %s", action, id)
+	}
+	return nil
+}
+
+func (nc *namespaceClient) List(ctx context.Context) ([]*Namespace, error) {
+	resp, err := nc.c.DoRequest(nc.newRequest(ctx, GET))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// the namespaces are a JSON array, which decode does not read
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list namespaces, %s", b)
+	}
+	var rs struct {
+		Code    int          `json:"code"`
+		Message string       `json:"message"`
+		Data    []*Namespace `json:"data"`
+	}
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil, err
+	}
+	if rs.Code != 0 && rs.Code != http.StatusOK {
+		return nil, fmt.Errorf("failed to list namespaces, %s", rs.Message)
+	}
+	return rs.Data, nil
+}
+
+func (nc *namespaceClient) Create(ctx context.Context, ns NamespaceOptions) error {
+	r := nc.newRequest(ctx, POST)
+	r.params.Set("customNamespaceId", ns.ID)
+	r.params.Set("namespaceName", ns.Name)
+	r.params.Set("namespaceDesc", ns.Description)
+	return nc.call(r, "create", ns.Name)
+}
+
+func (nc *namespaceClient) Update(ctx context.Context, ns NamespaceOptions) error {
+	r := nc.newRequest(ctx, PUT)
+	r.params.Set("namespace", ns.ID)
+	r.params.Set("namespaceShowName", ns.Name)
+	r.params.Set("namespaceDesc", ns.Description)
+	return nc.call(r, "update", ns.ID)
+}
+
+func (nc *namespaceClient) Delete(ctx context.Context, id string) error {
+	r := nc.newRequest(ctx, DELETE)
+	r.params.Set("namespaceId", id)
+	return nc.call(r, "delete", id)
+}
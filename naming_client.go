@@ -1,10 +1,9 @@
 package nacos
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -12,7 +11,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/google/uuid"
 )
@@ -23,6 +22,7 @@ type SelectorType string
 
 const (
 	serviceInfoSpliter   = "@@"
+	batchConcurrency     = 8
 	vipSrvRefInterMillis = 30
 	SelectorTypeNone     = "none"
 	SelectorTypeUnknown  = "unknown"
@@ -30,71 +30,38 @@ const (
 )
 
 type namingClient struct {
-	c                     *client
-	heartbeat             *heartbeat
-	failover              *failover
-	pushReceiver          *pushReceiver
-	listeners             *serviceChangeListener
-	serviceInfoMap        map[string]*ServiceInfo
-	lastServerRefreshTime int64
-	serversFromEndpoint   []string
-}
-
-func (ns *namingClient) refreshSrvIfNeed() error {
-	if len(ns.c.config.Hosts) != 0 {
-		// server list provide by user
-		return nil
-	}
-	if time.Now().Unix()-ns.lastServerRefreshTime < vipSrvRefInterMillis {
-		return nil
-	}
-	// get server list from endpoint
-	req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/nacos/serverlist", ns.c.config.Endpoint), nil)
-	ns.c.setHeader(req.Header)
-
-	resp, err := ns.c.config.HttpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error while requesting: %s. Server returned: %s", ns.c.config.Endpoint, err)
-	}
-	var response Response
-	decode(resp, &response)
-	if !response.Ok() {
-		return fmt.Errorf("Error while requesting: %s. Server returned: %s", ns.c.config.Endpoint, response.Message)
-	}
-	br := bufio.NewReader(strings.NewReader(response.Data))
-	var serverList []string
-	for {
-		l, err := br.ReadSlice('\n')
-		if err == io.EOF {
-			break
-		}
-		serverList = append(serverList, strings.TrimSpace(string(l)))
-	}
-	if len(serverList) == 0 {
-		return fmt.Errorf("Cannot acquire Nacos server")
-	}
-	ns.serversFromEndpoint = serverList
-	ns.lastServerRefreshTime = time.Now().Unix()
-
-	return nil
-}
-
+	c                 *client
+	heartbeat         *heartbeat
+	failover          *failover
+	pushReceiver      *pushReceiver
+	listeners         *serviceChangeListener
+	updater           *updater
+	redo              *redo
+	outliers          *outlierDetector
+	zones             *zoneRouter
+	transport         namingTransport
+	serviceInfoHolder *ServiceInfoHolder
+}
+
+// getServerList returns the servers of the client
 func (ns *namingClient) getServerList() []string {
-	if len(ns.c.config.Hosts) > 0 {
-		return ns.c.config.Hosts
-	}
-	return ns.serversFromEndpoint
+	return ns.c.getServerList()
 }
 
 func (ns *namingClient) NewRequest(method, path string) *Request {
-	r := &Request{
-		config: &ns.c.config,
+	return ns.c.newNamingRequest(method, path)
+}
+
+// newNamingRequest builds a request to the naming API, shared by the
+// clients calling it
+func (c *client) newNamingRequest(method, path string) *Request {
+	return &Request{
+		config: &c.config,
 		method: method,
 		path:   "/v1/ns" + path,
 		params: make(url.Values),
 		header: make(http.Header),
 	}
-	return r
 }
 
 func NewServiceInfo(name, groupName, clusters string) *ServiceInfo {
@@ -102,7 +69,8 @@ func NewServiceInfo(name, groupName, clusters string) *ServiceInfo {
 }
 
 type Selector struct {
-	Type SelectorType `json:"type"`
+	Type       SelectorType `json:"type"`
+	Expression string       `json:"expression,omitempty"`
 }
 
 type ServiceList struct {
@@ -116,8 +84,11 @@ type Service struct {
 	AppName          string
 	Metadata         map[string]string
 	ProtectThreshold float64
+	Selector         *Selector
+	Clusters         ClusterMap
 }
 
+// ServiceInfo is an immutable snapshot of the instances of a service
 type ServiceInfo struct {
 	Name           string
 	GroupName      string
@@ -130,6 +101,17 @@ type ServiceInfo struct {
 	AllIPs         bool
 }
 
+// splitHostNames sets the group of the hosts apart from their service name,
+// which the 1.x server returns grouped
+func (s *ServiceInfo) splitHostNames() *ServiceInfo {
+	for _, host := range s.Hosts {
+		if strings.Contains(host.ServiceName, serviceInfoSpliter) {
+			host.GroupName, host.ServiceName = splitGroupedServiceName(host.ServiceName)
+		}
+	}
+	return s
+}
+
 func NewServiceInfoByKey(key string) *ServiceInfo {
 	keys := strings.Split(key, serviceInfoSpliter)
 	var serviceInfo = new(ServiceInfo)
@@ -148,6 +130,12 @@ func (s *ServiceInfo) GetKey() string {
 	return s.Name
 }
 
+func (s *ServiceInfo) clone() *ServiceInfo {
+	c := *s
+	c.Hosts = cloneInstances(s.Hosts)
+	return &c
+}
+
 func (s *ServiceInfo) Validate() bool {
 	return true
 }
@@ -202,7 +190,9 @@ func setServiceQueryOptions(r *Request, q ServiceQueryOptions) {
 	if q.ServiceName != "" {
 		r.params.Set("serviceName", q.ServiceName)
 	}
-
+	if q.Selector.Type != "" && q.Selector.Type != SelectorTypeNone {
+		r.params.Set("selector", encode(q.Selector))
+	}
 }
 
 func setServiceOptions(r *Request, q *ServiceOptions) error {
@@ -233,7 +223,12 @@ func setServiceOptions(r *Request, q *ServiceOptions) error {
 }
 
 func (ns *namingClient) SelectServices(q ServiceQueryOptions) (*ServiceList, error) {
+	return ns.selectServices(context.Background(), q)
+}
+
+func (ns *namingClient) selectServices(ctx context.Context, q ServiceQueryOptions) (*ServiceList, error) {
 	r := ns.NewRequest(GET, "/service/list")
+	r.ctx = ctx
 	setServiceQueryOptions(r, q)
 	resp, err := ns.c.DoRequest(r)
 	if err != nil {
@@ -262,6 +257,41 @@ func (ns *namingClient) SelectService(q ServiceQueryOptions) (*Service, error) {
 	return &service, err
 }
 
+// GetService returns the service with every cluster expanded, including the
+// default ports the server keeps for them
+func (ns *namingClient) GetService(serviceName, groupName string) (*Service, error) {
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
+	r := ns.NewRequest(GET, "/catalog/service")
+	r.params.Set("serviceName", serviceName)
+	r.params.Set("groupName", groupName)
+	rs, err := callServer(ns.c, r)
+	if err != nil {
+		return nil, err
+	}
+	var detail struct {
+		Service  *Service   `json:"service"`
+		Clusters []*Cluster `json:"clusters"`
+	}
+	if err := json.Unmarshal([]byte(rs.Data), &detail); err != nil {
+		return nil, err
+	}
+	if detail.Service == nil {
+		return nil, errors.New("service " + serviceName + " not found")
+	}
+	if detail.Service.GroupName == "" {
+		detail.Service.GroupName = groupName
+	}
+	if len(detail.Clusters) > 0 {
+		detail.Service.Clusters = make(ClusterMap, len(detail.Clusters))
+		for _, c := range detail.Clusters {
+			detail.Service.Clusters[c.Name] = c
+		}
+	}
+	return detail.Service, nil
+}
+
 func (ns *namingClient) CreateService(q ServiceOptions) (*Response, error) {
 	r := ns.NewRequest(POST, "/service")
 	setServiceOptions(r, &q)
@@ -297,7 +327,7 @@ type Instance struct {
 	Port        int
 	Weight      float64
 	Healthy     bool
-	Enable      bool
+	Enable      bool `json:"enabled"`
 	Ephemeral   bool
 	Metadata    *Metadata
 }
@@ -317,6 +347,45 @@ func NewInstance(serviceName, groupName, clusterName string, ip string, port int
 	}
 }
 
+// InstanceKey identifies a registered instance
+type InstanceKey struct {
+	ServiceName string
+	GroupName   string
+	ClusterName string
+	IP          string
+	Port        int
+	Ephemeral   bool
+}
+
+// Key returns the InstanceKey of the instance
+func (i *Instance) Key() InstanceKey {
+	return InstanceKey{
+		ServiceName: i.ServiceName,
+		GroupName:   i.GroupName,
+		ClusterName: i.ClusterName,
+		IP:          i.IP,
+		Port:        i.Port,
+		Ephemeral:   i.Ephemeral,
+	}
+}
+
+func (i *Instance) clone() *Instance {
+	c := *i
+	c.Metadata = i.Metadata.clone()
+	return &c
+}
+
+func cloneInstances(hosts []*Instance) []*Instance {
+	if hosts == nil {
+		return nil
+	}
+	c := make([]*Instance, len(hosts))
+	for i, h := range hosts {
+		c[i] = h.clone()
+	}
+	return c
+}
+
 func (i *Instance) toInetAddr() string {
 	return fmt.Sprintf("%s:%d", i.IP, i.Port)
 }
@@ -329,7 +398,7 @@ func (i *Instance) equals(o *Instance) bool {
 }
 
 func setInstanceOptions(r *Request, instance *Instance) {
-	if instance.GroupName != "" {
+	if instance.GroupName == "" {
 		instance.GroupName = DefaultGroup
 	}
 	if instance.ClusterName == "" {
@@ -348,29 +417,228 @@ func setInstanceOptions(r *Request, instance *Instance) {
 }
 
 func (ns *namingClient) RegisterInstance(instance *Instance) (*Response, error) {
-	r := ns.NewRequest(POST, "/instance")
-	setInstanceOptions(r, instance)
-	rs, err := callServer(ns.c, r)
+	if instance.GroupName == "" {
+		instance.GroupName = DefaultGroup
+	}
+	if instance.ClusterName == "" {
+		instance.ClusterName = DefaultCluster
+	}
+	rs, err := ns.transport.registerInstance(instance)
+	if err != nil {
+		return nil, err
+	}
+	ns.redo.register(instance)
+	return rs, nil
+}
+
+// UpdateInstance updates weight, enable state and metadata of a registered
+// instance in place
+func (ns *namingClient) UpdateInstance(instance *Instance) (*Response, error) {
+	if instance.GroupName == "" {
+		instance.GroupName = DefaultGroup
+	}
+	if instance.ClusterName == "" {
+		instance.ClusterName = DefaultCluster
+	}
+	rs, err := ns.transport.updateInstance(instance)
 	if err != nil {
 		return nil, err
 	}
 	if instance.Ephemeral {
-		beatInfo := newBeat(r.params.Get("serviceName"), instance)
-		ns.heartbeat.addBeat(beatInfo)
+		ns.redo.update(instance.GroupName+serviceInfoSpliter+instance.ServiceName, instance.IP, instance.Port, func(recorded *Instance) {
+			*recorded = *instance.clone()
+		})
+	}
+	return rs, nil
+}
+
+func (ns *namingClient) putInstance(instance *Instance) (*Response, error) {
+	r := ns.NewRequest(PUT, "/instance")
+	setInstanceOptions(r, instance)
+	return callServer(ns.c, r)
+}
+
+// PatchInstanceMetadata adds the entries of add to and deletes the keys in
+// remove from the metadata of the instance identified by key, leaving other
+// entries untouched
+func (ns *namingClient) PatchInstanceMetadata(key InstanceKey, add map[string]string, remove []string) (*Response, error) {
+	if key.GroupName == "" {
+		key.GroupName = DefaultGroup
+	}
+	if key.ClusterName == "" {
+		key.ClusterName = DefaultCluster
+	}
+	rs, err := ns.transport.patchInstanceMetadata(key, add, remove)
+	if err != nil {
+		return nil, err
+	}
+	if key.Ephemeral {
+		ns.redo.update(key.GroupName+serviceInfoSpliter+key.ServiceName, key.IP, key.Port, func(recorded *Instance) {
+			recorded.Metadata = recorded.Metadata.patched(add, remove)
+		})
+	}
+	return rs, nil
+}
+
+// patchMetadata patches the metadata of an instance through the batch
+// metadata API
+func (ns *namingClient) patchMetadata(key InstanceKey, add map[string]string, remove []string) (*Response, error) {
+	var rs *Response
+	var err error
+	if len(add) > 0 {
+		rs, err = ns.batchMetadata(PUT, key, add)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(remove) > 0 {
+		m := make(map[string]string, len(remove))
+		for _, k := range remove {
+			m[k] = ""
+		}
+		rs, err = ns.batchMetadata(DELETE, key, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rs == nil {
+		rs = &Response{Code: 200}
 	}
 	return rs, nil
 }
 
+func (ns *namingClient) batchMetadata(method string, key InstanceKey, metadata map[string]string) (*Response, error) {
+	r := ns.NewRequest(method, "/instance/metadata/batch")
+	r.params.Set("serviceName", key.GroupName+serviceInfoSpliter+key.ServiceName)
+	r.params.Set("groupName", key.GroupName)
+	if key.Ephemeral {
+		r.params.Set("consistencyType", "ephemeral")
+	} else {
+		r.params.Set("consistencyType", "persist")
+	}
+	r.params.Set("instances", encode([]map[string]interface{}{{
+		"ip":          key.IP,
+		"port":        key.Port,
+		"clusterName": key.ClusterName,
+	}}))
+	r.params.Set("metadata", encode(metadata))
+	return callServer(ns.c, r)
+}
+
+func (ns *namingClient) registerService(instance *Instance) (*Response, error) {
+	r := ns.NewRequest(POST, "/instance")
+	setInstanceOptions(r, instance)
+	return callServer(ns.c, r)
+}
+
 func (ns *namingClient) DeRegisterInstance(serviceName, groupName, clusterName, ip string, port int, ephemeral bool) (*Response, error) {
-	if ephemeral {
-		ns.heartbeat.removeBeat(fmt.Sprintf("%s%s%s", groupName, serviceInfoSpliter, serviceName), ip, port)
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
+	if clusterName == "" {
+		clusterName = DefaultCluster
 	}
+	instance := &Instance{
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		ClusterName: clusterName,
+		IP:          ip,
+		Port:        port,
+		Ephemeral:   ephemeral,
+	}
+	ns.redo.deregister(instance)
+	return ns.transport.deregisterInstance(context.Background(), instance)
+}
+
+// InstanceResult is the outcome for one instance of a batch call
+type InstanceResult struct {
+	Instance *Instance
+	Response *Response
+	Err      error
+}
+
+// BatchRegisterInstances registers instances of one service and returns a
+// result for each of them, in the same order. The HTTP API has no batch
+// endpoint, so over HTTP this is one request per instance, up to
+// batchConcurrency in parallel; over gRPC the ephemeral ones are published by
+// one batch request.
+func (ns *namingClient) BatchRegisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult {
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
+	for _, instance := range instances {
+		instance.ServiceName = serviceName
+		instance.GroupName = groupName
+		if instance.ClusterName == "" {
+			instance.ClusterName = DefaultCluster
+		}
+	}
+	results := ns.transport.batchRegisterInstances(serviceName, groupName, instances)
+	for _, r := range results {
+		if r.Err == nil {
+			ns.redo.register(r.Instance)
+		}
+	}
+	return results
+}
+
+// BatchDeregisterInstances deregisters instances of one service and returns a
+// result for each of them, in the same order
+func (ns *namingClient) BatchDeregisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult {
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
+	keys := make([]*Instance, len(instances))
+	for i, instance := range instances {
+		keys[i] = &Instance{
+			ServiceName: serviceName,
+			GroupName:   groupName,
+			ClusterName: instance.ClusterName,
+			IP:          instance.IP,
+			Port:        instance.Port,
+			Ephemeral:   instance.Ephemeral,
+		}
+		if keys[i].ClusterName == "" {
+			keys[i].ClusterName = DefaultCluster
+		}
+		ns.redo.deregister(keys[i])
+	}
+	results := ns.transport.batchDeregisterInstances(serviceName, groupName, keys)
+	for i := range results {
+		results[i].Instance = instances[i]
+	}
+	return results
+}
+
+func (ns *namingClient) batch(instances []*Instance, fn func(*Instance) (*Response, error)) []InstanceResult {
+	results := make([]InstanceResult, len(instances))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, instance *Instance) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			rs, err := fn(instance)
+			results[i] = InstanceResult{Instance: instance, Response: rs, Err: err}
+		}(i, instance)
+	}
+	wg.Wait()
+	return results
+}
+
+func (ns *namingClient) deregisterService(ctx context.Context, instance *Instance) (*Response, error) {
 	r := ns.NewRequest(DELETE, "/instance")
-	r.params.Set("serviceName", serviceName)
-	r.params.Set("clusterName", clusterName)
-	r.params.Set("ip", ip)
-	r.params.Set("port", strconv.Itoa(port))
-	r.params.Set("ephemeral", strconv.FormatBool(ephemeral))
+	r.ctx = ctx
+	r.params.Set("serviceName", fmt.Sprintf("%s%s%s", instance.GroupName, serviceInfoSpliter, instance.ServiceName))
+	r.params.Set("groupName", instance.GroupName)
+	r.params.Set("clusterName", instance.ClusterName)
+	r.params.Set("ip", instance.IP)
+	r.params.Set("port", strconv.Itoa(instance.Port))
+	r.params.Set("ephemeral", strconv.FormatBool(instance.Ephemeral))
 	return callServer(ns.c, r)
 }
 
@@ -382,49 +650,143 @@ func (ns *namingClient) SelectInstance(q InstanceQueryOptions) []*Instance {
 	if q.Subscribe {
 		serviceInfo = ns.getServiceInfo(q.ServiceName, q.GroupName, strings.Join(q.ClusterName, ","))
 	} else {
-		serviceInfo = ns.getServiceInfoDirectlyFromServer(q.ServiceName, q.GroupName, strings.Join(q.ClusterName, ","))
+		serviceInfo = ns.getServiceInfoDirectlyFromServer(q.ServiceName, q.GroupName, strings.Join(q.ClusterName, ","), q.Healthy)
 	}
 	if serviceInfo == nil {
 		return nil
 	}
-	return serviceInfo.Hosts
+	return cloneInstances(serviceInfo.Hosts)
+}
+
+// SelectHealthyInstances returns the healthy instances of the service,
+// leaving out the instances ejected by the outlier detection unless all are,
+// and only those of the zone of the client while it has enough of them
+func (ns *namingClient) SelectHealthyInstances(q InstanceQueryOptions) []*Instance {
+	all := ns.SelectInstance(q)
+	instances := healthyInstances(all)
+	if len(instances) == 0 {
+		return nil
+	}
+	groupName := q.GroupName
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
+	clusters := q.ClusterName
+	if len(clusters) == 0 {
+		clusters = []string{DefaultCluster}
+	}
+	instances = ns.outliers.filter(groupName+serviceInfoSpliter+q.ServiceName, clusters, all, instances)
+	return ns.zones.prefer(all, instances)
+}
 
+// SelectOneHealthyInstance picks one of the instances returned by
+// SelectHealthyInstances by weighted random; it returns
+// ErrNoInstanceAvailable if there is none
+func (ns *namingClient) SelectOneHealthyInstance(q InstanceQueryOptions) (*Instance, error) {
+	instances := ns.SelectHealthyInstances(q)
+	if len(instances) == 0 {
+		return nil, ErrNoInstanceAvailable
+	}
+	return NewWeightedRandomBalancer().Pick(instances), nil
 }
+
+func (ns *namingClient) Report(groupedServiceName string, instance *Instance, err error) {
+	ns.outliers.report(groupedServiceName, instance, err)
+}
+
+func (ns *namingClient) AddOutlierListener(listener OutlierListener) {
+	ns.outliers.addListener(listener)
+}
+
+// GetServiceInfo returns a copy of the service held in the cache, the
+// service is subscribed first if it is not; the failover snapshot is returned
+// in failover mode. It returns nil if the service could not be queried.
+func (ns *namingClient) GetServiceInfo(serviceName, groupName string, clusters []string) *ServiceInfo {
+	serviceInfo := ns.getServiceInfo(serviceName, groupName, strings.Join(clusters, ","))
+	if serviceInfo == nil {
+		return nil
+	}
+	return serviceInfo.clone()
+}
+
 func (ns *namingClient) Subscribe(serviceName, groupName string, clusters []string, listener EventListener) {
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
+	ns.redo.subscribe(groupName+serviceInfoSpliter+serviceName, strings.Join(clusters, ","))
 	serviceInfo := ns.getServiceInfo(serviceName, groupName, strings.Join(clusters, ","))
-	ns.listeners.addListener(serviceInfo, strings.Join(clusters, ","), listener)
+	ns.listeners.addListener(groupName+serviceInfoSpliter+serviceName, strings.Join(clusters, ","), listener, serviceInfo)
 }
 func (ns *namingClient) Unsubscribe(serviceName, groupName string, clusters []string, listener EventListener) {
-	ns.listeners.removeListener(groupName+serviceInfoSpliter+serviceName, strings.Join(clusters, ","), listener)
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
+	groupedServiceName := groupName + serviceInfoSpliter + serviceName
+	if ns.listeners.removeListener(groupedServiceName, strings.Join(clusters, ","), listener) {
+		ns.redo.unsubscribe(groupedServiceName, strings.Join(clusters, ","))
+		if err := ns.transport.unsubscribe(groupedServiceName, strings.Join(clusters, ",")); err != nil {
+			ns.c.logger.Error("failed to unsubscribe %s: %v", groupedServiceName, err)
+		}
+	}
+}
+func (ns *namingClient) BeatStats() []BeatStats {
+	return ns.heartbeat.beatStats()
+}
+
+func (ns *namingClient) AddRedoListener(listener RedoListener) {
+	ns.redo.addListener(listener)
+}
+
+func (ns *namingClient) RedoStats() RedoStats {
+	return ns.redo.redoStats()
 }
-func (ns *namingClient) Shutdown() {
+
+func (ns *namingClient) Shutdown(ctx context.Context) error {
+	ns.redo.stop()
+	ns.outliers.stop()
+	err := ns.transport.close(ctx, !ns.c.config.KeepInstancesOnShutdown)
+	ns.failover.writeFile()
 	ns.c.cancel()
+	if e := ns.listeners.wait(ctx); e != nil {
+		return e
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
 func (ns *namingClient) getServiceInfo(serviceName, groupName, clusters string) *ServiceInfo {
+	if groupName == "" {
+		groupName = DefaultGroup
+	}
 	key := getServiceInfoKey(groupName+serviceInfoSpliter+serviceName, clusters)
 	if ns.failover.isFailoverSwitch() {
 		return ns.failover.getService(key)
 	}
-	serviceInfo, ok := ns.serviceInfoMap[key]
-	if !ok {
-		serviceInfo = NewServiceInfo(serviceName, groupName, clusters)
-		ns.updateServiceInfoNow(serviceInfo)
+	groupedServiceName := groupName + serviceInfoSpliter + serviceName
+	serviceInfo, ok := ns.serviceInfoHolder.Get(key)
+	if !ok || !ns.transport.isSubscribed(groupedServiceName, clusters) {
+		updated, err := ns.transport.subscribe(groupedServiceName, clusters)
+		if err != nil {
+			ns.c.logger.Error("failed to subscribe %s: %v", key, err)
+		} else if updated != nil {
+			serviceInfo = updated
+		}
 	}
 	return serviceInfo
 }
 
-func (ns *namingClient) getServiceInfoDirectlyFromServer(serviceName, groupName, clusters string) *ServiceInfo {
-	rs, err := ns.queryList(groupName+serviceInfoSpliter+serviceName, clusters, 0, false)
-	if err != nil {
-		return nil
+func (ns *namingClient) getServiceInfoDirectlyFromServer(serviceName, groupName, clusters string, healthyOnly bool) *ServiceInfo {
+	if groupName == "" {
+		groupName = DefaultGroup
 	}
-	var serviceInfo ServiceInfo
-	err = json.Unmarshal([]byte(rs.Data), &serviceInfo)
+	serviceInfo, err := ns.transport.queryInstances(groupName+serviceInfoSpliter+serviceName, clusters, healthyOnly)
 	if err != nil {
+		ns.c.logger.Error("failed to query %s: %v", serviceName, err)
 		return nil
 	}
-	return &serviceInfo
+	return serviceInfo
 }
 
 func (ns *namingClient) queryList(groupedServiceName, clusters string, udpPort int, healthyOnly bool) (*Response, error) {
@@ -437,11 +799,16 @@ func (ns *namingClient) queryList(groupedServiceName, clusters string, udpPort i
 	return callServer(ns.c, r)
 }
 
-func (ns *namingClient) updateServiceInfoNow(serviceInfo *ServiceInfo) {
-	rs, _ := ns.queryList(serviceInfo.GetKey(), serviceInfo.Clusters, ns.pushReceiver.port, false)
-	if rs.Ok() {
-		ns.updateServiceMap(rs.Data)
+func (ns *namingClient) updateServiceInfoNow(serviceInfo *ServiceInfo) (*ServiceInfo, error) {
+	var udpPort int
+	if ns.pushReceiver != nil {
+		udpPort = ns.pushReceiver.port
+	}
+	rs, err := ns.queryList(serviceInfo.Name, serviceInfo.Clusters, udpPort, false)
+	if err != nil {
+		return nil, err
 	}
+	return ns.updateServiceMap(rs.Data), nil
 }
 
 func (ns *namingClient) updateServiceMap(serviceJSON string) *ServiceInfo {
@@ -450,17 +817,26 @@ func (ns *namingClient) updateServiceMap(serviceJSON string) *ServiceInfo {
 	if err != nil {
 		return nil
 	}
+	serviceInfo.JsonFromServer = serviceJSON
+	return ns.updateService(serviceInfo.splitHostNames())
+}
+
+// updateService stores a service received from the server unless it is
+// older than the one held, and dispatches it to listeners if it changed
+func (ns *namingClient) updateService(serviceInfo *ServiceInfo) *ServiceInfo {
 	key := serviceInfo.GetKey()
-	oldServiceInfo, ok := ns.serviceInfoMap[key]
 	if serviceInfo.Hosts == nil || !serviceInfo.Validate() {
+		oldServiceInfo, _ := ns.serviceInfoHolder.Get(key)
+		return oldServiceInfo
+	}
+	oldServiceInfo, ok := ns.serviceInfoHolder.Update(serviceInfo)
+	if !ok {
+		// an older poll must not override a newer push
+		ns.c.logger.Warn("out of date data received, old-t: %d, new-t: %d", oldServiceInfo.LastRefTime, serviceInfo.LastRefTime)
 		return oldServiceInfo
 	}
 	var changed bool
-	if ok {
-		if oldServiceInfo.LastRefTime > serviceInfo.LastRefTime {
-			//
-		}
-		ns.serviceInfoMap[key] = &serviceInfo
+	if oldServiceInfo != nil {
 		oldHostMap := make(map[string]*Instance)
 		newHostMap := make(map[string]*Instance)
 
@@ -484,42 +860,24 @@ func (ns *namingClient) updateServiceMap(serviceJSON string) *ServiceInfo {
 		}
 
 		for k, v := range oldHostMap {
-			if _, ok := newHostMap[k]; ok {
-				continue
-			} else if !ok {
+			if _, ok := newHostMap[k]; !ok {
 				removeHosts = append(removeHosts, v)
 			}
 		}
 
-		if len(newHosts) > 0 {
-			//
-			changed = true
-		}
-		if len(removeHosts) > 0 {
-			//
-			changed = true
-		}
 		if len(modHosts) > 0 {
-			changed = true
-			ns.heartbeat.updateBeatInfo(modHosts)
-		}
-		serviceInfo.JsonFromServer = serviceJSON
-		if len(newHosts) > 0 || len(removeHosts) > 0 || len(modHosts) > 0 {
-			// TODO event dispatch
-			writeCache(ns.c.config.CacheDir, &serviceInfo)
+			ns.heartbeat.updateBeatInfo(serviceInfo.Name, modHosts)
 		}
+		changed = len(newHosts) > 0 || len(removeHosts) > 0 || len(modHosts) > 0
 	} else {
 		changed = true
-		ns.serviceInfoMap[key] = &serviceInfo
-		serviceInfo.JsonFromServer = serviceJSON
-		// TODO event dispatch
-		writeCache(ns.c.config.CacheDir, &serviceInfo)
 	}
 	if changed {
-		ns.listeners.serviceChange(&serviceInfo)
+		writeCache(ns.c.config.CacheDir, serviceInfo)
+		ns.listeners.serviceChange(serviceInfo)
 	}
 
-	return &serviceInfo
+	return serviceInfo
 
 }
 
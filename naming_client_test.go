@@ -7,11 +7,15 @@ import (
 	"testing"
 
 	. "github.com/echocat/gocheck-addons"
+	"github.com/litgh/nacos-go-sdk/nacostest"
 	. "gopkg.in/check.v1"
 )
 
+// MySuite runs against the server in NACOS_TEST_HOSTS, or a nacostest
+// server if it is not set
 type MySuite struct {
-	ns NamingClient
+	ns     NamingClient
+	server *nacostest.Server
 }
 
 var _ = Suite(&MySuite{})
@@ -33,8 +37,10 @@ func Test(t *testing.T) {
 }
 
 func (m *MySuite) SetUpSuite(c *C) {
+	hosts := hosts
 	if hosts == "" {
-		c.Fatal("NACOS_TEST_HOSTS not specified")
+		m.server = nacostest.NewServer(nacostest.Options{Username: username, Password: password})
+		hosts = m.server.URL
 	}
 	config := new(Config)
 	hostArr := strings.Split(hosts, ",")
@@ -70,6 +76,9 @@ func (m *MySuite) SetUpSuite(c *C) {
 }
 
 func (m *MySuite) TearDownSuite(c *C) {
+	if m.server != nil {
+		defer m.server.Close()
+	}
 	m.ns.DeRegisterInstance(serviceName, groupName, clusterName, ip, port, false)
 	resp, err := m.ns.DeleteService(ServiceOptions{
 		ServiceName: serviceName,
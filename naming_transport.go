@@ -0,0 +1,622 @@
+package nacos
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// namingTransport carries the instance and subscription calls of the naming
+// client. The HTTP transport beats ephemeral instances and polls subscribed
+// services next to UDP pushes; the gRPC transport binds ephemeral instances
+// to its connection and receives pushes through it. Service, cluster and
+// catalog management stays on HTTP for both.
+type namingTransport interface {
+	registerInstance(instance *Instance) (*Response, error)
+
+	batchRegisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult
+
+	deregisterInstance(ctx context.Context, instance *Instance) (*Response, error)
+
+	batchDeregisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult
+
+	updateInstance(instance *Instance) (*Response, error)
+
+	patchInstanceMetadata(key InstanceKey, add map[string]string, remove []string) (*Response, error)
+
+	isSubscribed(groupedServiceName, clusters string) bool
+
+	// subscribe queries the service and keeps it updated, the result is
+	// stored and dispatched to listeners before it is returned
+	subscribe(groupedServiceName, clusters string) (*ServiceInfo, error)
+
+	unsubscribe(groupedServiceName, clusters string) error
+
+	queryInstances(groupedServiceName, clusters string, healthyOnly bool) (*ServiceInfo, error)
+
+	// close releases the transport, deregistering the ephemeral instances it
+	// registered first if deregister is set
+	close(ctx context.Context, deregister bool) error
+}
+
+var (
+	_ namingTransport = new(httpNamingTransport)
+	_ namingTransport = new(grpcNamingTransport)
+)
+
+func newNamingTransport(ns *namingClient) namingTransport {
+	if ns.c.config.Protocol == ProtocolGRPC {
+		return newGrpcNamingTransport(ns)
+	}
+	return &httpNamingTransport{ns: ns}
+}
+
+// httpNamingTransport speaks the 1.x HTTP and UDP protocol
+type httpNamingTransport struct {
+	ns *namingClient
+}
+
+func (t *httpNamingTransport) registerInstance(instance *Instance) (*Response, error) {
+	rs, err := t.ns.registerService(instance)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Ephemeral {
+		beatInfo := newBeat(instance.GroupName+serviceInfoSpliter+instance.ServiceName, instance)
+		t.ns.heartbeat.addBeat(beatInfo)
+	}
+	return rs, nil
+}
+
+// batchRegisterInstances registers instances by up to batchConcurrency
+// parallel calls, the 1.x HTTP API has no batch endpoint; the beats of the
+// service share one schedule.
+func (t *httpNamingTransport) batchRegisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult {
+	return t.ns.batch(instances, t.registerInstance)
+}
+
+func (t *httpNamingTransport) deregisterInstance(ctx context.Context, instance *Instance) (*Response, error) {
+	if instance.Ephemeral {
+		t.ns.heartbeat.removeBeat(instance.GroupName+serviceInfoSpliter+instance.ServiceName, instance.IP, instance.Port)
+	}
+	return t.ns.deregisterService(ctx, instance)
+}
+
+func (t *httpNamingTransport) batchDeregisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult {
+	return t.ns.batch(instances, func(instance *Instance) (*Response, error) {
+		return t.deregisterInstance(context.Background(), instance)
+	})
+}
+
+// updateInstance updates the instance on the server and the beat sent for
+// it, so the next beat carries its weight and metadata
+func (t *httpNamingTransport) updateInstance(instance *Instance) (*Response, error) {
+	rs, err := t.ns.putInstance(instance)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Ephemeral {
+		t.ns.heartbeat.updateInstance(instance.GroupName+serviceInfoSpliter+instance.ServiceName, instance)
+	}
+	return rs, nil
+}
+
+func (t *httpNamingTransport) patchInstanceMetadata(key InstanceKey, add map[string]string, remove []string) (*Response, error) {
+	rs, err := t.ns.patchMetadata(key, add, remove)
+	if err != nil {
+		return nil, err
+	}
+	if key.Ephemeral {
+		t.ns.heartbeat.patchMetadata(key.GroupName+serviceInfoSpliter+key.ServiceName, key.IP, key.Port, add, remove)
+	}
+	return rs, nil
+}
+
+func (t *httpNamingTransport) isSubscribed(groupedServiceName, clusters string) bool {
+	return t.ns.updater.scheduled(groupedServiceName, clusters)
+}
+
+func (t *httpNamingTransport) subscribe(groupedServiceName, clusters string) (*ServiceInfo, error) {
+	serviceInfo, err := t.ns.updateServiceInfoNow(NewServiceInfo(groupedServiceName, "", clusters))
+	t.ns.updater.schedule(groupedServiceName, clusters)
+	return serviceInfo, err
+}
+
+func (t *httpNamingTransport) unsubscribe(groupedServiceName, clusters string) error {
+	t.ns.updater.remove(groupedServiceName, clusters)
+	return nil
+}
+
+func (t *httpNamingTransport) queryInstances(groupedServiceName, clusters string, healthyOnly bool) (*ServiceInfo, error) {
+	rs, err := t.ns.queryList(groupedServiceName, clusters, 0, healthyOnly)
+	if err != nil {
+		return nil, err
+	}
+	var serviceInfo ServiceInfo
+	if err := json.Unmarshal([]byte(rs.Data), &serviceInfo); err != nil {
+		return nil, err
+	}
+	return serviceInfo.splitHostNames(), nil
+}
+
+func (t *httpNamingTransport) close(ctx context.Context, deregister bool) error {
+	var err error
+	instances := t.ns.heartbeat.stop()
+	if deregister {
+		for _, instance := range instances {
+			if ctx.Err() != nil {
+				break
+			}
+			if _, e := t.ns.deregisterService(ctx, instance); e != nil {
+				t.ns.c.logger.Error("failed to deregister %s %s:%d on shutdown, %v", instance.ServiceName, instance.IP, instance.Port, e)
+				if err == nil {
+					err = e
+				}
+			}
+		}
+	}
+	if t.ns.pushReceiver != nil {
+		t.ns.pushReceiver.close()
+	}
+	return err
+}
+
+// grpcNamingTransport speaks the 2.x gRPC protocol. The server keeps one
+// registration per service and connection, so all ephemeral instances of a
+// service registered by this client are published together, by a batch
+// request when there is more than one. Persistent instances are not bound
+// to the connection and stay on HTTP. Registrations and subscriptions are
+// made again on reconnect, the server drops them with the connection.
+type grpcNamingTransport struct {
+	// serializes publications, held during the request
+	sync.Mutex
+	ns         *namingClient
+	gc         *grpcClient
+	registered map[string][]*Instance
+
+	subMu      sync.Mutex
+	subscribed map[string]subscription
+}
+
+type subscription struct {
+	groupedServiceName string
+	clusters           string
+}
+
+func newGrpcNamingTransport(ns *namingClient) *grpcNamingTransport {
+	t := &grpcNamingTransport{
+		ns:         ns,
+		gc:         newGrpcClient(ns.c, grpcModuleNaming, ns.getServerList),
+		registered: make(map[string][]*Instance),
+		subscribed: make(map[string]subscription),
+	}
+	t.gc.handle("NotifySubscriberRequest", t.onNotify)
+	t.gc.onReconnected(t.redo)
+	return t
+}
+
+type grpcInstance struct {
+	InstanceID  string    `json:"instanceId,omitempty"`
+	IP          string    `json:"ip"`
+	Port        int       `json:"port"`
+	Weight      float64   `json:"weight"`
+	Healthy     bool      `json:"healthy"`
+	Enabled     bool      `json:"enabled"`
+	Ephemeral   bool      `json:"ephemeral"`
+	ClusterName string    `json:"clusterName"`
+	ServiceName string    `json:"serviceName"`
+	Metadata    *Metadata `json:"metadata"`
+}
+
+func newGrpcInstance(instance *Instance) *grpcInstance {
+	return &grpcInstance{
+		InstanceID:  instance.InstanceID,
+		IP:          instance.IP,
+		Port:        instance.Port,
+		Weight:      instance.Weight,
+		Healthy:     instance.Healthy,
+		Enabled:     instance.Enable,
+		Ephemeral:   instance.Ephemeral,
+		ClusterName: instance.ClusterName,
+		ServiceName: instance.GroupName + serviceInfoSpliter + instance.ServiceName,
+		Metadata:    instance.Metadata,
+	}
+}
+
+type instanceRequest struct {
+	Namespace   string        `json:"namespace"`
+	ServiceName string        `json:"serviceName"`
+	GroupName   string        `json:"groupName"`
+	Type        string        `json:"type"`
+	Instance    *grpcInstance `json:"instance,omitempty"`
+}
+
+type batchInstanceRequest struct {
+	Namespace   string          `json:"namespace"`
+	ServiceName string          `json:"serviceName"`
+	GroupName   string          `json:"groupName"`
+	Type        string          `json:"type"`
+	Instances   []*grpcInstance `json:"instances"`
+}
+
+type subscribeServiceRequest struct {
+	Namespace   string `json:"namespace"`
+	ServiceName string `json:"serviceName"`
+	GroupName   string `json:"groupName"`
+	Clusters    string `json:"clusters"`
+	Subscribe   bool   `json:"subscribe"`
+}
+
+type serviceQueryRequest struct {
+	Namespace   string `json:"namespace"`
+	ServiceName string `json:"serviceName"`
+	GroupName   string `json:"groupName"`
+	Cluster     string `json:"cluster"`
+	HealthyOnly bool   `json:"healthyOnly"`
+	UDPPort     int    `json:"udpPort"`
+}
+
+type serviceInfoResponse struct {
+	grpcResponse
+	ServiceInfo *ServiceInfo `json:"serviceInfo"`
+}
+
+func (t *grpcNamingTransport) namespace() string {
+	if t.ns.c.config.Namespace == "" {
+		return "public"
+	}
+	return t.ns.c.config.Namespace
+}
+
+// splitGroupedServiceName returns the group and the name of a grouped
+// service name
+func splitGroupedServiceName(groupedServiceName string) (string, string) {
+	if i := strings.Index(groupedServiceName, serviceInfoSpliter); i >= 0 {
+		return groupedServiceName[:i], groupedServiceName[i+len(serviceInfoSpliter):]
+	}
+	return DefaultGroup, groupedServiceName
+}
+
+// publish replaces the instances of a service registered by this client,
+// removed is sent when none is left
+func (t *grpcNamingTransport) publish(ctx context.Context, serviceName, groupName string, instances []*Instance, removed *Instance) error {
+	switch len(instances) {
+	case 0:
+		return t.gc.request(ctx, "InstanceRequest", &instanceRequest{
+			Namespace:   t.namespace(),
+			ServiceName: serviceName,
+			GroupName:   groupName,
+			Type:        "deregisterInstance",
+			Instance:    newGrpcInstance(removed),
+		}, nil)
+	case 1:
+		return t.gc.request(ctx, "InstanceRequest", &instanceRequest{
+			Namespace:   t.namespace(),
+			ServiceName: serviceName,
+			GroupName:   groupName,
+			Type:        "registerInstance",
+			Instance:    newGrpcInstance(instances[0]),
+		}, nil)
+	}
+	batch := make([]*grpcInstance, len(instances))
+	for i, instance := range instances {
+		batch[i] = newGrpcInstance(instance)
+	}
+	return t.gc.request(ctx, "BatchInstanceRequest", &batchInstanceRequest{
+		Namespace:   t.namespace(),
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		Type:        "batchRegisterInstance",
+		Instances:   batch,
+	}, nil)
+}
+
+// update publishes the instances of a service with the given instances
+// added and removed, and records them once the server accepted them
+func (t *grpcNamingTransport) update(ctx context.Context, serviceName, groupName string, add, remove []*Instance) error {
+	t.Lock()
+	defer t.Unlock()
+	return t.updateLocked(ctx, serviceName, groupName, add, remove)
+}
+
+func (t *grpcNamingTransport) updateLocked(ctx context.Context, serviceName, groupName string, add, remove []*Instance) error {
+	grouped := groupName + serviceInfoSpliter + serviceName
+	current := t.registered[grouped]
+	next := make([]*Instance, 0, len(current)+len(add))
+	for _, instance := range current {
+		if !containsInstance(add, instance) && !containsInstance(remove, instance) {
+			next = append(next, instance)
+		}
+	}
+	for _, instance := range add {
+		next = append(next, instance.clone())
+	}
+	if len(next) == len(current) && len(add) == 0 {
+		// none of the instances to remove is registered by this client
+		return nil
+	}
+	var removed *Instance
+	if len(remove) > 0 {
+		removed = remove[0]
+	}
+	if err := t.publish(ctx, serviceName, groupName, next, removed); err != nil {
+		return err
+	}
+	if len(next) == 0 {
+		delete(t.registered, grouped)
+	} else {
+		t.registered[grouped] = next
+	}
+	return nil
+}
+
+func containsInstance(instances []*Instance, instance *Instance) bool {
+	for _, i := range instances {
+		if i.IP == instance.IP && i.Port == instance.Port && i.ClusterName == instance.ClusterName {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *grpcNamingTransport) registerInstance(instance *Instance) (*Response, error) {
+	if !instance.Ephemeral {
+		return t.ns.registerService(instance)
+	}
+	if err := t.update(context.Background(), instance.ServiceName, instance.GroupName, []*Instance{instance}, nil); err != nil {
+		return nil, err
+	}
+	return &Response{Code: 200, Data: "ok"}, nil
+}
+
+func (t *grpcNamingTransport) batchRegisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult {
+	return t.batch(instances, func(ephemeral []*Instance) error {
+		return t.update(context.Background(), serviceName, groupName, ephemeral, nil)
+	}, t.ns.registerService)
+}
+
+func (t *grpcNamingTransport) deregisterInstance(ctx context.Context, instance *Instance) (*Response, error) {
+	if !instance.Ephemeral {
+		return t.ns.deregisterService(ctx, instance)
+	}
+	if err := t.update(ctx, instance.ServiceName, instance.GroupName, nil, []*Instance{instance}); err != nil {
+		return nil, err
+	}
+	return &Response{Code: 200, Data: "ok"}, nil
+}
+
+func (t *grpcNamingTransport) batchDeregisterInstances(serviceName, groupName string, instances []*Instance) []InstanceResult {
+	return t.batch(instances, func(ephemeral []*Instance) error {
+		return t.update(context.Background(), serviceName, groupName, nil, ephemeral)
+	}, func(instance *Instance) (*Response, error) {
+		return t.ns.deregisterService(context.Background(), instance)
+	})
+}
+
+// batch applies fn to the ephemeral instances at once and persistent to
+// each persistent one
+func (t *grpcNamingTransport) batch(instances []*Instance, fn func([]*Instance) error, persistent func(*Instance) (*Response, error)) []InstanceResult {
+	var ephemeral []*Instance
+	var others []*Instance
+	for _, instance := range instances {
+		if instance.Ephemeral {
+			ephemeral = append(ephemeral, instance)
+		} else {
+			others = append(others, instance)
+		}
+	}
+	results := make(map[*Instance]InstanceResult, len(instances))
+	if len(ephemeral) > 0 {
+		var rs *Response
+		err := fn(ephemeral)
+		if err == nil {
+			rs = &Response{Code: 200, Data: "ok"}
+		}
+		for _, instance := range ephemeral {
+			results[instance] = InstanceResult{Instance: instance, Response: rs, Err: err}
+		}
+	}
+	for _, r := range t.ns.batch(others, persistent) {
+		results[r.Instance] = r
+	}
+	ordered := make([]InstanceResult, len(instances))
+	for i, instance := range instances {
+		ordered[i] = results[instance]
+	}
+	return ordered
+}
+
+// registeredLocked returns the ephemeral instance at the address of key
+// registered by this client, nil if there is none
+func (t *grpcNamingTransport) registeredLocked(key InstanceKey) *Instance {
+	for _, instance := range t.registered[key.GroupName+serviceInfoSpliter+key.ServiceName] {
+		if instance.IP == key.IP && instance.Port == key.Port && instance.ClusterName == key.ClusterName {
+			return instance
+		}
+	}
+	return nil
+}
+
+// updateInstance publishes an ephemeral instance registered by this client
+// again, so that a redo after a reconnect registers it as updated; other
+// instances are updated over HTTP
+func (t *grpcNamingTransport) updateInstance(instance *Instance) (*Response, error) {
+	if instance.Ephemeral {
+		t.Lock()
+		defer t.Unlock()
+		if t.registeredLocked(instance.Key()) != nil {
+			if err := t.updateLocked(context.Background(), instance.ServiceName, instance.GroupName, []*Instance{instance}, nil); err != nil {
+				return nil, err
+			}
+			return &Response{Code: 200, Data: "ok"}, nil
+		}
+	}
+	return t.ns.putInstance(instance)
+}
+
+// patchInstanceMetadata publishes an ephemeral instance registered by this
+// client again with its metadata patched; the metadata of other instances
+// is patched over HTTP
+func (t *grpcNamingTransport) patchInstanceMetadata(key InstanceKey, add map[string]string, remove []string) (*Response, error) {
+	if key.Ephemeral {
+		t.Lock()
+		defer t.Unlock()
+		if registered := t.registeredLocked(key); registered != nil {
+			instance := registered.clone()
+			instance.Metadata = registered.Metadata.patched(add, remove)
+			if err := t.updateLocked(context.Background(), key.ServiceName, key.GroupName, []*Instance{instance}, nil); err != nil {
+				return nil, err
+			}
+			return &Response{Code: 200, Data: "ok"}, nil
+		}
+	}
+	return t.ns.patchMetadata(key, add, remove)
+}
+
+func (t *grpcNamingTransport) isSubscribed(groupedServiceName, clusters string) bool {
+	t.subMu.Lock()
+	defer t.subMu.Unlock()
+	_, ok := t.subscribed[getServiceInfoKey(groupedServiceName, clusters)]
+	return ok
+}
+
+func (t *grpcNamingTransport) subscribe(groupedServiceName, clusters string) (*ServiceInfo, error) {
+	groupName, serviceName := splitGroupedServiceName(groupedServiceName)
+	var resp serviceInfoResponse
+	err := t.gc.request(context.Background(), "SubscribeServiceRequest", &subscribeServiceRequest{
+		Namespace:   t.namespace(),
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		Clusters:    clusters,
+		Subscribe:   true,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	t.subMu.Lock()
+	t.subscribed[getServiceInfoKey(groupedServiceName, clusters)] = subscription{groupedServiceName, clusters}
+	t.subMu.Unlock()
+	if resp.ServiceInfo == nil {
+		return nil, errors.New("no service info in response")
+	}
+	return t.ns.updateService(normalizeServiceInfo(resp.ServiceInfo)), nil
+}
+
+func (t *grpcNamingTransport) unsubscribe(groupedServiceName, clusters string) error {
+	t.subMu.Lock()
+	delete(t.subscribed, getServiceInfoKey(groupedServiceName, clusters))
+	t.subMu.Unlock()
+	groupName, serviceName := splitGroupedServiceName(groupedServiceName)
+	return t.gc.request(context.Background(), "SubscribeServiceRequest", &subscribeServiceRequest{
+		Namespace:   t.namespace(),
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		Clusters:    clusters,
+	}, nil)
+}
+
+func (t *grpcNamingTransport) queryInstances(groupedServiceName, clusters string, healthyOnly bool) (*ServiceInfo, error) {
+	groupName, serviceName := splitGroupedServiceName(groupedServiceName)
+	var resp serviceInfoResponse
+	err := t.gc.request(context.Background(), "ServiceQueryRequest", &serviceQueryRequest{
+		Namespace:   t.namespace(),
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		Cluster:     clusters,
+		HealthyOnly: healthyOnly,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ServiceInfo == nil {
+		return nil, errors.New("no service info in response")
+	}
+	return normalizeServiceInfo(resp.ServiceInfo), nil
+}
+
+// redo publishes the registered instances and subscribes the services again
+// on a new connection
+func (t *grpcNamingTransport) redo() {
+	var events []RedoEvent
+	t.Lock()
+	for grouped, instances := range t.registered {
+		groupName, serviceName := splitGroupedServiceName(grouped)
+		err := t.publish(context.Background(), serviceName, groupName, instances, nil)
+		for _, instance := range instances {
+			events = append(events, RedoEvent{Type: RedoRegister, ServiceName: grouped, Instance: instance.clone(), Err: err})
+		}
+	}
+	t.Unlock()
+	for _, event := range events {
+		t.ns.redo.recovered(event)
+	}
+	t.subMu.Lock()
+	subscriptions := make([]subscription, 0, len(t.subscribed))
+	for _, sub := range t.subscribed {
+		subscriptions = append(subscriptions, sub)
+	}
+	t.subMu.Unlock()
+	for _, sub := range subscriptions {
+		_, err := t.subscribe(sub.groupedServiceName, sub.clusters)
+		if err != nil {
+			// left to the reconciliation of the redo
+			t.subMu.Lock()
+			delete(t.subscribed, getServiceInfoKey(sub.groupedServiceName, sub.clusters))
+			t.subMu.Unlock()
+		}
+		t.ns.redo.recovered(RedoEvent{Type: RedoSubscribe, ServiceName: sub.groupedServiceName, Clusters: sub.clusters, Err: err})
+	}
+}
+
+func (t *grpcNamingTransport) onNotify(body []byte) string {
+	var req struct {
+		ServiceInfo *ServiceInfo `json:"serviceInfo"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.ServiceInfo == nil {
+		t.ns.c.logger.Error("failed to process pushed service, %v", err)
+	} else {
+		t.ns.updateService(normalizeServiceInfo(req.ServiceInfo))
+	}
+	return "NotifySubscriberResponse"
+}
+
+// normalizeServiceInfo groups the name of a service received over gRPC, the
+// 2.x server sends the group apart
+func normalizeServiceInfo(serviceInfo *ServiceInfo) *ServiceInfo {
+	if !strings.Contains(serviceInfo.Name, serviceInfoSpliter) {
+		if serviceInfo.GroupName == "" {
+			serviceInfo.GroupName = DefaultGroup
+		}
+		serviceInfo.Name = serviceInfo.GroupName + serviceInfoSpliter + serviceInfo.Name
+	}
+	if serviceInfo.JsonFromServer == "" {
+		serviceInfo.JsonFromServer = encode(serviceInfo)
+	}
+	return serviceInfo.splitHostNames()
+}
+
+func (t *grpcNamingTransport) close(ctx context.Context, deregister bool) error {
+	var err error
+	if deregister {
+		t.Lock()
+		for grouped, instances := range t.registered {
+			if ctx.Err() != nil {
+				break
+			}
+			groupName, serviceName := splitGroupedServiceName(grouped)
+			// the server drops every instance of the service published by
+			// the connection at once
+			if e := t.publish(ctx, serviceName, groupName, nil, instances[0]); e != nil {
+				t.ns.c.logger.Error("failed to deregister %s on shutdown, %v", grouped, e)
+				if err == nil {
+					err = e
+				}
+			}
+		}
+		t.registered = make(map[string][]*Instance)
+		t.Unlock()
+	}
+	t.gc.close()
+	return err
+}
@@ -0,0 +1,233 @@
+package nacos
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type GrpcNamingSuite struct {
+	standIn *grpcStandIn
+	ns      *namingClient
+}
+
+var _ = Suite(&GrpcNamingSuite{})
+
+func (s *GrpcNamingSuite) SetUpTest(c *C) {
+	s.standIn = newGrpcStandIn(c)
+	s.ns = newOfflineNamingClient(c)
+	s.ns.c.config.Protocol = ProtocolGRPC
+	s.ns.c.config.Hosts = []string{s.standIn.host()}
+	s.ns.transport = newNamingTransport(s.ns)
+}
+
+func (s *GrpcNamingSuite) TearDownTest(c *C) {
+	s.ns.transport.close(context.Background(), false)
+	s.ns.c.cancel()
+	s.standIn.stop()
+}
+
+func instancesOf(body map[string]interface{}) []string {
+	var addrs []string
+	if instance, ok := body["instance"].(map[string]interface{}); ok {
+		addrs = append(addrs, instance["ip"].(string))
+	}
+	if instances, ok := body["instances"].([]interface{}); ok {
+		for _, instance := range instances {
+			addrs = append(addrs, instance.(map[string]interface{})["ip"].(string))
+		}
+	}
+	return addrs
+}
+
+func (s *GrpcNamingSuite) TestRegisterPublishesAllInstancesOfService(c *C) {
+	_, err := s.ns.RegisterInstance(NewInstance("svc", "", "", "10.0.0.1", 80, 1, true, true, nil))
+	c.Assert(err, IsNil)
+	_, err = s.ns.RegisterInstance(NewInstance("svc", "", "", "10.0.0.2", 80, 1, true, true, nil))
+	c.Assert(err, IsNil)
+
+	registered := s.standIn.received("InstanceRequest")
+	c.Assert(registered, HasLen, 1)
+	c.Assert(registered[0]["type"], Equals, "registerInstance")
+	c.Assert(registered[0]["namespace"], Equals, "public")
+	c.Assert(registered[0]["groupName"], Equals, DefaultGroup)
+	c.Assert(registered[0]["serviceName"], Equals, "svc")
+	batch := s.standIn.received("BatchInstanceRequest")
+	c.Assert(batch, HasLen, 1)
+	c.Assert(batch[0]["type"], Equals, "batchRegisterInstance")
+	c.Assert(instancesOf(batch[0]), DeepEquals, []string{"10.0.0.1", "10.0.0.2"})
+
+	_, err = s.ns.DeRegisterInstance("svc", "", "", "10.0.0.1", 80, true)
+	c.Assert(err, IsNil)
+	_, err = s.ns.DeRegisterInstance("svc", "", "", "10.0.0.2", 80, true)
+	c.Assert(err, IsNil)
+	registered = s.standIn.received("InstanceRequest")
+	c.Assert(registered, HasLen, 3)
+	c.Assert(registered[1]["type"], Equals, "registerInstance")
+	c.Assert(instancesOf(registered[1]), DeepEquals, []string{"10.0.0.2"})
+	c.Assert(registered[2]["type"], Equals, "deregisterInstance")
+	c.Assert(instancesOf(registered[2]), DeepEquals, []string{"10.0.0.2"})
+}
+
+func (s *GrpcNamingSuite) TestBatchRegister(c *C) {
+	results := s.ns.BatchRegisterInstances("svc", "", []*Instance{
+		NewInstance("", "", "", "10.0.0.1", 80, 1, true, true, nil),
+		NewInstance("", "", "", "10.0.0.2", 80, 1, true, true, nil),
+		NewInstance("", "", "", "10.0.0.3", 80, 1, true, true, nil),
+	})
+	for _, r := range results {
+		c.Assert(r.Err, IsNil)
+	}
+	batch := s.standIn.received("BatchInstanceRequest")
+	c.Assert(batch, HasLen, 1)
+	c.Assert(instancesOf(batch[0]), DeepEquals, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+
+	s.standIn.handle("BatchInstanceRequest", func(*payload) interface{} {
+		return &grpcResponse{ResultCode: 500, ErrorCode: 501, Message: "request type not supported"}
+	})
+	results = s.ns.BatchRegisterInstances("svc", "", []*Instance{NewInstance("", "", "", "10.0.0.4", 80, 1, true, true, nil)})
+	c.Assert(results[0].Err, ErrorMatches, ".*request type not supported")
+
+	// a failed publication is not recorded
+	c.Assert(s.ns.transport.close(context.Background(), true), IsNil)
+	registered := s.standIn.received("InstanceRequest")
+	c.Assert(registered, HasLen, 1)
+	c.Assert(registered[0]["type"], Equals, "deregisterInstance")
+}
+
+func (s *GrpcNamingSuite) TestSubscribeAndPush(c *C) {
+	s.standIn.handle("SubscribeServiceRequest", func(*payload) interface{} {
+		return map[string]interface{}{
+			"resultCode":  200,
+			"serviceInfo": map[string]interface{}{"name": "svc", "groupName": DefaultGroup, "clusters": DefaultCluster, "lastRefTime": 1, "hosts": []map[string]interface{}{{"ip": "10.0.0.1", "port": 80}}},
+		}
+	})
+	events := make(chan *ServiceInfo, 4)
+	s.ns.Subscribe("svc", "", []string{DefaultCluster}, &funcListener{func(si *ServiceInfo) { events <- si }})
+	subscribed := s.standIn.received("SubscribeServiceRequest")
+	c.Assert(subscribed, HasLen, 1)
+	c.Assert(subscribed[0]["subscribe"], Equals, true)
+	c.Assert(subscribed[0]["clusters"], Equals, DefaultCluster)
+
+	select {
+	case si := <-events:
+		c.Assert(si.Name, Equals, "DEFAULT_GROUP@@svc")
+		c.Assert(si.Hosts, HasLen, 1)
+	case <-time.After(time.Second):
+		c.Fatal("no event")
+	}
+
+	s.standIn.push("NotifySubscriberRequest", map[string]interface{}{
+		"serviceInfo": map[string]interface{}{"name": "svc", "groupName": DefaultGroup, "clusters": DefaultCluster, "lastRefTime": 2, "hosts": []map[string]interface{}{{"ip": "10.0.0.1", "port": 80}, {"ip": "10.0.0.2", "port": 80}}},
+	})
+	select {
+	case si := <-events:
+		c.Assert(si.Hosts, HasLen, 2)
+	case <-time.After(time.Second):
+		c.Fatal("no event")
+	}
+	c.Assert(s.ns.SelectInstance(InstanceQueryOptions{ServiceName: "svc", Subscribe: true}), HasLen, 2)
+	c.Assert(s.standIn.received("SubscribeServiceRequest"), HasLen, 1)
+
+	s.ns.Unsubscribe("svc", "", []string{DefaultCluster}, nil)
+}
+
+func (s *GrpcNamingSuite) TestQuery(c *C) {
+	s.standIn.handle("ServiceQueryRequest", func(*payload) interface{} {
+		return map[string]interface{}{
+			"resultCode":  200,
+			"serviceInfo": map[string]interface{}{"name": "svc", "groupName": DefaultGroup, "hosts": []map[string]interface{}{{"ip": "10.0.0.1", "port": 80, "enabled": true, "metadata": map[string]string{"zone": "a"}}}},
+		}
+	})
+	hosts := s.ns.SelectInstance(InstanceQueryOptions{ServiceName: "svc", Healthy: true})
+	c.Assert(hosts, HasLen, 1)
+	c.Assert(hosts[0].Enable, Equals, true)
+	c.Assert(hosts[0].Metadata.Get("zone"), Equals, "a")
+	query := s.standIn.received("ServiceQueryRequest")
+	c.Assert(query[0]["healthyOnly"], Equals, true)
+	c.Assert(query[0]["cluster"], Equals, DefaultCluster)
+}
+
+func (s *GrpcNamingSuite) TestShutdownDeregisters(c *C) {
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		_, err := s.ns.RegisterInstance(NewInstance("svc", "", "", ip, 80, 1, true, true, nil))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(s.ns.Shutdown(context.Background()), IsNil)
+	registered := s.standIn.received("InstanceRequest")
+	c.Assert(registered[len(registered)-1]["type"], Equals, "deregisterInstance")
+}
+
+func (s *GrpcNamingSuite) TestRedoAfterReconnect(c *C) {
+	next := newGrpcStandIn(c)
+	defer next.stop()
+	s.ns.c.config.Hosts = []string{s.standIn.host(), next.host()}
+	s.ns.transport = newNamingTransport(s.ns)
+	serviceInfo := func(*payload) interface{} {
+		return map[string]interface{}{"resultCode": 200, "serviceInfo": map[string]interface{}{"name": "svc", "groupName": DefaultGroup, "clusters": DefaultCluster}}
+	}
+	s.standIn.handle("SubscribeServiceRequest", serviceInfo)
+	next.handle("SubscribeServiceRequest", serviceInfo)
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		_, err := s.ns.RegisterInstance(NewInstance("svc", "", "", ip, 80, 1, true, true, nil))
+		c.Assert(err, IsNil)
+	}
+	s.ns.Subscribe("svc", "", []string{DefaultCluster}, &funcListener{func(*ServiceInfo) {}})
+	first, other := s.standIn, next
+	if next.connections() == 1 {
+		first, other = next, s.standIn
+	}
+	first.stop()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(other.received("SubscribeServiceRequest")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	batch := other.received("BatchInstanceRequest")
+	c.Assert(batch, HasLen, 1)
+	c.Assert(instancesOf(batch[0]), DeepEquals, []string{"10.0.0.1", "10.0.0.2"})
+	subscribed := other.received("SubscribeServiceRequest")
+	c.Assert(subscribed, HasLen, 1)
+	c.Assert(subscribed[0]["serviceName"], Equals, "svc")
+	c.Assert(subscribed[0]["clusters"], Equals, DefaultCluster)
+	stats := s.ns.RedoStats()
+	c.Assert(stats.Reregistered, Equals, int64(2))
+	c.Assert(stats.Resubscribed, Equals, int64(1))
+}
+
+func (s *GrpcNamingSuite) TestUpdateSurvivesReconnect(c *C) {
+	next := newGrpcStandIn(c)
+	defer next.stop()
+	s.ns.c.config.Hosts = []string{s.standIn.host(), next.host()}
+	s.ns.transport = newNamingTransport(s.ns)
+
+	instance := NewInstance("svc", "", "", "10.0.0.1", 80, 1, true, true, NewMetadata(nil).Put("a", "1"))
+	_, err := s.ns.RegisterInstance(instance)
+	c.Assert(err, IsNil)
+	update := instance.clone()
+	update.Weight = 5
+	_, err = s.ns.UpdateInstance(update)
+	c.Assert(err, IsNil)
+	_, err = s.ns.PatchInstanceMetadata(update.Key(), map[string]string{"b": "2"}, []string{"a"})
+	c.Assert(err, IsNil)
+
+	first, other := s.standIn, next
+	if next.connections() == 1 {
+		first, other = next, s.standIn
+	}
+	published := first.received("InstanceRequest")
+	c.Assert(published, HasLen, 3)
+	first.stop()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(other.received("InstanceRequest")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	redone := other.received("InstanceRequest")
+	c.Assert(redone, HasLen, 1)
+	redoneInstance := redone[0]["instance"].(map[string]interface{})
+	c.Assert(redoneInstance["weight"], Equals, float64(5))
+	c.Assert(redoneInstance["metadata"], DeepEquals, map[string]interface{}{"b": "2"})
+}
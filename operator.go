@@ -0,0 +1,226 @@
+package nacos
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+var _ OperatorClient = new(operatorClient)
+
+const (
+	ServerStatusUp   = "UP"
+	ServerStatusDown = "DOWN"
+)
+
+// serverStatusTimeout bounds the requests behind GetServerStatus, which
+// probes readiness and must answer even when the server does not
+var serverStatusTimeout = 5 * time.Second
+
+// Switches are the runtime switches of the naming service
+type Switches struct {
+	Name                         string         `json:"name"`
+	Masters                      []string       `json:"masters"`
+	AdWeightMap                  map[string]int `json:"adWeightMap"`
+	DefaultPushCacheMillis       int64          `json:"defaultPushCacheMillis"`
+	ClientBeatInterval           int64          `json:"clientBeatInterval"`
+	DefaultCacheMillis           int64          `json:"defaultCacheMillis"`
+	DistroThreshold              float64        `json:"distroThreshold"`
+	HealthCheckEnabled           bool           `json:"healthCheckEnabled"`
+	AutoChangeHealthCheckEnabled bool           `json:"autoChangeHealthCheckEnabled"`
+	DistroEnabled                bool           `json:"distroEnabled"`
+	EnableStandalone             bool           `json:"enableStandalone"`
+	PushEnabled                  bool           `json:"pushEnabled"`
+	CheckTimes                   int            `json:"checkTimes"`
+	DisableAddIP                 bool           `json:"disableAddIP"`
+	SendBeatOnly                 bool           `json:"sendBeatOnly"`
+	LightBeatEnabled             bool           `json:"lightBeatEnabled"`
+	LimitedURLMap                map[string]int `json:"limitedUrlMap"`
+	DistroServerExpiredMillis    int64          `json:"distroServerExpiredMillis"`
+	PushGoVersion                string         `json:"pushGoVersion"`
+	PushJavaVersion              string         `json:"pushJavaVersion"`
+	PushPythonVersion            string         `json:"pushPythonVersion"`
+	PushCVersion                 string         `json:"pushCVersion"`
+	EnableAuthentication         bool           `json:"enableAuthentication"`
+	OverriddenServerStatus       string         `json:"overriddenServerStatus"`
+	DefaultInstanceEphemeral     bool           `json:"defaultInstanceEphemeral"`
+	HealthCheckWhiteList         []string       `json:"healthCheckWhiteList"`
+	Checksum                     string         `json:"checksum"`
+}
+
+// ServerMetrics are the metrics of the server that answered
+type ServerMetrics struct {
+	Status                   string  `json:"status"`
+	ServiceCount             int     `json:"serviceCount"`
+	InstanceCount            int     `json:"instanceCount"`
+	SubscribeCount           int     `json:"subscribeCount"`
+	ResponsibleServiceCount  int     `json:"responsibleServiceCount"`
+	ResponsibleInstanceCount int     `json:"responsibleInstanceCount"`
+	ClientCount              int     `json:"clientCount"`
+	CPU                      float64 `json:"cpu"`
+	Load                     float64 `json:"load"`
+	Mem                      float64 `json:"mem"`
+}
+
+// ServerMember is a member of the Nacos cluster
+type ServerMember struct {
+	IP          string            `json:"ip"`
+	Port        int               `json:"port"`
+	Address     string            `json:"address"`
+	State       string            `json:"state"`
+	ExtendInfo  map[string]string `json:"-"`
+	LastRefTime int64             `json:"lastRefTime"`
+	// reported by servers before 1.3
+	ServePort int  `json:"servePort"`
+	Alive     bool `json:"alive"`
+}
+
+// Up reports whether the member is serving
+func (m *ServerMember) Up() bool {
+	if m.State != "" {
+		return m.State == ServerStatusUp
+	}
+	return m.Alive
+}
+
+// RaftPeer is a member of the raft group of the naming service
+type RaftPeer struct {
+	IP      string `json:"ip"`
+	VoteFor string `json:"voteFor"`
+	Term    int64  `json:"term"`
+	State   string `json:"state"`
+}
+
+type operatorClient struct {
+	c *client
+}
+
+func newOperatorClient(c *client) *operatorClient {
+	return &operatorClient{c: c}
+}
+
+func (ns *namingClient) Operator() OperatorClient {
+	return newOperatorClient(ns.c)
+}
+
+func (oc *operatorClient) newRequest(ctx context.Context, method, path string) *Request {
+	r := oc.c.newNamingRequest(method, path)
+	r.ctx = ctx
+	return r
+}
+
+func (oc *operatorClient) call(r *Request, out interface{}) error {
+	rs, err := callServer(oc.c, r)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(rs.Data), out)
+}
+
+func (oc *operatorClient) Switches(ctx context.Context) (*Switches, error) {
+	var switches Switches
+	if err := oc.call(oc.newRequest(ctx, GET, "/operator/switches"), &switches); err != nil {
+		return nil, err
+	}
+	return &switches, nil
+}
+
+func (oc *operatorClient) UpdateSwitch(ctx context.Context, entry, value string, debug bool) error {
+	r := oc.newRequest(ctx, PUT, "/operator/switches")
+	r.params.Set("entry", entry)
+	r.params.Set("value", value)
+	r.params.Set("debug", strconv.FormatBool(debug))
+	return oc.call(r, nil)
+}
+
+func (oc *operatorClient) Metrics(ctx context.Context) (*ServerMetrics, error) {
+	var metrics ServerMetrics
+	if err := oc.call(oc.newRequest(ctx, GET, "/operator/metrics"), &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
+
+func (oc *operatorClient) Servers(ctx context.Context, healthyOnly bool) ([]*ServerMember, error) {
+	r := oc.newRequest(ctx, GET, "/operator/servers")
+	r.params.Set("healthy", strconv.FormatBool(healthyOnly))
+	var servers struct {
+		Servers []*struct {
+			ServerMember
+			ExtendInfo map[string]interface{} `json:"extendInfo"`
+		} `json:"servers"`
+	}
+	if err := oc.call(r, &servers); err != nil {
+		return nil, err
+	}
+	members := make([]*ServerMember, 0, len(servers.Servers))
+	for _, s := range servers.Servers {
+		m := s.ServerMember
+		if len(s.ExtendInfo) > 0 {
+			m.ExtendInfo = make(map[string]string, len(s.ExtendInfo))
+			for k, v := range s.ExtendInfo {
+				if str, ok := v.(string); ok {
+					m.ExtendInfo[k] = str
+				} else {
+					m.ExtendInfo[k] = encode(v)
+				}
+			}
+		}
+		if m.Port == 0 {
+			m.Port = m.ServePort
+		}
+		if m.Address == "" {
+			m.Address = m.IP + ":" + strconv.Itoa(m.Port)
+		}
+		members = append(members, &m)
+	}
+	return members, nil
+}
+
+func (oc *operatorClient) Leader(ctx context.Context) (*RaftPeer, error) {
+	// the leader is a JSON document embedded as a string
+	var leader struct {
+		Leader string `json:"leader"`
+	}
+	if err := oc.call(oc.newRequest(ctx, GET, "/raft/leader"), &leader); err != nil {
+		return nil, err
+	}
+	var peer RaftPeer
+	if err := json.Unmarshal([]byte(leader.Leader), &peer); err != nil {
+		return nil, err
+	}
+	return &peer, nil
+}
+
+// serverStatus is UP when the server answering reports itself UP and at
+// least one member of its cluster is serving, within serverStatusTimeout
+func (oc *operatorClient) serverStatus(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, serverStatusTimeout)
+	defer cancel()
+	metrics, err := oc.Metrics(ctx)
+	if err != nil {
+		oc.c.logger.Warn("failed to get server metrics, %v", err)
+		return ServerStatusDown
+	}
+	if metrics.Status != "" && metrics.Status != ServerStatusUp {
+		return ServerStatusDown
+	}
+	servers, err := oc.Servers(ctx, false)
+	if err != nil {
+		oc.c.logger.Warn("failed to list servers, %v", err)
+		return ServerStatusDown
+	}
+	for _, s := range servers {
+		if s.Up() {
+			return ServerStatusUp
+		}
+	}
+	if len(servers) == 0 {
+		// standalone servers do not always list themselves
+		return ServerStatusUp
+	}
+	return ServerStatusDown
+}
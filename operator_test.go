@@ -0,0 +1,142 @@
+package nacos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type OperatorSuite struct {
+	srv     *httptest.Server
+	ns      *namingClient
+	method  string
+	query   url.Values
+	status  string
+	servers string
+}
+
+var _ = Suite(&OperatorSuite{})
+
+func (s *OperatorSuite) SetUpTest(c *C) {
+	s.status = "UP"
+	s.servers = `{"servers":[{"ip":"10.0.0.1","port":8848,"state":"UP","address":"10.0.0.1:8848","extendInfo":{"site":"unknown","raftPort":"7848","lastRefreshTime":1600000000000}},{"ip":"10.0.0.2","port":8848,"state":"DOWN","address":"10.0.0.2:8848"}]}`
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.method = r.Method
+		s.query = r.URL.Query()
+		switch r.URL.Path {
+		case "/nacos/v1/ns/operator/switches":
+			if r.Method == PUT {
+				w.Write([]byte("ok"))
+				return
+			}
+			w.Write([]byte(`{"name":"00-00---000-NACOS_SWITCH_DOMAIN-000---00-00","masters":null,"adWeightMap":{},"defaultPushCacheMillis":10000,"clientBeatInterval":5000,"defaultCacheMillis":3000,"distroThreshold":0.7,"healthCheckEnabled":true,"distroEnabled":true,"pushEnabled":true,"checkTimes":3,"lightBeatEnabled":true,"pushGoVersion":"0.1.0","overriddenServerStatus":null,"defaultInstanceEphemeral":true,"checksum":null}`))
+		case "/nacos/v1/ns/operator/metrics":
+			w.Write([]byte(`{"status":"` + s.status + `","serviceCount":3,"load":0.5,"mem":0.8,"responsibleServiceCount":2,"instanceCount":7,"cpu":0.1,"responsibleInstanceCount":4}`))
+		case "/nacos/v1/ns/operator/servers":
+			w.Write([]byte(s.servers))
+		case "/nacos/v1/ns/raft/leader":
+			w.Write([]byte(`{"leader":"{\"heartbeatDueMs\":2500,\"ip\":\"10.0.0.1:8848\",\"leaderDueMs\":12853,\"state\":\"LEADER\",\"term\":5,\"voteFor\":\"10.0.0.1:8848\"}"}`))
+		}
+	}))
+	u, _ := url.Parse(s.srv.URL)
+	s.ns = newOfflineNamingClient(c)
+	s.ns.c.config.Scheme = "http"
+	s.ns.c.config.Hosts = []string{u.Host}
+	s.ns.c.config.ContextPath = "/nacos"
+	s.ns.c.config.HttpClient = DefaultPooledClient()
+}
+
+func (s *OperatorSuite) TearDownTest(c *C) {
+	s.ns.c.cancel()
+	s.srv.Close()
+}
+
+func (s *OperatorSuite) TestSwitches(c *C) {
+	switches, err := s.ns.Operator().Switches(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(switches.ClientBeatInterval, Equals, int64(5000))
+	c.Assert(switches.DistroThreshold, Equals, 0.7)
+	c.Assert(switches.LightBeatEnabled, Equals, true)
+
+	err = s.ns.Operator().UpdateSwitch(context.Background(), "pushEnabled", "false", true)
+	c.Assert(err, IsNil)
+	c.Assert(s.method, Equals, PUT)
+	c.Assert(s.query.Get("entry"), Equals, "pushEnabled")
+	c.Assert(s.query.Get("value"), Equals, "false")
+	c.Assert(s.query.Get("debug"), Equals, "true")
+}
+
+func (s *OperatorSuite) TestMetrics(c *C) {
+	metrics, err := s.ns.Operator().Metrics(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(*metrics, DeepEquals, ServerMetrics{
+		Status:                   "UP",
+		ServiceCount:             3,
+		InstanceCount:            7,
+		ResponsibleServiceCount:  2,
+		ResponsibleInstanceCount: 4,
+		CPU:                      0.1,
+		Load:                     0.5,
+		Mem:                      0.8,
+	})
+}
+
+func (s *OperatorSuite) TestServers(c *C) {
+	servers, err := s.ns.Operator().Servers(context.Background(), true)
+	c.Assert(err, IsNil)
+	c.Assert(s.query.Get("healthy"), Equals, "true")
+	c.Assert(servers, HasLen, 2)
+	c.Assert(servers[0].Up(), Equals, true)
+	c.Assert(servers[0].ExtendInfo["raftPort"], Equals, "7848")
+	c.Assert(servers[0].ExtendInfo["lastRefreshTime"], Equals, "1600000000000")
+	c.Assert(servers[1].Up(), Equals, false)
+
+	// servers before 1.3
+	s.servers = `{"servers":[{"ip":"10.0.0.3","servePort":8848,"site":"unknown","weight":1,"adWeight":0,"alive":true,"lastRefTime":1600000000000}]}`
+	servers, err = s.ns.Operator().Servers(context.Background(), false)
+	c.Assert(err, IsNil)
+	c.Assert(servers[0].Address, Equals, "10.0.0.3:8848")
+	c.Assert(servers[0].Up(), Equals, true)
+}
+
+func (s *OperatorSuite) TestLeader(c *C) {
+	leader, err := s.ns.Operator().Leader(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(*leader, DeepEquals, RaftPeer{IP: "10.0.0.1:8848", VoteFor: "10.0.0.1:8848", Term: 5, State: "LEADER"})
+}
+
+func (s *OperatorSuite) TestGetServerStatus(c *C) {
+	config := s.ns.c.Config()
+	c.Assert(config.GetServerStatus(), Equals, ServerStatusUp)
+
+	s.servers = `{"servers":[{"ip":"10.0.0.2","port":8848,"state":"DOWN"}]}`
+	c.Assert(config.GetServerStatus(), Equals, ServerStatusDown)
+
+	s.servers = `{"servers":[]}`
+	s.status = "DOWN"
+	c.Assert(config.GetServerStatus(), Equals, ServerStatusDown)
+
+	s.srv.Close()
+	c.Assert(config.GetServerStatus(), Equals, ServerStatusDown)
+}
+
+func (s *OperatorSuite) TestGetServerStatusTimeout(c *C) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+	u, _ := url.Parse(srv.URL)
+	s.ns.c.config.Hosts = []string{u.Host}
+
+	defer func(d time.Duration) { serverStatusTimeout = d }(serverStatusTimeout)
+	serverStatusTimeout = 100 * time.Millisecond
+	start := time.Now()
+	c.Assert(s.ns.c.Config().GetServerStatus(), Equals, ServerStatusDown)
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+}
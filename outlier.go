@@ -0,0 +1,358 @@
+package nacos
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	OutlierEjected  = "ejected"
+	OutlierReturned = "returned"
+
+	defaultOutlierConsecutiveErrors  = 5
+	defaultOutlierErrorRate          = 0.5
+	defaultOutlierMinRequests        = 10
+	defaultOutlierInterval           = 10 * time.Second
+	defaultOutlierBaseEjectionTime   = 30 * time.Second
+	defaultOutlierMaxEjectionTime    = 300 * time.Second
+	defaultOutlierMaxEjectionPercent = 10
+)
+
+// OutlierConfig configures the ejection of the instances reported failing
+// from SelectHealthyInstances
+type OutlierConfig struct {
+	// ConsecutiveErrors ejects an instance after that many failures in a
+	// row, 5 if zero; negative disables it
+	ConsecutiveErrors int
+	// ErrorRate ejects an instance whose share of failures over Interval
+	// reaches it, 0.5 if zero; negative disables it
+	ErrorRate float64
+	// MinRequests is the number of requests over Interval the error rate
+	// needs, 10 if zero
+	MinRequests int
+	// Interval is the window of the error rate, and the time without
+	// ejection after which the ejection time of an instance is halved back;
+	// 10s if zero
+	Interval time.Duration
+	// BaseEjectionTime is the time of a first ejection, doubled on each
+	// ejection following it; 30s if zero
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime caps the ejection time, 300s if zero
+	MaxEjectionTime time.Duration
+	// MaxEjectionPercent caps the share of the instances of a service
+	// ejected at once, one can always be; 10 if zero
+	MaxEjectionPercent int
+}
+
+func (c OutlierConfig) withDefaults() OutlierConfig {
+	if c.ConsecutiveErrors == 0 {
+		c.ConsecutiveErrors = defaultOutlierConsecutiveErrors
+	}
+	if c.ErrorRate == 0 {
+		c.ErrorRate = defaultOutlierErrorRate
+	}
+	if c.MinRequests == 0 {
+		c.MinRequests = defaultOutlierMinRequests
+	}
+	if c.Interval == 0 {
+		c.Interval = defaultOutlierInterval
+	}
+	if c.BaseEjectionTime == 0 {
+		c.BaseEjectionTime = defaultOutlierBaseEjectionTime
+	}
+	if c.MaxEjectionTime == 0 {
+		c.MaxEjectionTime = defaultOutlierMaxEjectionTime
+	}
+	if c.MaxEjectionPercent == 0 {
+		c.MaxEjectionPercent = defaultOutlierMaxEjectionPercent
+	}
+	return c
+}
+
+// OutlierEvent reports an instance ejected or returned
+type OutlierEvent struct {
+	// Type is OutlierEjected or OutlierReturned
+	Type string
+	// ServiceName is the grouped service name, GROUP@@name
+	ServiceName string
+	IP          string
+	Port        int
+	// Reason is why the instance is ejected, for OutlierEjected
+	Reason string
+	// Ejections is the number of ejections the ejection time is based on
+	Ejections int
+	// Until is the end of the ejection, for OutlierEjected
+	Until time.Time
+}
+
+// outlier is the state of an instance reported
+type outlier struct {
+	serviceName string
+	cluster     string
+	ip          string
+	port        int
+	reported    time.Time
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+	ejected     bool
+	ejections   int
+	returned    time.Time
+	timer       *time.Timer
+}
+
+// outlierDetector ejects the instances callers report failing, for a time
+// doubling on each ejection, as long as no more than MaxEjectionPercent of
+// the instances of the service are ejected
+type outlierDetector struct {
+	sync.Mutex
+	ns       *namingClient
+	config   OutlierConfig
+	outliers map[string]*outlier
+	// hosts is the number of available instances of each cluster of the
+	// services selected
+	hosts     map[string]map[string]int
+	swept     time.Time
+	listeners []OutlierListener
+	stopped   bool
+}
+
+func newOutlierDetector(ns *namingClient) *outlierDetector {
+	return &outlierDetector{
+		ns:       ns,
+		config:   ns.c.config.Outlier.withDefaults(),
+		outliers: make(map[string]*outlier),
+		hosts:    make(map[string]map[string]int),
+	}
+}
+
+func (d *outlierDetector) addListener(listener OutlierListener) {
+	d.Lock()
+	defer d.Unlock()
+	d.listeners = append(d.listeners, listener)
+}
+
+// report records the outcome of a request to instance
+func (d *outlierDetector) report(groupedServiceName string, instance *Instance, err error) {
+	d.Lock()
+	now := time.Now()
+	if now.Sub(d.swept) >= d.config.Interval {
+		d.sweepLocked(now)
+	}
+	key := buildKey(groupedServiceName, instance.IP, instance.Port)
+	o, ok := d.outliers[key]
+	if !ok {
+		o = &outlier{serviceName: groupedServiceName, cluster: instance.ClusterName, ip: instance.IP, port: instance.Port}
+		d.outliers[key] = o
+	}
+	o.reported = now
+	if d.stopped || o.ejected {
+		d.Unlock()
+		return
+	}
+	if now.Sub(o.windowStart) >= d.config.Interval {
+		o.requests, o.failures, o.windowStart = 0, 0, now
+	}
+	o.requests++
+	if err != nil {
+		o.failures++
+		o.consecutive++
+	} else {
+		o.consecutive = 0
+	}
+
+	var reason string
+	switch rate := float64(o.failures) / float64(o.requests); {
+	case d.config.ConsecutiveErrors > 0 && o.consecutive >= d.config.ConsecutiveErrors:
+		reason = fmt.Sprintf("%d consecutive errors", o.consecutive)
+	case d.config.ErrorRate > 0 && o.requests >= d.config.MinRequests && rate >= d.config.ErrorRate:
+		reason = fmt.Sprintf("error rate %.0f%% over %d requests", rate*100, o.requests)
+	}
+	if reason == "" || !d.canEject(groupedServiceName) {
+		d.Unlock()
+		return
+	}
+	event := d.eject(key, o, now, reason)
+	d.Unlock()
+	d.notify(event)
+}
+
+// canEject reports whether another instance of the service can be ejected
+func (d *outlierDetector) canEject(groupedServiceName string) bool {
+	total, ejected := 0, 0
+	for _, o := range d.outliers {
+		if o.serviceName == groupedServiceName {
+			total++
+			if o.ejected {
+				ejected++
+			}
+		}
+	}
+	hosts := 0
+	for _, n := range d.hosts[groupedServiceName] {
+		hosts += n
+	}
+	if hosts > total {
+		total = hosts
+	}
+	max := total * d.config.MaxEjectionPercent / 100
+	if max < 1 {
+		max = 1
+	}
+	return ejected < max
+}
+
+func (d *outlierDetector) eject(key string, o *outlier, now time.Time, reason string) OutlierEvent {
+	if !o.returned.IsZero() {
+		for quiet := now.Sub(o.returned); quiet >= d.config.Interval && o.ejections > 0; quiet -= d.config.Interval {
+			o.ejections--
+		}
+	}
+	o.ejections++
+	ejectionTime := d.config.BaseEjectionTime
+	for i := 1; i < o.ejections && ejectionTime < d.config.MaxEjectionTime; i++ {
+		ejectionTime *= 2
+	}
+	if ejectionTime > d.config.MaxEjectionTime {
+		ejectionTime = d.config.MaxEjectionTime
+	}
+	o.ejected = true
+	o.consecutive, o.requests, o.failures = 0, 0, 0
+	o.timer = time.AfterFunc(ejectionTime, func() { d.restore(key) })
+	return OutlierEvent{
+		Type:        OutlierEjected,
+		ServiceName: o.serviceName,
+		IP:          o.ip,
+		Port:        o.port,
+		Reason:      reason,
+		Ejections:   o.ejections,
+		Until:       now.Add(ejectionTime),
+	}
+}
+
+// restore returns the instance once its ejection time is over
+func (d *outlierDetector) restore(key string) {
+	d.Lock()
+	o, ok := d.outliers[key]
+	if !ok || !o.ejected || d.stopped {
+		d.Unlock()
+		return
+	}
+	o.ejected = false
+	o.timer = nil
+	o.returned = time.Now()
+	o.windowStart = o.returned
+	o.reported = o.returned
+	event := OutlierEvent{
+		Type:        OutlierReturned,
+		ServiceName: o.serviceName,
+		IP:          o.ip,
+		Port:        o.port,
+		Ejections:   o.ejections,
+	}
+	d.Unlock()
+	d.notify(event)
+}
+
+// filter returns the available instances which are not ejected, or all of
+// them if every one is; the state of the instances of the clusters selected
+// no longer in all, the instances of those clusters whatever their health,
+// is dropped
+func (d *outlierDetector) filter(groupedServiceName string, clusters []string, all, instances []*Instance) []*Instance {
+	d.Lock()
+	defer d.Unlock()
+	selected := make(map[string]bool, len(clusters))
+	for _, cluster := range clusters {
+		selected[cluster] = true
+	}
+	for _, instance := range all {
+		selected[instance.ClusterName] = true
+	}
+	hosts, ok := d.hosts[groupedServiceName]
+	if !ok {
+		hosts = make(map[string]int)
+		d.hosts[groupedServiceName] = hosts
+	}
+	for cluster := range selected {
+		delete(hosts, cluster)
+	}
+	for _, instance := range instances {
+		hosts[instance.ClusterName]++
+	}
+	d.pruneLocked(groupedServiceName, selected, all)
+	available := make([]*Instance, 0, len(instances))
+	for _, instance := range instances {
+		if o, ok := d.outliers[buildKey(groupedServiceName, instance.IP, instance.Port)]; !ok || !o.ejected {
+			available = append(available, instance)
+		}
+	}
+	if len(available) == 0 {
+		return instances
+	}
+	return available
+}
+
+// pruneLocked drops the state of the instances of the clusters selected
+// which left them
+func (d *outlierDetector) pruneLocked(groupedServiceName string, selected map[string]bool, all []*Instance) {
+	present := make(map[string]bool, len(all))
+	for _, instance := range all {
+		present[buildKey(groupedServiceName, instance.IP, instance.Port)] = true
+	}
+	for key, o := range d.outliers {
+		if o.serviceName != groupedServiceName || !selected[o.cluster] || present[key] {
+			continue
+		}
+		if o.timer != nil {
+			o.timer.Stop()
+		}
+		delete(d.outliers, key)
+	}
+}
+
+// sweepLocked drops the state of the instances not ejected which were not
+// reported for MaxEjectionTime, those of services never selected included
+func (d *outlierDetector) sweepLocked(now time.Time) {
+	d.swept = now
+	for key, o := range d.outliers {
+		if !o.ejected && now.Sub(o.reported) >= d.config.MaxEjectionTime {
+			delete(d.outliers, key)
+		}
+	}
+}
+
+func (d *outlierDetector) stop() {
+	d.Lock()
+	defer d.Unlock()
+	d.stopped = true
+	for _, o := range d.outliers {
+		if o.timer != nil {
+			o.timer.Stop()
+		}
+	}
+}
+
+func (d *outlierDetector) notify(event OutlierEvent) {
+	d.Lock()
+	listeners := append([]OutlierListener(nil), d.listeners...)
+	d.Unlock()
+	if event.Type == OutlierEjected {
+		d.ns.c.logger.Warn("eject %s %s:%d until %s, %s", event.ServiceName, event.IP, event.Port, event.Until.Format(time.RFC3339), event.Reason)
+	} else {
+		d.ns.c.logger.Info("return %s %s:%d", event.ServiceName, event.IP, event.Port)
+	}
+	for _, listener := range listeners {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					d.ns.c.logger.Error("outlier listener panicked, %v", p)
+				}
+			}()
+			listener.OnOutlier(event)
+		}()
+	}
+}
+
+var _ OutlierReporter = new(namingClient)
@@ -0,0 +1,223 @@
+package nacos
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type OutlierSuite struct {
+	ns     *namingClient
+	events chan OutlierEvent
+}
+
+var _ = Suite(&OutlierSuite{})
+
+type outlierFunc func(event OutlierEvent)
+
+func (f outlierFunc) OnOutlier(event OutlierEvent) { f(event) }
+
+func (s *OutlierSuite) SetUpTest(c *C) {
+	s.ns = newOfflineNamingClient(c)
+	s.events = make(chan OutlierEvent, 16)
+}
+
+func (s *OutlierSuite) TearDownTest(c *C) {
+	s.ns.outliers.stop()
+	s.ns.c.cancel()
+}
+
+func (s *OutlierSuite) detect(config OutlierConfig) *outlierDetector {
+	s.ns.c.config.Outlier = config
+	s.ns.outliers = newOutlierDetector(s.ns)
+	s.ns.AddOutlierListener(outlierFunc(func(event OutlierEvent) { s.events <- event }))
+	return s.ns.outliers
+}
+
+func (s *OutlierSuite) next(c *C) OutlierEvent {
+	select {
+	case event := <-s.events:
+		return event
+	case <-time.After(3 * time.Second):
+		c.Fatal("no outlier event")
+	}
+	return OutlierEvent{}
+}
+
+func (s *OutlierSuite) noEvent(c *C) {
+	select {
+	case event := <-s.events:
+		c.Fatalf("unexpected outlier event %+v", event)
+	default:
+	}
+}
+
+func outlierHosts(ips ...string) []*Instance {
+	instances := make([]*Instance, len(ips))
+	for i, ip := range ips {
+		instances[i] = &Instance{IP: ip, Port: 80, Weight: 1, Healthy: true, Enable: true}
+	}
+	return instances
+}
+
+func (s *OutlierSuite) TestConsecutiveErrors(c *C) {
+	d := s.detect(OutlierConfig{ConsecutiveErrors: 3, BaseEjectionTime: 50 * time.Millisecond, MaxEjectionPercent: 50})
+	instances := outlierHosts("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4")
+	c.Assert(d.filter("g@@svc", nil, instances, instances), HasLen, 4)
+
+	failure := errors.New("refused")
+	s.ns.Report("g@@svc", instances[0], failure)
+	s.ns.Report("g@@svc", instances[0], failure)
+	s.ns.Report("g@@svc", instances[0], nil)
+	s.ns.Report("g@@svc", instances[0], failure)
+	s.ns.Report("g@@svc", instances[0], failure)
+	s.noEvent(c)
+	start := time.Now()
+	s.ns.Report("g@@svc", instances[0], failure)
+
+	event := s.next(c)
+	c.Assert(event.Type, Equals, OutlierEjected)
+	c.Assert(event.ServiceName, Equals, "g@@svc")
+	c.Assert(event.IP, Equals, "10.0.0.1")
+	c.Assert(event.Reason, Equals, "3 consecutive errors")
+	c.Assert(event.Ejections, Equals, 1)
+	c.Assert(d.filter("g@@svc", nil, instances, instances), DeepEquals, instances[1:])
+
+	event = s.next(c)
+	c.Assert(event.Type, Equals, OutlierReturned)
+	c.Assert(time.Since(start) >= 50*time.Millisecond, Equals, true)
+	c.Assert(d.filter("g@@svc", nil, instances, instances), HasLen, 4)
+
+	for i := 0; i < 3; i++ {
+		s.ns.Report("g@@svc", instances[0], failure)
+	}
+	event = s.next(c)
+	c.Assert(event.Ejections, Equals, 2)
+	c.Assert(event.Until.Sub(time.Now()) > 60*time.Millisecond, Equals, true)
+}
+
+func (s *OutlierSuite) TestErrorRate(c *C) {
+	s.detect(OutlierConfig{ConsecutiveErrors: -1, ErrorRate: 0.5, MinRequests: 4})
+	instance := outlierHosts("10.0.0.1")[0]
+	failure := errors.New("status 503")
+	for i := 0; i < 3; i++ {
+		s.ns.Report("g@@svc", instance, failure)
+		s.ns.Report("g@@svc", instance, nil)
+		if i == 0 {
+			s.noEvent(c)
+		}
+	}
+	event := s.next(c)
+	c.Assert(event.Type, Equals, OutlierEjected)
+	c.Assert(event.Reason, Equals, "error rate 50% over 4 requests")
+	c.Assert(event.Until.Sub(time.Now()) > 29*time.Second, Equals, true)
+}
+
+func (s *OutlierSuite) TestMaxEjectionPercent(c *C) {
+	d := s.detect(OutlierConfig{ConsecutiveErrors: 1})
+	instances := outlierHosts("10.0.0.1", "10.0.0.2")
+	d.filter("g@@svc", nil, instances, instances)
+	s.ns.Report("g@@svc", instances[0], errors.New("refused"))
+	c.Assert(s.next(c).IP, Equals, "10.0.0.1")
+	s.ns.Report("g@@svc", instances[1], errors.New("refused"))
+	s.ns.Report("g@@svc", instances[1], errors.New("refused"))
+	s.noEvent(c)
+	s.ns.Report("g@@other", instances[1], errors.New("refused"))
+	c.Assert(s.next(c).ServiceName, Equals, "g@@other")
+
+	c.Assert(d.filter("g@@other", nil, instances[1:], instances[1:]), HasLen, 1)
+}
+
+func (s *OutlierSuite) TestDropInstancesLeft(c *C) {
+	d := s.detect(OutlierConfig{ConsecutiveErrors: 1, BaseEjectionTime: 50 * time.Millisecond, MaxEjectionPercent: 50})
+	instances := outlierHosts("10.0.0.1", "10.0.0.2")
+	d.filter("g@@svc", nil, instances, instances)
+	s.ns.Report("g@@svc", instances[0], errors.New("refused"))
+	c.Assert(s.next(c).Type, Equals, OutlierEjected)
+	s.ns.Report("g@@other", instances[0], nil)
+
+	// an unhealthy instance is still in the service
+	c.Assert(d.filter("g@@svc", nil, instances, instances[1:]), HasLen, 1)
+	c.Assert(d.outliers, HasLen, 2)
+
+	c.Assert(d.filter("g@@svc", nil, instances[1:], instances[1:]), HasLen, 1)
+	c.Assert(d.outliers, HasLen, 1)
+	_, ok := d.outliers[buildKey("g@@other", "10.0.0.1", 80)]
+	c.Assert(ok, Equals, true)
+	// the ejection timer is stopped with the instance dropped
+	time.Sleep(100 * time.Millisecond)
+	s.noEvent(c)
+
+	c.Assert(d.filter("g@@svc", nil, instances, instances), HasLen, 2)
+}
+
+func (s *OutlierSuite) TestClustersSelectedApart(c *C) {
+	d := s.detect(OutlierConfig{ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+	a := outlierHosts("10.0.0.1", "10.0.0.2")
+	b := outlierHosts("10.0.1.1", "10.0.1.2")
+	for _, instance := range a {
+		instance.ClusterName = "a"
+	}
+	for _, instance := range b {
+		instance.ClusterName = "b"
+	}
+	d.filter("g@@svc", []string{"a"}, a, a)
+	d.filter("g@@svc", []string{"b"}, b, b)
+
+	// two of the four instances of the service can be ejected
+	s.ns.Report("g@@svc", a[0], errors.New("refused"))
+	c.Assert(s.next(c).IP, Equals, "10.0.0.1")
+	d.filter("g@@svc", []string{"a"}, a, a)
+	s.ns.Report("g@@svc", b[0], errors.New("refused"))
+	c.Assert(s.next(c).IP, Equals, "10.0.1.1")
+
+	// selecting a drops only the instances which left a
+	c.Assert(d.filter("g@@svc", []string{"a"}, a[1:], a[1:]), HasLen, 1)
+	c.Assert(d.outliers, HasLen, 1)
+	c.Assert(d.filter("g@@svc", []string{"b"}, b, b), DeepEquals, b[1:])
+
+	// a cluster selected without instances drops all of its own
+	d.filter("g@@svc", []string{"b"}, nil, nil)
+	c.Assert(d.outliers, HasLen, 0)
+}
+
+func (s *OutlierSuite) TestSweepIdle(c *C) {
+	d := s.detect(OutlierConfig{ConsecutiveErrors: 3, Interval: 10 * time.Millisecond, MaxEjectionTime: 50 * time.Millisecond})
+	instances := outlierHosts("10.0.0.1", "10.0.0.2")
+	// the service is never selected
+	s.ns.Report("g@@svc", instances[0], errors.New("refused"))
+	time.Sleep(60 * time.Millisecond)
+	s.ns.Report("g@@svc", instances[1], errors.New("refused"))
+	c.Assert(d.outliers, HasLen, 1)
+	_, ok := d.outliers[buildKey("g@@svc", "10.0.0.2", 80)]
+	c.Assert(ok, Equals, true)
+	s.noEvent(c)
+}
+
+func (s *OutlierSuite) TestSelectOneHealthyInstance(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"DEFAULT_GROUP@@svc","clusters":"DEFAULT","hosts":[` +
+			`{"ip":"10.0.0.1","port":80,"weight":1,"healthy":true,"enabled":true},` +
+			`{"ip":"10.0.0.2","port":80,"weight":1,"healthy":true,"enabled":true}]}`))
+	}))
+	defer srv.Close()
+	s.ns.c.config.Scheme = "http"
+	s.ns.c.config.Hosts = []string{strings.TrimPrefix(srv.URL, "http://")}
+	s.ns.c.config.ContextPath = "/nacos"
+	s.ns.c.config.HttpClient = DefaultPooledClient()
+	s.detect(OutlierConfig{ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+
+	instance, err := s.ns.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	s.ns.Report("DEFAULT_GROUP@@svc", instance, errors.New("refused"))
+	s.next(c)
+	for i := 0; i < 20; i++ {
+		picked, err := s.ns.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+		c.Assert(err, IsNil)
+		c.Assert(picked.IP, Not(Equals), instance.IP)
+	}
+}
@@ -22,13 +22,17 @@ import (
 	"math/rand"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 )
 
 type pushReceiver struct {
-	port int
-	host string
-	ns   *namingClient
+	sync.Mutex
+	port   int
+	host   string
+	ns     *namingClient
+	conn   *net.UDPConn
+	closed bool
 }
 
 type pushData struct {
@@ -45,7 +49,7 @@ func newPushRecevier(ns *namingClient) *pushReceiver {
 	pr := pushReceiver{
 		ns: ns,
 	}
-	go pr.startServer()
+	pr.startServer()
 	return &pr
 }
 
@@ -85,16 +89,44 @@ func (us *pushReceiver) startServer() {
 		}
 	}
 
-	defer conn.Close()
-	for {
-		us.handleClient(conn)
+	if conn == nil {
+		return
 	}
+	us.conn = conn
+	go func() {
+		for !us.isClosed() {
+			us.handleClient(conn)
+		}
+	}()
+}
+
+func (us *pushReceiver) isClosed() bool {
+	us.Lock()
+	defer us.Unlock()
+	return us.closed
+}
+
+// close stops the UDP server
+func (us *pushReceiver) close() error {
+	us.Lock()
+	defer us.Unlock()
+	if us.closed {
+		return nil
+	}
+	us.closed = true
+	if us.conn != nil {
+		return us.conn.Close()
+	}
+	return nil
 }
 
 func (us *pushReceiver) handleClient(conn *net.UDPConn) {
 	data := make([]byte, 4024)
 	n, remoteAddr, err := conn.ReadFromUDP(data)
 	if err != nil {
+		if us.isClosed() {
+			return
+		}
 		us.ns.c.logger.Error("failed to read UDP msg because of %+v", err)
 		return
 	}
@@ -120,7 +152,7 @@ func (us *pushReceiver) handleClient(conn *net.UDPConn) {
 	} else if pushData.PushType == "dump" {
 		ack["type"] = "dump-ack"
 		ack["lastRefTime"] = strconv.FormatInt(pushData.LastRefTime, 10)
-		ack["data"] = encode(us.ns.serviceInfoMap)
+		ack["data"] = encode(us.ns.serviceInfoHolder.Snapshot())
 	} else {
 		ack["type"] = "unknow-ack"
 		ack["lastRefTime"] = strconv.FormatInt(pushData.LastRefTime, 10)
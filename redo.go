@@ -0,0 +1,249 @@
+package nacos
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	RedoRegister  = "register"
+	RedoSubscribe = "subscribe"
+
+	defaultRedoInterval = 30 * time.Second
+)
+
+// RedoEvent reports a registration or a subscription lost by the server
+// being applied again
+type RedoEvent struct {
+	// Type is RedoRegister or RedoSubscribe
+	Type string
+	// ServiceName is the grouped service name, GROUP@@name
+	ServiceName string
+	// Instance is the instance registered again, for RedoRegister
+	Instance *Instance
+	// Clusters are the clusters subscribed again, for RedoSubscribe
+	Clusters string
+	// Err is set if applying it again failed, it is retried next round
+	Err error
+}
+
+// RedoStats describes the redo of the naming client
+type RedoStats struct {
+	// Instances and Subscriptions are the number recorded
+	Instances     int
+	Subscriptions int
+	Rounds        int64
+	Reregistered  int64
+	Resubscribed  int64
+	Failed        int64
+	LastRound     time.Time
+	LastError     string
+}
+
+// redo records the ephemeral instances registered and the services subscribed
+// through the naming client, and reconciles them against the server every
+// interval: instances missing from their service are registered again, and
+// subscriptions the transport no longer holds are made again. Instances
+// registered again by the heartbeat or after a reconnect are reported
+// through it as well.
+type redo struct {
+	sync.Mutex
+	ns            *namingClient
+	interval      time.Duration
+	instances     map[string]*Instance
+	subscriptions map[string]subscription
+	listeners     []RedoListener
+	stats         RedoStats
+	stopped       bool
+}
+
+func newRedo(ns *namingClient) *redo {
+	r := &redo{
+		ns:            ns,
+		interval:      ns.c.config.RedoInterval,
+		instances:     make(map[string]*Instance),
+		subscriptions: make(map[string]subscription),
+	}
+	if r.interval == 0 {
+		r.interval = defaultRedoInterval
+	}
+	if r.interval > 0 {
+		go r.run(ns.c.ctx)
+	}
+	return r
+}
+
+func instanceKey(instance *Instance) string {
+	return buildKey(instance.GroupName+serviceInfoSpliter+instance.ServiceName, instance.IP, instance.Port)
+}
+
+func (r *redo) register(instance *Instance) {
+	if !instance.Ephemeral {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.instances[instanceKey(instance)] = instance.clone()
+}
+
+func (r *redo) deregister(instance *Instance) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.instances, instanceKey(instance))
+}
+
+// update changes the recorded instance, if any, by fn
+func (r *redo) update(groupedServiceName, ip string, port int, fn func(*Instance)) {
+	r.Lock()
+	defer r.Unlock()
+	if instance, ok := r.instances[buildKey(groupedServiceName, ip, port)]; ok {
+		fn(instance)
+	}
+}
+
+func (r *redo) subscribe(groupedServiceName, clusters string) {
+	r.Lock()
+	defer r.Unlock()
+	r.subscriptions[getServiceInfoKey(groupedServiceName, clusters)] = subscription{groupedServiceName, clusters}
+}
+
+func (r *redo) unsubscribe(groupedServiceName, clusters string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.subscriptions, getServiceInfoKey(groupedServiceName, clusters))
+}
+
+func (r *redo) addListener(listener RedoListener) {
+	r.Lock()
+	defer r.Unlock()
+	r.listeners = append(r.listeners, listener)
+}
+
+// stop ends reconciliation, it is called before the instances are
+// deregistered on shutdown
+func (r *redo) stop() {
+	r.Lock()
+	defer r.Unlock()
+	r.stopped = true
+}
+
+func (r *redo) redoStats() RedoStats {
+	r.Lock()
+	defer r.Unlock()
+	stats := r.stats
+	stats.Instances = len(r.instances)
+	stats.Subscriptions = len(r.subscriptions)
+	return stats
+}
+
+func (r *redo) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconcile(ctx)
+		}
+	}
+}
+
+// reconcile runs one round, the services of the recorded instances are
+// queried and the instances missing are registered again
+func (r *redo) reconcile(ctx context.Context) {
+	r.Lock()
+	if r.stopped {
+		r.Unlock()
+		return
+	}
+	services := make(map[string][]*Instance)
+	for _, instance := range r.instances {
+		grouped := instance.GroupName + serviceInfoSpliter + instance.ServiceName
+		services[grouped] = append(services[grouped], instance.clone())
+	}
+	subscriptions := make([]subscription, 0, len(r.subscriptions))
+	for _, sub := range r.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	r.stats.Rounds++
+	r.stats.LastRound = time.Now()
+	r.Unlock()
+
+	for grouped, instances := range services {
+		if ctx.Err() != nil {
+			return
+		}
+		serviceInfo, err := r.ns.transport.queryInstances(grouped, "", false)
+		if err != nil {
+			r.ns.c.logger.Warn("failed to reconcile instances of %s, %v", grouped, err)
+			r.failed(err)
+			continue
+		}
+		for _, instance := range instances {
+			if containsInstance(serviceInfo.Hosts, instance) || !r.recorded(instance) {
+				continue
+			}
+			_, err := r.ns.transport.registerInstance(instance)
+			r.recovered(RedoEvent{Type: RedoRegister, ServiceName: grouped, Instance: instance, Err: err})
+		}
+	}
+	for _, sub := range subscriptions {
+		if ctx.Err() != nil {
+			return
+		}
+		if r.ns.transport.isSubscribed(sub.groupedServiceName, sub.clusters) {
+			continue
+		}
+		_, err := r.ns.transport.subscribe(sub.groupedServiceName, sub.clusters)
+		r.recovered(RedoEvent{Type: RedoSubscribe, ServiceName: sub.groupedServiceName, Clusters: sub.clusters, Err: err})
+	}
+}
+
+// recorded tells whether the instance is still to be registered, it may have
+// been deregistered while the round was running
+func (r *redo) recorded(instance *Instance) bool {
+	r.Lock()
+	defer r.Unlock()
+	_, ok := r.instances[instanceKey(instance)]
+	return ok && !r.stopped
+}
+
+func (r *redo) failed(err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.stats.Failed++
+	r.stats.LastError = err.Error()
+}
+
+// recovered counts and dispatches an event, listeners are called in order
+func (r *redo) recovered(event RedoEvent) {
+	r.Lock()
+	switch {
+	case event.Err != nil:
+		r.stats.Failed++
+		r.stats.LastError = event.Err.Error()
+	case event.Type == RedoRegister:
+		r.stats.Reregistered++
+	default:
+		r.stats.Resubscribed++
+	}
+	listeners := append([]RedoListener(nil), r.listeners...)
+	r.Unlock()
+	if event.Err != nil {
+		r.ns.c.logger.Error("failed to %s %s again, %v", event.Type, event.ServiceName, event.Err)
+	} else {
+		r.ns.c.logger.Info("%s %s again", event.Type, event.ServiceName)
+	}
+	for _, listener := range listeners {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					r.ns.c.logger.Error("redo listener panicked, %v", p)
+				}
+			}()
+			listener.OnRedo(event)
+		}()
+	}
+}
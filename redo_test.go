@@ -0,0 +1,160 @@
+package nacos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+type redoFunc func(RedoEvent)
+
+func (f redoFunc) OnRedo(event RedoEvent) {
+	f(event)
+}
+
+type RedoSuite struct {
+	sync.Mutex
+	srv       *httptest.Server
+	ns        *namingClient
+	instances map[string]url.Values
+	failList  bool
+}
+
+var _ = Suite(&RedoSuite{})
+
+func (s *RedoSuite) SetUpTest(c *C) {
+	s.instances = make(map[string]url.Values)
+	s.failList = false
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.Lock()
+		defer s.Unlock()
+		key := r.Form.Get("ip") + ":" + r.Form.Get("port")
+		switch {
+		case r.URL.Path == "/nacos/v1/ns/instance" && r.Method == POST:
+			s.instances[key] = r.Form
+			w.Write([]byte("ok"))
+		case r.URL.Path == "/nacos/v1/ns/instance" && r.Method == DELETE:
+			delete(s.instances, key)
+			w.Write([]byte("ok"))
+		case r.URL.Path == "/nacos/v1/ns/instance/list":
+			if s.failList {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("server is starting"))
+				return
+			}
+			var hosts []map[string]interface{}
+			for _, form := range s.instances {
+				port, _ := strconv.Atoi(form.Get("port"))
+				hosts = append(hosts, map[string]interface{}{"ip": form.Get("ip"), "port": port, "clusterName": form.Get("clusterName")})
+			}
+			w.Write([]byte(encode(map[string]interface{}{"name": r.Form.Get("serviceName"), "clusters": r.Form.Get("clusters"), "hosts": hosts})))
+		case r.URL.Path == "/nacos/v1/ns/instance/beat":
+			w.Write([]byte(`{"code":10200,"clientBeatInterval":60000}`))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	u, _ := url.Parse(s.srv.URL)
+	s.ns = newOfflineNamingClient(c)
+	s.ns.c.config.Scheme = "http"
+	s.ns.c.config.Hosts = []string{u.Host}
+	s.ns.c.config.ContextPath = "/nacos"
+	s.ns.c.config.HttpClient = DefaultPooledClient()
+}
+
+func (s *RedoSuite) TearDownTest(c *C) {
+	s.ns.c.cancel()
+	s.srv.Close()
+}
+
+// lose drops every instance, as a restarted server would
+func (s *RedoSuite) lose() {
+	s.Lock()
+	defer s.Unlock()
+	s.instances = make(map[string]url.Values)
+}
+
+func (s *RedoSuite) TestReconcileRegistersLostInstances(c *C) {
+	var events []RedoEvent
+	s.ns.AddRedoListener(redoFunc(func(event RedoEvent) { events = append(events, event) }))
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		_, err := s.ns.RegisterInstance(NewInstance("svc", "", "", ip, 80, 1, true, true, nil))
+		c.Assert(err, IsNil)
+	}
+	_, err := s.ns.RegisterInstance(NewInstance("db", "", "", "10.0.0.3", 80, 1, true, false, nil))
+	c.Assert(err, IsNil)
+	_, err = s.ns.DeRegisterInstance("svc", "", "", "10.0.0.2", 80, true)
+	c.Assert(err, IsNil)
+	_, err = s.ns.PatchInstanceMetadata(InstanceKey{ServiceName: "svc", IP: "10.0.0.1", Port: 80, Ephemeral: true}, map[string]string{"version": "2"}, nil)
+	c.Assert(err, IsNil)
+
+	// nothing is lost yet
+	s.ns.redo.reconcile(context.Background())
+	c.Assert(events, HasLen, 0)
+
+	s.lose()
+	s.ns.redo.reconcile(context.Background())
+	c.Assert(events, HasLen, 1)
+	c.Assert(events[0].Type, Equals, RedoRegister)
+	c.Assert(events[0].ServiceName, Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(events[0].Instance.IP, Equals, "10.0.0.1")
+	c.Assert(events[0].Err, IsNil)
+	s.Lock()
+	c.Assert(s.instances, HasLen, 1)
+	c.Assert(strings.TrimSpace(s.instances["10.0.0.1:80"].Get("metadata")), Equals, `{"version":"2"}`)
+	s.Unlock()
+
+	stats := s.ns.RedoStats()
+	c.Assert(stats.Instances, Equals, 1)
+	c.Assert(stats.Rounds, Equals, int64(2))
+	c.Assert(stats.Reregistered, Equals, int64(1))
+	c.Assert(stats.Failed, Equals, int64(0))
+	c.Assert(s.ns.BeatStats(), HasLen, 1)
+}
+
+func (s *RedoSuite) TestReconcileFailure(c *C) {
+	_, err := s.ns.RegisterInstance(NewInstance("svc", "", "", "10.0.0.1", 80, 1, true, true, nil))
+	c.Assert(err, IsNil)
+	s.lose()
+	s.Lock()
+	s.failList = true
+	s.Unlock()
+	s.ns.redo.reconcile(context.Background())
+	stats := s.ns.RedoStats()
+	c.Assert(stats.Failed, Equals, int64(1))
+	c.Assert(stats.LastError, Matches, ".*server is starting.*")
+	c.Assert(stats.Reregistered, Equals, int64(0))
+
+	s.ns.redo.stop()
+	s.Lock()
+	s.failList = false
+	s.Unlock()
+	s.ns.redo.reconcile(context.Background())
+	c.Assert(s.ns.RedoStats().Rounds, Equals, int64(1))
+}
+
+func (s *RedoSuite) TestReconcileSubscribes(c *C) {
+	var events []RedoEvent
+	s.ns.AddRedoListener(redoFunc(func(event RedoEvent) { events = append(events, event) }))
+	listener := &funcListener{func(*ServiceInfo) {}}
+	s.ns.Subscribe("svc", "", nil, listener)
+	c.Assert(s.ns.RedoStats().Subscriptions, Equals, 1)
+
+	s.ns.updater.remove("DEFAULT_GROUP@@svc", "")
+	s.ns.redo.reconcile(context.Background())
+	c.Assert(events, HasLen, 1)
+	c.Assert(events[0].Type, Equals, RedoSubscribe)
+	c.Assert(events[0].ServiceName, Equals, "DEFAULT_GROUP@@svc")
+	c.Assert(s.ns.updater.scheduled("DEFAULT_GROUP@@svc", ""), Equals, true)
+	c.Assert(s.ns.RedoStats().Resubscribed, Equals, int64(1))
+
+	s.ns.Unsubscribe("svc", "", nil, listener)
+	c.Assert(s.ns.RedoStats().Subscriptions, Equals, 0)
+}
@@ -0,0 +1,186 @@
+// Package resolver resolves gRPC targets of the nacos scheme to the
+// instances of a Nacos service:
+//
+//	nacos://group/service?clusters=a,b&healthy=true
+//
+// The group defaults to DEFAULT_GROUP when empty, as in nacos:///service.
+// The service is subscribed through a NamingClient and every change is
+// pushed to the gRPC client. The weight and metadata of an instance are set
+// as balancer attributes of its address, see Weight and Metadata.
+//
+// The addresses are balanced by the gRPC client: the zone preference and
+// the outlier ejection of the naming client, which apply to each selection
+// of SelectHealthyInstances, do not apply to them.
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"google.golang.org/grpc/attributes"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+// Scheme is the scheme of the targets resolved
+const Scheme = "nacos"
+
+type attributeKey string
+
+const (
+	weightKey   = attributeKey("nacos.weight")
+	metadataKey = attributeKey("nacos.metadata")
+)
+
+// metadata is the metadata of an instance as an attribute value, which must
+// be comparable
+type metadata map[string]string
+
+func (m metadata) Equal(o interface{}) bool {
+	other, ok := o.(metadata)
+	if !ok || len(m) != len(other) {
+		return false
+	}
+	for k, v := range m {
+		if ov, ok := other[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Weight returns the weight of the instance an address was resolved from
+func Weight(addr gresolver.Address) float64 {
+	w, _ := addr.BalancerAttributes.Value(weightKey).(float64)
+	return w
+}
+
+// Metadata returns the metadata of the instance an address was resolved from
+func Metadata(addr gresolver.Address) map[string]string {
+	m, _ := addr.BalancerAttributes.Value(metadataKey).(metadata)
+	return m
+}
+
+// Register registers a builder of the nacos scheme resolving through client,
+// it must be called at init time as gresolver.Register
+func Register(client nacos.NamingClient) {
+	gresolver.Register(NewBuilder(client))
+}
+
+// NewBuilder returns a builder of the nacos scheme resolving through client,
+// to be passed by grpc.WithResolvers
+func NewBuilder(client nacos.NamingClient) gresolver.Builder {
+	return &builder{client: client}
+}
+
+type builder struct {
+	client nacos.NamingClient
+}
+
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+// parseTarget returns the query of a target
+func parseTarget(u url.URL) (nacos.InstanceQueryOptions, error) {
+	q := nacos.InstanceQueryOptions{
+		GroupName:   u.Host,
+		ServiceName: strings.TrimPrefix(u.Path, "/"),
+		Subscribe:   true,
+	}
+	if q.ServiceName == "" || strings.Contains(q.ServiceName, "/") {
+		return q, fmt.Errorf("invalid nacos target %q, want nacos://group/service", u.String())
+	}
+	if q.GroupName == "" {
+		q.GroupName = nacos.DefaultGroup
+	}
+	params := u.Query()
+	if clusters := params.Get("clusters"); clusters != "" {
+		q.ClusterName = strings.Split(clusters, ",")
+	}
+	if healthy := params.Get("healthy"); healthy != "" {
+		var err error
+		if q.Healthy, err = strconv.ParseBool(healthy); err != nil {
+			return q, fmt.Errorf("invalid healthy %q of nacos target %q", healthy, u.String())
+		}
+	}
+	return q, nil
+}
+
+func (b *builder) Build(target gresolver.Target, cc gresolver.ClientConn, opts gresolver.BuildOptions) (gresolver.Resolver, error) {
+	q, err := parseTarget(target.URL)
+	if err != nil {
+		return nil, err
+	}
+	r := &nacosResolver{client: b.client, cc: cc, query: q}
+	b.client.Subscribe(q.ServiceName, q.GroupName, q.ClusterName, r)
+	// a service without instances yet is not dispatched by Subscribe
+	selected := q
+	if len(selected.ClusterName) == 0 {
+		// all clusters as subscribed, SelectInstance defaults to DEFAULT
+		selected.ClusterName = []string{""}
+	}
+	instances := b.client.SelectInstance(selected)
+	r.Lock()
+	if !r.updated {
+		r.updateLocked(instances)
+	}
+	r.Unlock()
+	return r, nil
+}
+
+// nacosResolver pushes the instances of a subscribed service to the gRPC
+// client
+type nacosResolver struct {
+	sync.Mutex
+	client  nacos.NamingClient
+	cc      gresolver.ClientConn
+	query   nacos.InstanceQueryOptions
+	updated bool
+	closed  bool
+}
+
+// OnEvent receives the service changes of the subscription
+func (r *nacosResolver) OnEvent(serviceInfo *nacos.ServiceInfo) {
+	r.Lock()
+	defer r.Unlock()
+	if !r.closed {
+		r.updateLocked(serviceInfo.Hosts)
+	}
+}
+
+func (r *nacosResolver) updateLocked(instances []*nacos.Instance) {
+	r.updated = true
+	var state gresolver.State
+	for _, instance := range instances {
+		if !instance.Enable || instance.Weight <= 0 || (r.query.Healthy && !instance.Healthy) {
+			continue
+		}
+		addr := gresolver.Address{
+			Addr: net.JoinHostPort(instance.IP, strconv.Itoa(instance.Port)),
+			BalancerAttributes: attributes.New(weightKey, instance.Weight).
+				WithValue(metadataKey, metadata(instance.Metadata.Map())),
+		}
+		state.Addresses = append(state.Addresses, addr)
+		state.Endpoints = append(state.Endpoints, gresolver.Endpoint{Addresses: []gresolver.Address{addr}})
+	}
+	if len(state.Addresses) == 0 {
+		r.cc.ReportError(fmt.Errorf("no instance available of %s@@%s", r.query.GroupName, r.query.ServiceName))
+		return
+	}
+	r.cc.UpdateState(state)
+}
+
+// ResolveNow does nothing, changes are pushed by the subscription
+func (r *nacosResolver) ResolveNow(gresolver.ResolveNowOptions) {}
+
+func (r *nacosResolver) Close() {
+	r.Lock()
+	r.closed = true
+	r.Unlock()
+	r.client.Unsubscribe(r.query.ServiceName, r.query.GroupName, r.query.ClusterName, r)
+}
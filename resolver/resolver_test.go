@@ -0,0 +1,170 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	nacos "github.com/litgh/nacos-go-sdk"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	gresolver "google.golang.org/grpc/resolver"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ResolverSuite struct{}
+
+var _ = Suite(&ResolverSuite{})
+
+// fakeNaming holds the instances of one service
+type fakeNaming struct {
+	nacos.NamingClient
+	sync.Mutex
+	instances []*nacos.Instance
+	listeners []nacos.EventListener
+	selected  []nacos.InstanceQueryOptions
+}
+
+func (f *fakeNaming) Subscribe(serviceName, groupName string, clusters []string, listener nacos.EventListener) {
+	f.Lock()
+	defer f.Unlock()
+	f.listeners = append(f.listeners, listener)
+}
+
+func (f *fakeNaming) Unsubscribe(serviceName, groupName string, clusters []string, listener nacos.EventListener) {
+	f.Lock()
+	defer f.Unlock()
+	for i, l := range f.listeners {
+		if l == listener {
+			f.listeners = append(f.listeners[:i], f.listeners[i+1:]...)
+			break
+		}
+	}
+}
+
+func (f *fakeNaming) SelectInstance(q nacos.InstanceQueryOptions) []*nacos.Instance {
+	f.Lock()
+	defer f.Unlock()
+	f.selected = append(f.selected, q)
+	return f.instances
+}
+
+func (f *fakeNaming) push(instances ...*nacos.Instance) {
+	f.Lock()
+	f.instances = instances
+	listeners := append([]nacos.EventListener(nil), f.listeners...)
+	f.Unlock()
+	for _, l := range listeners {
+		l.OnEvent(&nacos.ServiceInfo{Name: "DEFAULT_GROUP@@svc", Hosts: instances})
+	}
+}
+
+type fakeClientConn struct {
+	gresolver.ClientConn
+	states chan gresolver.State
+	errs   chan error
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{states: make(chan gresolver.State, 8), errs: make(chan error, 8)}
+}
+
+func (cc *fakeClientConn) UpdateState(state gresolver.State) error {
+	cc.states <- state
+	return nil
+}
+
+func (cc *fakeClientConn) ReportError(err error) {
+	cc.errs <- err
+}
+
+func instance(ip string, weight float64, healthy, enable bool, metadata map[string]string) *nacos.Instance {
+	i := nacos.NewInstance("svc", nacos.DefaultGroup, nacos.DefaultCluster, ip, 80, weight, enable, true, nacos.NewMetadata(metadata))
+	i.Healthy = healthy
+	return i
+}
+
+func build(c *C, naming *fakeNaming, target string) (gresolver.Resolver, *fakeClientConn) {
+	u, err := url.Parse(target)
+	c.Assert(err, IsNil)
+	cc := newFakeClientConn()
+	r, err := NewBuilder(naming).Build(gresolver.Target{URL: *u}, cc, gresolver.BuildOptions{})
+	c.Assert(err, IsNil)
+	return r, cc
+}
+
+func (s *ResolverSuite) TestParseTarget(c *C) {
+	for target, want := range map[string]nacos.InstanceQueryOptions{
+		"nacos:///svc":                         {ServiceName: "svc", GroupName: nacos.DefaultGroup, Subscribe: true},
+		"nacos://g/svc?clusters=a,b&healthy=1": {ServiceName: "svc", GroupName: "g", ClusterName: []string{"a", "b"}, Healthy: true, Subscribe: true},
+	} {
+		u, _ := url.Parse(target)
+		q, err := parseTarget(*u)
+		c.Assert(err, IsNil)
+		c.Assert(q, DeepEquals, want)
+	}
+	for _, target := range []string{"nacos://g", "nacos://g/a/b", "nacos://g/svc?healthy=maybe"} {
+		u, _ := url.Parse(target)
+		_, err := parseTarget(*u)
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *ResolverSuite) TestResolve(c *C) {
+	naming := &fakeNaming{instances: []*nacos.Instance{
+		instance("10.0.0.1", 2, true, true, map[string]string{"zone": "a"}),
+		instance("10.0.0.2", 1, false, true, nil),
+		instance("10.0.0.3", 1, true, false, nil),
+	}}
+	r, cc := build(c, naming, "nacos:///svc?healthy=true")
+	c.Assert(naming.selected[0].ClusterName, DeepEquals, []string{""})
+
+	state := <-cc.states
+	c.Assert(state.Addresses, HasLen, 1)
+	c.Assert(state.Endpoints, HasLen, 1)
+	c.Assert(state.Addresses[0].Addr, Equals, "10.0.0.1:80")
+	c.Assert(Weight(state.Addresses[0]), Equals, 2.0)
+	c.Assert(Metadata(state.Addresses[0]), DeepEquals, map[string]string{"zone": "a"})
+
+	naming.push(instance("10.0.0.1", 2, true, true, nil), instance("10.0.0.2", 1, true, true, nil))
+	state = <-cc.states
+	c.Assert(state.Addresses, HasLen, 2)
+
+	naming.push()
+	c.Assert(<-cc.errs, ErrorMatches, "no instance available of DEFAULT_GROUP@@svc")
+
+	r.Close()
+	c.Assert(naming.listeners, HasLen, 0)
+}
+
+func (s *ResolverSuite) TestDial(c *C) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	port := lis.Addr().(*net.TCPAddr).Port
+	naming := &fakeNaming{instances: []*nacos.Instance{
+		nacos.NewInstance("svc", nacos.DefaultGroup, nacos.DefaultCluster, "127.0.0.1", port, 1, true, true, nil),
+	}}
+	conn, err := grpc.NewClient("nacos://DEFAULT_GROUP/svc",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(NewBuilder(naming)))
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Status, Equals, healthpb.HealthCheckResponse_SERVING)
+}
@@ -0,0 +1,165 @@
+package nacos
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultTransportRetries = 2
+
+// OutlierReporter receives the outcome of every request sent to an instance
+// by Transport, err is nil on success and set on a connection failure or a
+// 5xx response
+type OutlierReporter interface {
+	Report(groupedServiceName string, instance *Instance, err error)
+}
+
+// DefaultServiceHostSuffix marks the hosts Transport resolves when
+// Transport.Suffix is empty and Transport.NoSuffix is not set
+const DefaultServiceHostSuffix = ".nacos"
+
+// Transport is an http.RoundTripper sending the requests for
+// http://service.group.nacos/path to an instance of the Nacos service, picked
+// by the balancer among the instances SelectHealthyInstances returns. The
+// group is DEFAULT_GROUP when the host is service.nacos; hosts without the
+// suffix are sent by Base as they are. With NoSuffix set the hosts are
+// http://service.group/path instead.
+//
+// Idempotent requests are retried on another instance after a connection
+// failure, as long as their body can be read again.
+type Transport struct {
+	Naming NamingClient
+	// Base sends the requests, http.DefaultTransport if nil
+	Base http.RoundTripper
+	// Suffix ends the hosts naming a service, DefaultServiceHostSuffix if
+	// empty
+	Suffix string
+	// NoSuffix makes every host name a service, as service.group or
+	// service; only IP addresses and hosts with a port are sent by Base
+	NoSuffix bool
+	// Balancer picks the instance, weighted random if nil
+	Balancer Balancer
+	// Clusters restricts the instances to the given clusters
+	Clusters []string
+	// MaxRetries is the number of other instances an idempotent request is
+	// retried on, 2 if zero; negative disables retries
+	MaxRetries int
+	// Outlier is told the outcome of each request if set, such as the
+	// NamingClient for its outlier detection
+	Outlier OutlierReporter
+}
+
+var _ http.RoundTripper = new(Transport)
+
+// splitServiceHost returns the service and the group a host ending with
+// suffix names
+func splitServiceHost(host, suffix string) (string, string, bool) {
+	if len(host) <= len(suffix) || !strings.EqualFold(host[len(host)-len(suffix):], suffix) {
+		return "", "", false
+	}
+	host = host[:len(host)-len(suffix)]
+	if strings.Contains(host, ":") || net.ParseIP(host) != nil {
+		return "", "", false
+	}
+	if i := strings.LastIndex(host, "."); i >= 0 {
+		if i == 0 || i == len(host)-1 {
+			return "", "", false
+		}
+		return host[:i], host[i+1:], true
+	}
+	return host, DefaultGroup, true
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", GET, "HEAD", "OPTIONS", "TRACE", PUT, DELETE:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	suffix := t.Suffix
+	if suffix == "" && !t.NoSuffix {
+		suffix = DefaultServiceHostSuffix
+	}
+	serviceName, groupName, ok := splitServiceHost(req.URL.Host, suffix)
+	if !ok {
+		return base.RoundTrip(req)
+	}
+	balancer := t.Balancer
+	if balancer == nil {
+		balancer = NewWeightedRandomBalancer()
+	}
+	groupedServiceName := groupName + serviceInfoSpliter + serviceName
+	instances := t.Naming.SelectHealthyInstances(InstanceQueryOptions{
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		ClusterName: t.Clusters,
+		Subscribe:   true,
+	})
+
+	attempts := 1
+	if isIdempotent(req) {
+		retries := t.MaxRetries
+		if retries == 0 {
+			retries = defaultTransportRetries
+		}
+		if retries > 0 {
+			attempts += retries
+		}
+	}
+	var err error
+	for i := 0; i < attempts && len(instances) > 0; i++ {
+		instance := balancer.Pick(instances)
+		instances = without(instances, instance)
+
+		out := req.Clone(req.Context())
+		out.URL.Host = net.JoinHostPort(instance.IP, strconv.Itoa(instance.Port))
+		out.Host = ""
+		if i > 0 && req.GetBody != nil {
+			if out.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		var resp *http.Response
+		resp, err = base.RoundTrip(out)
+		if err == nil {
+			if t.Outlier != nil {
+				var failure error
+				if resp.StatusCode >= 500 {
+					failure = fmt.Errorf("status %d", resp.StatusCode)
+				}
+				t.Outlier.Report(groupedServiceName, instance, failure)
+			}
+			return resp, nil
+		}
+		if t.Outlier != nil {
+			t.Outlier.Report(groupedServiceName, instance, err)
+		}
+		if req.Context().Err() != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = ErrNoInstanceAvailable
+	}
+	return nil, fmt.Errorf("%s: %w", groupedServiceName, err)
+}
+
+func without(instances []*Instance, instance *Instance) []*Instance {
+	rest := make([]*Instance, 0, len(instances))
+	for _, i := range instances {
+		if i != instance {
+			rest = append(rest, i)
+		}
+	}
+	return rest
+}
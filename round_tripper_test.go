@@ -0,0 +1,315 @@
+package nacos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// stubNaming returns fixed instances from SelectHealthyInstances
+type stubNaming struct {
+	NamingClient
+	instances []*Instance
+	queries   []InstanceQueryOptions
+}
+
+func (n *stubNaming) SelectHealthyInstances(q InstanceQueryOptions) []*Instance {
+	n.queries = append(n.queries, q)
+	return healthyInstances(n.instances)
+}
+
+// firstBalancer picks the first instance, so retries go in order
+type firstBalancer struct{}
+
+func (firstBalancer) Pick(instances []*Instance) *Instance {
+	return instances[0]
+}
+
+type outlierReport struct {
+	service string
+	ip      string
+	port    int
+	err     error
+}
+
+type outlierRecorder struct {
+	sync.Mutex
+	reports []outlierReport
+}
+
+func (r *outlierRecorder) Report(groupedServiceName string, instance *Instance, err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.reports = append(r.reports, outlierReport{groupedServiceName, instance.IP, instance.Port, err})
+}
+
+func hostPort(c *C, rawURL string) (string, int) {
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(rawURL, "http://"))
+	c.Assert(err, IsNil)
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+type TransportSuite struct {
+	up      *httptest.Server
+	down    string
+	naming  *stubNaming
+	outlier *outlierRecorder
+	client  *http.Client
+}
+
+var _ = Suite(&TransportSuite{})
+
+func (s *TransportSuite) SetUpTest(c *C) {
+	s.up = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(r.Method + " " + r.Host + r.URL.Path + " " + string(body)))
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.down = lis.Addr().String()
+	lis.Close()
+
+	downIP, downPort := hostPort(c, s.down)
+	upIP, upPort := hostPort(c, s.up.URL)
+	s.naming = &stubNaming{instances: []*Instance{
+		NewInstance("svc", "", "", downIP, downPort, 1, true, true, nil),
+		NewInstance("svc", "", "", "10.0.0.9", 80, 0, true, true, nil),
+		NewInstance("svc", "", "", upIP, upPort, 1, true, true, nil),
+	}}
+	for _, instance := range s.naming.instances {
+		instance.Healthy = true
+	}
+	s.outlier = &outlierRecorder{}
+	s.client = &http.Client{Transport: &Transport{
+		Naming:   s.naming,
+		Balancer: firstBalancer{},
+		Clusters: []string{"a"},
+		Outlier:  s.outlier,
+	}}
+}
+
+func (s *TransportSuite) TearDownTest(c *C) {
+	s.up.Close()
+}
+
+func (s *TransportSuite) TestRetryIdempotentRequest(c *C) {
+	resp, err := s.client.Get("http://svc.g.nacos/hello")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Assert(string(body), Equals, "GET "+strings.TrimPrefix(s.up.URL, "http://")+"/hello ")
+
+	c.Assert(s.naming.queries, DeepEquals, []InstanceQueryOptions{{ServiceName: "svc", GroupName: "g", ClusterName: []string{"a"}, Subscribe: true}})
+	c.Assert(s.outlier.reports, HasLen, 2)
+	c.Assert(s.outlier.reports[0].service, Equals, "g@@svc")
+	c.Assert(s.outlier.reports[0].err, NotNil)
+	c.Assert(s.outlier.reports[1].err, IsNil)
+
+	resp, err = s.client.Post("http://svc.nacos/hello", "text/plain", strings.NewReader("x"))
+	c.Assert(err, ErrorMatches, ".*DEFAULT_GROUP@@svc: .*connection refused")
+	c.Assert(s.outlier.reports, HasLen, 3)
+
+	req, _ := http.NewRequest(PUT, "http://svc.nacos/hello", strings.NewReader("x"))
+	resp, err = s.client.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, _ = ioutil.ReadAll(resp.Body)
+	c.Assert(string(body), Matches, "PUT .*/hello x")
+}
+
+func (s *TransportSuite) TestReportServerError(c *C) {
+	s.naming.instances = s.naming.instances[2:]
+	resp, err := s.client.Get("http://svc.nacos/fail")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusServiceUnavailable)
+	c.Assert(s.outlier.reports, HasLen, 1)
+	c.Assert(s.outlier.reports[0].err, ErrorMatches, "status 503")
+}
+
+func (s *TransportSuite) TestNoInstance(c *C) {
+	s.naming.instances = nil
+	_, err := s.client.Get("http://svc.nacos/hello")
+	c.Assert(errors.Is(err, ErrNoInstanceAvailable), Equals, true)
+}
+
+func (s *TransportSuite) TestAddressNotResolved(c *C) {
+	resp, err := s.client.Get(s.up.URL + "/direct")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(s.naming.queries, HasLen, 0)
+}
+
+func (s *TransportSuite) TestHostWithoutSuffixGoesToBase(c *C) {
+	var hosts []string
+	s.client.Transport.(*Transport).Base = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	for _, rawURL := range []string{"http://example.com/", "http://localhost/", "http://svc/", "http://svc.nacos.example.com/"} {
+		resp, err := s.client.Get(rawURL)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+	}
+	c.Assert(hosts, DeepEquals, []string{"example.com", "localhost", "svc", "svc.nacos.example.com"})
+	c.Assert(s.naming.queries, HasLen, 0)
+
+	s.client.Transport.(*Transport).Suffix = ".svc.local"
+	resp, err := s.client.Get("http://svc.g.svc.local/")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(s.naming.queries, HasLen, 1)
+	c.Assert(s.naming.queries[0].GroupName, Equals, "g")
+}
+
+func (s *TransportSuite) TestNoSuffix(c *C) {
+	s.client.Transport.(*Transport).NoSuffix = true
+	resp, err := s.client.Get("http://svc.g/hello")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Assert(string(body), Equals, "GET "+strings.TrimPrefix(s.up.URL, "http://")+"/hello ")
+	c.Assert(s.naming.queries, HasLen, 1)
+	c.Assert(s.naming.queries[0].ServiceName, Equals, "svc")
+	c.Assert(s.naming.queries[0].GroupName, Equals, "g")
+
+	// addresses are not services
+	resp, err = s.client.Get(s.up.URL + "/direct")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, _ = ioutil.ReadAll(resp.Body)
+	c.Assert(string(body), Equals, "GET "+strings.TrimPrefix(s.up.URL, "http://")+"/direct ")
+	c.Assert(s.naming.queries, HasLen, 1)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (s *TransportSuite) TestSelectLikeSelectOneHealthyInstance(c *C) {
+	downIP, downPort := hostPort(c, s.down)
+	upIP, upPort := hostPort(c, s.up.URL)
+	hosts := fmt.Sprintf(`[{"ip":"10.0.0.9","port":80,"weight":1,"healthy":true,"enabled":true,"metadata":{"zone":"b"}},`+
+		`{"ip":"%s","port":%d,"weight":1,"healthy":true,"enabled":true,"metadata":{"zone":"a"}},`+
+		`{"ip":"%s","port":%d,"weight":1,"healthy":true,"enabled":true,"metadata":{"zone":"a"}}]`, downIP, downPort, upIP, upPort)
+	ns, stop := newPolledNamingClient(c, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"DEFAULT_GROUP@@svc","clusters":"DEFAULT","cacheMillis":10000,"hosts":` + hosts + `}`))
+	})
+	defer stop()
+	ns.c.config.Outlier = OutlierConfig{ConsecutiveErrors: 1, MaxEjectionPercent: 50}
+	ns.outliers = newOutlierDetector(ns)
+	defer ns.outliers.stop()
+	ns.c.config.Metadata = map[string]string{MetadataKeyZone: "a"}
+	ns.c.config.ZoneRouting = ZoneConfig{FailoverThreshold: 0.1}
+	ns.zones = newZoneRouter(ns)
+	client := &http.Client{Transport: &Transport{Naming: ns, Balancer: firstBalancer{}, MaxRetries: -1, Outlier: ns}}
+
+	// the instance of the other zone is never picked, the failing one is
+	// ejected after its first failure
+	_, err := client.Get("http://svc.nacos/hello")
+	c.Assert(err, ErrorMatches, ".*connection refused")
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("http://svc.nacos/hello")
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	}
+}
+
+type BalancerSuite struct{}
+
+var _ = Suite(&BalancerSuite{})
+
+func (s *BalancerSuite) TestWeightedRandom(c *C) {
+	instances := []*Instance{
+		{IP: "10.0.0.1", Weight: 1},
+		{IP: "10.0.0.2", Weight: 3},
+	}
+	picks := make(map[string]int)
+	b := NewWeightedRandomBalancer()
+	for i := 0; i < 4000; i++ {
+		picks[b.Pick(instances).IP]++
+	}
+	c.Assert(picks["10.0.0.1"] > 800 && picks["10.0.0.1"] < 1200, Equals, true, Commentf("%v", picks))
+}
+
+func (s *BalancerSuite) TestHealthyInstances(c *C) {
+	instances := []*Instance{
+		{IP: "10.0.0.1", Weight: 1, Healthy: true, Enable: true},
+		{IP: "10.0.0.2", Weight: 1, Healthy: false, Enable: true},
+		{IP: "10.0.0.3", Weight: 1, Healthy: true, Enable: false},
+		{IP: "10.0.0.4", Weight: 0, Healthy: true, Enable: true},
+	}
+	healthy := healthyInstances(instances)
+	c.Assert(healthy, HasLen, 1)
+	c.Assert(healthy[0].IP, Equals, "10.0.0.1")
+}
+
+func (s *BalancerSuite) TestSplitServiceHost(c *C) {
+	for host, want := range map[string][2]string{
+		"svc.nacos":          {"svc", DefaultGroup},
+		"svc.g.nacos":        {"svc", "g"},
+		"api.svc.prod.nacos": {"api.svc", "prod"},
+		"svc.g.NACOS":        {"svc", "g"},
+	} {
+		service, group, ok := splitServiceHost(host, DefaultServiceHostSuffix)
+		c.Assert(ok, Equals, true)
+		c.Assert([2]string{service, group}, Equals, want)
+	}
+	for _, host := range []string{"", "svc", "svc.g", "example.com", "localhost", "10.0.0.1", ".nacos", "svc.nacos:80", "svc.:80.nacos", ".g.nacos", "svc..nacos"} {
+		_, _, ok := splitServiceHost(host, DefaultServiceHostSuffix)
+		c.Assert(ok, Equals, false, Commentf(host))
+	}
+}
+
+func (s *BalancerSuite) TestSplitServiceHostWithoutSuffix(c *C) {
+	for host, want := range map[string][2]string{
+		"svc":          {"svc", DefaultGroup},
+		"svc.g":        {"svc", "g"},
+		"api.svc.prod": {"api.svc", "prod"},
+	} {
+		service, group, ok := splitServiceHost(host, "")
+		c.Assert(ok, Equals, true)
+		c.Assert([2]string{service, group}, Equals, want)
+	}
+	for _, host := range []string{"", "10.0.0.1", "::1", "svc:80", "svc.", ".g"} {
+		_, _, ok := splitServiceHost(host, "")
+		c.Assert(ok, Equals, false, Commentf(host))
+	}
+}
+
+func (s *BalancerSuite) TestSelectOneHealthyInstance(c *C) {
+	hosts := `[{"ip":"10.0.0.1","port":80,"weight":1,"healthy":false,"enabled":true},{"ip":"10.0.0.2","port":80,"weight":1,"healthy":true,"enabled":true}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"DEFAULT_GROUP@@svc","clusters":"DEFAULT","hosts":` + hosts + `}`))
+	}))
+	defer srv.Close()
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{strings.TrimPrefix(srv.URL, "http://")}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+
+	instance, err := ns.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, IsNil)
+	c.Assert(instance.IP, Equals, "10.0.0.2")
+
+	hosts = `[]`
+	_, err = ns.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc"})
+	c.Assert(err, Equals, ErrNoInstanceAvailable)
+}
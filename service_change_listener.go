@@ -9,80 +9,185 @@ type EventListener interface {
 	OnEvent(*ServiceInfo)
 }
 
+// serviceChangeListener dispatches service changes to subscribed listeners.
+//
+// Every listener gets its own subscriber with a single-slot queue: a change
+// that arrives while the previous one is still pending replaces it, so rapid
+// updates are coalesced and only the latest ServiceInfo is delivered. Each
+// subscriber is drained by its own goroutine, so a listener that blocks or
+// panics never delays the push receiver, the refresh loop or other listeners.
 type serviceChangeListener struct {
 	sync.Mutex
 	ctx         context.Context
 	stop        context.CancelFunc
-	ch          chan *ServiceInfo
-	observerMap map[string][]EventListener
+	logger      Logger
+	observerMap map[string][]*subscriber
+	running     sync.WaitGroup
 }
 
-func newServiceChangeListener() *serviceChangeListener {
-	ctx, cancel := context.WithCancel(context.Background())
+func newServiceChangeListener(ctx context.Context, logger Logger) *serviceChangeListener {
+	ctx, cancel := context.WithCancel(ctx)
 	return &serviceChangeListener{
 		ctx:         ctx,
 		stop:        cancel,
-		ch:          make(chan *ServiceInfo, 0),
-		observerMap: make(map[string][]EventListener),
+		logger:      logger,
+		observerMap: make(map[string][]*subscriber),
 	}
 }
 
-func (l *serviceChangeListener) addListener(serviceInfo *ServiceInfo, clusters string, listener EventListener) {
+// addListener registers listener for the service identified by
+// groupedServiceName and clusters. If serviceInfo already carries hosts it is
+// delivered to the new listener straight away.
+func (l *serviceChangeListener) addListener(groupedServiceName, clusters string, listener EventListener, serviceInfo *ServiceInfo) {
+	key := getServiceInfoKey(groupedServiceName, clusters)
+	s := newSubscriber(listener)
+
 	l.Lock()
-	defer l.Unlock()
-	key := getServiceInfoKey(serviceInfo.Name, clusters)
-	if v, ok := l.observerMap[key]; ok {
-		v = append(v, listener)
-	} else {
-		l.observerMap[key] = []EventListener{listener}
+	l.observerMap[key] = append(l.observerMap[key], s)
+	l.Unlock()
+
+	l.running.Add(1)
+	go func() {
+		defer l.running.Done()
+		s.run(l.ctx, l.logger)
+	}()
+	if serviceInfo != nil && len(serviceInfo.Hosts) > 0 {
+		s.offer(serviceInfo)
 	}
 }
 
-func (l *serviceChangeListener) removeListener(serviceName, clusters string, listener EventListener) {
+// removeListener unregisters listener and reports whether the service has no
+// listeners left.
+func (l *serviceChangeListener) removeListener(groupedServiceName, clusters string, listener EventListener) bool {
 	l.Lock()
 	defer l.Unlock()
-	key := getServiceInfoKey(serviceName, clusters)
-	if v, ok := l.observerMap[key]; ok {
-		for i, ol := range v {
-			if ol == listener {
-				v = append(v[:i], v[i+1:]...)
-			}
-		}
-		if len(v) == 0 {
-			delete(l.observerMap, key)
+	key := getServiceInfoKey(groupedServiceName, clusters)
+	v, ok := l.observerMap[key]
+	if !ok {
+		return true
+	}
+	remain := v[:0]
+	for _, s := range v {
+		if s.listener == listener {
+			s.close()
+			continue
 		}
+		remain = append(remain, s)
 	}
+	if len(remain) == 0 {
+		delete(l.observerMap, key)
+		return true
+	}
+	l.observerMap[key] = remain
+	return false
 }
 
-func (l *serviceChangeListener) isSubscribed(serviceName, clusters string) bool {
+func (l *serviceChangeListener) isSubscribed(groupedServiceName, clusters string) bool {
 	l.Lock()
 	defer l.Unlock()
-	_, ok := l.observerMap[getServiceInfoKey(serviceName, clusters)]
+	_, ok := l.observerMap[getServiceInfoKey(groupedServiceName, clusters)]
 	return ok
 }
 
+// serviceChange hands serviceInfo to every listener of the service. It never
+// blocks.
 func (l *serviceChangeListener) serviceChange(serviceInfo *ServiceInfo) {
 	if serviceInfo == nil {
 		return
 	}
-	l.ch <- serviceInfo
+	l.Lock()
+	defer l.Unlock()
+	for _, s := range l.observerMap[serviceInfo.GetKey()] {
+		s.offer(serviceInfo)
+	}
 }
 
 func (l *serviceChangeListener) shutdown() {
 	l.stop()
 }
 
-func (l *serviceChangeListener) observe() {
+// wait blocks until every listener callback in flight has returned or ctx is
+// done.
+func (l *serviceChangeListener) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type subscriber struct {
+	sync.Mutex
+	listener EventListener
+	pending  *ServiceInfo
+	// lastRefTime of the latest change offered
+	lastRefTime int64
+	notify      chan struct{}
+	done        chan struct{}
+	once        sync.Once
+}
+
+func newSubscriber(listener EventListener) *subscriber {
+	return &subscriber{
+		listener: listener,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// offer replaces the pending change with serviceInfo and wakes the subscriber.
+// A change older than the one offered last is dropped.
+func (s *subscriber) offer(serviceInfo *ServiceInfo) {
+	s.Lock()
+	if serviceInfo.LastRefTime < s.lastRefTime {
+		s.Unlock()
+		return
+	}
+	s.lastRefTime = serviceInfo.LastRefTime
+	s.pending = serviceInfo
+	s.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *subscriber) run(ctx context.Context, logger Logger) {
 	for {
 		select {
-		case <-l.ctx.Done():
+		case <-ctx.Done():
+			return
+		case <-s.done:
 			return
-		case s := <-l.ch:
-			if v, ok := l.observerMap[s.GetKey()]; ok {
-				for _, listener := range v {
-					listener.OnEvent(s)
-				}
+		case <-s.notify:
+			s.Lock()
+			serviceInfo := s.pending
+			s.pending = nil
+			s.Unlock()
+			if serviceInfo != nil {
+				s.dispatch(serviceInfo, logger)
 			}
 		}
 	}
 }
+
+func (s *subscriber) dispatch(serviceInfo *ServiceInfo, logger Logger) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("listener of %s panicked: %v", serviceInfo.GetKey(), r)
+		}
+	}()
+	s.listener.OnEvent(serviceInfo.clone())
+}
@@ -0,0 +1,109 @@
+package nacos
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ListenerSuite struct {
+	logger Logger
+}
+
+var _ = Suite(&ListenerSuite{})
+
+type funcListener struct {
+	fn func(*ServiceInfo)
+}
+
+func (l *funcListener) OnEvent(s *ServiceInfo) {
+	l.fn(s)
+}
+
+func (s *ListenerSuite) SetUpSuite(c *C) {
+	logger, err := NewLogger(c.MkDir()+"/nacos.log", LogError)
+	c.Assert(err, IsNil)
+	s.logger = logger
+}
+
+func (s *ListenerSuite) TestIsolation(c *C) {
+	l := newServiceChangeListener(context.Background(), s.logger)
+	defer l.shutdown()
+
+	block := make(chan struct{})
+	defer close(block)
+	received := make(chan *ServiceInfo, 1)
+
+	l.addListener("DEFAULT_GROUP@@svc", "", &funcListener{func(*ServiceInfo) { panic("boom") }}, nil)
+	l.addListener("DEFAULT_GROUP@@svc", "", &funcListener{func(*ServiceInfo) { <-block }}, nil)
+	l.addListener("DEFAULT_GROUP@@svc", "", &funcListener{func(si *ServiceInfo) { received <- si }}, nil)
+
+	serviceInfo := &ServiceInfo{Name: "DEFAULT_GROUP@@svc"}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			l.serviceChange(serviceInfo)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		c.Fatal("serviceChange blocked")
+	}
+	select {
+	case si := <-received:
+		c.Assert(si.Name, Equals, serviceInfo.Name)
+	case <-time.After(time.Second):
+		c.Fatal("healthy listener was not notified")
+	}
+}
+
+func (s *ListenerSuite) TestCoalesce(c *C) {
+	l := newServiceChangeListener(context.Background(), s.logger)
+	defer l.shutdown()
+
+	var calls int32
+	release := make(chan struct{})
+	last := make(chan *ServiceInfo, 10)
+	l.addListener("DEFAULT_GROUP@@svc", "a", &funcListener{func(si *ServiceInfo) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+		last <- si
+	}}, nil)
+
+	first := &ServiceInfo{Name: "DEFAULT_GROUP@@svc", Clusters: "a", LastRefTime: 1}
+	l.serviceChange(first)
+	time.Sleep(50 * time.Millisecond)
+	for i := int64(2); i <= 10; i++ {
+		l.serviceChange(&ServiceInfo{Name: "DEFAULT_GROUP@@svc", Clusters: "a", LastRefTime: i})
+	}
+	close(release)
+
+	c.Assert((<-last).LastRefTime, Equals, int64(1))
+	select {
+	case si := <-last:
+		c.Assert(si.LastRefTime, Equals, int64(10))
+	case <-time.After(time.Second):
+		c.Fatal("coalesced change was not delivered")
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(2))
+}
+
+func (s *ListenerSuite) TestRemoveListener(c *C) {
+	l := newServiceChangeListener(context.Background(), s.logger)
+	defer l.shutdown()
+
+	a := &funcListener{func(*ServiceInfo) {}}
+	b := &funcListener{func(*ServiceInfo) {}}
+	l.addListener("DEFAULT_GROUP@@svc", "", a, nil)
+	l.addListener("DEFAULT_GROUP@@svc", "", b, nil)
+	c.Assert(l.removeListener("DEFAULT_GROUP@@svc", "", a), Equals, false)
+	c.Assert(l.isSubscribed("DEFAULT_GROUP@@svc", ""), Equals, true)
+	c.Assert(l.removeListener("DEFAULT_GROUP@@svc", "", b), Equals, true)
+	c.Assert(l.isSubscribed("DEFAULT_GROUP@@svc", ""), Equals, false)
+}
@@ -0,0 +1,67 @@
+package nacos
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ServiceInfoHolder holds the ServiceInfo of every known service as an
+// immutable snapshot. Writers copy the snapshot, apply their change and swap
+// it in, so readers never take a lock and never see a half-updated host list.
+//
+// A ServiceInfo must not be modified once it has been stored in a holder.
+type ServiceInfoHolder struct {
+	mu       sync.Mutex
+	snapshot atomic.Value
+}
+
+// NewServiceInfoHolder returns an empty ServiceInfoHolder
+func NewServiceInfoHolder() *ServiceInfoHolder {
+	h := new(ServiceInfoHolder)
+	h.snapshot.Store(make(map[string]*ServiceInfo))
+	return h
+}
+
+func (h *ServiceInfoHolder) load() map[string]*ServiceInfo {
+	return h.snapshot.Load().(map[string]*ServiceInfo)
+}
+
+// Get returns the ServiceInfo stored under key
+func (h *ServiceInfoHolder) Get(key string) (*ServiceInfo, bool) {
+	serviceInfo, ok := h.load()[key]
+	return serviceInfo, ok
+}
+
+// Snapshot returns a consistent view of all services. The returned map is
+// shared and must be treated as read-only.
+func (h *ServiceInfoHolder) Snapshot() map[string]*ServiceInfo {
+	return h.load()
+}
+
+// Update stores serviceInfo under its key unless the stored entry has a newer
+// LastRefTime. It returns the entry held before the call and whether
+// serviceInfo was stored.
+func (h *ServiceInfoHolder) Update(serviceInfo *ServiceInfo) (*ServiceInfo, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := serviceInfo.GetKey()
+	old := h.load()
+	oldServiceInfo, ok := old[key]
+	if ok && oldServiceInfo.LastRefTime > serviceInfo.LastRefTime {
+		return oldServiceInfo, false
+	}
+	m := make(map[string]*ServiceInfo, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[key] = serviceInfo
+	h.snapshot.Store(m)
+	return oldServiceInfo, true
+}
+
+// replace swaps in m as the whole snapshot
+func (h *ServiceInfoHolder) replace(m map[string]*ServiceInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshot.Store(m)
+}
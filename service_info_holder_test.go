@@ -0,0 +1,167 @@
+package nacos
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ServiceInfoHolderSuite struct{}
+
+var _ = Suite(&ServiceInfoHolderSuite{})
+
+// serviceJSON renders a service whose three hosts all carry generation gen
+func serviceJSON(gen int64) string {
+	hosts := ""
+	for i := 1; i <= 3; i++ {
+		if i > 1 {
+			hosts += ","
+		}
+		hosts += fmt.Sprintf(`{"ip":"10.0.0.%d","port":8080,"weight":%d,"healthy":true,"enabled":true,"metadata":{"gen":"%d"}}`, i, gen, gen)
+	}
+	return fmt.Sprintf(`{"name":"DEFAULT_GROUP@@svc","clusters":"DEFAULT","cacheMillis":10,"lastRefTime":%d,"hosts":[%s]}`, gen, hosts)
+}
+
+func assertConsistent(c *C, hosts []*Instance) {
+	if len(hosts) == 0 {
+		return
+	}
+	c.Assert(hosts, HasLen, 3)
+	gen := hosts[0].Metadata.Get("gen")
+	for _, h := range hosts {
+		c.Assert(h.Metadata.Get("gen"), Equals, gen)
+		c.Assert(fmt.Sprintf("%d", int64(h.Weight)), Equals, gen)
+	}
+}
+
+func (s *ServiceInfoHolderSuite) TestUpdateOrdering(c *C) {
+	h := NewServiceInfoHolder()
+	old, ok := h.Update(&ServiceInfo{Name: "svc", LastRefTime: 2})
+	c.Assert(old, IsNil)
+	c.Assert(ok, Equals, true)
+	snapshot := h.Snapshot()
+
+	old, ok = h.Update(&ServiceInfo{Name: "svc", LastRefTime: 1})
+	c.Assert(ok, Equals, false)
+	c.Assert(old.LastRefTime, Equals, int64(2))
+
+	_, ok = h.Update(&ServiceInfo{Name: "svc", LastRefTime: 3})
+	c.Assert(ok, Equals, true)
+	c.Assert(snapshot["svc"].LastRefTime, Equals, int64(2))
+	serviceInfo, _ := h.Get("svc")
+	c.Assert(serviceInfo.LastRefTime, Equals, int64(3))
+}
+
+func (s *ServiceInfoHolderSuite) TestConcurrentPushPollSelect(c *C) {
+	var gen int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(serviceJSON(atomic.AddInt64(&gen, 1))))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+	ns.pushReceiver = &pushReceiver{ns: ns}
+
+	var events int64
+	ns.Subscribe("svc", DefaultGroup, []string{DefaultCluster}, &funcListener{func(si *ServiceInfo) {
+		atomic.AddInt64(&events, 1)
+		assertConsistent(c, si.Hosts)
+	}})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	run := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					fn()
+				}
+			}
+		}()
+	}
+	// push
+	run(func() {
+		ns.updateServiceMap(serviceJSON(atomic.AddInt64(&gen, 1)))
+	})
+	// poll
+	task := &updateTask{u: ns.updater, groupedServiceName: "DEFAULT_GROUP@@svc", clusters: DefaultCluster}
+	run(func() {
+		task.update()
+	})
+	// select, scribbling over the returned instances
+	for i := 0; i < 4; i++ {
+		run(func() {
+			hosts := ns.SelectInstance(InstanceQueryOptions{ServiceName: "svc", GroupName: DefaultGroup, Subscribe: true})
+			assertConsistent(c, hosts)
+			for _, h := range hosts {
+				h.Weight = -1
+				h.Metadata.Put("gen", "scribbled")
+			}
+		})
+	}
+	run(func() {
+		ns.failover.writeFile()
+		time.Sleep(time.Millisecond)
+	})
+
+	time.Sleep(500 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	c.Assert(atomic.LoadInt64(&events) > 0, Equals, true)
+}
+
+func (s *ServiceInfoHolderSuite) TestHostNamesSplit(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"g@@svc","clusters":"","cacheMillis":10000,"lastRefTime":1,"hosts":[{"ip":"10.0.0.1","port":8080,"serviceName":"g@@svc","weight":1,"healthy":true,"enabled":true}]}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+	ns.pushReceiver = &pushReceiver{ns: ns}
+
+	assertSplit := func(hosts []*Instance) {
+		c.Assert(hosts, HasLen, 1)
+		c.Assert(hosts[0].GroupName, Equals, "g")
+		c.Assert(hosts[0].ServiceName, Equals, "svc")
+	}
+	assertSplit(ns.SelectInstance(InstanceQueryOptions{ServiceName: "svc", GroupName: "g"}))
+
+	events := make(chan *ServiceInfo, 10)
+	ns.Subscribe("svc", "g", nil, &funcListener{func(si *ServiceInfo) { events <- si }})
+	select {
+	case si := <-events:
+		assertSplit(si.Hosts)
+	case <-time.After(time.Second):
+		c.Fatal("no event received")
+	}
+	assertSplit(ns.SelectInstance(InstanceQueryOptions{ServiceName: "svc", GroupName: "g", Subscribe: true}))
+	serviceInfo, ok := ns.serviceInfoHolder.Get("g@@svc")
+	c.Assert(ok, Equals, true)
+	assertSplit(serviceInfo.Hosts)
+	instance, err := ns.SelectOneHealthyInstance(InstanceQueryOptions{ServiceName: "svc", GroupName: "g", Subscribe: true})
+	c.Assert(err, IsNil)
+	assertSplit([]*Instance{instance})
+}
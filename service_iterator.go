@@ -0,0 +1,174 @@
+package nacos
+
+import (
+	"context"
+)
+
+const defaultServicePageSize = 100
+
+// ServiceIteratorOptions options
+type ServiceIteratorOptions struct {
+	GroupName string
+	// services per page, defaults to 100
+	PageSize int
+	// only list services matched by the selector
+	Selector *Selector
+	// fill the cluster and instance counts of each entry from the catalog
+	WithCounts bool
+}
+
+// ServiceIterator walks all pages of a service listing
+//
+//	it := naming.ServiceIterator(ctx, nacos.ServiceIteratorOptions{WithCounts: true})
+//	for it.Next() {
+//		entry := it.Service()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type ServiceIterator struct {
+	naming NamingClient
+	// selectServices lists a page, with the context when the naming client
+	// takes it
+	selectServices func(ctx context.Context, q ServiceQueryOptions) (*ServiceList, error)
+	ctx            context.Context
+	opts           ServiceIteratorOptions
+	page           []ServiceEntry
+	pageNo         int
+	seen           int
+	cur            ServiceEntry
+	err            error
+	done           bool
+}
+
+// ServiceIterator returns an iterator over every service of a group
+func (ns *namingClient) ServiceIterator(ctx context.Context, opts ServiceIteratorOptions) *ServiceIterator {
+	it := NewServiceIterator(ctx, ns, opts)
+	it.selectServices = ns.selectServices
+	return it
+}
+
+// NewServiceIterator returns an iterator over every service of a group
+// listed by SelectServices and the Catalog of naming, for implementations of
+// NamingClient other than the one of NewClient
+func NewServiceIterator(ctx context.Context, naming NamingClient, opts ServiceIteratorOptions) *ServiceIterator {
+	if opts.GroupName == "" {
+		opts.GroupName = DefaultGroup
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = defaultServicePageSize
+	}
+	return &ServiceIterator{
+		naming: naming,
+		selectServices: func(ctx context.Context, q ServiceQueryOptions) (*ServiceList, error) {
+			return naming.SelectServices(q)
+		},
+		ctx:  ctx,
+		opts: opts,
+	}
+}
+
+// SelectAllServices returns the names of every service of a group
+func (ns *namingClient) SelectAllServices(ctx context.Context, groupName string) ([]string, error) {
+	it := ns.ServiceIterator(ctx, ServiceIteratorOptions{GroupName: groupName})
+	var names []string
+	for it.Next() {
+		names = append(names, it.Service().Name)
+	}
+	return names, it.Err()
+}
+
+// Next advances to the next service, it returns false when the listing is
+// exhausted or an error occurred
+func (it *ServiceIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.cur = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Service returns the current service
+func (it *ServiceIterator) Service() ServiceEntry {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration
+func (it *ServiceIterator) Err() error {
+	return it.err
+}
+
+func (it *ServiceIterator) fetch() {
+	if it.err = it.ctx.Err(); it.err != nil {
+		return
+	}
+	it.pageNo++
+	var (
+		entries  []ServiceEntry
+		received int
+		total    int
+	)
+	if it.opts.WithCounts && it.opts.Selector == nil {
+		// the catalog carries the counts already, but matches the group
+		// as a substring
+		list, err := it.naming.Catalog().Services(it.ctx, CatalogQueryOptions{Page: it.pageNo, Size: it.opts.PageSize, GroupName: it.opts.GroupName})
+		if err != nil {
+			it.err = err
+			return
+		}
+		for _, e := range list.Services {
+			if e.GroupName == it.opts.GroupName {
+				entries = append(entries, e)
+			}
+		}
+		received, total = len(list.Services), list.Count
+	} else {
+		q := ServiceQueryOptions{Page: it.pageNo, Size: it.opts.PageSize, GroupName: it.opts.GroupName}
+		if it.opts.Selector != nil {
+			q.Selector = *it.opts.Selector
+		}
+		list, err := it.selectServices(it.ctx, q)
+		if err != nil {
+			it.err = err
+			return
+		}
+		for _, name := range list.Service {
+			entries = append(entries, ServiceEntry{Name: name, GroupName: it.opts.GroupName})
+		}
+		received, total = len(list.Service), list.Count
+		if it.opts.WithCounts {
+			for i := range entries {
+				if it.err = it.enrich(&entries[i]); it.err != nil {
+					return
+				}
+			}
+		}
+	}
+	it.seen += received
+	if received == 0 || it.seen >= total {
+		it.done = true
+	}
+	it.page = entries
+}
+
+// enrich looks the counts of e up in the catalog
+func (it *ServiceIterator) enrich(e *ServiceEntry) error {
+	for pageNo := 1; ; pageNo++ {
+		list, err := it.naming.Catalog().Services(it.ctx, CatalogQueryOptions{Page: pageNo, Size: it.opts.PageSize, ServiceName: e.Name, GroupName: e.GroupName})
+		if err != nil {
+			return err
+		}
+		for _, c := range list.Services {
+			if c.Name == e.Name && c.GroupName == e.GroupName {
+				*e = c
+				return nil
+			}
+		}
+		if len(list.Services) == 0 || pageNo*it.opts.PageSize >= list.Count {
+			return nil
+		}
+	}
+}
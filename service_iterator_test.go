@@ -0,0 +1,119 @@
+package nacos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ServiceIteratorSuite struct {
+	srv       *httptest.Server
+	ns        *namingClient
+	services  []string
+	selectors []string
+}
+
+var _ = Suite(&ServiceIteratorSuite{})
+
+func (s *ServiceIteratorSuite) SetUpTest(c *C) {
+	s.services = nil
+	s.selectors = nil
+	for i := 0; i < 25; i++ {
+		s.services = append(s.services, fmt.Sprintf("svc-%02d", i))
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		pageNo, _ := strconv.Atoi(q.Get("pageNo"))
+		pageSize, _ := strconv.Atoi(q.Get("pageSize"))
+		switch r.URL.Path {
+		case "/nacos/v1/ns/service/list":
+			s.selectors = append(s.selectors, q.Get("selector"))
+			fmt.Fprintf(w, `{"count":%d,"doms":%s}`, len(s.services), encode(pageOf(s.services, pageNo, pageSize)))
+		case "/nacos/v1/ns/catalog/services":
+			var matched []string
+			for _, name := range s.services {
+				if strings.Contains(name, q.Get("serviceNameParam")) {
+					matched = append(matched, name)
+				}
+			}
+			var list []ServiceEntry
+			for _, name := range pageOf(matched, pageNo, pageSize) {
+				list = append(list, ServiceEntry{Name: name, GroupName: DefaultGroup, ClusterCount: 1, IPCount: 3, HealthyInstanceCount: 2})
+			}
+			// a service of a group containing the requested one
+			list = append(list, ServiceEntry{Name: "other", GroupName: "X" + DefaultGroup})
+			fmt.Fprintf(w, `{"count":%d,"serviceList":%s}`, len(matched), encode(list))
+		}
+	}))
+	u, _ := url.Parse(s.srv.URL)
+	s.ns = newOfflineNamingClient(c)
+	s.ns.c.config.Scheme = "http"
+	s.ns.c.config.Hosts = []string{u.Host}
+	s.ns.c.config.ContextPath = "/nacos"
+	s.ns.c.config.HttpClient = DefaultPooledClient()
+}
+
+func pageOf(names []string, pageNo, pageSize int) []string {
+	from := (pageNo - 1) * pageSize
+	if from >= len(names) {
+		return []string{}
+	}
+	to := from + pageSize
+	if to > len(names) {
+		to = len(names)
+	}
+	return names[from:to]
+}
+
+func (s *ServiceIteratorSuite) TearDownTest(c *C) {
+	s.ns.c.cancel()
+	s.srv.Close()
+}
+
+func (s *ServiceIteratorSuite) TestSelectAllServices(c *C) {
+	names, err := s.ns.SelectAllServices(context.Background(), "")
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, s.services)
+}
+
+func (s *ServiceIteratorSuite) TestWithCounts(c *C) {
+	it := s.ns.ServiceIterator(context.Background(), ServiceIteratorOptions{PageSize: 10, WithCounts: true})
+	var entries []ServiceEntry
+	for it.Next() {
+		entries = append(entries, it.Service())
+	}
+	c.Assert(it.Err(), IsNil)
+	c.Assert(entries, HasLen, 25)
+	c.Assert(entries[24], DeepEquals, ServiceEntry{Name: "svc-24", GroupName: DefaultGroup, ClusterCount: 1, IPCount: 3, HealthyInstanceCount: 2})
+}
+
+func (s *ServiceIteratorSuite) TestSelector(c *C) {
+	it := s.ns.ServiceIterator(context.Background(), ServiceIteratorOptions{
+		PageSize:   10,
+		Selector:   &Selector{Type: SelectorTypeLabel, Expression: "CONSUMER.label.env = PROVIDER.label.env"},
+		WithCounts: true,
+	})
+	var entries []ServiceEntry
+	for it.Next() {
+		entries = append(entries, it.Service())
+	}
+	c.Assert(it.Err(), IsNil)
+	c.Assert(entries, HasLen, 25)
+	c.Assert(entries[3].IPCount, Equals, 3)
+	c.Assert(s.selectors, HasLen, 3)
+	c.Assert(s.selectors[0], Equals, `{"type":"label","expression":"CONSUMER.label.env = PROVIDER.label.env"}`)
+}
+
+func (s *ServiceIteratorSuite) TestCanceled(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it := s.ns.ServiceIterator(ctx, ServiceIteratorOptions{})
+	c.Assert(it.Next(), Equals, false)
+	c.Assert(it.Err(), Equals, context.Canceled)
+}
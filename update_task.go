@@ -0,0 +1,163 @@
+package nacos
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultUpdateDelay = time.Second
+	maxUpdateDelay     = time.Minute
+	maxUpdateFailCount = 6
+	// updateTaskIdle is how long a service nobody listens to keeps being
+	// polled after its last lookup
+	updateTaskIdle = 5 * time.Minute
+)
+
+// updater keeps subscribed services fresh by polling the server, mirroring
+// the UpdateTask of the Java client. UDP pushes remain the fast path, polling
+// only catches what a lost push would otherwise leave stale. A service without
+// listeners stops being polled once it has not been looked up for
+// updateTaskIdle, the next lookup queries it again.
+type updater struct {
+	sync.Mutex
+	ns    *namingClient
+	ctx   context.Context
+	tasks map[string]*updateTask
+}
+
+func newUpdater(ns *namingClient) *updater {
+	return &updater{
+		ns:    ns,
+		ctx:   ns.c.ctx,
+		tasks: make(map[string]*updateTask),
+	}
+}
+
+type updateTask struct {
+	u                  *updater
+	groupedServiceName string
+	clusters           string
+	lastRefTime        int64
+	failCount          uint
+	lastUsed           int64
+	stop               context.CancelFunc
+}
+
+// schedule starts polling the service unless it is polled already.
+func (u *updater) schedule(groupedServiceName, clusters string) {
+	key := getServiceInfoKey(groupedServiceName, clusters)
+	u.Lock()
+	defer u.Unlock()
+	if _, ok := u.tasks[key]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(u.ctx)
+	t := &updateTask{
+		u:                  u,
+		groupedServiceName: groupedServiceName,
+		clusters:           clusters,
+		lastUsed:           time.Now().UnixNano(),
+		stop:               cancel,
+	}
+	u.tasks[key] = t
+	go t.run(ctx)
+}
+
+// scheduled reports whether the service is polled, and keeps its task from
+// expiring as it is asked on every lookup.
+func (u *updater) scheduled(groupedServiceName, clusters string) bool {
+	u.Lock()
+	defer u.Unlock()
+	t, ok := u.tasks[getServiceInfoKey(groupedServiceName, clusters)]
+	if ok {
+		atomic.StoreInt64(&t.lastUsed, time.Now().UnixNano())
+	}
+	return ok
+}
+
+func (u *updater) remove(groupedServiceName, clusters string) {
+	key := getServiceInfoKey(groupedServiceName, clusters)
+	u.Lock()
+	defer u.Unlock()
+	if t, ok := u.tasks[key]; ok {
+		t.stop()
+		delete(u.tasks, key)
+	}
+}
+
+func (t *updateTask) run(ctx context.Context) {
+	timer := time.NewTimer(defaultUpdateDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if t.idle() {
+				t.u.remove(t.groupedServiceName, t.clusters)
+				return
+			}
+			timer.Reset(t.update())
+		}
+	}
+}
+
+// idle reports whether nobody listens to the service nor looked it up lately
+func (t *updateTask) idle() bool {
+	if t.u.ns.listeners.isSubscribed(t.groupedServiceName, t.clusters) {
+		return false
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.lastUsed))) > updateTaskIdle
+}
+
+// update polls the service once and returns the delay until the next poll.
+func (t *updateTask) update() time.Duration {
+	ns := t.u.ns
+	if ns.failover.isFailoverSwitch() {
+		return defaultUpdateDelay
+	}
+	key := getServiceInfoKey(t.groupedServiceName, t.clusters)
+	serviceInfo, ok := ns.serviceInfoHolder.Get(key)
+	if !ok || serviceInfo.LastRefTime <= t.lastRefTime {
+		var err error
+		serviceInfo, err = ns.updateServiceInfoNow(NewServiceInfo(t.groupedServiceName, "", t.clusters))
+		if err != nil {
+			ns.c.logger.Error("failed to query %s: %v", key, err)
+		}
+	} else {
+		// a push arrived since the last poll, only renew the push target
+		// on the server so the pushed data is not overridden by a pull
+		if _, err := ns.queryList(t.groupedServiceName, t.clusters, ns.pushReceiver.port, false); err != nil {
+			serviceInfo = nil
+		}
+	}
+	// a service without instances is a valid answer, only a failed poll
+	// backs off
+	if serviceInfo == nil {
+		return t.backoff()
+	}
+	t.lastRefTime = serviceInfo.LastRefTime
+	t.failCount = 0
+	delay := time.Duration(serviceInfo.CacheMillis) * time.Millisecond
+	if delay <= 0 {
+		delay = defaultUpdateDelay
+	}
+	if delay > maxUpdateDelay {
+		delay = maxUpdateDelay
+	}
+	return delay
+}
+
+func (t *updateTask) backoff() time.Duration {
+	if t.failCount < maxUpdateFailCount {
+		t.failCount++
+	}
+	delay := defaultUpdateDelay << t.failCount
+	if delay > maxUpdateDelay {
+		delay = maxUpdateDelay
+	}
+	return delay
+}
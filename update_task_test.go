@@ -0,0 +1,124 @@
+package nacos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type UpdateTaskSuite struct{}
+
+var _ = Suite(&UpdateTaskSuite{})
+
+// newOfflineNamingClient returns a namingClient that is never connected to
+// a server, for tests that only exercise local state.
+func newOfflineNamingClient(c *C) *namingClient {
+	dir := c.MkDir()
+	logger, err := NewLogger(dir+"/nacos.log", LogError)
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cl := &client{
+		config: Config{CacheDir: dir, LogDir: dir},
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	ns := &namingClient{c: cl, serviceInfoHolder: NewServiceInfoHolder()}
+	ns.listeners = newServiceChangeListener(ctx, logger)
+	ns.updater = newUpdater(ns)
+	ns.failover = newFailover(ns)
+	ns.heartbeat = newHeartbeat(ns)
+	ns.redo = newRedo(ns)
+	ns.outliers = newOutlierDetector(ns)
+	ns.zones = newZoneRouter(ns)
+	ns.transport = newNamingTransport(ns)
+	return ns
+}
+
+func (s *UpdateTaskSuite) TestBackoff(c *C) {
+	t := &updateTask{}
+	c.Assert(t.backoff(), Equals, 2*time.Second)
+	c.Assert(t.backoff(), Equals, 4*time.Second)
+	for i := 0; i < 10; i++ {
+		t.backoff()
+	}
+	c.Assert(t.backoff(), Equals, maxUpdateDelay)
+}
+
+func (s *UpdateTaskSuite) TestOlderDataIgnored(c *C) {
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+
+	newer := ns.updateServiceMap(`{"name":"DEFAULT_GROUP@@svc","clusters":"","lastRefTime":200,"hosts":[{"ip":"10.0.0.1","port":80}]}`)
+	c.Assert(newer, NotNil)
+	older := ns.updateServiceMap(`{"name":"DEFAULT_GROUP@@svc","clusters":"","lastRefTime":100,"hosts":[{"ip":"10.0.0.2","port":80}]}`)
+	c.Assert(older, Equals, newer)
+	serviceInfo, _ := ns.serviceInfoHolder.Get("DEFAULT_GROUP@@svc")
+	c.Assert(serviceInfo.Hosts[0].IP, Equals, "10.0.0.1")
+}
+
+func newPolledNamingClient(c *C, handler http.HandlerFunc) (*namingClient, func()) {
+	srv := httptest.NewServer(handler)
+	u, _ := url.Parse(srv.URL)
+	ns := newOfflineNamingClient(c)
+	ns.c.config.Scheme = "http"
+	ns.c.config.Hosts = []string{u.Host}
+	ns.c.config.ContextPath = "/nacos"
+	ns.c.config.HttpClient = DefaultPooledClient()
+	return ns, func() {
+		ns.c.cancel()
+		srv.Close()
+	}
+}
+
+func (s *UpdateTaskSuite) TestEmptyServiceKeepsPolling(c *C) {
+	var polls int64
+	ns, stop := newPolledNamingClient(c, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&polls, 1)
+		fmt.Fprintf(w, `{"name":"DEFAULT_GROUP@@svc","clusters":"","cacheMillis":3000,"lastRefTime":%d,"hosts":[]}`, n)
+	})
+	defer stop()
+
+	t := &updateTask{u: ns.updater, groupedServiceName: "DEFAULT_GROUP@@svc"}
+	c.Assert(t.update(), Equals, 3*time.Second)
+	c.Assert(t.update(), Equals, 3*time.Second)
+	c.Assert(t.failCount, Equals, uint(0))
+	c.Assert(atomic.LoadInt64(&polls), Equals, int64(2))
+}
+
+func (s *UpdateTaskSuite) TestIdleTaskExpires(c *C) {
+	ns, stop := newPolledNamingClient(c, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"DEFAULT_GROUP@@svc","clusters":"","cacheMillis":1000,"hosts":[]}`))
+	})
+	defer stop()
+
+	ns.updater.schedule("DEFAULT_GROUP@@svc", "")
+	ns.updater.Lock()
+	t := ns.updater.tasks[getServiceInfoKey("DEFAULT_GROUP@@svc", "")]
+	ns.updater.Unlock()
+	c.Assert(t.idle(), Equals, false)
+
+	// a lookup keeps the task alive
+	atomic.StoreInt64(&t.lastUsed, time.Now().Add(-2*updateTaskIdle).UnixNano())
+	c.Assert(t.idle(), Equals, true)
+	c.Assert(ns.updater.scheduled("DEFAULT_GROUP@@svc", ""), Equals, true)
+	c.Assert(t.idle(), Equals, false)
+
+	// so does a listener
+	atomic.StoreInt64(&t.lastUsed, time.Now().Add(-2*updateTaskIdle).UnixNano())
+	listener := &funcListener{func(*ServiceInfo) {}}
+	ns.listeners.addListener("DEFAULT_GROUP@@svc", "", listener, nil)
+	c.Assert(t.idle(), Equals, false)
+
+	ns.listeners.removeListener("DEFAULT_GROUP@@svc", "", listener)
+	time.Sleep(defaultUpdateDelay + 200*time.Millisecond)
+	ns.updater.Lock()
+	c.Assert(ns.updater.tasks, HasLen, 0)
+	ns.updater.Unlock()
+}
@@ -0,0 +1,97 @@
+package nacos
+
+import (
+	"math/rand"
+	"os"
+)
+
+const (
+	// MetadataKeyZone holds the zone of an instance, and of the client in
+	// Config.Metadata
+	MetadataKeyZone = "zone"
+	// EnvZone is the environment variable holding the zone of the client
+	// when Config.Metadata has none
+	EnvZone = "NACOS_ZONE"
+
+	defaultZoneFailoverThreshold = 0.5
+)
+
+// ZoneConfig configures the preference of SelectHealthyInstances for the
+// instances in the zone of the client
+type ZoneConfig struct {
+	// Disabled selects among the instances of all zones
+	Disabled bool
+	// FailoverThreshold is the share of the weight of the instances of the
+	// zone which must be available, healthy and not ejected, for the
+	// selection to stay in the zone, 0.5 if zero
+	FailoverThreshold float64
+	// WeightByCapacity keeps, below the threshold, the share of the
+	// selections the zone has capacity for in the zone, the others going to
+	// the other zones; without it every available instance may be selected
+	WeightByCapacity bool
+}
+
+// zoneRouter narrows the instances available to those of the zone of the
+// client while it has enough of them
+type zoneRouter struct {
+	zone   string
+	config ZoneConfig
+}
+
+func newZoneRouter(ns *namingClient) *zoneRouter {
+	z := &zoneRouter{zone: ns.c.config.Metadata[MetadataKeyZone], config: ns.c.config.ZoneRouting}
+	if z.zone == "" {
+		z.zone = os.Getenv(EnvZone)
+	}
+	if z.config.FailoverThreshold == 0 {
+		z.config.FailoverThreshold = defaultZoneFailoverThreshold
+	}
+	if z.zone != "" && !z.config.Disabled {
+		ns.c.logger.Info("prefer instances in zone %s", z.zone)
+	}
+	return z
+}
+
+func instanceZone(instance *Instance) string {
+	if instance.Metadata == nil {
+		return ""
+	}
+	return instance.Metadata.Get(MetadataKeyZone)
+}
+
+// prefer returns the available instances to select from, all being the
+// instances of the service whatever their health
+func (z *zoneRouter) prefer(all, available []*Instance) []*Instance {
+	if z.zone == "" || z.config.Disabled {
+		return available
+	}
+	var total, capacity float64
+	for _, instance := range all {
+		if instance.Enable && instance.Weight > 0 && instanceZone(instance) == z.zone {
+			total += instance.Weight
+		}
+	}
+	local := make([]*Instance, 0, len(available))
+	others := make([]*Instance, 0, len(available))
+	for _, instance := range available {
+		if instanceZone(instance) == z.zone {
+			local = append(local, instance)
+			capacity += instance.Weight
+		} else {
+			others = append(others, instance)
+		}
+	}
+	if len(local) == 0 || len(others) == 0 {
+		return available
+	}
+	share := capacity / total
+	switch {
+	case share >= z.config.FailoverThreshold:
+		return local
+	case z.config.WeightByCapacity && rand.Float64() < share:
+		return local
+	case z.config.WeightByCapacity:
+		return others
+	}
+	return available
+}
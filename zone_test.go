@@ -0,0 +1,75 @@
+package nacos
+
+import (
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+type ZoneSuite struct{}
+
+var _ = Suite(&ZoneSuite{})
+
+func zoned(ip, zone string, healthy bool) *Instance {
+	return &Instance{IP: ip, Port: 80, Weight: 1, Healthy: healthy, Enable: true,
+		Metadata: NewMetadata(map[string]string{MetadataKeyZone: zone})}
+}
+
+func ips(instances []*Instance) []string {
+	var ips []string
+	for _, instance := range instances {
+		ips = append(ips, instance.IP)
+	}
+	return ips
+}
+
+func (s *ZoneSuite) TestClientZone(c *C) {
+	ns := newOfflineNamingClient(c)
+	defer ns.c.cancel()
+	c.Assert(newZoneRouter(ns).zone, Equals, "")
+
+	defer os.Unsetenv(EnvZone)
+	os.Setenv(EnvZone, "b")
+	c.Assert(newZoneRouter(ns).zone, Equals, "b")
+
+	ns.c.config.Metadata = map[string]string{MetadataKeyZone: "a"}
+	c.Assert(newZoneRouter(ns).zone, Equals, "a")
+}
+
+func (s *ZoneSuite) TestPrefer(c *C) {
+	z := &zoneRouter{zone: "a", config: ZoneConfig{FailoverThreshold: 0.5}}
+	all := []*Instance{
+		zoned("10.0.0.1", "a", true),
+		zoned("10.0.0.2", "a", true),
+		zoned("10.0.0.3", "a", true),
+		zoned("10.0.0.4", "a", true),
+		zoned("10.0.1.1", "b", true),
+		{IP: "10.0.2.1", Port: 80, Weight: 1, Healthy: true, Enable: true},
+	}
+	c.Assert(ips(z.prefer(all, healthyInstances(all))), DeepEquals, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"})
+
+	all[0].Healthy, all[1].Healthy = false, false
+	c.Assert(ips(z.prefer(all, healthyInstances(all))), DeepEquals, []string{"10.0.0.3", "10.0.0.4"})
+
+	all[2].Healthy = false
+	c.Assert(ips(z.prefer(all, healthyInstances(all))), DeepEquals, []string{"10.0.0.4", "10.0.1.1", "10.0.2.1"})
+
+	z.config.WeightByCapacity = true
+	local := 0
+	for i := 0; i < 4000; i++ {
+		if instanceZone(z.prefer(all, healthyInstances(all))[0]) == "a" {
+			local++
+		}
+	}
+	c.Assert(local > 800 && local < 1200, Equals, true, Commentf("%d", local))
+
+	all[3].Healthy = false
+	c.Assert(ips(z.prefer(all, healthyInstances(all))), DeepEquals, []string{"10.0.1.1", "10.0.2.1"})
+
+	z.config.Disabled = true
+	all[3].Healthy = true
+	c.Assert(z.prefer(all, healthyInstances(all)), HasLen, 3)
+
+	z = &zoneRouter{config: ZoneConfig{FailoverThreshold: 0.5}}
+	c.Assert(z.prefer(all, healthyInstances(all)), HasLen, 3)
+}